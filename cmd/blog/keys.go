@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+)
+
+// loadSigningKeys reads the configured signing keys from disk, returning nil if none are configured
+func loadSigningKeys(cfg config.AuthConfig) (*httputils.KeySet, error) {
+	if len(cfg.SigningKeys) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]*httputils.SigningKey, 0, len(cfg.SigningKeys))
+	for _, keyCfg := range cfg.SigningKeys {
+		b, err := os.ReadFile(keyCfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key %q: %w", keyCfg.ID, err)
+		}
+		// secrets written with echo end in a newline that is not part of the secret
+		if keyCfg.Algorithm == httputils.AlgHS256 {
+			b = bytes.TrimRight(b, "\r\n")
+		}
+
+		key, err := httputils.ParseSigningKey(keyCfg.ID, keyCfg.Algorithm, b)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	// there is no need to choose when there is only one key
+	active := cfg.ActiveSigningKey
+	if active == "" && len(keys) == 1 {
+		active = keys[0].ID
+	}
+	return httputils.NewKeySet(active, keys...)
+}
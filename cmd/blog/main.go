@@ -1,25 +1,36 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/James-D-Wood/blog-api/internal/api"
 	"github.com/James-D-Wood/blog-api/internal/api/middleware"
 	"github.com/James-D-Wood/blog-api/internal/config"
 	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/mail"
+	"github.com/James-D-Wood/blog-api/internal/model"
+	"github.com/James-D-Wood/blog-api/internal/oidc"
 )
 
 func main() {
-	if err := run(); err != nil {
+	if err := run(os.Args[1:]); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func run() error {
+func run(args []string) error {
 	// load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -31,23 +42,230 @@ func run() error {
 		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.Logger.GetSlogLevel()}),
 	)
 
+	// dispatch subcommands, defaulting to running the server
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			return runMigrate(context.Background(), cfg, args[1:])
+		case "hash-password":
+			return runHashPassword(os.Stdin, os.Stdout)
+		case "serve":
+		default:
+			return fmt.Errorf("unknown command %q - expected serve, migrate or hash-password", args[0])
+		}
+	}
+
+	return serve(cfg, logger)
+}
+
+func serve(cfg *config.Config, logger *slog.Logger) error {
+	// cancelled on SIGINT/SIGTERM to shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Auth.AccessTokenTTL <= 0 || cfg.Auth.RefreshTokenTTL <= 0 {
+		return errors.New("auth.access_token_ttl and auth.refresh_token_ttl must be positive")
+	}
+	httputils.AccessTokens = httputils.TokenSettings{
+		Issuer:   cfg.Auth.Issuer,
+		Audience: cfg.Auth.Audience,
+		TTL:      cfg.Auth.AccessTokenTTL,
+	}
+
+	signingKeys, err := loadSigningKeys(cfg.Auth)
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	if signingKeys != nil {
+		httputils.SigningKeys = signingKeys
+	} else {
+		logger.Warn("no signing keys configured - tokens will not be accepted after a restart or by other instances")
+	}
+
+	var users map[string]*model.User
+	switch {
+	case len(cfg.Users) > 0:
+		users, err = db.NewUserMap(cfg.Users)
+		if err != nil {
+			return fmt.Errorf("failed to load users: %w", err)
+		}
+	case !cfg.DB.Enabled:
+		logger.Warn("no users configured - using the built-in demo users")
+		users = db.DefaultUserMap
+	default:
+		// the demo users have well known passwords, so must never be written to a database that outlives this run
+		logger.Warn("no users configured - only users who sign up can log in, so configure an admin in users to manage them")
+	}
+
 	// set up app
-	var blogSvc db.BlogService
-	if !cfg.DB.Enabled {
+	var (
+		blogSvc db.BlogService
+		userSvc db.UserService = &db.InMemoryUserService{
+			Users: users,
+		}
+		refreshSvc    db.RefreshTokenService    = db.NewInMemoryRefreshTokenService()
+		revocationSvc db.TokenRevocationService = db.NewInMemoryTokenRevocationService()
+		apiTokenSvc   db.APITokenService        = db.NewInMemoryAPITokenService()
+		lockoutSvc    db.LockoutService         = db.NewInMemoryLockoutService()
+		twoFactorSvc  db.TwoFactorService       = db.NewInMemoryTwoFactorService()
+		emailTokenSvc db.EmailTokenService      = db.NewInMemoryEmailTokenService()
+	)
+	if !cfg.DB.Enabled && cfg.DB.SnapshotPath == "" {
 		logger.Info("using in-memory database")
-		blogSvc = db.NewInMemoryBlogService()
+		store := db.NewInMemoryBlogService()
+		store.Logger = logger
+		blogSvc = store
+	} else if !cfg.DB.Enabled {
+		if cfg.DB.SnapshotInterval <= 0 {
+			return errors.New("db.snapshot_interval must be positive when db.snapshot_path is set")
+		}
+		store, err := db.LoadInMemoryBlogService(cfg.DB.SnapshotPath)
+		if err != nil {
+			return fmt.Errorf("failed to load snapshot: %w", err)
+		}
+		store.Logger = logger
+		logger.Info("using in-memory database with snapshots", "path", cfg.DB.SnapshotPath, "interval", cfg.DB.SnapshotInterval.String())
+
+		snapshotsDone := make(chan struct{})
+		go func() {
+			store.RunSnapshots(ctx, cfg.DB.SnapshotPath, cfg.DB.SnapshotInterval, logger)
+			close(snapshotsDone)
+		}()
+		// make sure the final snapshot is written before exiting
+		defer func() {
+			stop()
+			<-snapshotsDone
+		}()
+
+		blogSvc = store
 	} else {
 		// set up DB connection
-		logger.Error("database not implemented yet")
-		return fmt.Errorf("database not implemented")
+		conn, err := db.Open(ctx, cfg.DB)
+		if err != nil {
+			return fmt.Errorf("failed to connect to database: %w", err)
+		}
+		defer conn.Close()
+
+		if cfg.DB.AutoMigrate {
+			if err := migrateUp(ctx, conn, logger); err != nil {
+				return err
+			}
+		}
+
+		switch cfg.DB.Driver {
+		case db.DriverPostgres:
+			logger.Info("using postgres database")
+			blogSvc = db.NewPostgresBlogService(conn)
+
+			postgresUsers := db.NewPostgresUserService(conn)
+			if err := postgresUsers.SeedUsers(ctx, users); err != nil {
+				return fmt.Errorf("failed to seed users: %w", err)
+			}
+			userSvc = postgresUsers
+			refreshSvc = db.NewPostgresRefreshTokenService(conn)
+			revocationSvc = db.NewPostgresTokenRevocationService(conn)
+			apiTokenSvc = db.NewPostgresAPITokenService(conn)
+			lockoutSvc = db.NewPostgresLockoutService(conn)
+			twoFactorSvc = db.NewPostgresTwoFactorService(conn)
+			emailTokenSvc = db.NewPostgresEmailTokenService(conn)
+		case db.DriverSQLite:
+			logger.Info("using sqlite database", "dsn", cfg.DB.DSN)
+			blogSvc = db.NewSQLiteBlogService(conn)
+
+			sqliteUsers := db.NewSQLiteUserService(conn)
+			if err := sqliteUsers.SeedUsers(ctx, users); err != nil {
+				return fmt.Errorf("failed to seed users: %w", err)
+			}
+			userSvc = sqliteUsers
+			refreshSvc = db.NewSQLiteRefreshTokenService(conn)
+			revocationSvc = db.NewSQLiteTokenRevocationService(conn)
+			apiTokenSvc = db.NewSQLiteAPITokenService(conn)
+			lockoutSvc = db.NewSQLiteLockoutService(conn)
+			twoFactorSvc = db.NewSQLiteTwoFactorService(conn)
+			emailTokenSvc = db.NewSQLiteEmailTokenService(conn)
+		}
+	}
+
+	if cfg.Trash.Retention > 0 {
+		if cfg.Trash.PurgeInterval <= 0 {
+			return errors.New("trash.purge_interval must be positive when trash.retention is set")
+		}
+		logger.Info("purging deleted posts", "retention", cfg.Trash.Retention.String(), "interval", cfg.Trash.PurgeInterval.String())
+		go db.RunTrashPurge(ctx, blogSvc, cfg.Trash.Retention, cfg.Trash.PurgeInterval, logger)
+	}
+
+	if cfg.Auth.Lockout.Enabled {
+		lockout := cfg.Auth.Lockout
+		if lockout.UsernameThreshold <= 0 || lockout.IPThreshold <= 0 || lockout.BaseDelay <= 0 || lockout.MaxDelay < lockout.BaseDelay || lockout.ResetAfter <= 0 {
+			return errors.New("auth.lockout thresholds, delays and reset_after must be positive, and max_delay at least base_delay")
+		}
+	} else {
+		logger.Warn("login lockouts disabled - passwords can be guessed without limit")
+		lockoutSvc = nil
+	}
+
+	var mailer mail.Mailer
+	if cfg.Mail.Enabled {
+		if cfg.Auth.PasswordResetTTL <= 0 || cfg.Auth.EmailVerificationTTL <= 0 {
+			return errors.New("auth.password_reset_ttl and auth.email_verification_ttl must be positive")
+		}
+		mailer, err = mail.New(cfg.Mail)
+		if err != nil {
+			return fmt.Errorf("failed to set up mail: %w", err)
+		}
+		if cfg.Mail.Driver == mail.DriverOutbox {
+			logger.Warn("mail is written to the outbox rather than delivered", "dir", cfg.Mail.OutboxDir)
+		}
+	} else {
+		logger.Info("mail disabled - users cannot reset their passwords")
+	}
+
+	var oidcProvider *oidc.Provider
+	if cfg.Auth.OIDC.Enabled {
+		oidcProvider, err = oidc.NewProvider(ctx, cfg.Auth.OIDC)
+		if err != nil {
+			return fmt.Errorf("failed to set up OIDC login: %w", err)
+		}
+		logger.Info("OIDC login enabled", "issuer", cfg.Auth.OIDC.IssuerURL)
+	}
+
+	cookies, err := sessionCookies(cfg.Auth.Sessions)
+	if err != nil {
+		return err
+	}
+	if cookies != nil {
+		logger.Info("cookie sessions enabled", "same_site", cfg.Auth.Sessions.CookieSameSite)
+		if !cookies.Secure {
+			logger.Warn("session cookies are sent over plain HTTP")
+		}
+		if cookies.CSRFKey == nil {
+			cookies.CSRFKey = make([]byte, 32)
+			if _, err := rand.Read(cookies.CSRFKey); err != nil {
+				return fmt.Errorf("failed to generate CSRF key: %w", err)
+			}
+			logger.Warn("no CSRF key configured - CSRF tokens will not be accepted after a restart or by other instances")
+		}
 	}
 
 	app := api.App{
-		BlogService: blogSvc,
-		UserService: &db.InMemoryUserService{
-			Users: db.DefaultUserMap,
-		},
-		Logger: logger,
+		BlogService:            blogSvc,
+		UserService:            userSvc,
+		RefreshTokenService:    refreshSvc,
+		TokenRevocationService: revocationSvc,
+		APITokenService:        apiTokenSvc,
+		LockoutService:         lockoutSvc,
+		UsernameLockouts:       lockoutPolicy(cfg.Auth.Lockout, cfg.Auth.Lockout.UsernameThreshold),
+		IPLockouts:             lockoutPolicy(cfg.Auth.Lockout, cfg.Auth.Lockout.IPThreshold),
+		TwoFactorService:       twoFactorSvc,
+		Mailer:                 mailer,
+		EmailTokenService:      emailTokenSvc,
+		PasswordResetTTL:       cfg.Auth.PasswordResetTTL,
+		EmailVerificationTTL:   cfg.Auth.EmailVerificationTTL,
+		OIDCProvider:           oidcProvider,
+		Logger:                 logger,
+		RefreshTokenTTL:        cfg.Auth.RefreshTokenTTL,
+		RequireIfMatch:         cfg.Server.RequireIfMatch,
+		SessionCookies:         cookies,
 	}
 
 	// set up routing
@@ -62,6 +280,15 @@ func run() error {
 		Handler: m,
 	}
 
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
 	logger.Info(fmt.Sprintf("listening on %s", server.Addr))
 	err = server.ListenAndServe()
 
@@ -70,7 +297,45 @@ func run() error {
 			return fmt.Errorf("server error: %w", err)
 		}
 		logger.Info("shutting down server...")
+		// emails still being sent are finished off once no more requests can start them
+		<-shutdownDone
+		app.Wait()
 	}
 
 	return nil
 }
+
+// lockoutPolicy returns the policy for locking out usernames or IP addresses after threshold failed logins
+func lockoutPolicy(cfg config.LockoutConfig, threshold int) db.LockoutPolicy {
+	return db.LockoutPolicy{
+		Threshold:  threshold,
+		BaseDelay:  cfg.BaseDelay,
+		MaxDelay:   cfg.MaxDelay,
+		ResetAfter: cfg.ResetAfter,
+	}
+}
+
+// sessionCookies returns the cookies browsers are logged in with, or nil when clients are handed bearer tokens
+func sessionCookies(cfg config.SessionConfig) (*api.SessionCookies, error) {
+	switch cfg.Mode {
+	case api.SessionModeBearer:
+		return nil, nil
+	case api.SessionModeCookie:
+	default:
+		return nil, fmt.Errorf("unknown auth.sessions.mode %q - use %q or %q", cfg.Mode, api.SessionModeBearer, api.SessionModeCookie)
+	}
+
+	cookies := &api.SessionCookies{Secure: cfg.CookieSecure, Domain: cfg.CookieDomain}
+	if cfg.CSRFKey != "" {
+		cookies.CSRFKey = []byte(cfg.CSRFKey)
+	}
+	switch strings.ToLower(cfg.CookieSameSite) {
+	case "strict":
+		cookies.SameSite = http.SameSiteStrictMode
+	case "lax":
+		cookies.SameSite = http.SameSiteLaxMode
+	default:
+		return nil, fmt.Errorf("unknown auth.sessions.cookie_same_site %q - use \"strict\" or \"lax\"", cfg.CookieSameSite)
+	}
+	return cookies, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+	"github.com/James-D-Wood/blog-api/internal/db"
+)
+
+const migrateUsage = "usage: blog migrate up|down|status"
+
+// runMigrate implements the `blog migrate` subcommand
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	if !cfg.DB.Enabled {
+		return errors.New("migrations require a database - set db.enabled")
+	}
+
+	conn, err := db.Open(ctx, cfg.DB)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+
+	migrator, err := db.NewMigrator(conn)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	switch args[0] {
+	case "up":
+		ran, err := migrator.Up(ctx)
+		for _, m := range ran {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(ran) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		m, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return tw.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
+
+// migrateUp applies pending migrations on server start up
+func migrateUp(ctx context.Context, conn *sql.DB, logger *slog.Logger) error {
+	migrator, err := db.NewMigrator(conn)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	ran, err := migrator.Up(ctx)
+	for _, m := range ran {
+		logger.Info("applied migration", "version", m.Version, "name", m.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return nil
+}
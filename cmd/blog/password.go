@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+)
+
+// runHashPassword implements the `blog hash-password` subcommand, printing the hash of a password read
+// from stdin so it can be added to the users config without ending up in shell history
+func runHashPassword(stdin io.Reader, stdout io.Writer) error {
+	password, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return errors.New("usage: echo <password> | blog hash-password")
+	}
+
+	hash, err := db.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, hash)
+	return nil
+}
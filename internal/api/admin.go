@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+)
+
+// AdminRevokeUserTokensHandler logs a user out everywhere, ie: when their account has been compromised, by
+// revoking every access and refresh token issued to them so far, and deleting their API tokens
+func (app *App) AdminRevokeUserTokensHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+
+	if _, ok := app.fetchUser(w, r, "AdminRevokeUserTokensHandler", userID); !ok {
+		return
+	}
+
+	if !app.revokeSessions(w, r, "AdminRevokeUserTokensHandler", userID) {
+		return
+	}
+
+	err := app.APITokenService.DeleteUserAPITokens(r.Context(), userID)
+	if err != nil {
+		app.Logger.Error("failed to delete API tokens", "error", err, "location", "AdminRevokeUserTokensHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	app.Logger.Info("revoked all tokens for user", "userID", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeSessions logs userID out everywhere by revoking every access and refresh token issued to them so far,
+// returning false if that failed
+func (app *App) revokeSessions(w http.ResponseWriter, r *http.Request, location, userID string) bool {
+	err := app.TokenRevocationService.RevokeUserTokens(r.Context(), userID, time.Now())
+	if err != nil {
+		app.Logger.Error("failed to revoke access tokens", "error", err, "location", location)
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return false
+	}
+
+	err = app.RefreshTokenService.RevokeUserRefreshTokens(r.Context(), userID)
+	if err != nil {
+		app.Logger.Error("failed to revoke refresh tokens", "error", err, "location", location)
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/James-D-Wood/blog-api/internal/auth"
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// statuses of a post in a BulkPostsResponse
+const (
+	BulkPostUpdated   = "updated"
+	BulkPostUnchanged = "unchanged"
+	BulkPostFailed    = "failed"
+	// BulkPostRolledBack posts could have been updated, but were not because the action failed for another post
+	BulkPostRolledBack = "rolled_back"
+)
+
+type TransferPostsRequest struct {
+	// AuthorID is the user who becomes the author of the posts
+	AuthorID string `json:"author_id"`
+}
+
+type TransferPostsResponse struct {
+	Transferred int `json:"transferred"`
+}
+
+type BulkPostsRequest struct {
+	Action  string   `json:"action"`
+	PostIDs []string `json:"post_ids"`
+	// Tags replace the tags of every post, and are required by the retag action and rejected by the others
+	Tags []string `json:"tags"`
+}
+
+type BulkPostsResponse struct {
+	// Error explains why nothing was applied, and is only set if the action failed for some post
+	Error   string           `json:"error,omitempty"`
+	Results []BulkPostResult `json:"results"`
+}
+
+type BulkPostResult struct {
+	PostID string `json:"post_id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AdminTransferBlogPostHandler makes another user the author of a post, whether it is live or in the trash
+func (app *App) AdminTransferBlogPostHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	postID := r.PathValue("id")
+
+	var req TransferPostsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.Logger.Error("failed to read transfer payload", "error", err, "location", "AdminTransferBlogPostHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+	if !app.checkTransferTarget(w, r, "AdminTransferBlogPostHandler", req.AuthorID) {
+		return
+	}
+
+	post, err := app.BlogService.TransferBlogPost(r.Context(), auth.UserID(r.Context()), postID, req.AuthorID)
+	if err != nil {
+		app.Logger.Error("failed to transfer blog post", "error", err, "location", "AdminTransferBlogPostHandler")
+		switch {
+		case errors.Is(err, db.ErrEntityNotFound):
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: blog post with ID %s does not exist", postID), 404)
+		case errors.Is(err, db.ErrBlogPostAlreadyExists):
+			httputils.RespondWithJsonError(w, "cannot transfer blog post - the new author already has a post with its title", 409)
+		default:
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+		}
+		return
+	}
+
+	type Response struct {
+		Post model.BlogPost `json:"post"`
+	}
+
+	app.Logger.Info("transferred blog post", "postID", postID, "authorID", req.AuthorID)
+	w.Header().Set("ETag", httputils.ETag(post.Version))
+	httputils.RespondWithJson(w, Response{
+		Post: post,
+	}, 200)
+}
+
+// AdminTransferUserBlogPostsHandler makes another user the author of every post of a user, including the ones in
+// the trash, ie: before deleting the user. Either every post is transferred or none are.
+func (app *App) AdminTransferUserBlogPostsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID := r.PathValue("id")
+
+	var req TransferPostsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.Logger.Error("failed to read transfer payload", "error", err, "location", "AdminTransferUserBlogPostsHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+	if req.AuthorID == userID {
+		app.Logger.Error("attempted to transfer posts to their own author", "location", "AdminTransferUserBlogPostsHandler")
+		httputils.RespondWithJsonError(w, "invalid request: posts cannot be transferred to the user they belong to", 400)
+		return
+	}
+	if !app.checkTransferTarget(w, r, "AdminTransferUserBlogPostsHandler", req.AuthorID) {
+		return
+	}
+
+	// the user is not looked up, so that the posts of users that no longer exist can be recovered
+	n, err := app.BlogService.TransferAuthorBlogPosts(r.Context(), auth.UserID(r.Context()), userID, req.AuthorID)
+	if err != nil {
+		app.Logger.Error("failed to transfer blog posts", "error", err, "location", "AdminTransferUserBlogPostsHandler")
+		if errors.Is(err, db.ErrBlogPostAlreadyExists) {
+			httputils.RespondWithJsonError(w, "cannot transfer blog posts - the new author already has a post with the title of one of them", 409)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	app.Logger.Info("transferred blog posts", "fromUserID", userID, "authorID", req.AuthorID, "count", n)
+	httputils.RespondWithJson(w, TransferPostsResponse{Transferred: n}, 200)
+}
+
+// AdminBulkBlogPostsHandler applies an action to many posts at once in a single transaction, reporting what
+// happened to each. If the action fails for any post nothing is applied, and the report says which ones failed.
+func (app *App) AdminBulkBlogPostsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req BulkPostsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.Logger.Error("failed to read bulk action payload", "error", err, "location", "AdminBulkBlogPostsHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+
+	action := db.BulkAction(req.Action)
+	if !slices.Contains(db.BulkActions, action) {
+		app.Logger.Error("invalid bulk action", "action", req.Action, "location", "AdminBulkBlogPostsHandler")
+		httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: unknown action %q - expected one of %v", req.Action, db.BulkActions), 400)
+		return
+	}
+	// an empty list of tags is allowed, as retagging with it clears the tags of every post
+	if (action == db.BulkRetag) != (req.Tags != nil) {
+		app.Logger.Error("tags given with the wrong bulk action", "action", req.Action, "location", "AdminBulkBlogPostsHandler")
+		httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: tags must be given for the %q action and only for it", db.BulkRetag), 400)
+		return
+	}
+	if len(req.PostIDs) == 0 || len(req.PostIDs) > db.MaxBulkActionPosts {
+		app.Logger.Error("invalid number of posts for bulk action", "count", len(req.PostIDs), "location", "AdminBulkBlogPostsHandler")
+		httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: post_ids must list between 1 and %d posts", db.MaxBulkActionPosts), 400)
+		return
+	}
+
+	results, err := app.BlogService.ApplyBulkAction(r.Context(), auth.UserID(r.Context()), action, req.PostIDs, req.Tags)
+	if errors.Is(err, db.ErrInvalidTags) {
+		app.Logger.Error("invalid tags for bulk action", "error", err, "location", "AdminBulkBlogPostsHandler")
+		httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: %v", err), 400)
+		return
+	}
+	if err != nil && !errors.Is(err, db.ErrBulkActionFailed) {
+		app.Logger.Error("failed to apply bulk action", "error", err, "location", "AdminBulkBlogPostsHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	failed := err != nil
+
+	resp := BulkPostsResponse{Results: make([]BulkPostResult, len(results))}
+	for i, result := range results {
+		resp.Results[i] = BulkPostResult{PostID: result.PostID}
+		switch {
+		case errors.Is(result.Err, db.ErrEntityNotFound):
+			resp.Results[i].Status = BulkPostFailed
+			resp.Results[i].Error = "blog post does not exist"
+		case result.Err != nil:
+			resp.Results[i].Status = BulkPostFailed
+			resp.Results[i].Error = "internal service error"
+		case failed:
+			resp.Results[i].Status = BulkPostRolledBack
+		case result.Changed:
+			resp.Results[i].Status = BulkPostUpdated
+		default:
+			resp.Results[i].Status = BulkPostUnchanged
+		}
+	}
+
+	if failed {
+		app.Logger.Error("bulk action failed for some posts", "action", action, "location", "AdminBulkBlogPostsHandler")
+		resp.Error = "the action could not be applied to every post, so was applied to none of them"
+		httputils.RespondWithJson(w, resp, 409)
+		return
+	}
+
+	app.Logger.Info("applied bulk action", "action", action, "count", len(results))
+	httputils.RespondWithJson(w, resp, 200)
+}
+
+// checkTransferTarget responds with 400 and returns false unless authorID is a user who can write posts
+func (app *App) checkTransferTarget(w http.ResponseWriter, r *http.Request, location, authorID string) bool {
+	user, err := app.UserService.FetchUserByID(r.Context(), authorID)
+	if err != nil {
+		app.Logger.Error("failed to fetch new author", "error", err, "location", location)
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: user with ID %s does not exist", authorID), 400)
+			return false
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return false
+	}
+
+	if !user.Role.Can(model.PermWritePosts) {
+		app.Logger.Error("new author cannot write posts", "role", user.Role, "location", location)
+		httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: user with ID %s is not allowed to write posts", authorID), 400)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// mustFetchPost fetches a post as the holder of accessToken
+func mustFetchPost(t *testing.T, h http.Handler, accessToken, postID string) model.BlogPost {
+	t.Helper()
+
+	rr := serve(h, "GET", "/api/v1/posts/"+postID, accessToken, "")
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d fetching post %s, want %d", rr.Result().StatusCode, postID, 200)
+	}
+	var resp struct {
+		Post model.BlogPost `json:"post"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Post
+}
+
+func TestAdminTransferBlogPost(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+	author := mustLogIn(t, h, "kishiguro")
+	postID := mustCreatePost(t, h, author.Token, "Never Let Me Go")
+
+	tt := []struct {
+		Name     string
+		PostID   string
+		AuthorID string
+		Code     int
+	}{
+		{Name: "Missing Post", PostID: "0197aaed-4a35-74da-8574-4165524a9999", AuthorID: adminTestUserID, Code: 404},
+		{Name: "Missing Author", PostID: postID, AuthorID: "0197aaed-4a35-74da-8574-4165524a9999", Code: 400},
+		{Name: "Transfer", PostID: postID, AuthorID: adminTestUserID, Code: 200},
+	}
+
+	for _, tt := range tt {
+		t.Run(tt.Name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"author_id": %q}`, tt.AuthorID)
+			rr := serve(h, "PUT", "/api/v1/admin/posts/"+tt.PostID+"/author", admin.Token, body)
+			if rr.Result().StatusCode != tt.Code {
+				t.Errorf("got %d, want %d: %s", rr.Result().StatusCode, tt.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if post := mustFetchPost(t, h, "", postID); post.AuthorID != adminTestUserID {
+		t.Errorf("got author %s, want %s", post.AuthorID, adminTestUserID)
+	}
+
+	// posts cannot be given to users who are not allowed to write them
+	if rr := serve(h, "PUT", "/api/v1/admin/users/"+authorTestUserID+"/role", admin.Token, `{"role": "reader"}`); rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d changing role, want %d", rr.Result().StatusCode, 200)
+	}
+	body := fmt.Sprintf(`{"author_id": %q}`, authorTestUserID)
+	if rr := serve(h, "PUT", "/api/v1/admin/posts/"+postID+"/author", admin.Token, body); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d transferring to a reader, want %d", rr.Result().StatusCode, 400)
+	}
+}
+
+func TestAdminTransferUserBlogPosts(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+	author := mustLogIn(t, h, "kishiguro")
+	for _, title := range []string{"Never Let Me Go", "Klara and the Sun"} {
+		mustCreatePost(t, h, author.Token, title)
+	}
+
+	path := "/api/v1/admin/users/" + authorTestUserID + "/posts/transfer"
+	if rr := serve(h, "POST", path, admin.Token, fmt.Sprintf(`{"author_id": %q}`, authorTestUserID)); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d transferring to the same user, want %d", rr.Result().StatusCode, 400)
+	}
+
+	rr := serve(h, "POST", path, admin.Token, fmt.Sprintf(`{"author_id": %q}`, adminTestUserID))
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d transferring, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+	var resp TransferPostsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Transferred != 2 {
+		t.Errorf("got %d transferred, want %d", resp.Transferred, 2)
+	}
+	if got := countPosts(t, h, "/api/v1/authors/"+adminTestUserID+"/posts", ""); got != 2 {
+		t.Errorf("got %d posts by the new author, want %d", got, 2)
+	}
+
+	// once their posts have a new author the user can be deleted
+	if rr := serve(h, "DELETE", "/api/v1/admin/users/"+authorTestUserID, admin.Token, ""); rr.Result().StatusCode != 204 {
+		t.Errorf("got %d deleting the user, want %d: %s", rr.Result().StatusCode, 204, rr.Body.String())
+	}
+}
+
+func TestAdminTransferUserBlogPostsConflict(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+	author := mustLogIn(t, h, "kishiguro")
+	mustCreatePost(t, h, admin.Token, "Klara and the Sun")
+	for _, title := range []string{"Never Let Me Go", "Klara and the Sun"} {
+		mustCreatePost(t, h, author.Token, title)
+	}
+
+	body := fmt.Sprintf(`{"author_id": %q}`, adminTestUserID)
+	if rr := serve(h, "POST", "/api/v1/admin/users/"+authorTestUserID+"/posts/transfer", admin.Token, body); rr.Result().StatusCode != 409 {
+		t.Errorf("got %d transferring onto a title in use, want %d", rr.Result().StatusCode, 409)
+	}
+	if got := countPosts(t, h, "/api/v1/authors/"+authorTestUserID+"/posts", ""); got != 2 {
+		t.Errorf("got %d posts left with the author, want %d", got, 2)
+	}
+}
+
+func TestAdminBulkBlogPosts(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+	author := mustLogIn(t, h, "kishiguro")
+	first := mustCreatePost(t, h, author.Token, "Never Let Me Go")
+	second := mustCreatePost(t, h, author.Token, "Klara and the Sun")
+	missing := "0197aaed-4a35-74da-8574-4165524a9999"
+
+	tt := []struct {
+		Name     string
+		Action   string
+		PostIDs  []string
+		Tags     []string
+		Code     int
+		Statuses []string
+	}{
+		{Name: "Unknown Action", Action: "archive", PostIDs: []string{first}, Code: 400},
+		{Name: "No Posts", Action: "unpublish", PostIDs: []string{}, Code: 400},
+		{Name: "Unpublish", Action: "unpublish", PostIDs: []string{first, second}, Code: 200, Statuses: []string{BulkPostUpdated, BulkPostUpdated}},
+		{Name: "Missing Post", Action: "delete", PostIDs: []string{first, missing}, Code: 409, Statuses: []string{BulkPostRolledBack, BulkPostFailed}},
+		{Name: "Restore Live Post", Action: "restore", PostIDs: []string{first}, Code: 200, Statuses: []string{BulkPostUnchanged}},
+		{Name: "Retag Without Tags", Action: "retag", PostIDs: []string{first}, Code: 400},
+		{Name: "Tags Without Retag", Action: "unpublish", PostIDs: []string{first}, Tags: []string{"fiction"}, Code: 400},
+		{Name: "Invalid Tags", Action: "retag", PostIDs: []string{first}, Tags: []string{"literary fiction"}, Code: 400},
+		{Name: "Retag", Action: "retag", PostIDs: []string{first, second}, Tags: []string{"Fiction"}, Code: 200, Statuses: []string{BulkPostUpdated, BulkPostUpdated}},
+		{Name: "Retag Missing Post", Action: "retag", PostIDs: []string{second, missing}, Tags: []string{"novels"}, Code: 409, Statuses: []string{BulkPostRolledBack, BulkPostFailed}},
+		{Name: "Delete", Action: "delete", PostIDs: []string{first}, Code: 200, Statuses: []string{BulkPostUpdated}},
+	}
+
+	for _, tt := range tt {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, _ := json.Marshal(BulkPostsRequest{Action: tt.Action, PostIDs: tt.PostIDs, Tags: tt.Tags})
+			rr := serve(h, "POST", "/api/v1/admin/posts/bulk", admin.Token, string(b))
+			if rr.Result().StatusCode != tt.Code {
+				t.Fatalf("got %d, want %d: %s", rr.Result().StatusCode, tt.Code, rr.Body.String())
+			}
+			if tt.Statuses == nil {
+				return
+			}
+
+			var resp BulkPostsResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			statuses := []string{}
+			for i, result := range resp.Results {
+				if result.PostID != tt.PostIDs[i] {
+					t.Errorf("got result for %s at %d, want %s", result.PostID, i, tt.PostIDs[i])
+				}
+				statuses = append(statuses, result.Status)
+			}
+			if !slices.Equal(statuses, tt.Statuses) {
+				t.Errorf("got statuses %v, want %v", statuses, tt.Statuses)
+			}
+			if (resp.Error != "") != (tt.Code != 200) {
+				t.Errorf("got error %q, want one only if nothing was applied", resp.Error)
+			}
+		})
+	}
+
+	if got := countPosts(t, h, "/api/v1/posts", ""); got != 0 {
+		t.Errorf("got %d published posts, want %d", got, 0)
+	}
+	post := mustFetchPost(t, h, author.Token, second)
+	if post.Status != model.DRAFT {
+		t.Errorf("got status %s, want the failed delete rolled back", post.Status)
+	}
+	if !slices.Equal(post.Tags, []string{"fiction"}) {
+		t.Errorf("got tags %v, want the failed retag rolled back", post.Tags)
+	}
+	if rr := serve(h, "GET", "/api/v1/posts/"+first, author.Token, ""); rr.Result().StatusCode != 404 {
+		t.Errorf("got %d fetching a deleted post, want %d", rr.Result().StatusCode, 404)
+	}
+}
+
+func TestAdminBulkBlogPostsRevisions(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+	author := mustLogIn(t, h, "kishiguro")
+	postID := mustCreatePost(t, h, author.Token, "Never Let Me Go")
+
+	b, _ := json.Marshal(BulkPostsRequest{Action: "unpublish", PostIDs: []string{postID}})
+	if rr := serve(h, "POST", "/api/v1/admin/posts/bulk", admin.Token, string(b)); rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+
+	// the author can see that a moderator made the change rather than them
+	rr := serve(h, "GET", "/api/v1/posts/"+postID+"/revisions", author.Token, "")
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d listing revisions, want %d", rr.Result().StatusCode, 200)
+	}
+	var resp struct {
+		Revisions []model.BlogPostRevision `json:"revisions"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Revisions) != 2 || resp.Revisions[0].AuthorID != authorTestUserID || resp.Revisions[1].AuthorID != adminTestUserID {
+		t.Errorf("got revisions %+v, want the unpublish attributed to %s", resp.Revisions, adminTestUserID)
+	}
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/James-D-Wood/blog-api/internal/auth"
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+type FetchUsersResponse struct {
+	Users []model.User `json:"users"`
+}
+
+type FetchUserResponse struct {
+	User model.User `json:"user"`
+}
+
+type SuspendUserRequest struct {
+	// HidePosts hides the user's posts from everyone but moderators until they are reactivated
+	HidePosts bool `json:"hide_posts"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// AdminFetchUsersHandler lists every user ordered by username, optionally only those with a given role or
+// suspension status
+func (app *App) AdminFetchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	var role model.Role
+	if param := params.Get("role"); param != "" {
+		var err error
+		if role, err = model.ParseRole(param); err != nil {
+			app.Logger.Error("invalid role", "error", err, "location", "AdminFetchUsersHandler")
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: %s", err), 400)
+			return
+		}
+	}
+	var suspended *bool
+	if param := params.Get("suspended"); param != "" {
+		b, err := strconv.ParseBool(param)
+		if err != nil {
+			app.Logger.Error("invalid suspended filter", "error", err, "location", "AdminFetchUsersHandler")
+			httputils.RespondWithJsonError(w, "invalid request: suspended must be true or false", 400)
+			return
+		}
+		suspended = &b
+	}
+
+	users, err := app.UserService.ListUsers(r.Context())
+	if err != nil {
+		app.Logger.Error("failed to list users", "error", err, "location", "AdminFetchUsersHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	matching := make([]model.User, 0, len(users))
+	for _, user := range users {
+		if role != "" && user.Role != role {
+			continue
+		}
+		if suspended != nil && user.Suspended != *suspended {
+			continue
+		}
+		matching = append(matching, user)
+	}
+
+	httputils.RespondWithJson(w, FetchUsersResponse{Users: matching}, 200)
+}
+
+func (app *App) AdminFetchUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUser(w, r, "AdminFetchUserHandler", r.PathValue("id"))
+	if !ok {
+		return
+	}
+	httputils.RespondWithJson(w, FetchUserResponse{User: *user}, 200)
+}
+
+// AdminSuspendUserHandler stops a user from logging in and logs them out everywhere. Their API tokens are
+// rejected while they are suspended, but kept so that they work again once the user is reactivated.
+func (app *App) AdminSuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID := r.PathValue("id")
+	if !app.checkNotSelf(w, r, "AdminSuspendUserHandler", userID, "suspend") {
+		return
+	}
+
+	// the body is optional, so posts stay visible unless asked otherwise
+	var req SuspendUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		app.Logger.Error("failed to read suspend user payload", "error", err, "location", "AdminSuspendUserHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+
+	if _, ok := app.fetchUser(w, r, "AdminSuspendUserHandler", userID); !ok {
+		return
+	}
+	if err := app.UserService.SuspendUser(r.Context(), userID, req.HidePosts); err != nil {
+		app.Logger.Error("failed to suspend user", "error", err, "location", "AdminSuspendUserHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	if !app.revokeSessions(w, r, "AdminSuspendUserHandler", userID) {
+		return
+	}
+
+	app.Logger.Info("suspended user", "userID", userID, "hidePosts", req.HidePosts)
+	app.respondWithUser(w, r, "AdminSuspendUserHandler", userID)
+}
+
+// AdminReactivateUserHandler lifts a user's suspension, letting them log in again and showing their posts
+func (app *App) AdminReactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+
+	user, ok := app.fetchUser(w, r, "AdminReactivateUserHandler", userID)
+	if !ok {
+		return
+	}
+	if !user.Suspended {
+		app.Logger.Error("user is not suspended", "location", "AdminReactivateUserHandler")
+		httputils.RespondWithJsonError(w, "user is not suspended", 409)
+		return
+	}
+
+	if err := app.UserService.ReactivateUser(r.Context(), userID); err != nil {
+		app.Logger.Error("failed to reactivate user", "error", err, "location", "AdminReactivateUserHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	app.Logger.Info("reactivated user", "userID", userID)
+	app.respondWithUser(w, r, "AdminReactivateUserHandler", userID)
+}
+
+// AdminUpdateUserRoleHandler changes a user's role, which applies to their next request
+func (app *App) AdminUpdateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID := r.PathValue("id")
+	if !app.checkNotSelf(w, r, "AdminUpdateUserRoleHandler", userID, "change the role of") {
+		return
+	}
+
+	var req UpdateUserRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.Logger.Error("failed to read update role payload", "error", err, "location", "AdminUpdateUserRoleHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+	role, err := model.ParseRole(req.Role)
+	if err != nil {
+		app.Logger.Error("invalid role", "error", err, "location", "AdminUpdateUserRoleHandler")
+		httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: %s", err), 400)
+		return
+	}
+
+	user, ok := app.fetchUser(w, r, "AdminUpdateUserRoleHandler", userID)
+	if !ok {
+		return
+	}
+	user.Role = role
+	if err := app.UserService.UpdateUser(r.Context(), user); err != nil {
+		app.Logger.Error("failed to update user", "error", err, "location", "AdminUpdateUserRoleHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	app.Logger.Info("changed user's role", "userID", userID, "role", role)
+	httputils.RespondWithJson(w, FetchUserResponse{User: *user}, 200)
+}
+
+// AdminDeleteUserHandler permanently deletes a user along with their credentials. Users who still have posts,
+// deleted or not, cannot be deleted, so that no post is left without an author.
+func (app *App) AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	if !app.checkNotSelf(w, r, "AdminDeleteUserHandler", userID, "delete") {
+		return
+	}
+
+	if _, ok := app.fetchUser(w, r, "AdminDeleteUserHandler", userID); !ok {
+		return
+	}
+
+	page, err := app.BlogService.FetchAuthorBlogPosts(r.Context(), userID, true, db.BlogPostQuery{Limit: 1})
+	if err != nil {
+		app.Logger.Error("failed to fetch user's posts", "error", err, "location", "AdminDeleteUserHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	// deleted posts count too, as they can be restored until they are purged
+	deleted, err := app.BlogService.FetchDeletedBlogPosts(r.Context(), userID)
+	if err != nil {
+		app.Logger.Error("failed to fetch user's deleted posts", "error", err, "location", "AdminDeleteUserHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	if len(page.Posts) > 0 || len(deleted) > 0 {
+		app.Logger.Error("attempted to delete a user with posts", "location", "AdminDeleteUserHandler")
+		httputils.RespondWithJsonError(w, "user still has posts, including any awaiting purge from the trash - transfer them to another user first", 409)
+		return
+	}
+
+	// the stores of tokens are not necessarily the same database as the users
+	if !app.revokeSessions(w, r, "AdminDeleteUserHandler", userID) {
+		return
+	}
+	if err := app.APITokenService.DeleteUserAPITokens(r.Context(), userID); err != nil {
+		app.Logger.Error("failed to delete API tokens", "error", err, "location", "AdminDeleteUserHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	if err := app.UserService.DeleteUser(r.Context(), userID); err != nil {
+		app.Logger.Error("failed to delete user", "error", err, "location", "AdminDeleteUserHandler")
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: user with ID %s does not exist", userID), 404)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	app.Logger.Info("deleted user", "userID", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fetchUser returns the user with the given ID, or responds with 404 and returns false if there is none
+func (app *App) fetchUser(w http.ResponseWriter, r *http.Request, location, userID string) (*model.User, bool) {
+	user, err := app.UserService.FetchUserByID(r.Context(), userID)
+	if err != nil {
+		app.Logger.Error("failed to fetch user", "error", err, "location", location)
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: user with ID %s does not exist", userID), 404)
+			return nil, false
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return nil, false
+	}
+	return user, true
+}
+
+// respondWithUser responds with the user with the given ID as it is stored
+func (app *App) respondWithUser(w http.ResponseWriter, r *http.Request, location, userID string) {
+	user, ok := app.fetchUser(w, r, location, userID)
+	if !ok {
+		return
+	}
+	httputils.RespondWithJson(w, FetchUserResponse{User: *user}, 200)
+}
+
+// checkNotSelf responds with 400 and returns false if userID is the admin making the request, so that admins
+// cannot lock themselves out
+func (app *App) checkNotSelf(w http.ResponseWriter, r *http.Request, location, userID, action string) bool {
+	if userID == auth.UserID(r.Context()) {
+		app.Logger.Error("admin attempted to "+action+" their own account", "location", location)
+		httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: you cannot %s your own account", action), 400)
+		return false
+	}
+	return true
+}
+
+// hiddenAuthorIDs returns the authors whose posts are hidden from the user making the request. Moderators see
+// every post.
+func (app *App) hiddenAuthorIDs(ctx context.Context) ([]string, error) {
+	if principal, ok := auth.FromContext(ctx); ok && principal.Can(model.PermModeratePosts) {
+		return nil, nil
+	}
+	return app.UserService.FetchHiddenAuthorIDs(ctx)
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+const (
+	adminTestUserID  = "0197aaed-4a35-74da-8574-4165524a3333"
+	authorTestUserID = "0197aaed-4a35-74da-8574-4165524a1111"
+)
+
+// mustCreatePost creates a published post as the user logged in with accessToken, returning its ID
+func mustCreatePost(t *testing.T, h http.Handler, accessToken, title string) string {
+	t.Helper()
+
+	rr := serve(h, "POST", "/api/v1/posts", accessToken, `{"title": "`+title+`", "status": "PUBLISHED"}`)
+	if rr.Result().StatusCode != 201 {
+		t.Fatalf("got %d creating a post, want %d: %s", rr.Result().StatusCode, 201, rr.Body.String())
+	}
+	var resp struct {
+		Post model.BlogPost `json:"post"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Post.ID
+}
+
+// countPosts returns how many posts a listing shows to the holder of accessToken
+func countPosts(t *testing.T, h http.Handler, path, accessToken string) int {
+	t.Helper()
+
+	rr := serve(h, "GET", path, accessToken, "")
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d listing posts, want %d", rr.Result().StatusCode, 200)
+	}
+	var resp struct {
+		Posts []json.RawMessage `json:"posts"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return len(resp.Posts)
+}
+
+func TestAdminFetchUsers(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+
+	tt := []struct {
+		Name      string
+		Query     string
+		Code      int
+		Usernames []string
+	}{
+		{Name: "All Users", Query: "", Code: 200, Usernames: []string{"admin", "dsedaris", "kishiguro"}},
+		{Name: "By Role", Query: "?role=author", Code: 200, Usernames: []string{"dsedaris", "kishiguro"}},
+		{Name: "Suspended", Query: "?suspended=true", Code: 200, Usernames: []string{}},
+		{Name: "Unknown Role", Query: "?role=owner", Code: 400},
+		{Name: "Invalid Suspended", Query: "?suspended=maybe", Code: 400},
+	}
+
+	for _, tt := range tt {
+		t.Run(tt.Name, func(t *testing.T) {
+			rr := serve(h, "GET", "/api/v1/admin/users"+tt.Query, admin.Token, "")
+			if rr.Result().StatusCode != tt.Code {
+				t.Fatalf("got %d, want %d: %s", rr.Result().StatusCode, tt.Code, rr.Body.String())
+			}
+			if tt.Code != 200 {
+				return
+			}
+
+			var resp FetchUsersResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			usernames := []string{}
+			for _, user := range resp.Users {
+				if user.PasswordHash != "" {
+					t.Errorf("got password hash for %s in the response", user.Username)
+				}
+				usernames = append(usernames, user.Username)
+			}
+			if !slices.Equal(usernames, tt.Usernames) {
+				t.Errorf("got users %v, want %v", usernames, tt.Usernames)
+			}
+		})
+	}
+
+	if rr := serve(h, "GET", "/api/v1/admin/users/"+authorTestUserID, admin.Token, ""); rr.Result().StatusCode != 200 {
+		t.Errorf("got %d fetching a user, want %d", rr.Result().StatusCode, 200)
+	}
+	if rr := serve(h, "GET", "/api/v1/admin/users/0197aaed-4a35-74da-8574-4165524a9999", admin.Token, ""); rr.Result().StatusCode != 404 {
+		t.Errorf("got %d fetching a missing user, want %d", rr.Result().StatusCode, 404)
+	}
+}
+
+func TestAdminSuspendUser(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+	author := mustLogIn(t, h, "kishiguro")
+	apiToken := mustCreateAPIToken(t, h, author.Token, "posts:read")
+	postID := mustCreatePost(t, h, author.Token, "Never Let Me Go")
+
+	rr := serve(h, "POST", "/api/v1/admin/users/"+authorTestUserID+"/suspend", admin.Token, `{"hide_posts": true}`)
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d suspending, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+	var resp FetchUserResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.User.Suspended || !resp.User.PostsHidden {
+		t.Errorf("got user %+v, want them suspended with their posts hidden", resp.User)
+	}
+
+	// the user is logged out everywhere and cannot log back in
+	assertSession(t, h, author, false)
+	if rr := serve(h, "GET", "/api/v1/me/posts", apiToken.Token, ""); rr.Result().StatusCode != 403 {
+		t.Errorf("got %d using an API token while suspended, want %d", rr.Result().StatusCode, 403)
+	}
+	req := httptest.NewRequest("POST", "/api/v1/login", nil)
+	req.SetBasicAuth("kishiguro", "a long password")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Result().StatusCode != 403 {
+		t.Errorf("got %d logging in while suspended, want %d", rr.Result().StatusCode, 403)
+	}
+
+	// their posts are hidden from everyone but moderators
+	if got := countPosts(t, h, "/api/v1/posts", ""); got != 0 {
+		t.Errorf("got %d posts listed anonymously, want %d", got, 0)
+	}
+	if rr := serve(h, "GET", "/api/v1/posts/"+postID, "", ""); rr.Result().StatusCode != 404 {
+		t.Errorf("got %d fetching a hidden post, want %d", rr.Result().StatusCode, 404)
+	}
+	if got := countPosts(t, h, "/api/v1/authors/"+authorTestUserID+"/posts", ""); got != 0 {
+		t.Errorf("got %d posts listed by author, want %d", got, 0)
+	}
+	if got := countPosts(t, h, "/api/v1/posts", admin.Token); got != 1 {
+		t.Errorf("got %d posts listed for a moderator, want %d", got, 1)
+	}
+	if rr := serve(h, "GET", "/api/v1/posts/"+postID, admin.Token, ""); rr.Result().StatusCode != 200 {
+		t.Errorf("got %d fetching a hidden post as a moderator, want %d", rr.Result().StatusCode, 200)
+	}
+
+	// reactivating restores everything but the sessions
+	if rr := serve(h, "POST", "/api/v1/admin/users/"+authorTestUserID+"/reactivate", admin.Token, ""); rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d reactivating, want %d", rr.Result().StatusCode, 200)
+	}
+	if rr := serve(h, "POST", "/api/v1/admin/users/"+authorTestUserID+"/reactivate", admin.Token, ""); rr.Result().StatusCode != 409 {
+		t.Errorf("got %d reactivating again, want %d", rr.Result().StatusCode, 409)
+	}
+	if got := countPosts(t, h, "/api/v1/posts", ""); got != 1 {
+		t.Errorf("got %d posts listed after reactivating, want %d", got, 1)
+	}
+	if rr := serve(h, "GET", "/api/v1/me/posts", apiToken.Token, ""); rr.Result().StatusCode != 200 {
+		t.Errorf("got %d using an API token after reactivating, want %d", rr.Result().StatusCode, 200)
+	}
+	mustLogIn(t, h, "kishiguro")
+}
+
+func TestAdminSuspendUserKeepsPostsVisibleByDefault(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+	author := mustLogIn(t, h, "kishiguro")
+	mustCreatePost(t, h, author.Token, "Never Let Me Go")
+
+	if rr := serve(h, "POST", "/api/v1/admin/users/"+authorTestUserID+"/suspend", admin.Token, ""); rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d suspending, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+	if got := countPosts(t, h, "/api/v1/posts", ""); got != 1 {
+		t.Errorf("got %d posts listed, want %d", got, 1)
+	}
+}
+
+func TestAdminUpdateUserRole(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+	author := mustLogIn(t, h, "kishiguro")
+
+	path := "/api/v1/admin/users/" + authorTestUserID + "/role"
+	if rr := serve(h, "PUT", path, admin.Token, `{"role": "owner"}`); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d for an unknown role, want %d", rr.Result().StatusCode, 400)
+	}
+	if rr := serve(h, "PUT", path, admin.Token, `{"role": "reader"}`); rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d changing role, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+
+	// the new role applies to tokens issued before the change
+	if rr := serve(h, "POST", "/api/v1/posts", author.Token, `{"title": "Klara and the Sun"}`); rr.Result().StatusCode != 403 {
+		t.Errorf("got %d writing as a reader, want %d", rr.Result().StatusCode, 403)
+	}
+}
+
+func TestAdminCannotManageThemselves(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+
+	tt := []struct {
+		Name   string
+		Method string
+		Path   string
+		Body   string
+	}{
+		{Name: "Suspend", Method: "POST", Path: "/suspend"},
+		{Name: "Change Role", Method: "PUT", Path: "/role", Body: `{"role": "reader"}`},
+		{Name: "Delete", Method: "DELETE"},
+	}
+
+	for _, tt := range tt {
+		t.Run(tt.Name, func(t *testing.T) {
+			rr := serve(h, tt.Method, "/api/v1/admin/users/"+adminTestUserID+tt.Path, admin.Token, tt.Body)
+			if rr.Result().StatusCode != 400 {
+				t.Errorf("got %d, want %d", rr.Result().StatusCode, 400)
+			}
+		})
+	}
+	assertSession(t, h, admin, true)
+}
+
+func TestAdminDeleteUser(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+	author := mustLogIn(t, h, "kishiguro")
+	postID := mustCreatePost(t, h, author.Token, "Never Let Me Go")
+
+	path := "/api/v1/admin/users/" + authorTestUserID
+	if rr := serve(h, "DELETE", path, admin.Token, ""); rr.Result().StatusCode != 409 {
+		t.Errorf("got %d deleting a user with posts, want %d", rr.Result().StatusCode, 409)
+	}
+	assertSession(t, h, author, true)
+
+	// deleted posts still count, as they can be restored
+	if rr := serve(h, "DELETE", "/api/v1/admin/posts/"+postID, admin.Token, ""); rr.Result().StatusCode != 204 {
+		t.Fatalf("got %d deleting the post, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+	if rr := serve(h, "DELETE", path, admin.Token, ""); rr.Result().StatusCode != 409 {
+		t.Errorf("got %d deleting a user with deleted posts, want %d", rr.Result().StatusCode, 409)
+	}
+}
+
+func TestAdminDeleteUserWithoutPosts(t *testing.T) {
+	h := newTestServer(t, nil)
+	admin := mustLogIn(t, h, "admin")
+	author := mustLogIn(t, h, "kishiguro")
+	apiToken := mustCreateAPIToken(t, h, author.Token, "posts:read")
+
+	path := "/api/v1/admin/users/" + authorTestUserID
+	if rr := serve(h, "DELETE", path, admin.Token, ""); rr.Result().StatusCode != 204 {
+		t.Fatalf("got %d deleting, want %d: %s", rr.Result().StatusCode, 204, rr.Body.String())
+	}
+	if rr := serve(h, "DELETE", path, admin.Token, ""); rr.Result().StatusCode != 404 {
+		t.Errorf("got %d deleting again, want %d", rr.Result().StatusCode, 404)
+	}
+
+	// every credential of the user stops working
+	assertSession(t, h, author, false)
+	if rr := serve(h, "GET", "/api/v1/me/posts", apiToken.Token, ""); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d using an API token of a deleted user, want %d", rr.Result().StatusCode, 401)
+	}
+}
@@ -1,18 +1,74 @@
 package api
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/James-D-Wood/blog-api/internal/api/middleware"
+	"github.com/James-D-Wood/blog-api/internal/auth"
 	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/mail"
+	"github.com/James-D-Wood/blog-api/internal/model"
+	"github.com/James-D-Wood/blog-api/internal/oidc"
 )
 
 // App wraps all global/shared state for an instance of API
 type App struct {
-	UserService db.UserService
-	BlogService db.BlogService
-	Logger      *slog.Logger
+	UserService            db.UserService
+	BlogService            db.BlogService
+	RefreshTokenService    db.RefreshTokenService
+	TokenRevocationService db.TokenRevocationService
+	APITokenService        db.APITokenService
+	// LockoutService locks out usernames and IP addresses with repeated failed logins when set
+	LockoutService db.LockoutService
+	// UsernameLockouts and IPLockouts decide when failed logins lock out a username or an IP address
+	UsernameLockouts db.LockoutPolicy
+	IPLockouts       db.LockoutPolicy
+	// TwoFactorService lets users protect their logins with TOTP codes when set
+	TwoFactorService db.TwoFactorService
+	// Mailer lets users reset their password by email, and makes them verify their email address before
+	// publishing, when set. EmailTokenService stores the tokens it sends.
+	Mailer            mail.Mailer
+	EmailTokenService db.EmailTokenService
+	// PasswordResetTTL and EmailVerificationTTL are how long the tokens emailed to users are valid for
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+	// OIDCProvider enables logging in through an external identity provider when set
+	OIDCProvider *oidc.Provider
+	Logger       *slog.Logger
+	// RefreshTokenTTL is how long the refresh tokens issued on login and refresh are valid for
+	RefreshTokenTTL time.Duration
+	// SessionCookies logs browsers in with cookies instead of returning the tokens, and requires a CSRF token on
+	// state-changing requests authenticated by them, when set
+	SessionCookies *SessionCookies
+	// RequireIfMatch rejects updates and deletes of posts that do not send an If-Match header
+	RequireIfMatch bool
+
+	// background tracks work that carries on after the response to the request that started it
+	background sync.WaitGroup
+}
+
+// backgroundTimeout bounds how long work started by goBackground may take
+const backgroundTimeout = time.Minute
+
+// goBackground runs f without holding up the response to r, with a context that is not cancelled when r ends
+func (app *App) goBackground(r *http.Request, f func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), backgroundTimeout)
+	app.background.Add(1)
+	go func() {
+		defer app.background.Done()
+		defer cancel()
+		f(ctx)
+	}()
+}
+
+// Wait blocks until the work handlers left running in the background, ie: sending email, has finished. It should
+// only be called once the server has stopped handling requests.
+func (app *App) Wait() {
+	app.background.Wait()
 }
 
 func (app *App) RegisterRoutes() http.Handler {
@@ -20,18 +76,80 @@ func (app *App) RegisterRoutes() http.Handler {
 	// V1 API routes
 	apiV1 := http.NewServeMux()
 
+	authn := app.authenticator()
+
 	// login
 	apiV1.HandleFunc("POST /login", app.LoginHandler)
+	apiV1.HandleFunc("POST /token/refresh", app.RefreshTokenHandler)
+	apiV1.Handle("POST /logout", middleware.AuthProtectedMiddleware(http.HandlerFunc(app.LogoutHandler), authn))
+
+	// login through an external identity provider
+	if app.OIDCProvider != nil {
+		apiV1.HandleFunc("GET /oidc/login", app.OIDCLoginHandler)
+		apiV1.HandleFunc("GET /oidc/callback", app.OIDCCallbackHandler)
+	}
+
+	// two-factor authentication
+	if app.TwoFactorService != nil {
+		apiV1.HandleFunc("POST /login/2fa", app.LoginTwoFactorHandler)
+		apiV1.Handle("POST /me/2fa/enroll", middleware.AuthProtectedMiddleware(http.HandlerFunc(app.EnrollTwoFactorHandler), authn))
+		apiV1.Handle("POST /me/2fa/confirm", middleware.AuthProtectedMiddleware(http.HandlerFunc(app.ConfirmTwoFactorHandler), authn))
+		apiV1.Handle("POST /me/2fa/disable", middleware.AuthProtectedMiddleware(http.HandlerFunc(app.DisableTwoFactorHandler), authn))
+	}
+
+	// users
+	apiV1.HandleFunc("POST /users", app.CreateUserHandler)
+
+	// account recovery and email verification
+	if app.Mailer != nil {
+		apiV1.HandleFunc("POST /password/forgot", app.ForgotPasswordHandler)
+		apiV1.HandleFunc("POST /password/reset", app.ResetPasswordHandler)
+		apiV1.HandleFunc("POST /email/verify", app.VerifyEmailHandler)
+		apiV1.Handle("POST /me/email/verification", middleware.AuthProtectedMiddleware(http.HandlerFunc(app.SendEmailVerificationHandler), authn))
+	}
+
+	// API tokens
+	apiV1.Handle("POST /me/tokens", middleware.AuthProtectedMiddleware(http.HandlerFunc(app.CreateAPITokenHandler), authn))
+	apiV1.Handle("GET /me/tokens", middleware.AuthProtectedMiddleware(http.HandlerFunc(app.FetchAPITokensHandler), authn))
+	apiV1.Handle("DELETE /me/tokens/{id}", middleware.AuthProtectedMiddleware(http.HandlerFunc(app.DeleteAPITokenHandler), authn))
 
 	// blog posts
-	apiV1.Handle("POST /posts", middleware.AuthProtectedMiddleware(http.HandlerFunc(app.CreateBlogPostHandler)))
-	apiV1.Handle("GET /posts/{id}", middleware.AuthOptionalMiddleware(http.HandlerFunc(app.FetchBlogPostHandler)))
-	apiV1.Handle("GET /posts", middleware.AuthOptionalMiddleware(http.HandlerFunc(app.FetchBlogPostsHandler)))
-	apiV1.Handle("PUT /posts/{id}", middleware.AuthProtectedMiddleware(http.HandlerFunc(app.UpdateBlogPostHandler)))
-	apiV1.Handle("DELETE /posts/{id}", middleware.AuthProtectedMiddleware(http.HandlerFunc(app.DeleteBlogPostHandler)))
+	apiV1.Handle("POST /posts", middleware.RequirePermission(http.HandlerFunc(app.CreateBlogPostHandler), authn, model.PermWritePosts))
+	apiV1.Handle("GET /posts/{id}", middleware.AuthOptionalMiddleware(http.HandlerFunc(app.FetchBlogPostHandler), authn))
+	apiV1.Handle("GET /posts", middleware.AuthOptionalMiddleware(http.HandlerFunc(app.FetchBlogPostsHandler), authn))
+	apiV1.Handle("PUT /posts/{id}", middleware.RequirePermission(http.HandlerFunc(app.UpdateBlogPostHandler), authn, model.PermWritePosts))
+	apiV1.Handle("DELETE /posts/{id}", middleware.RequirePermission(http.HandlerFunc(app.DeleteBlogPostHandler), authn, model.PermWritePosts))
+
+	// blog posts by author
+	apiV1.Handle("GET /me/posts", middleware.RequirePermission(http.HandlerFunc(app.FetchMyBlogPostsHandler), authn, model.PermReadPosts))
+	apiV1.Handle("GET /authors/{id}/posts", middleware.AuthOptionalMiddleware(http.HandlerFunc(app.FetchAuthorBlogPostsHandler), authn))
+
+	// deleted blog posts
+	apiV1.Handle("GET /posts/trash", middleware.RequirePermission(http.HandlerFunc(app.FetchDeletedBlogPostsHandler), authn, model.PermReadPosts))
+	apiV1.Handle("POST /posts/{id}/restore", middleware.RequirePermission(http.HandlerFunc(app.RestoreBlogPostHandler), authn, model.PermWritePosts))
 
-	// admin
-	apiV1.Handle("DELETE /admin/posts/{id}", middleware.AdminOnlyMiddleware(http.HandlerFunc(app.AdminDeleteBlogPostHandler)))
+	// blog post revisions
+	apiV1.Handle("GET /posts/{id}/revisions", middleware.RequirePermission(http.HandlerFunc(app.FetchBlogPostRevisionsHandler), authn, model.PermReadPosts))
+	apiV1.Handle("GET /posts/{id}/revisions/{rev}", middleware.RequirePermission(http.HandlerFunc(app.FetchBlogPostRevisionHandler), authn, model.PermReadPosts))
+	apiV1.Handle("GET /posts/{id}/revisions/{rev}/diff/{other}", middleware.RequirePermission(http.HandlerFunc(app.DiffBlogPostRevisionsHandler), authn, model.PermReadPosts))
+	apiV1.Handle("POST /posts/{id}/revisions/{rev}/restore", middleware.RequirePermission(http.HandlerFunc(app.RestoreBlogPostRevisionHandler), authn, model.PermWritePosts))
+
+	// moderation and user management
+	apiV1.Handle("DELETE /admin/posts/{id}", middleware.RequirePermission(http.HandlerFunc(app.AdminDeleteBlogPostHandler), authn, model.PermModeratePosts))
+	apiV1.Handle("POST /admin/posts/bulk", middleware.RequirePermission(http.HandlerFunc(app.AdminBulkBlogPostsHandler), authn, model.PermModeratePosts))
+	apiV1.Handle("PUT /admin/posts/{id}/author", middleware.RequirePermission(http.HandlerFunc(app.AdminTransferBlogPostHandler), authn, model.PermManageUsers))
+	apiV1.Handle("POST /admin/users/{id}/posts/transfer", middleware.RequirePermission(http.HandlerFunc(app.AdminTransferUserBlogPostsHandler), authn, model.PermManageUsers))
+	apiV1.Handle("GET /admin/users", middleware.RequirePermission(http.HandlerFunc(app.AdminFetchUsersHandler), authn, model.PermManageUsers))
+	apiV1.Handle("GET /admin/users/{id}", middleware.RequirePermission(http.HandlerFunc(app.AdminFetchUserHandler), authn, model.PermManageUsers))
+	apiV1.Handle("PUT /admin/users/{id}/role", middleware.RequirePermission(http.HandlerFunc(app.AdminUpdateUserRoleHandler), authn, model.PermManageUsers))
+	apiV1.Handle("POST /admin/users/{id}/suspend", middleware.RequirePermission(http.HandlerFunc(app.AdminSuspendUserHandler), authn, model.PermManageUsers))
+	apiV1.Handle("POST /admin/users/{id}/reactivate", middleware.RequirePermission(http.HandlerFunc(app.AdminReactivateUserHandler), authn, model.PermManageUsers))
+	apiV1.Handle("DELETE /admin/users/{id}", middleware.RequirePermission(http.HandlerFunc(app.AdminDeleteUserHandler), authn, model.PermManageUsers))
+	apiV1.Handle("POST /admin/users/{id}/revoke-tokens", middleware.RequirePermission(http.HandlerFunc(app.AdminRevokeUserTokensHandler), authn, model.PermManageUsers))
+	if app.LockoutService != nil {
+		apiV1.Handle("GET /admin/lockouts", middleware.RequirePermission(http.HandlerFunc(app.AdminFetchLockoutsHandler), authn, model.PermManageUsers))
+		apiV1.Handle("DELETE /admin/lockouts/{key}", middleware.RequirePermission(http.HandlerFunc(app.AdminClearLockoutHandler), authn, model.PermManageUsers))
+	}
 
 	// top level mux
 	m := http.NewServeMux()
@@ -41,8 +159,24 @@ func (app *App) RegisterRoutes() http.Handler {
 		w.Write([]byte("pong!"))
 	})
 
+	// public keys for verifying access tokens
+	m.HandleFunc("GET /.well-known/jwks.json", app.JWKSHandler)
+
 	// register nested mux
 	m.Handle("/api/v1/", http.StripPrefix("/api/v1", apiV1))
 
 	return m
 }
+
+// authenticator accepts API tokens and the access tokens issued on login, including as session cookies when
+// cookie sessions are enabled. Bearer tokens are tried first as they cannot be sent by another site.
+func (app *App) authenticator() *auth.Authenticator {
+	extractors := []auth.Extractor{
+		auth.NewAPITokenExtractor(app.APITokenService, app.UserService),
+		auth.NewAccessTokenExtractor(app.TokenRevocationService, app.UserService),
+	}
+	if app.SessionCookies != nil {
+		extractors = append(extractors, auth.NewSessionCookieExtractor(app.TokenRevocationService, app.UserService, app.SessionCookies.CSRFKey))
+	}
+	return auth.NewAuthenticator(extractors...)
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/James-D-Wood/blog-api/internal/auth"
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+)
+
+type CreateAPITokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type CreateAPITokenResponse struct {
+	APIToken db.APIToken `json:"api_token"`
+	// Token is only ever returned here, as only its hash is stored
+	Token string `json:"token"`
+}
+
+// CreateAPITokenHandler creates an API token for the user, limited to the given scopes
+func (app *App) CreateAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	principal, ok := app.sessionPrincipal(w, r, "CreateAPITokenHandler")
+	if !ok {
+		return
+	}
+
+	var req CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.Logger.Error("failed to read API token payload", "error", err, "location", "CreateAPITokenHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+
+	token, apiToken, err := db.NewAPIToken(principal.UserID, req.Name, req.Scopes)
+	if err != nil {
+		app.Logger.Error("invalid API token details", "error", err, "location", "CreateAPITokenHandler")
+		switch {
+		case errors.Is(err, db.ErrInvalidAPITokenName), errors.Is(err, db.ErrInvalidScopes):
+			httputils.RespondWithJsonError(w, err.Error(), 400)
+		default:
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+		}
+		return
+	}
+	// tokens cannot be used to do anything their owner cannot
+	for _, scope := range apiToken.Scopes {
+		if !principal.Role.Can(scope) {
+			app.Logger.Error("API token scope is not granted by the user's role", "role", principal.Role, "scope", scope, "location", "CreateAPITokenHandler")
+			httputils.RespondWithJsonError(w, fmt.Sprintf("the %s role cannot grant the %s scope", principal.Role, scope), 400)
+			return
+		}
+	}
+
+	err = app.APITokenService.CreateAPIToken(r.Context(), &apiToken)
+	if err != nil {
+		app.Logger.Error("failed to persist API token", "error", err, "location", "CreateAPITokenHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.RespondWithJson(w, CreateAPITokenResponse{
+		APIToken: apiToken,
+		Token:    token,
+	}, 201)
+}
+
+// FetchAPITokensHandler lists the user's API tokens, without the tokens themselves
+func (app *App) FetchAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := app.sessionPrincipal(w, r, "FetchAPITokensHandler")
+	if !ok {
+		return
+	}
+
+	tokens, err := app.APITokenService.ListAPITokens(r.Context(), principal.UserID)
+	if err != nil {
+		app.Logger.Error("failed to fetch API tokens", "error", err, "location", "FetchAPITokensHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	type Response struct {
+		APITokens []db.APIToken `json:"api_tokens"`
+	}
+
+	httputils.RespondWithJson(w, Response{
+		APITokens: tokens,
+	}, 200)
+}
+
+// DeleteAPITokenHandler deletes one of the user's API tokens, which stops working straight away
+func (app *App) DeleteAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := app.sessionPrincipal(w, r, "DeleteAPITokenHandler")
+	if !ok {
+		return
+	}
+	id := r.PathValue("id")
+
+	err := app.APITokenService.DeleteAPIToken(r.Context(), principal.UserID, id)
+	if err != nil {
+		app.Logger.Error("failed to delete API token", "error", err, "location", "DeleteAPITokenHandler")
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: API token with ID %s does not exist", id), 404)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sessionPrincipal returns the principal of a request authenticated by logging in. API tokens are rejected, so
+// that a leaked token cannot be used to create more of them or to change how the user logs in.
+func (app *App) sessionPrincipal(w http.ResponseWriter, r *http.Request, location string) (*auth.Principal, bool) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		app.Logger.Error("failed to identify user", "location", location)
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return nil, false
+	}
+	if principal.Method == auth.MethodAPIToken {
+		app.Logger.Error("attempted to use an API token where logging in is required", "location", location)
+		httputils.RespondWithJsonError(w, "API tokens cannot be used for this - log in instead", 403)
+		return nil, false
+	}
+	return principal, true
+}
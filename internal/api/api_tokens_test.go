@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+)
+
+// mustCreateAPIToken creates an API token with the given scopes using an access token, returning the API token
+func mustCreateAPIToken(t *testing.T, h http.Handler, accessToken string, scopes ...string) CreateAPITokenResponse {
+	t.Helper()
+
+	b, _ := json.Marshal(CreateAPITokenRequest{Name: "ci", Scopes: scopes})
+	rr := serve(h, "POST", "/api/v1/me/tokens", accessToken, string(b))
+	if rr.Result().StatusCode != 201 {
+		t.Fatalf("got %d creating an API token, want %d: %s", rr.Result().StatusCode, 201, rr.Body.String())
+	}
+
+	var resp CreateAPITokenResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestAPITokenLifecycle(t *testing.T) {
+	h := newTestServer(t, nil)
+	login := mustLogIn(t, h, "kishiguro")
+
+	created := mustCreateAPIToken(t, h, login.Token, "posts:write", "posts:read")
+	if !strings.HasPrefix(created.Token, db.APITokenPrefix) {
+		t.Errorf("got token %q, want the %s prefix", created.Token, db.APITokenPrefix)
+	}
+
+	// the token can be used in place of an access token
+	post := `{"title": "Published From CI", "contents": "Contents", "status": "PUBLISHED"}`
+	if rr := serve(h, "POST", "/api/v1/posts", created.Token, post); rr.Result().StatusCode != 201 {
+		t.Fatalf("got %d creating a post with the API token, want %d: %s", rr.Result().StatusCode, 201, rr.Body.String())
+	}
+
+	rr := serve(h, "GET", "/api/v1/me/tokens", login.Token, "")
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d listing API tokens, want %d", rr.Result().StatusCode, 200)
+	}
+	if strings.Contains(rr.Body.String(), created.Token) {
+		t.Error("listing API tokens returned the token itself")
+	}
+	var list struct {
+		APITokens []db.APIToken `json:"api_tokens"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.APITokens) != 1 || list.APITokens[0].ID != created.APIToken.ID || list.APITokens[0].LastUsedTS == nil {
+		t.Errorf("got %+v, want the created token with its last use recorded", list.APITokens)
+	}
+
+	path := "/api/v1/me/tokens/" + created.APIToken.ID
+	if rr := serve(h, "DELETE", path, login.Token, ""); rr.Result().StatusCode != 204 {
+		t.Fatalf("got %d deleting the API token, want %d", rr.Result().StatusCode, 204)
+	}
+	if rr := serve(h, "GET", "/api/v1/me/posts", created.Token, ""); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d using a deleted API token, want %d", rr.Result().StatusCode, 401)
+	}
+	if rr := serve(h, "DELETE", path, login.Token, ""); rr.Result().StatusCode != 404 {
+		t.Errorf("got %d deleting the API token again, want %d", rr.Result().StatusCode, 404)
+	}
+}
+
+func TestCreateAPITokenHandler(t *testing.T) {
+	tests := []struct {
+		Name         string
+		Body         string
+		ResponseCode int
+	}{
+		{"Happy Path", `{"name": "ci", "scopes": ["posts:read", "posts:write"]}`, 201},
+		{"Missing Name", `{"name": " ", "scopes": ["posts:read"]}`, 400},
+		{"Missing Scopes", `{"name": "ci", "scopes": []}`, 400},
+		{"Unknown Scope", `{"name": "ci", "scopes": ["posts:everything"]}`, 400},
+		{"Scope Not Granted By Role", `{"name": "ci", "scopes": ["posts:moderate"]}`, 400},
+		{"Invalid Body", `{"name": `, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			h := newTestServer(t, nil)
+			login := mustLogIn(t, h, "kishiguro")
+
+			rr := serve(h, "POST", "/api/v1/me/tokens", login.Token, tt.Body)
+			if rr.Result().StatusCode != tt.ResponseCode {
+				t.Errorf("got %d, want %d: %s", rr.Result().StatusCode, tt.ResponseCode, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPITokenRestrictions(t *testing.T) {
+	h := newTestServer(t, nil)
+	login := mustLogIn(t, h, "kishiguro")
+	readOnly := mustCreateAPIToken(t, h, login.Token, "posts:read")
+
+	tests := []struct {
+		Name         string
+		Token        string
+		Method       string
+		Path         string
+		Body         string
+		ResponseCode int
+	}{
+		{"Scope Allows", readOnly.Token, "GET", "/api/v1/me/posts", "", 200},
+		{"Scope Forbids", readOnly.Token, "POST", "/api/v1/posts", `{"title": "Title", "contents": "Contents"}`, 403},
+		{"Cannot Create Tokens", readOnly.Token, "POST", "/api/v1/me/tokens", `{"name": "more", "scopes": ["posts:read"]}`, 403},
+		{"Cannot List Tokens", readOnly.Token, "GET", "/api/v1/me/tokens", "", 403},
+		{"Cannot Log Out", readOnly.Token, "POST", "/api/v1/logout", "", 400},
+		{"Unknown Token", db.APITokenPrefix + "unknown", "GET", "/api/v1/me/posts", "", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			rr := serve(h, tt.Method, tt.Path, tt.Token, tt.Body)
+			if rr.Result().StatusCode != tt.ResponseCode {
+				t.Errorf("got %d, want %d: %s", rr.Result().StatusCode, tt.ResponseCode, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPITokenDraftAccess(t *testing.T) {
+	h := newTestServer(t, nil)
+	login := mustLogIn(t, h, "kishiguro")
+	writeOnly := mustCreateAPIToken(t, h, login.Token, "posts:write")
+	readOnly := mustCreateAPIToken(t, h, login.Token, "posts:read")
+
+	rr := serve(h, "POST", "/api/v1/posts", login.Token, `{"title": "Draft", "contents": "Contents", "status": "DRAFT"}`)
+	if rr.Result().StatusCode != 201 {
+		t.Fatalf("got %d creating a draft, want %d: %s", rr.Result().StatusCode, 201, rr.Body.String())
+	}
+	var created struct {
+		Post struct {
+			ID string `json:"id"`
+		} `json:"post"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	// drafts are only readable by their author with a credential allowed to read posts
+	tests := []struct {
+		Name         string
+		Token        string
+		ResponseCode int
+		Drafts       int
+	}{
+		{"Read Scope", readOnly.Token, 200, 1},
+		{"Write Scope", writeOnly.Token, 403, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if rr := serve(h, "GET", "/api/v1/posts/"+created.Post.ID, tt.Token, ""); rr.Result().StatusCode != tt.ResponseCode {
+				t.Errorf("got %d fetching the draft, want %d", rr.Result().StatusCode, tt.ResponseCode)
+			}
+			if got := countPosts(t, h, "/api/v1/authors/"+authorTestUserID+"/posts", tt.Token); got != tt.Drafts {
+				t.Errorf("got %d posts listing the author's posts, want %d", got, tt.Drafts)
+			}
+		})
+	}
+}
+
+func TestAdminRevokeUserTokensDeletesAPITokens(t *testing.T) {
+	h := newTestServer(t, nil)
+	login := mustLogIn(t, h, "kishiguro")
+	created := mustCreateAPIToken(t, h, login.Token, "posts:read")
+	admin := mustLogIn(t, h, "admin")
+
+	path := fmt.Sprintf("/api/v1/admin/users/%s/revoke-tokens", "0197aaed-4a35-74da-8574-4165524a1111")
+	if rr := serve(h, "POST", path, admin.Token, ""); rr.Result().StatusCode != 204 {
+		t.Fatalf("got %d, want %d", rr.Result().StatusCode, 204)
+	}
+	if rr := serve(h, "GET", "/api/v1/me/posts", created.Token, ""); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d using the API token, want %d", rr.Result().StatusCode, 401)
+	}
+}
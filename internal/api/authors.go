@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/James-D-Wood/blog-api/internal/auth"
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+)
+
+func (app *App) FetchMyBlogPostsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		app.Logger.Error("failed to identify user", "location", "FetchMyBlogPostsHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	userID := principal.UserID
+
+	app.respondWithBlogPostPage(w, r, "FetchMyBlogPostsHandler", func(ctx context.Context, query db.BlogPostQuery) (db.BlogPostPage, error) {
+		return app.BlogService.FetchAuthorBlogPosts(ctx, userID, true, query)
+	})
+}
+
+func (app *App) FetchAuthorBlogPostsHandler(w http.ResponseWriter, r *http.Request) {
+	// a malformed ID is rejected as an invalid query, like the author filter of other listings
+	authorID := r.PathValue("id")
+	includeDrafts := canReadDrafts(r.Context(), authorID)
+
+	app.respondWithBlogPostPage(w, r, "FetchAuthorBlogPostsHandler", func(ctx context.Context, query db.BlogPostQuery) (db.BlogPostPage, error) {
+		hidden, err := app.hiddenAuthorIDs(ctx)
+		if err != nil {
+			return db.BlogPostPage{}, err
+		}
+		query.ExcludeAuthorIDs = hidden
+		return app.BlogService.FetchAuthorBlogPosts(ctx, authorID, includeDrafts, query)
+	})
+}
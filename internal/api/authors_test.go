@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+var authorPostsTestCases = []struct {
+	Name         string
+	Path         string
+	Handler      func(app *App) http.HandlerFunc
+	User         string
+	ResponseCode int
+	Posts        int
+}{
+	{
+		Name:         "Me - Includes Drafts",
+		Path:         "/me/posts",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchMyBlogPostsHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		ResponseCode: 200,
+		Posts:        2,
+	},
+	{
+		Name:         "Me - Sorted By Publish Date",
+		Path:         "/me/posts?sort=published",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchMyBlogPostsHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		ResponseCode: 400,
+	},
+	{
+		Name:         "Me - Unknown User",
+		Path:         "/me/posts",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchMyBlogPostsHandler },
+		ResponseCode: 500,
+	},
+	{
+		Name:         "Author - Same User",
+		Path:         "/authors/0197aaed-4a35-74da-8574-4165524a1111/posts",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchAuthorBlogPostsHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		ResponseCode: 200,
+		Posts:        2,
+	},
+	{
+		Name:         "Author - Different User",
+		Path:         "/authors/0197aaed-4a35-74da-8574-4165524a1111/posts",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchAuthorBlogPostsHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a2222",
+		ResponseCode: 200,
+		Posts:        1,
+	},
+	{
+		Name:         "Author - Anonymous",
+		Path:         "/authors/0197aaed-4a35-74da-8574-4165524a1111/posts",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchAuthorBlogPostsHandler },
+		ResponseCode: 200,
+		Posts:        1,
+	},
+	{
+		Name:         "Author - Malformed ID",
+		Path:         "/authors/not-a-uuid/posts",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchAuthorBlogPostsHandler },
+		ResponseCode: 400,
+	},
+}
+
+func TestAuthorPostsHandlers(t *testing.T) {
+	for _, tt := range authorPostsTestCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			app := &App{
+				Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				BlogService: db.NewInMemoryBlogService(),
+				UserService: &db.InMemoryUserService{},
+			}
+			for _, post := range []*model.BlogPost{
+				{Title: "published", Status: model.PUBLISHED},
+				{Title: "draft", Status: model.DRAFT},
+			} {
+				if err := app.BlogService.CreateBlogPost(context.TODO(), "0197aaed-4a35-74da-8574-4165524a1111", post); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// register on a mux so path values are parsed the same way as in RegisterRoutes
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /me/posts", tt.Handler(app))
+			mux.HandleFunc("GET /authors/{id}/posts", tt.Handler(app))
+
+			req := httptest.NewRequest("GET", tt.Path, nil)
+			if tt.User != "" {
+				req = req.WithContext(withUser(req.Context(), tt.User))
+			}
+			rr := httptest.NewRecorder()
+
+			mux.ServeHTTP(rr, req)
+			if rr.Result().StatusCode != tt.ResponseCode {
+				t.Fatalf("got %d, want %d", rr.Result().StatusCode, tt.ResponseCode)
+			}
+			if tt.ResponseCode != 200 {
+				return
+			}
+
+			var resp struct {
+				Posts []model.BlogPost `json:"posts"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Posts) != tt.Posts {
+				t.Errorf("got %d posts, want %d", len(resp.Posts), tt.Posts)
+			}
+		})
+	}
+}
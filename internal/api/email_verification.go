@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/James-D-Wood/blog-api/internal/auth"
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/mail"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+type VerifyEmailRequest struct {
+	// Token is the email verification token emailed to the user
+	Token string `json:"token"`
+}
+
+// VerifyEmailHandler marks the email address an email verification token was sent to as verified, letting its
+// user publish posts
+func (app *App) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.Logger.Error("failed to read verify email payload", "error", err, "location", "VerifyEmailHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+
+	user, token, ok := app.redeemEmailToken(w, r, "VerifyEmailHandler", req.Token, db.PurposeEmailVerification)
+	if !ok {
+		return
+	}
+	if !app.consumeEmailToken(w, r, "VerifyEmailHandler", token) {
+		return
+	}
+
+	user.EmailVerified = true
+	if err := app.UserService.UpdateUser(r.Context(), user); err != nil {
+		app.Logger.Error("failed to update user", "error", err, "location", "VerifyEmailHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	app.Logger.Info("verified email address", "userID", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SendEmailVerificationHandler emails the user a new email verification token, ie: when the one sent on sign up
+// has expired. Earlier tokens stop working.
+func (app *App) SendEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.UserService.FetchUserByID(r.Context(), auth.UserID(r.Context()))
+	if err != nil {
+		app.Logger.Error("failed to fetch user", "error", err, "location", "SendEmailVerificationHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	switch {
+	case user.Email == "":
+		app.Logger.Error("user has no email address", "location", "SendEmailVerificationHandler")
+		httputils.RespondWithJsonError(w, "invalid request: you have no email address to verify", 400)
+		return
+	case user.EmailVerified:
+		app.Logger.Error("email address already verified", "location", "SendEmailVerificationHandler")
+		httputils.RespondWithJsonError(w, "email address is already verified", 409)
+		return
+	}
+
+	if err := app.sendVerificationEmail(r.Context(), user); err != nil {
+		app.Logger.Error("failed to send verification email", "error", err, "location", "SendEmailVerificationHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendVerificationEmail emails user a token to verify their email address with
+func (app *App) sendVerificationEmail(ctx context.Context, user *model.User) error {
+	token, err := app.createEmailToken(ctx, user, db.PurposeEmailVerification, app.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	err = app.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nThanks for signing up as %s. Verify that this is your email address within %s using this token:\n\n%s\n\nYou will not be able to publish posts until you do.\n",
+			user.Name, user.Username, formatTTL(app.EmailVerificationTTL), token,
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	app.Logger.Info("sent verification email", "userID", user.ID)
+	return nil
+}
+
+// checkCanPublish responds with 403 and returns false if userID has not verified their email address yet
+func (app *App) checkCanPublish(w http.ResponseWriter, r *http.Request, location, userID string) bool {
+	user, err := app.UserService.FetchUserByID(r.Context(), userID)
+	if err != nil {
+		app.Logger.Error("failed to fetch user", "error", err, "location", location)
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return false
+	}
+	if !user.CanPublish() {
+		app.Logger.Error("attempted to publish before verifying email address", "location", location, "userID", userID)
+		httputils.RespondWithJsonError(w, "verify your email address before publishing", 403)
+		return false
+	}
+	return true
+}
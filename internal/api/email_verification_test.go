@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/mail"
+)
+
+func TestSignUpEmailVerification(t *testing.T) {
+	h, outbox := newMailTestServer(t)
+
+	if rr := serve(h, "POST", "/api/v1/users", "", `{"username": "gsaunders", "name": "George Saunders", "password": "a long password"}`); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d signing up without an email address, want %d", rr.Result().StatusCode, 400)
+	}
+	if rr := serve(h, "POST", "/api/v1/users", "", `{"username": "gsaunders", "name": "George Saunders", "password": "a long password", "email": "kazuo@example.com"}`); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d signing up with a taken email address, want %d", rr.Result().StatusCode, 400)
+	}
+
+	rr := serve(h, "POST", "/api/v1/users", "", `{"username": "gsaunders", "name": "George Saunders", "password": "a long password", "email": "george@example.com"}`)
+	if rr.Result().StatusCode != 201 {
+		t.Fatalf("got %d signing up, want %d: %s", rr.Result().StatusCode, 201, rr.Body.String())
+	}
+	token := lastEmailToken(t, outbox, "george@example.com")
+	login := mustLogIn(t, h, "gsaunders")
+
+	// drafts can be written, but not published
+	if rr := serve(h, "POST", "/api/v1/posts", login.Token, `{"title": "Draft", "status": "DRAFT"}`); rr.Result().StatusCode != 201 {
+		t.Errorf("got %d creating a draft, want %d", rr.Result().StatusCode, 201)
+	}
+	published := `{"title": "Published", "status": "PUBLISHED"}`
+	if rr := serve(h, "POST", "/api/v1/posts", login.Token, published); rr.Result().StatusCode != 403 {
+		t.Errorf("got %d publishing before verifying, want %d", rr.Result().StatusCode, 403)
+	}
+
+	// asking for another token replaces the first
+	if rr := serve(h, "POST", "/api/v1/me/email/verification", login.Token, ""); rr.Result().StatusCode != 202 {
+		t.Fatalf("got %d asking for another token, want %d", rr.Result().StatusCode, 202)
+	}
+	if rr := serve(h, "POST", "/api/v1/email/verify", "", fmt.Sprintf(`{"token": %q}`, token)); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d verifying with a replaced token, want %d", rr.Result().StatusCode, 400)
+	}
+	token = lastEmailToken(t, outbox, "george@example.com")
+	if rr := serve(h, "POST", "/api/v1/email/verify", "", fmt.Sprintf(`{"token": %q}`, token)); rr.Result().StatusCode != 204 {
+		t.Fatalf("got %d verifying, want %d", rr.Result().StatusCode, 204)
+	}
+
+	if rr := serve(h, "POST", "/api/v1/posts", login.Token, published); rr.Result().StatusCode != 201 {
+		t.Errorf("got %d publishing once verified, want %d", rr.Result().StatusCode, 201)
+	}
+	if rr := serve(h, "POST", "/api/v1/me/email/verification", login.Token, ""); rr.Result().StatusCode != 409 {
+		t.Errorf("got %d asking for a token once verified, want %d", rr.Result().StatusCode, 409)
+	}
+}
+
+func TestSendEmailVerificationWithoutEmail(t *testing.T) {
+	h, _ := newMailTestServer(t)
+	login := mustLogIn(t, h, "dsedaris")
+
+	if rr := serve(h, "POST", "/api/v1/me/email/verification", login.Token, ""); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d, want %d", rr.Result().StatusCode, 400)
+	}
+	// users without an email address are not held back from publishing
+	if rr := serve(h, "POST", "/api/v1/posts", login.Token, `{"title": "Published", "status": "PUBLISHED"}`); rr.Result().StatusCode != 201 {
+		t.Errorf("got %d publishing, want %d", rr.Result().StatusCode, 201)
+	}
+}
+
+// blockingMailer holds every message until release is closed
+type blockingMailer struct {
+	release chan struct{}
+}
+
+func (m blockingMailer) Send(ctx context.Context, msg mail.Message) error {
+	select {
+	case <-m.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestSignUpDoesNotWaitForMail(t *testing.T) {
+	mailer := blockingMailer{release: make(chan struct{})}
+	var app *App
+	h := newTestServer(t, func(a *App) {
+		app = a
+		app.Mailer = mailer
+		app.EmailTokenService = db.NewInMemoryEmailTokenService()
+		app.EmailVerificationTTL = time.Hour
+	})
+	defer app.Wait()
+	defer close(mailer.release)
+
+	done := make(chan int)
+	go func() {
+		rr := serve(h, "POST", "/api/v1/users", "", `{"username": "gsaunders", "name": "George Saunders", "password": "a long password", "email": "george@example.com"}`)
+		done <- rr.Result().StatusCode
+	}()
+
+	select {
+	case code := <-done:
+		if code != 201 {
+			t.Errorf("got %d signing up while mail is slow, want %d", code, 201)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sign up waited for the verification email to be sent")
+	}
+}
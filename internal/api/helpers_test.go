@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/api/middleware"
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// newTestServer serves the full API backed by in-memory services, with two authors and an admin who can log in
+// with the password "a long password". kishiguro has a verified email address and dsedaris has none. configure,
+// if not nil, can change the App before its routes are registered, so tests only set up what they rely on.
+func newTestServer(t *testing.T, configure func(*App)) http.Handler {
+	t.Helper()
+
+	hash, err := db.HashPassword("a long password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{
+		Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		BlogService: db.NewInMemoryBlogService(),
+		UserService: &db.InMemoryUserService{
+			Users: map[string]*model.User{
+				"kishiguro": {ID: authorTestUserID, Username: "kishiguro", Name: "Kazuo Ishiguro", PasswordHash: hash, Role: model.RoleAuthor, Email: "kazuo@example.com", EmailVerified: true},
+				"dsedaris":  {ID: "0197aaed-4a35-74da-8574-4165524a2222", Username: "dsedaris", Name: "David Sedaris", PasswordHash: hash, Role: model.RoleAuthor},
+				"admin":     {ID: adminTestUserID, Username: "admin", PasswordHash: hash, Role: model.RoleAdmin},
+			},
+		},
+		RefreshTokenService:    db.NewInMemoryRefreshTokenService(),
+		TokenRevocationService: db.NewInMemoryTokenRevocationService(),
+		APITokenService:        db.NewInMemoryAPITokenService(),
+		RefreshTokenTTL:        time.Hour,
+	}
+	if configure != nil {
+		configure(app)
+	}
+	return middleware.LoggerMiddleware(app.RegisterRoutes(), app.Logger)
+}
+
+func serve(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func mustLogIn(t *testing.T, h http.Handler, username string) LoginResponse {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/api/v1/login", nil)
+	req.SetBasicAuth(username, "a long password")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d logging in as %s, want %d", rr.Result().StatusCode, username, 200)
+	}
+
+	var resp LoginResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
@@ -0,0 +1,15 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+)
+
+// JWKSHandler publishes the public keys that access tokens are signed with, so that other services can verify
+// tokens issued by this API without calling it
+func (app *App) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	// verifiers should pick up a new key soon after it is added, ahead of it becoming active
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	httputils.RespondWithJson(w, httputils.SigningKeys.JWKS(), 200)
+}
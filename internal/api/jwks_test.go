@@ -0,0 +1,32 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+)
+
+func TestJWKSHandler(t *testing.T) {
+	app := App{Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+	rr := httptest.NewRecorder()
+	app.RegisterRoutes().ServeHTTP(rr, req)
+
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d, want %d", rr.Result().StatusCode, 200)
+	}
+
+	var jwks httputils.JWKSet
+	if err := json.NewDecoder(rr.Body).Decode(&jwks); err != nil {
+		t.Fatal(err)
+	}
+	// the default key is an HS256 secret, which is never published
+	if jwks.Keys == nil || len(jwks.Keys) != 0 {
+		t.Errorf("got %+v, want an empty key set", jwks)
+	}
+}
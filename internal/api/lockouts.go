@@ -0,0 +1,143 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+)
+
+// loginLockout is a key failed logins are counted against, along with the policy that locks it out
+type loginLockout struct {
+	key    string
+	policy db.LockoutPolicy
+}
+
+// loginLockouts returns the keys a login for username from r is counted against. Usernames are counted whether
+// or not the user exists, so that lockouts do not reveal which users do.
+func (app *App) loginLockouts(r *http.Request, username string) []loginLockout {
+	return []loginLockout{
+		{key: "username:" + username, policy: app.UsernameLockouts},
+		{key: "ip:" + clientIP(r), policy: app.IPLockouts},
+	}
+}
+
+// checkLoginLockouts responds with 429 and returns false if any of lockouts is locked out
+func (app *App) checkLoginLockouts(w http.ResponseWriter, r *http.Request, location string, lockouts []loginLockout) bool {
+	now := time.Now()
+
+	var retryAfter time.Duration
+	for _, l := range lockouts {
+		lockout, err := app.LockoutService.FetchLockout(r.Context(), l.key)
+		if err != nil {
+			if errors.Is(err, db.ErrEntityNotFound) {
+				continue
+			}
+			app.Logger.Error("failed to fetch lockout", "error", err, "location", location)
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+			return false
+		}
+		retryAfter = max(retryAfter, lockout.RetryAfter(now))
+	}
+
+	if retryAfter > 0 {
+		app.Logger.Warn("login attempted while locked out", "location", location, "retryAfter", retryAfter.String())
+		respondLockedOut(w, retryAfter)
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed login against each of lockouts, responding with 429 and returning true if
+// that locked any of them out
+func (app *App) recordLoginFailure(w http.ResponseWriter, r *http.Request, location string, lockouts []loginLockout) bool {
+	now := time.Now()
+
+	var retryAfter time.Duration
+	for _, l := range lockouts {
+		lockout, err := app.LockoutService.RecordLoginFailure(r.Context(), l.key, now, l.policy)
+		if err != nil {
+			app.Logger.Error("failed to record failed login", "error", err, "location", location)
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+			return true
+		}
+		if after := lockout.RetryAfter(now); after > 0 {
+			app.Logger.Warn("locked out after repeated failed logins", "key", l.key, "failures", lockout.Failures, "location", location)
+			retryAfter = max(retryAfter, after)
+		}
+	}
+
+	if retryAfter > 0 {
+		respondLockedOut(w, retryAfter)
+		return true
+	}
+	return false
+}
+
+// clearLoginLockout forgets the failures of the username of lockouts once they have logged in, returning false
+// if that failed. The address is left alone, as logging in to one account says nothing about others from it.
+func (app *App) clearLoginLockout(w http.ResponseWriter, r *http.Request, location string, lockouts []loginLockout) bool {
+	err := app.LockoutService.ClearLockout(r.Context(), lockouts[0].key)
+	if err != nil && !errors.Is(err, db.ErrEntityNotFound) {
+		app.Logger.Error("failed to clear lockout", "error", err, "location", location)
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return false
+	}
+	return true
+}
+
+func respondLockedOut(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	httputils.RespondWithJsonError(w, "too many failed login attempts - try again later", http.StatusTooManyRequests)
+}
+
+// clientIP returns the address r was sent from. Behind a reverse proxy this is the proxy's address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type FetchLockoutsResponse struct {
+	Lockouts []db.Lockout `json:"lockouts"`
+}
+
+// AdminFetchLockoutsHandler lists the usernames and IP addresses with recent failed logins, and whether they
+// are locked out
+func (app *App) AdminFetchLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := app.LockoutService.ListLockouts(r.Context())
+	if err != nil {
+		app.Logger.Error("failed to list lockouts", "error", err, "location", "AdminFetchLockoutsHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	httputils.RespondWithJson(w, FetchLockoutsResponse{Lockouts: lockouts}, 200)
+}
+
+// AdminClearLockoutHandler forgets the failed logins of a username or IP address, lifting any lockout
+func (app *App) AdminClearLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+
+	err := app.LockoutService.ClearLockout(r.Context(), key)
+	if err != nil {
+		app.Logger.Error("failed to clear lockout", "error", err, "location", "AdminClearLockoutHandler")
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: %s has no failed logins", key), 404)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	app.Logger.Info("cleared lockout", "key", key)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+)
+
+// newLockoutTestServer returns a server locking out usernames after 3 failed logins and IP addresses after 5
+func newLockoutTestServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	return newTestServer(t, func(app *App) {
+		policy := db.LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, ResetAfter: 24 * time.Hour}
+		app.LockoutService = db.NewInMemoryLockoutService()
+		app.UsernameLockouts = policy
+		app.IPLockouts = policy
+		app.IPLockouts.Threshold = 5
+	})
+}
+
+// logIn attempts a login from the given IP address
+func logIn(h http.Handler, ip, username, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/v1/login", nil)
+	req.RemoteAddr = ip + ":1234"
+	req.SetBasicAuth(username, password)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestLoginLockout(t *testing.T) {
+	h := newLockoutTestServer(t)
+
+	for i := range 2 {
+		if rr := logIn(h, "192.0.2.10", "kishiguro", "wrong password"); rr.Result().StatusCode != 401 {
+			t.Fatalf("got %d for failed login %d, want %d", rr.Result().StatusCode, i+1, 401)
+		}
+	}
+
+	// the third failure locks the username out
+	rr := logIn(h, "192.0.2.10", "kishiguro", "wrong password")
+	if rr.Result().StatusCode != 429 {
+		t.Fatalf("got %d for the failure reaching the threshold, want %d", rr.Result().StatusCode, 429)
+	}
+	if got := rr.Result().Header.Get("Retry-After"); got != "60" {
+		t.Errorf("got Retry-After %q, want %q", got, "60")
+	}
+
+	// even the right password is refused, from any address
+	rr = logIn(h, "198.51.100.1", "kishiguro", "a long password")
+	if rr.Result().StatusCode != 429 {
+		t.Fatalf("got %d logging in while locked out, want %d", rr.Result().StatusCode, 429)
+	}
+	if rr.Result().Header.Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+
+	// other users can still log in
+	if rr := logIn(h, "198.51.100.1", "dsedaris", "a long password"); rr.Result().StatusCode != 200 {
+		t.Errorf("got %d logging in as another user, want %d", rr.Result().StatusCode, 200)
+	}
+}
+
+func TestLoginLockoutByIP(t *testing.T) {
+	h := newLockoutTestServer(t)
+
+	// guessing across usernames still counts against the address
+	for i, username := range []string{"kishiguro", "dsedaris", "admin", "nobody"} {
+		if rr := logIn(h, "192.0.2.10", username, "wrong password"); rr.Result().StatusCode != 401 {
+			t.Fatalf("got %d for failed login %d, want %d", rr.Result().StatusCode, i+1, 401)
+		}
+	}
+	if rr := logIn(h, "192.0.2.10", "someone", "wrong password"); rr.Result().StatusCode != 429 {
+		t.Fatalf("got %d for the failure reaching the threshold, want %d", rr.Result().StatusCode, 429)
+	}
+
+	if rr := logIn(h, "192.0.2.10", "kishiguro", "a long password"); rr.Result().StatusCode != 429 {
+		t.Errorf("got %d logging in from the locked out address, want %d", rr.Result().StatusCode, 429)
+	}
+	if rr := logIn(h, "198.51.100.1", "kishiguro", "a long password"); rr.Result().StatusCode != 200 {
+		t.Errorf("got %d logging in from another address, want %d", rr.Result().StatusCode, 200)
+	}
+}
+
+func TestLoginSuccessResetsUsernameFailures(t *testing.T) {
+	h := newLockoutTestServer(t)
+
+	for _, password := range []string{"wrong password", "wrong password", "a long password", "wrong password", "wrong password"} {
+		want := 401
+		if password == "a long password" {
+			want = 200
+		}
+		if rr := logIn(h, "192.0.2.10", "kishiguro", password); rr.Result().StatusCode != want {
+			t.Fatalf("got %d, want %d", rr.Result().StatusCode, want)
+		}
+	}
+}
+
+func TestAdminLockouts(t *testing.T) {
+	h := newLockoutTestServer(t)
+	admin := mustLogIn(t, h, "admin")
+	author := mustLogIn(t, h, "dsedaris")
+
+	for range 3 {
+		logIn(h, "192.0.2.10", "kishiguro", "wrong password")
+	}
+
+	if rr := serve(h, "GET", "/api/v1/admin/lockouts", author.Token, ""); rr.Result().StatusCode != 403 {
+		t.Errorf("got %d listing lockouts as an author, want %d", rr.Result().StatusCode, 403)
+	}
+
+	rr := serve(h, "GET", "/api/v1/admin/lockouts", admin.Token, "")
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d listing lockouts, want %d", rr.Result().StatusCode, 200)
+	}
+	var resp FetchLockoutsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	lockouts := map[string]db.Lockout{}
+	for _, lockout := range resp.Lockouts {
+		lockouts[lockout.Key] = lockout
+	}
+	if lockout, ok := lockouts["username:kishiguro"]; !ok || lockout.Failures != 3 || lockout.LockedUntilTS == nil {
+		t.Errorf("got %+v, want kishiguro locked out after 3 failures", resp.Lockouts)
+	}
+	if lockout, ok := lockouts["ip:192.0.2.10"]; !ok || lockout.Failures != 3 || lockout.LockedUntilTS != nil {
+		t.Errorf("got %+v, want the address counted but not locked out", resp.Lockouts)
+	}
+
+	if rr := serve(h, "DELETE", "/api/v1/admin/lockouts/username:kishiguro", admin.Token, ""); rr.Result().StatusCode != 204 {
+		t.Fatalf("got %d clearing the lockout, want %d", rr.Result().StatusCode, 204)
+	}
+	if rr := logIn(h, "192.0.2.10", "kishiguro", "a long password"); rr.Result().StatusCode != 200 {
+		t.Errorf("got %d logging in after the lockout was cleared, want %d", rr.Result().StatusCode, 200)
+	}
+
+	if rr := serve(h, "DELETE", "/api/v1/admin/lockouts/username:kishiguro", admin.Token, ""); rr.Result().StatusCode != 404 {
+		t.Errorf("got %d clearing a lockout that does not exist, want %d", rr.Result().StatusCode, 404)
+	}
+}
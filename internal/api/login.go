@@ -1,43 +1,118 @@
 package api
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/James-D-Wood/blog-api/internal/db"
 	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
 )
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	// Token and RefreshToken are set as cookies instead when cookie sessions are enabled
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// ExpiresIn is the number of seconds until Token expires
+	ExpiresIn int `json:"expires_in"`
+	// CSRFToken is sent back in the X-CSRF-Token header of state-changing requests when cookie sessions are enabled
+	CSRFToken string `json:"csrf_token,omitempty"`
 }
 
 func (app *App) LoginHandler(w http.ResponseWriter, r *http.Request) {
-	user, pass, err := httputils.DecodeBasicAuth(r)
+	username, pass, err := httputils.DecodeBasicAuth(r)
 	if err != nil {
 		app.Logger.Error("failed to decode basic auth", "error", err, "location", "LoginHandler")
 		httputils.RespondWithJsonError(w, "malformatted auth header", 401)
 		return
 	}
 
-	// fake login based on mock user list
-	token, err := app.UserService.AuthenticateUser(user, pass)
+	var lockouts []loginLockout
+	if app.LockoutService != nil {
+		lockouts = app.loginLockouts(r, username)
+		if !app.checkLoginLockouts(w, r, "LoginHandler", lockouts) {
+			return
+		}
+	}
+
+	user, err := app.UserService.AuthenticateUser(username, pass)
 	if err != nil {
-		// return
 		app.Logger.Error("failed to authenticate user", "error", err, "location", "LoginHandler")
-		httputils.RespondWithJsonError(w, "user does not exist or wrong password provided", 401)
+		if errors.Is(err, db.ErrInvalidCredentials) {
+			if app.LockoutService != nil && app.recordLoginFailure(w, r, "LoginHandler", lockouts) {
+				return
+			}
+			// don't reveal whether the user exists
+			httputils.RespondWithJsonError(w, "invalid username or password", 401)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
 		return
 	}
 
-	resp := LoginResponse{
-		Token: token,
+	if !app.checkSecondFactor(w, r, "LoginHandler", user) {
+		return
 	}
 
-	b, err := json.Marshal(resp)
+	if app.LockoutService != nil && !app.clearLoginLockout(w, r, "LoginHandler", lockouts) {
+		return
+	}
+
+	app.startSession(w, r, "LoginHandler", user)
+}
+
+// startSession logs user in, responding with an access token and the first refresh token of a new family
+func (app *App) startSession(w http.ResponseWriter, r *http.Request, location string, user *model.User) {
+	if !app.checkNotSuspended(w, location, user) {
+		return
+	}
+
+	refreshToken, stored, err := db.NewRefreshToken(user.ID, app.RefreshTokenTTL)
 	if err != nil {
-		httputils.RespondWithJsonError(w, "internal error processing request", 500)
+		app.Logger.Error("failed to generate refresh token", "error", err, "location", location)
+		httputils.RespondWithJsonError(w, "internal service error", 500)
 		return
 	}
+	err = app.RefreshTokenService.CreateRefreshToken(r.Context(), &stored)
+	if err != nil {
+		app.Logger.Error("failed to persist refresh token", "error", err, "location", location)
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	app.respondWithTokens(w, location, user, refreshToken, stored.FamilyID)
+}
+
+// checkNotSuspended responds with 403 and returns false if user is suspended. It is called before any refresh
+// token is issued or rotated, so that suspended users are never left holding one.
+func (app *App) checkNotSuspended(w http.ResponseWriter, location string, user *model.User) bool {
+	if user.Suspended {
+		app.Logger.Error("suspended user attempted to log in", "userID", user.ID, "location", location)
+		httputils.RespondWithJsonError(w, "your account has been suspended", 403)
+		return false
+	}
+	return true
+}
+
+// respondWithTokens responds with a new access token for user alongside the refresh token from the given family,
+// or sets them as cookies when cookie sessions are enabled. Callers check that user is not suspended first.
+func (app *App) respondWithTokens(w http.ResponseWriter, location string, user *model.User, refreshToken, familyID string) {
+	token, err := httputils.GenerateJWT(user, familyID)
+	if err != nil {
+		app.Logger.Error("failed to generate JWT", "error", err, "location", location)
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	resp := LoginResponse{ExpiresIn: int(httputils.AccessTokens.TTL.Seconds())}
+	if app.SessionCookies != nil {
+		// scripts cannot read the tokens, so an XSS hole cannot leak them
+		resp.CSRFToken = app.setSessionCookies(w, token, refreshToken, familyID)
+	} else {
+		resp.Token, resp.RefreshToken = token, refreshToken
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(b)
+	// tokens must not end up in a shared cache
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.RespondWithJson(w, resp, 200)
 }
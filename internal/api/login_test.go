@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+var loginTestCases = []struct {
+	Name         string
+	Username     string
+	Password     string
+	NoAuth       bool
+	ResponseCode int
+}{
+	{
+		Name:         "Happy Path",
+		Username:     "kishiguro",
+		Password:     "hailsham",
+		ResponseCode: 200,
+	},
+	{
+		Name:         "Wrong Password",
+		Username:     "kishiguro",
+		Password:     "password",
+		ResponseCode: 401,
+	},
+	{
+		Name:         "Unknown User",
+		Username:     "nobody",
+		Password:     "hailsham",
+		ResponseCode: 401,
+	},
+	{
+		Name:         "Missing Auth Header",
+		NoAuth:       true,
+		ResponseCode: 401,
+	},
+}
+
+func TestLoginHandler(t *testing.T) {
+	hash, err := db.HashPassword("hailsham")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range loginTestCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			app := App{
+				Logger: slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				UserService: &db.InMemoryUserService{
+					Users: map[string]*model.User{
+						"kishiguro": {ID: "0197aaed-4a35-74da-8574-4165524a1111", Username: "kishiguro", PasswordHash: hash},
+					},
+				},
+				RefreshTokenService: db.NewInMemoryRefreshTokenService(),
+				RefreshTokenTTL:     time.Hour,
+			}
+
+			req := httptest.NewRequest("POST", "/api/v1/login", nil)
+			if !tt.NoAuth {
+				req.SetBasicAuth(tt.Username, tt.Password)
+			}
+			rr := httptest.NewRecorder()
+
+			app.LoginHandler(rr, req)
+			if rr.Result().StatusCode != tt.ResponseCode {
+				t.Fatalf("got %d, want %d", rr.Result().StatusCode, tt.ResponseCode)
+			}
+			if tt.ResponseCode != 200 {
+				return
+			}
+
+			var resp LoginResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Token == "" || resp.RefreshToken == "" || resp.ExpiresIn <= 0 {
+				t.Errorf("got %+v, want an access token, a refresh token and its lifetime", resp)
+			}
+
+			var claims httputils.AuthClaims
+			if err := httputils.ExtractJWTClaims(resp.Token, &claims); err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID != "0197aaed-4a35-74da-8574-4165524a1111" {
+				t.Errorf("got user ID %q, want %q", claims.UserID, "0197aaed-4a35-74da-8574-4165524a1111")
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/James-D-Wood/blog-api/internal/auth"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+)
+
+// LogoutHandler revokes the access token the request was made with, along with the refresh tokens issued alongside it
+func (app *App) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		app.Logger.Error("failed to identify user", "location", "LogoutHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	if principal.Method == auth.MethodAPIToken {
+		app.Logger.Error("attempted to log out with an API token", "location", "LogoutHandler")
+		httputils.RespondWithJsonError(w, "API tokens cannot log out - delete the token instead", 400)
+		return
+	}
+
+	err := app.TokenRevocationService.RevokeToken(r.Context(), principal.TokenID, principal.ExpiresAt)
+	if err != nil {
+		app.Logger.Error("failed to revoke access token", "error", err, "location", "LogoutHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	if principal.SessionID != "" {
+		err = app.RefreshTokenService.RevokeRefreshTokenFamily(r.Context(), principal.SessionID)
+		if err != nil {
+			app.Logger.Error("failed to revoke refresh tokens", "error", err, "location", "LogoutHandler")
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+			return
+		}
+	}
+
+	if principal.Method == auth.MethodSessionCookie {
+		app.clearSessionCookies(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// assertSession checks whether the access and refresh tokens of a login can still be used
+func assertSession(t *testing.T, h http.Handler, login LoginResponse, wantValid bool) {
+	t.Helper()
+
+	wantCode := 401
+	if wantValid {
+		wantCode = 200
+	}
+
+	if rr := serve(h, "GET", "/api/v1/me/posts", login.Token, ""); rr.Result().StatusCode != wantCode {
+		t.Errorf("got %d using the access token, want %d", rr.Result().StatusCode, wantCode)
+	}
+	body := fmt.Sprintf(`{"refresh_token": %q}`, login.RefreshToken)
+	if rr := serve(h, "POST", "/api/v1/token/refresh", "", body); rr.Result().StatusCode != wantCode {
+		t.Errorf("got %d using the refresh token, want %d", rr.Result().StatusCode, wantCode)
+	}
+}
+
+func TestLogoutHandler(t *testing.T) {
+	h := newTestServer(t, nil)
+
+	login := mustLogIn(t, h, "kishiguro")
+	other := mustLogIn(t, h, "kishiguro")
+
+	if rr := serve(h, "POST", "/api/v1/logout", login.Token, ""); rr.Result().StatusCode != 204 {
+		t.Fatalf("got %d, want %d", rr.Result().StatusCode, 204)
+	}
+
+	assertSession(t, h, login, false)
+	// logging out of one session leaves the others alone
+	assertSession(t, h, other, true)
+
+	if rr := serve(h, "POST", "/api/v1/logout", "", ""); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d logging out without a token, want %d", rr.Result().StatusCode, 401)
+	}
+}
+
+func TestAdminRevokeUserTokensHandler(t *testing.T) {
+	tests := []struct {
+		Name         string
+		Caller       string
+		UserID       string
+		ResponseCode int
+		Revoked      bool
+	}{
+		{"Happy Path", "admin", "0197aaed-4a35-74da-8574-4165524a1111", 204, true},
+		{"Not An Admin", "kishiguro", "0197aaed-4a35-74da-8574-4165524a1111", 403, false},
+		{"Unknown User", "admin", "efbfa286-ca55-4ded-a28e-9881118186c8", 404, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			h := newTestServer(t, nil)
+
+			sessions := []LoginResponse{mustLogIn(t, h, "kishiguro"), mustLogIn(t, h, "kishiguro")}
+			caller := mustLogIn(t, h, tt.Caller)
+
+			path := fmt.Sprintf("/api/v1/admin/users/%s/revoke-tokens", tt.UserID)
+			if rr := serve(h, "POST", path, caller.Token, ""); rr.Result().StatusCode != tt.ResponseCode {
+				t.Fatalf("got %d, want %d", rr.Result().StatusCode, tt.ResponseCode)
+			}
+
+			for _, session := range sessions {
+				assertSession(t, h, session, !tt.Revoked)
+			}
+		})
+	}
+}
@@ -1,166 +1,111 @@
 package middleware
 
 import (
-	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 
+	"github.com/James-D-Wood/blog-api/internal/auth"
 	"github.com/James-D-Wood/blog-api/internal/constant"
 	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
 )
 
-// AuthProtectedMiddleware verifies the user is valid and passes the auth claims on in the context
-func AuthProtectedMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-		// TODO: this should be more durable
-		logger, _ := r.Context().Value(constant.LoggerKey).(*slog.Logger)
-
-		ctx := r.Context()
-
-		// verify auth token and reject request if user ID cannot be established
-		token, err := httputils.DecodeBearerAuth(r)
-		if err != nil {
-			switch err {
-			case httputils.ErrAuthHeaderMissing:
-				logger.Error("could not authenticate user", "error", err, "location", "AuthProtectedMiddleware")
-				httputils.RespondWithJsonError(w, "could not authenticate user - Authorization header missing", 401)
-				return
-			case httputils.ErrNotBearerAuth:
-				logger.Error("could not authenticate user", "error", err, "location", "AuthProtectedMiddleware")
-				httputils.RespondWithJsonError(w, "could not authenticate user - wrong Authorization header type, use bearer", 401)
-				return
-			default:
-				logger.Error("could not authenticate user", "error", err, "location", "AuthProtectedMiddleware")
-				httputils.RespondWithJsonError(w, "could not authenticate user", 401)
-				return
-			}
-		}
-
-		var claims httputils.AuthClaims
-		err = httputils.ExtractJWTClaims(token, &claims)
-		if err != nil {
-			logger.Error("could not authenticate user", "error", err, "location", "AuthProtectedMiddleware")
-			httputils.RespondWithJsonError(w, "could not authenticate user", 401)
-			return
-		}
-		if claims.UserID == "" {
-			logger.Error("user ID came out empty", "location", "AuthProtectedMiddleware")
-			httputils.RespondWithJsonError(w, "could not authenticate user", 401)
-			return
-		}
-		logger.Debug("claims extracted from auth JWT", "claims", claims)
+// policy decides whether a request may proceed once authenticator has run, responding with an error and
+// returning false if not. principal is nil for anonymous requests.
+type policy func(w http.ResponseWriter, logger *slog.Logger, principal *auth.Principal, location string) bool
 
-		ctx = context.WithValue(ctx, constant.UserIDKey, claims.UserID)
-		ctx = context.WithValue(ctx, constant.AdminKey, claims.IsAdmin)
+// AuthProtectedMiddleware verifies the user is valid and passes their principal on in the context
+func AuthProtectedMiddleware(next http.Handler, authenticator *auth.Authenticator) http.Handler {
+	return authMiddleware(next, authenticator, "AuthProtectedMiddleware", requireUser)
+}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+// AuthOptionalMiddleware tries to ID a user if credentials are provided
+func AuthOptionalMiddleware(next http.Handler, authenticator *auth.Authenticator) http.Handler {
+	return authMiddleware(next, authenticator, "AuthOptionalMiddleware", func(w http.ResponseWriter, logger *slog.Logger, principal *auth.Principal, location string) bool {
+		return true
 	})
 }
 
-// AuthOptionalMiddleware tries to ID a user if an auth token is provided
-func AuthOptionalMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-		// TODO: this should be more durable
-		logger, _ := r.Context().Value(constant.LoggerKey).(*slog.Logger)
-
-		ctx := r.Context()
-
-		// verify if auth token is present
-		token, err := httputils.DecodeBearerAuth(r)
-		if err != nil {
-			switch err {
-			case httputils.ErrAuthHeaderMissing:
-				logger.Debug("auth token not passed", "location", "AuthOptionalMiddleware")
-				// default values
-				ctx = context.WithValue(ctx, constant.UserIDKey, "")
-				ctx = context.WithValue(ctx, constant.AdminKey, false)
-				next.ServeHTTP(w, r.WithContext(ctx))
-				return
-			case httputils.ErrNotBearerAuth:
-				logger.Error("could not authenticate user", "error", err, "location", "AuthProtectedMiddleware")
-				httputils.RespondWithJsonError(w, "could not authenticate user - wrong Authorization header type, use bearer", 401)
-				return
-			default:
-				logger.Error("could not authenticate user", "error", err, "location", "AuthProtectedMiddleware")
-				httputils.RespondWithJsonError(w, "could not authenticate user", 401)
-				return
-			}
+// RequirePermission verifies the user is allowed perm, by both their role and the scopes of their credential,
+// before proceeding
+func RequirePermission(next http.Handler, authenticator *auth.Authenticator, perm model.Permission) http.Handler {
+	return authMiddleware(next, authenticator, "RequirePermission", func(w http.ResponseWriter, logger *slog.Logger, principal *auth.Principal, location string) bool {
+		if !requireUser(w, logger, principal, location) {
+			return false
 		}
 
-		var claims httputils.AuthClaims
-		err = httputils.ExtractJWTClaims(token, &claims)
-		if err != nil {
-			logger.Error("token passed but could not authenticate user", "error", err, "location", "AuthOptionalMiddleware")
-			httputils.RespondWithJsonError(w, "could not authenticate user", 401)
-			return
+		if !principal.Role.Can(perm) {
+			logger.Error("user's role does not grant the required permission", "role", principal.Role, "permission", perm, "location", location)
+			httputils.RespondWithJsonError(w, "user is not authorized to perform this action", 403)
+			return false
 		}
-		if claims.UserID == "" {
-			logger.Error("token passed but user ID came out empty", "location", "AuthOptionalMiddleware")
-			httputils.RespondWithJsonError(w, "could not authenticate user", 401)
-			return
+		if !principal.HasScope(perm) {
+			logger.Error("API token does not have the required scope", "scopes", principal.Scopes, "permission", perm, "location", location)
+			httputils.RespondWithJsonError(w, "API token is missing the "+string(perm)+" scope", 403)
+			return false
 		}
-		logger.Debug("claims extracted from auth JWT", "claims", claims)
-
-		ctx = context.WithValue(ctx, constant.UserIDKey, claims.UserID)
-		ctx = context.WithValue(ctx, constant.AdminKey, claims.IsAdmin)
-
-		next.ServeHTTP(w, r.WithContext(ctx))
+		return true
 	})
 }
 
-// AdminOnlyMiddleware verifies the user is an admin before proceeding
-func AdminOnlyMiddleware(next http.Handler) http.Handler {
+func requireUser(w http.ResponseWriter, logger *slog.Logger, principal *auth.Principal, location string) bool {
+	if principal == nil {
+		logger.Error("could not authenticate user", "error", auth.ErrNoCredentials, "location", location)
+		httputils.RespondWithJsonError(w, "could not authenticate user - no credentials provided", 401)
+		return false
+	}
+	return true
+}
+
+// authMiddleware authenticates the request and applies allowed to the result, passing the principal on in the
+// context if it may proceed
+func authMiddleware(next http.Handler, authenticator *auth.Authenticator, location string, allowed policy) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		// TODO: this should be more durable
 		logger, _ := r.Context().Value(constant.LoggerKey).(*slog.Logger)
 
-		ctx := r.Context()
-
-		// verify auth token and reject request if user ID cannot be established
-		token, err := httputils.DecodeBearerAuth(r)
-		if err != nil {
-			switch err {
-			case httputils.ErrAuthHeaderMissing:
-				logger.Error("could not authenticate user", "error", err, "location", "AuthProtectedMiddleware")
-				httputils.RespondWithJsonError(w, "could not authenticate user - Authorization header missing", 401)
-				return
-			case httputils.ErrNotBearerAuth:
-				logger.Error("could not authenticate user", "error", err, "location", "AuthProtectedMiddleware")
-				httputils.RespondWithJsonError(w, "could not authenticate user - wrong Authorization header type, use bearer", 401)
-				return
-			default:
-				logger.Error("could not authenticate user", "error", err, "location", "AuthProtectedMiddleware")
-				httputils.RespondWithJsonError(w, "could not authenticate user", 401)
-				return
-			}
-		}
-
-		var claims httputils.AuthClaims
-		err = httputils.ExtractJWTClaims(token, &claims)
-		if err != nil {
-			logger.Error("could not authenticate user", "error", err, "location", "AdminOnlyMiddleware")
-			httputils.RespondWithJsonError(w, "could not authenticate user", 401)
+		principal, err := authenticator.Authenticate(r)
+		switch {
+		case err == nil:
+			logger.Debug("authenticated user", "userID", principal.UserID, "method", principal.Method, "location", location)
+		case errors.Is(err, auth.ErrNoCredentials):
+			logger.Debug("no credentials passed", "location", location)
+		case errors.Is(err, auth.ErrTokenRevoked):
+			logger.Error("could not authenticate user", "error", err, "location", location)
+			httputils.RespondWithJsonError(w, "could not authenticate user - token has been revoked", 401)
 			return
-		}
-		if claims.UserID == "" {
-			logger.Error("user ID came out empty", "location", "AdminOnlyMiddleware")
+		case errors.Is(err, httputils.ErrNotBearerAuth):
+			logger.Error("could not authenticate user", "error", err, "location", location)
+			httputils.RespondWithJsonError(w, "could not authenticate user - wrong Authorization header type, use bearer", 401)
+			return
+		case errors.Is(err, auth.ErrUserSuspended):
+			logger.Error("could not authenticate user", "error", err, "location", location)
+			httputils.RespondWithJsonError(w, "your account has been suspended", 403)
+			return
+		case errors.Is(err, httputils.ErrCSRFTokenInvalid):
+			logger.Error("rejected session cookie", "error", err, "location", location)
+			httputils.RespondWithJsonError(w, "missing or invalid CSRF token - send the "+httputils.CSRFCookie+" cookie in the "+httputils.CSRFHeader+" header", 403)
+			return
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			logger.Error("could not authenticate user", "error", err, "location", location)
 			httputils.RespondWithJsonError(w, "could not authenticate user", 401)
 			return
+		default:
+			logger.Error("failed to authenticate user", "error", err, "location", location)
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+			return
 		}
-		logger.Debug("claims extracted from auth JWT", "claims", claims)
 
-		if !claims.IsAdmin {
-			logger.Error("user attempting to access admin-only endpoint is not an admin", "location", "AdminOnlyMiddleware")
-			httputils.RespondWithJsonError(w, "user is not authorized to perform this action", 403)
+		if !allowed(w, logger, principal, location) {
 			return
 		}
 
-		ctx = context.WithValue(ctx, constant.UserIDKey, claims.UserID)
-		ctx = context.WithValue(ctx, constant.AdminKey, claims.IsAdmin)
-
+		ctx := r.Context()
+		if principal != nil {
+			ctx = auth.NewContext(ctx, principal)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
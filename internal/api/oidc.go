@@ -0,0 +1,151 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
+	"github.com/James-D-Wood/blog-api/internal/oidc"
+)
+
+const (
+	// oidcFlowCookie holds the state, nonce and PKCE verifier of a login in progress, tying the callback to the
+	// browser that started it
+	oidcFlowCookie = "oidc_flow"
+	oidcFlowMaxAge = 600
+	oidcCookiePath = "/api/v1/oidc"
+)
+
+// OIDCLoginHandler sends the user to the identity provider to log in
+func (app *App) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var values [3]string
+	for i := range values {
+		value, err := randomValue()
+		if err != nil {
+			app.Logger.Error("failed to generate OIDC flow values", "error", err, "location", "OIDCLoginHandler")
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	http.SetCookie(w, app.oidcFlowCookie(strings.Join(values[:], "."), oidcFlowMaxAge))
+	http.Redirect(w, r, app.OIDCProvider.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+// OIDCCallbackHandler completes a login at the identity provider, creating a user the first time an identity
+// logs in, and responds with our own tokens - or a two-factor challenge, like LoginHandler
+func (app *App) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	// the flow values can only be used once, whatever the outcome
+	http.SetCookie(w, app.oidcFlowCookie("", -1))
+
+	q := r.URL.Query()
+	if errCode := q.Get("error"); errCode != "" {
+		app.Logger.Error("identity provider returned an error", "error", errCode, "description", q.Get("error_description"), "location", "OIDCCallbackHandler")
+		httputils.RespondWithJsonError(w, "login was not completed", 401)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		app.Logger.Error("missing OIDC flow cookie", "error", err, "location", "OIDCCallbackHandler")
+		httputils.RespondWithJsonError(w, "login expired - please try again", 401)
+		return
+	}
+	values := strings.Split(cookie.Value, ".")
+	if len(values) != 3 || subtle.ConstantTimeCompare([]byte(values[0]), []byte(q.Get("state"))) != 1 {
+		app.Logger.Error("OIDC state mismatch", "location", "OIDCCallbackHandler")
+		httputils.RespondWithJsonError(w, "login expired - please try again", 401)
+		return
+	}
+	nonce, verifier := values[1], values[2]
+
+	identity, err := app.OIDCProvider.Exchange(r.Context(), q.Get("code"), nonce, verifier)
+	if err != nil {
+		app.Logger.Error("failed to complete OIDC login", "error", err, "location", "OIDCCallbackHandler")
+		httputils.RespondWithJsonError(w, "login could not be verified", 401)
+		return
+	}
+
+	user, err := app.externalUser(r, identity)
+	if err != nil {
+		app.Logger.Error("failed to provision user", "error", err, "location", "OIDCCallbackHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	// a second factor the user turned on applies whichever way they log in
+	if !app.checkSecondFactor(w, r, "OIDCCallbackHandler", user) {
+		return
+	}
+
+	app.startSession(w, r, "OIDCCallbackHandler", user)
+}
+
+// externalUser returns the user linked to identity, creating one on its first login
+func (app *App) externalUser(r *http.Request, identity oidc.Identity) (*model.User, error) {
+	user, err := app.UserService.FetchUserByIdentity(r.Context(), identity.Issuer, identity.Subject)
+	if err == nil || !errors.Is(err, db.ErrEntityNotFound) {
+		return user, err
+	}
+
+	for _, username := range oidc.UsernameCandidates(identity) {
+		name := strings.TrimSpace(identity.Name)
+		if name == "" {
+			name = username
+		}
+		for utf8.RuneCountInString(name) > 64 {
+			_, size := utf8.DecodeLastRuneInString(name)
+			name = name[:len(name)-size]
+		}
+
+		user, err := db.NewExternalUser(username, name)
+		if err != nil {
+			return nil, err
+		}
+
+		err = app.UserService.CreateExternalUser(r.Context(), user, identity.Issuer, identity.Subject)
+		switch {
+		case err == nil:
+			app.Logger.Info("provisioned user", "id", user.ID, "username", user.Username, "issuer", identity.Issuer)
+			return user, nil
+		case errors.Is(err, db.ErrIdentityAlreadyLinked):
+			// a concurrent login of the same identity got there first
+			return app.UserService.FetchUserByIdentity(r.Context(), identity.Issuer, identity.Subject)
+		case !errors.Is(err, db.ErrUserAlreadyExists):
+			return nil, err
+		}
+	}
+	return nil, errors.New("no free username for identity")
+}
+
+func (app *App) oidcFlowCookie(value string, maxAge int) *http.Cookie {
+	redirect, _ := url.Parse(app.OIDCProvider.RedirectURL())
+	return &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   redirect != nil && redirect.Scheme == "https",
+		// Lax so the cookie is sent on the provider's top level redirect back to the callback
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func randomValue() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
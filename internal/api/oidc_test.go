@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
+	"github.com/James-D-Wood/blog-api/internal/oidc"
+	"github.com/James-D-Wood/blog-api/internal/oidc/oidctest"
+	"github.com/James-D-Wood/blog-api/internal/totp"
+)
+
+func newOIDCTestServer(t *testing.T, provider *oidctest.Provider, users db.UserService) http.Handler {
+	t.Helper()
+
+	relyingParty, err := oidc.NewProvider(context.Background(), provider.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestServer(t, func(app *App) {
+		app.UserService = users
+		app.TwoFactorService = db.NewInMemoryTwoFactorService()
+		app.OIDCProvider = relyingParty
+	})
+}
+
+// startOIDCLogin starts a login, returning the flow cookie and the callback the provider redirects back to
+func startOIDCLogin(t *testing.T, h http.Handler, provider *oidctest.Provider) (*http.Cookie, *url.URL) {
+	t.Helper()
+
+	rr := serve(h, "GET", "/api/v1/oidc/login", "", "")
+	if rr.Result().StatusCode != http.StatusFound {
+		t.Fatalf("got %d starting login, want %d", rr.Result().StatusCode, http.StatusFound)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcFlowCookie || !cookies[0].HttpOnly {
+		t.Fatalf("expected an HttpOnly %s cookie, got %v", oidcFlowCookie, cookies)
+	}
+	return cookies[0], provider.Authorize(t, rr.Result().Header.Get("Location"))
+}
+
+func finishOIDCLogin(h http.Handler, cookie *http.Cookie, callback *url.URL) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/api/v1/oidc/callback?"+callback.RawQuery, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// mustOIDCLogIn logs in through the provider, returning the user the access token was issued for
+func mustOIDCLogIn(t *testing.T, h http.Handler, provider *oidctest.Provider, users db.UserService) *model.User {
+	t.Helper()
+
+	cookie, callback := startOIDCLogin(t, h, provider)
+	rr := finishOIDCLogin(h, cookie, callback)
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d completing login, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+
+	var resp LoginResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.RefreshToken == "" {
+		t.Error("expected a refresh token")
+	}
+	var claims httputils.AuthClaims
+	if err := httputils.ExtractJWTClaims(resp.Token, &claims); err != nil {
+		t.Fatal(err)
+	}
+	user, err := users.FetchUserByID(context.Background(), claims.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := oidctest.NewProvider(t)
+	users := &db.InMemoryUserService{}
+	h := newOIDCTestServer(t, provider, users)
+
+	provider.LogInAs(oidctest.User{Subject: "248289761001", PreferredUsername: "Jane.Doe@example.com", Name: "Jane Doe"})
+	first := mustOIDCLogIn(t, h, provider, users)
+	if first.Username != "jane.doe" {
+		t.Errorf("got username %q, want %q", first.Username, "jane.doe")
+	}
+
+	if first.Name != "Jane Doe" || first.PasswordHash != "" {
+		t.Errorf("unexpected provisioned user %+v", first)
+	}
+	if _, err := users.AuthenticateUser(first.Username, ""); err == nil {
+		t.Error("provisioned user could log in without a password")
+	}
+
+	// logging in again reuses the user, even when the provider's username changes
+	provider.LogInAs(oidctest.User{Subject: "248289761001", PreferredUsername: "jdoe", Name: "Jane Doe"})
+	second := mustOIDCLogIn(t, h, provider, users)
+	if second.ID != first.ID || second.Username != "jane.doe" {
+		t.Errorf("got user %s (%s), want the provisioned user %s (%s)", second.ID, second.Username, first.ID, first.Username)
+	}
+}
+
+func TestOIDCLoginTwoFactor(t *testing.T) {
+	provider := oidctest.NewProvider(t)
+	users := &db.InMemoryUserService{}
+	h := newOIDCTestServer(t, provider, users)
+	provider.LogInAs(oidctest.User{Subject: "248289761001", PreferredUsername: "jdoe", Name: "Jane Doe"})
+
+	cookie, callback := startOIDCLogin(t, h, provider)
+	var login LoginResponse
+	if err := json.NewDecoder(finishOIDCLogin(h, cookie, callback).Body).Decode(&login); err != nil {
+		t.Fatal(err)
+	}
+	secret, _, step := mustEnableTwoFactor(t, h, login.Token)
+
+	// once the user turns on a second factor, the provider's login alone is not enough
+	cookie, callback = startOIDCLogin(t, h, provider)
+	rr := finishOIDCLogin(h, cookie, callback)
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d completing login, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+	var challenge TwoFactorChallengeResponse
+	if err := json.NewDecoder(rr.Body).Decode(&challenge); err != nil {
+		t.Fatal(err)
+	}
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("got %+v, want a challenge", challenge)
+	}
+
+	code, err := totp.Code(secret, step+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = loginTwoFactor(h, challenge.ChallengeToken, "code", code)
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d with the code, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&login); err != nil || login.Token == "" {
+		t.Errorf("got %+v, want tokens", login)
+	}
+}
+
+func TestOIDCLoginUsernameTaken(t *testing.T) {
+	provider := oidctest.NewProvider(t)
+	users := &db.InMemoryUserService{
+		Users: map[string]*model.User{
+			"kishiguro": {ID: "0197aaed-4a35-74da-8574-4165524a1111", Username: "kishiguro", Name: "Kazuo Ishiguro"},
+		},
+	}
+	h := newOIDCTestServer(t, provider, users)
+
+	identity := oidc.Identity{Issuer: provider.URL, Subject: "someone-else", Username: "kishiguro"}
+	provider.LogInAs(oidctest.User{Subject: identity.Subject, PreferredUsername: identity.Username})
+	user := mustOIDCLogIn(t, h, provider, users)
+
+	if user.ID == "0197aaed-4a35-74da-8574-4165524a1111" {
+		t.Fatal("external identity was logged in as the local user with the same username")
+	}
+	if want := oidc.UsernameCandidates(identity)[1]; user.Username != want {
+		t.Errorf("got username %q, want %q", user.Username, want)
+	}
+}
+
+func TestOIDCCallbackRejected(t *testing.T) {
+	tt := []struct {
+		name   string
+		modify func(provider *oidctest.Provider, cookie **http.Cookie, callback *url.URL)
+	}{
+		{
+			name: "State Mismatch",
+			modify: func(provider *oidctest.Provider, cookie **http.Cookie, callback *url.URL) {
+				q := callback.Query()
+				q.Set("state", "forged")
+				callback.RawQuery = q.Encode()
+			},
+		},
+		{
+			name: "Missing Flow Cookie",
+			modify: func(provider *oidctest.Provider, cookie **http.Cookie, callback *url.URL) {
+				*cookie = nil
+			},
+		},
+		{
+			name: "Provider Error",
+			modify: func(provider *oidctest.Provider, cookie **http.Cookie, callback *url.URL) {
+				q := callback.Query()
+				q.Del("code")
+				q.Set("error", "access_denied")
+				callback.RawQuery = q.Encode()
+			},
+		},
+		{
+			name: "Unknown Code",
+			modify: func(provider *oidctest.Provider, cookie **http.Cookie, callback *url.URL) {
+				q := callback.Query()
+				q.Set("code", "forged")
+				callback.RawQuery = q.Encode()
+			},
+		},
+		{
+			name: "Nonce Mismatch",
+			modify: func(provider *oidctest.Provider, cookie **http.Cookie, callback *url.URL) {
+				provider.OverrideNonce("replayed")
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := oidctest.NewProvider(t)
+			users := &db.InMemoryUserService{}
+			h := newOIDCTestServer(t, provider, users)
+			provider.LogInAs(oidctest.User{Subject: "248289761001", PreferredUsername: "jdoe"})
+
+			cookie, callback := startOIDCLogin(t, h, provider)
+			tc.modify(provider, &cookie, callback)
+
+			rr := finishOIDCLogin(h, cookie, callback)
+			if rr.Result().StatusCode != 401 {
+				t.Errorf("got %d, want %d", rr.Result().StatusCode, 401)
+			}
+			if _, err := users.FetchUserByIdentity(context.Background(), provider.URL, "248289761001"); err == nil {
+				t.Error("expected no user to be provisioned")
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackReplay(t *testing.T) {
+	provider := oidctest.NewProvider(t)
+	users := &db.InMemoryUserService{}
+	h := newOIDCTestServer(t, provider, users)
+	provider.LogInAs(oidctest.User{Subject: "248289761001", PreferredUsername: "jdoe"})
+
+	cookie, callback := startOIDCLogin(t, h, provider)
+	if rr := finishOIDCLogin(h, cookie, callback); rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d, want %d", rr.Result().StatusCode, 200)
+	}
+	if rr := finishOIDCLogin(h, cookie, callback); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d replaying the callback, want %d", rr.Result().StatusCode, 401)
+	}
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/mail"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	// Token is the password reset token emailed to the user
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ForgotPasswordHandler emails a password reset token to the user with the given email address. It responds the
+// same whether or not there is one, so that it cannot be used to discover which addresses have accounts. The
+// address is looked up and mailed in the background, so that neither how long the response takes nor a failure
+// to send gives it away either.
+func (app *App) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.Logger.Error("failed to read forgot password payload", "error", err, "location", "ForgotPasswordHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+
+	email, err := db.NormalizeEmail(req.Email)
+	if err != nil {
+		app.Logger.Error("invalid email address", "error", err, "location", "ForgotPasswordHandler")
+		httputils.RespondWithJsonError(w, err.Error(), 400)
+		return
+	}
+
+	app.goBackground(r, func(ctx context.Context) {
+		app.sendPasswordResetEmail(ctx, email)
+	})
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordResetEmail emails a password reset token to the user with the given email address, if there is one,
+// logging rather than returning failures as nobody is waiting on the outcome
+func (app *App) sendPasswordResetEmail(ctx context.Context, email string) {
+	user, err := app.UserService.FetchUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, db.ErrEntityNotFound) {
+			app.Logger.Info("password reset requested for unknown email address", "location", "ForgotPasswordHandler")
+			return
+		}
+		app.Logger.Error("failed to fetch user", "error", err, "location", "ForgotPasswordHandler")
+		return
+	}
+
+	token, err := app.createEmailToken(ctx, user, db.PurposePasswordReset, app.PasswordResetTTL)
+	if err != nil {
+		app.Logger.Error("failed to create password reset token", "error", err, "location", "ForgotPasswordHandler")
+		return
+	}
+
+	err = app.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to reset the password of your account, %s. If it was you, reset it within %s using this token:\n\n%s\n\nIf it was not you, you can ignore this email - your password has not been changed.\n",
+			user.Name, user.Username, formatTTL(app.PasswordResetTTL), token,
+		),
+	})
+	if err != nil {
+		app.Logger.Error("failed to send password reset email", "error", err, "location", "ForgotPasswordHandler")
+		return
+	}
+
+	app.Logger.Info("sent password reset email", "userID", user.ID)
+}
+
+// ResetPasswordHandler sets a new password for the user a password reset token was emailed to, logging them
+// out everywhere
+func (app *App) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.Logger.Error("failed to read reset password payload", "error", err, "location", "ResetPasswordHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+
+	user, token, ok := app.redeemEmailToken(w, r, "ResetPasswordHandler", req.Token, db.PurposePasswordReset)
+	if !ok {
+		return
+	}
+
+	// checked before the token is used up, so that a weak password can be corrected
+	if err := db.ValidatePassword(user.Username, req.Password); err != nil {
+		app.Logger.Error("invalid password", "error", err, "location", "ResetPasswordHandler")
+		httputils.RespondWithJsonError(w, err.Error(), 400)
+		return
+	}
+	hash, err := db.HashPassword(req.Password)
+	if err != nil {
+		app.Logger.Error("failed to hash password", "error", err, "location", "ResetPasswordHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	if !app.consumeEmailToken(w, r, "ResetPasswordHandler", token) {
+		return
+	}
+
+	user.PasswordHash = hash
+	// the token could only be used by someone reading the user's mail
+	user.EmailVerified = true
+	if err := app.UserService.UpdateUser(r.Context(), user); err != nil {
+		app.Logger.Error("failed to update password", "error", err, "location", "ResetPasswordHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	// whoever knew the old password must not stay logged in
+	if !app.revokeSessions(w, r, "ResetPasswordHandler", user.ID) {
+		return
+	}
+	if app.LockoutService != nil && !app.clearLoginLockout(w, r, "ResetPasswordHandler", app.loginLockouts(r, user.Username)) {
+		return
+	}
+
+	app.Logger.Info("reset password", "userID", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createEmailToken stores a new token for purpose, returning the token to email to user
+func (app *App) createEmailToken(ctx context.Context, user *model.User, purpose db.EmailTokenPurpose, ttl time.Duration) (string, error) {
+	token, stored, err := db.NewEmailToken(user.ID, user.Email, purpose, ttl)
+	if err != nil {
+		return "", err
+	}
+	if err := app.EmailTokenService.CreateEmailToken(ctx, &stored); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// redeemEmailToken returns the user a token for purpose was emailed to, along with the stored token, or
+// responds with 400 and returns false if it is invalid. The token is not used up until consumeEmailToken.
+func (app *App) redeemEmailToken(w http.ResponseWriter, r *http.Request, location, token string, purpose db.EmailTokenPurpose) (*model.User, *db.EmailToken, bool) {
+	invalid := fmt.Sprintf("invalid or expired %s token", purposeName(purpose))
+
+	stored, err := app.EmailTokenService.FetchEmailToken(r.Context(), db.HashRefreshToken(token), time.Now())
+	if err != nil {
+		app.Logger.Error("failed to fetch email token", "error", err, "location", location)
+		if errors.Is(err, db.ErrInvalidEmailToken) {
+			httputils.RespondWithJsonError(w, invalid, 400)
+			return nil, nil, false
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return nil, nil, false
+	}
+	if stored.Purpose != purpose {
+		app.Logger.Error("email token used for the wrong purpose", "purpose", stored.Purpose, "location", location)
+		httputils.RespondWithJsonError(w, invalid, 400)
+		return nil, nil, false
+	}
+
+	user, err := app.UserService.FetchUserByID(r.Context(), stored.UserID)
+	if err != nil {
+		app.Logger.Error("failed to fetch user", "error", err, "location", location)
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, invalid, 400)
+			return nil, nil, false
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return nil, nil, false
+	}
+	// a token sent to an address the user no longer has proves nothing
+	if stored.Email != user.Email {
+		app.Logger.Error("email token was sent to a previous email address", "location", location)
+		httputils.RespondWithJsonError(w, invalid, 400)
+		return nil, nil, false
+	}
+	return user, stored, true
+}
+
+// consumeEmailToken uses up a token returned by redeemEmailToken, responding with 400 and returning false if it
+// was used in the meantime
+func (app *App) consumeEmailToken(w http.ResponseWriter, r *http.Request, location string, token *db.EmailToken) bool {
+	err := app.EmailTokenService.ConsumeEmailToken(r.Context(), token.Hash)
+	if err != nil {
+		app.Logger.Error("failed to consume email token", "error", err, "location", location)
+		if errors.Is(err, db.ErrInvalidEmailToken) {
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid or expired %s token", purposeName(token.Purpose)), 400)
+			return false
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return false
+	}
+	return true
+}
+
+// purposeName describes purpose in error messages
+func purposeName(purpose db.EmailTokenPurpose) string {
+	if purpose == db.PurposePasswordReset {
+		return "password reset"
+	}
+	return "email verification"
+}
+
+// formatTTL describes how long an emailed token lasts, ie: 1 hour or 30 minutes
+func formatTTL(ttl time.Duration) string {
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		if ttl == time.Hour {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", ttl/time.Hour)
+	}
+	if ttl == time.Minute {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", ttl/time.Minute)
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/mail"
+)
+
+// newMailTestServer returns a server sending mail to the returned outbox. Each request only returns once the mail
+// it sends in the background has been sent, so the outbox can be checked straight after.
+func newMailTestServer(t *testing.T) (http.Handler, *mail.Outbox) {
+	t.Helper()
+
+	outbox, err := mail.NewOutbox("blog@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newMailerTestServer(t, outbox), outbox
+}
+
+// newMailerTestServer returns a server sending mail with mailer, which waits for mail sent in the background
+func newMailerTestServer(t *testing.T, mailer mail.Mailer) http.Handler {
+	t.Helper()
+
+	var app *App
+	h := newTestServer(t, func(a *App) {
+		app = a
+		app.Mailer = mailer
+		app.EmailTokenService = db.NewInMemoryEmailTokenService()
+		app.PasswordResetTTL = time.Hour
+		app.EmailVerificationTTL = time.Hour
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		app.Wait()
+	})
+}
+
+// failingMailer fails to send every message
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg mail.Message) error {
+	return errors.New("mail server unavailable")
+}
+
+var emailTokenPattern = regexp.MustCompile(`\n\n([A-Za-z0-9_-]{43})\n\n`)
+
+// lastEmailToken returns the token in the last message sent to the given address
+func lastEmailToken(t *testing.T, outbox *mail.Outbox, to string) string {
+	t.Helper()
+
+	messages := outbox.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To != to {
+			continue
+		}
+		match := emailTokenPattern.FindStringSubmatch(messages[i].Body)
+		if match == nil {
+			t.Fatalf("no token in %q", messages[i].Body)
+		}
+		return match[1]
+	}
+	t.Fatalf("no mail sent to %s", to)
+	return ""
+}
+
+func TestPasswordReset(t *testing.T) {
+	h, outbox := newMailTestServer(t)
+	login := mustLogIn(t, h, "kishiguro")
+
+	if rr := serve(h, "POST", "/api/v1/password/forgot", "", `{"email": "Kazuo@Example.com"}`); rr.Result().StatusCode != 202 {
+		t.Fatalf("got %d, want %d", rr.Result().StatusCode, 202)
+	}
+	first := lastEmailToken(t, outbox, "kazuo@example.com")
+
+	// only the latest token sent works
+	serve(h, "POST", "/api/v1/password/forgot", "", `{"email": "kazuo@example.com"}`)
+	token := lastEmailToken(t, outbox, "kazuo@example.com")
+	if rr := serve(h, "POST", "/api/v1/password/reset", "", fmt.Sprintf(`{"token": %q, "password": "never let me go"}`, first)); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d with a replaced token, want %d", rr.Result().StatusCode, 400)
+	}
+
+	// a weak password does not use up the token
+	if rr := serve(h, "POST", "/api/v1/password/reset", "", fmt.Sprintf(`{"token": %q, "password": "short"}`, token)); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d with a weak password, want %d", rr.Result().StatusCode, 400)
+	}
+	if rr := serve(h, "POST", "/api/v1/password/reset", "", fmt.Sprintf(`{"token": %q, "password": "never let me go"}`, token)); rr.Result().StatusCode != 204 {
+		t.Fatalf("got %d resetting, want %d: %s", rr.Result().StatusCode, 204, rr.Body.String())
+	}
+	if rr := serve(h, "POST", "/api/v1/password/reset", "", fmt.Sprintf(`{"token": %q, "password": "the remains of the day"}`, token)); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d reusing the token, want %d", rr.Result().StatusCode, 400)
+	}
+
+	// existing sessions are logged out, and only the new password works
+	assertSession(t, h, login, false)
+	if rr := logIn(h, "192.0.2.10", "kishiguro", "a long password"); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d logging in with the old password, want %d", rr.Result().StatusCode, 401)
+	}
+	if rr := logIn(h, "192.0.2.10", "kishiguro", "never let me go"); rr.Result().StatusCode != 200 {
+		t.Errorf("got %d logging in with the new password, want %d", rr.Result().StatusCode, 200)
+	}
+}
+
+func TestForgotPasswordHandler(t *testing.T) {
+	tests := []struct {
+		Name         string
+		Body         string
+		ResponseCode int
+		Sent         bool
+	}{
+		{"Known Address", `{"email": "kazuo@example.com"}`, 202, true},
+		{"Unknown Address", `{"email": "nobody@example.com"}`, 202, false},
+		{"Invalid Address", `{"email": "Kazuo <kazuo@example.com>"}`, 400, false},
+		{"Invalid Body", `{"email": `, 400, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			h, outbox := newMailTestServer(t)
+
+			if rr := serve(h, "POST", "/api/v1/password/forgot", "", tt.Body); rr.Result().StatusCode != tt.ResponseCode {
+				t.Fatalf("got %d, want %d", rr.Result().StatusCode, tt.ResponseCode)
+			}
+			if sent := len(outbox.Messages()) > 0; sent != tt.Sent {
+				t.Errorf("got mail sent %t, want %t", sent, tt.Sent)
+			}
+		})
+	}
+}
+
+func TestForgotPasswordHandlerSendFailure(t *testing.T) {
+	h := newMailerTestServer(t, failingMailer{})
+
+	// failing to send is not reported, as that would reveal the address has an account
+	if rr := serve(h, "POST", "/api/v1/password/forgot", "", `{"email": "kazuo@example.com"}`); rr.Result().StatusCode != 202 {
+		t.Errorf("got %d, want %d", rr.Result().StatusCode, 202)
+	}
+}
+
+func TestResetPasswordInvalidToken(t *testing.T) {
+	h, outbox := newMailTestServer(t)
+
+	if rr := serve(h, "POST", "/api/v1/password/reset", "", `{"token": "not-a-token", "password": "never let me go"}`); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d with an unknown token, want %d", rr.Result().StatusCode, 400)
+	}
+
+	// tokens only work for what they were sent for
+	serve(h, "POST", "/api/v1/password/forgot", "", `{"email": "kazuo@example.com"}`)
+	token := lastEmailToken(t, outbox, "kazuo@example.com")
+	if rr := serve(h, "POST", "/api/v1/email/verify", "", fmt.Sprintf(`{"token": %q}`, token)); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d verifying with a password reset token, want %d", rr.Result().StatusCode, 400)
+	}
+}
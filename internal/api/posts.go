@@ -1,10 +1,17 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
 
+	"github.com/James-D-Wood/blog-api/internal/auth"
 	"github.com/James-D-Wood/blog-api/internal/db"
 	"github.com/James-D-Wood/blog-api/internal/httputils"
 	"github.com/James-D-Wood/blog-api/internal/model"
@@ -17,74 +24,181 @@ func (app *App) FetchBlogPostHandler(w http.ResponseWriter, r *http.Request) {
 	post, err := app.BlogService.FetchBlogPost(r.Context(), postID)
 	if err != nil {
 		app.Logger.Error("failed to fetch blog post", "error", err, "location", "FetchBlogPostHandler")
-		httputils.RespondWithJsonError(w, "failed to fetch blog post", 404)
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, "failed to fetch blog post", 404)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
 		return
 	}
 
-	userID, err := httputils.GetUserFromContext(r.Context())
+	// the posts of some suspended users are hidden as if they did not exist
+	hidden, err := app.hiddenAuthorIDs(r.Context())
 	if err != nil {
-		app.Logger.Warn("failed to identify user", "error", err, "location", "FetchBlogPostHandler")
+		app.Logger.Error("failed to fetch hidden authors", "error", err, "location", "FetchBlogPostHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	if slices.Contains(hidden, post.AuthorID) {
+		app.Logger.Error("blog post is hidden", "location", "FetchBlogPostHandler")
+		httputils.RespondWithJsonError(w, "failed to fetch blog post", 404)
+		return
 	}
 
-	if post.Status == model.DRAFT {
-		if post.AuthorID != userID {
-			app.Logger.Error("user not authorized to view blog post", "error", err, "location", "FetchBlogPostHandler")
-			httputils.RespondWithJsonError(w, "user not authorized to view this post", 403)
-			return
-		}
+	if post.Status == model.DRAFT && !canReadDrafts(r.Context(), post.AuthorID) {
+		app.Logger.Error("user not authorized to view blog post", "location", "FetchBlogPostHandler")
+		httputils.RespondWithJsonError(w, "user not authorized to view this post", 403)
+		return
 	}
 
 	type Response struct {
 		Post model.BlogPost `json:"post"`
 	}
 
+	w.Header().Set("ETag", httputils.ETag(post.Version))
 	httputils.RespondWithJson(w, Response{
 		Post: post,
 	}, 200)
 }
 
+// canReadDrafts reports whether the user making the request can see the drafts of authorID. Drafts are only
+// visible to their author, and only with a credential allowed to read posts.
+func canReadDrafts(ctx context.Context, authorID string) bool {
+	principal, ok := auth.FromContext(ctx)
+	return ok && principal.UserID == authorID && principal.Can(model.PermReadPosts)
+}
+
 func (app *App) FetchBlogPostsHandler(w http.ResponseWriter, r *http.Request) {
-	posts, err := app.BlogService.FetchPublishedBlogPosts(r.Context())
+	app.respondWithBlogPostPage(w, r, "FetchBlogPostsHandler", func(ctx context.Context, query db.BlogPostQuery) (db.BlogPostPage, error) {
+		hidden, err := app.hiddenAuthorIDs(ctx)
+		if err != nil {
+			return db.BlogPostPage{}, err
+		}
+		query.ExcludeAuthorIDs = hidden
+		return app.BlogService.FetchPublishedBlogPosts(ctx, query)
+	})
+}
+
+// respondWithBlogPostPage responds with the page of posts fetch returns for the request's query parameters
+func (app *App) respondWithBlogPostPage(w http.ResponseWriter, r *http.Request, location string, fetch func(context.Context, db.BlogPostQuery) (db.BlogPostPage, error)) {
+	query, err := parseBlogPostQuery(r)
+	if err != nil {
+		app.Logger.Error("invalid blog post query", "error", err, "location", location)
+		httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: %s", err), 400)
+		return
+	}
+
+	page, err := fetch(r.Context(), query)
 	if err != nil {
-		app.Logger.Error("failed to fetch blogs", "error", err, "location", "FetchBlogPostsHandler")
+		app.Logger.Error("failed to fetch blogs", "error", err, "location", location)
+		if errors.Is(err, db.ErrInvalidCursor) || errors.Is(err, db.ErrInvalidQuery) {
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: %s", err), 400)
+			return
+		}
 		httputils.RespondWithJsonError(w, "failed to fetch blogs", 500)
 		return
 	}
 
 	type Response struct {
-		Posts []model.BlogPost `json:"posts"`
+		Posts      []model.BlogPost `json:"posts"`
+		NextCursor string           `json:"next_cursor,omitempty"`
+		// Next is the URL of the following page
+		Next string `json:"next,omitempty"`
 	}
 
-	httputils.RespondWithJson(w, Response{
-		Posts: posts,
-	}, 200)
+	resp := Response{
+		Posts:      page.Posts,
+		NextCursor: page.NextCursor,
+	}
+	if page.NextCursor != "" {
+		resp.Next = nextPageURL(r, page.NextCursor)
+	}
+
+	httputils.RespondWithJson(w, resp, 200)
+}
+
+// parseBlogPostQuery reads the paging, filtering and sorting parameters of a post listing
+func parseBlogPostQuery(r *http.Request) (db.BlogPostQuery, error) {
+	params := r.URL.Query()
+	query := db.BlogPostQuery{
+		Cursor:   params.Get("cursor"),
+		AuthorID: params.Get("author"),
+		Sort:     db.BlogPostSort(params.Get("sort")),
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return db.BlogPostQuery{}, fmt.Errorf("limit must be a positive integer")
+		}
+		query.Limit = n
+	}
+
+	for param, field := range map[string]*time.Time{
+		"published_after":  &query.PublishedAfter,
+		"published_before": &query.PublishedBefore,
+	} {
+		if v := params.Get(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return db.BlogPostQuery{}, fmt.Errorf("%s must be an RFC3339 timestamp", param)
+			}
+			*field = t
+		}
+	}
+
+	return query, nil
+}
+
+// nextPageURL returns the URL of the current request with its cursor replaced
+func nextPageURL(r *http.Request, cursor string) string {
+	// RequestURI still carries any prefix stripped by the router
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		u = &url.URL{Path: r.URL.Path}
+	}
+
+	params := r.URL.Query()
+	params.Set("cursor", cursor)
+	u.RawQuery = params.Encode()
+	return u.String()
 }
 
 func (app *App) CreateBlogPostHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	var post model.BlogPost
-	err := json.NewDecoder(r.Body).Decode(&post)
-	if err != nil {
-		app.Logger.Error("failed to read blog post payload", "error", err, "location", "CreateBlogPostHandler")
-		httputils.RespondWithJsonError(w, "invalid request body", 400)
+	post, ok := app.readBlogPost(w, r, "CreateBlogPostHandler")
+	if !ok {
 		return
 	}
 
-	userID, err := httputils.GetUserFromContext(r.Context())
-	if err != nil || userID == "" {
-		app.Logger.Error("failed to identify user", "error", err, "location", "CreateBlogPostHandler")
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		app.Logger.Error("failed to identify user", "location", "CreateBlogPostHandler")
 		httputils.RespondWithJsonError(w, "internal service error", 500)
 		return
 	}
+	userID := principal.UserID
+
+	if post.Status == model.PUBLISHED && !app.checkCanPublish(w, r, "CreateBlogPostHandler", userID) {
+		return
+	}
 
-	err = app.BlogService.CreateBlogPost(r.Context(), userID, &post)
+	err := app.BlogService.CreateBlogPost(r.Context(), userID, &post)
 	if err != nil {
-		switch err {
-		case db.ErrBlogPostAlreadyExists:
+		switch {
+		case errors.Is(err, db.ErrBlogPostAlreadyExists):
 			app.Logger.Error("failed to persist blog post", "error", err, "location", "CreateBlogPostHandler")
 			httputils.RespondWithJsonError(w, "cannot create blog post - resource already exists", 400)
 			return
+		case errors.Is(err, db.ErrInvalidStatus):
+			app.Logger.Error("failed to persist blog post", "error", err, "location", "CreateBlogPostHandler")
+			httputils.RespondWithJsonError(w, "cannot create blog post - invalid status", 400)
+			return
+		case errors.Is(err, db.ErrInvalidTags):
+			app.Logger.Error("failed to persist blog post", "error", err, "location", "CreateBlogPostHandler")
+			httputils.RespondWithJsonError(w, fmt.Sprintf("cannot create blog post - %v", err), 400)
+			return
 		default:
 			app.Logger.Error("failed to persist blog post", "error", err, "location", "CreateBlogPostHandler")
 			httputils.RespondWithJsonError(w, "internal service error", 500)
@@ -97,6 +211,7 @@ func (app *App) CreateBlogPostHandler(w http.ResponseWriter, r *http.Request) {
 		Post model.BlogPost `json:"post"`
 	}
 
+	w.Header().Set("ETag", httputils.ETag(post.Version))
 	httputils.RespondWithJson(w, Response{
 		Post: post,
 	}, 201)
@@ -107,11 +222,8 @@ func (app *App) UpdateBlogPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	postID := r.PathValue("id")
 
-	var revisedPost model.BlogPost
-	err := json.NewDecoder(r.Body).Decode(&revisedPost)
-	if err != nil {
-		app.Logger.Error("failed to read blog post payload", "error", err, "location", "UpdateBlogPostHandler")
-		httputils.RespondWithJsonError(w, "invalid request body", 400)
+	revisedPost, ok := app.readBlogPost(w, r, "UpdateBlogPostHandler")
+	if !ok {
 		return
 	}
 
@@ -123,12 +235,7 @@ func (app *App) UpdateBlogPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// validate user owns resource
-	userID, err := httputils.GetUserFromContext(r.Context())
-	if err != nil {
-		app.Logger.Error("failed to identify user", "error", err, "location", "UpdateBlogPostHandler")
-		httputils.RespondWithJsonError(w, "internal service error", 500)
-		return
-	}
+	userID := auth.UserID(r.Context())
 
 	if storedPost.AuthorID != userID {
 		app.Logger.Error("requestor does not own the blog post they are editing", "location", "UpdateBlogPostHandler", "originalAuthor", storedPost.AuthorID, "requestor", userID)
@@ -136,11 +243,30 @@ func (app *App) UpdateBlogPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.BlogService.UpdateBlogPost(r.Context(), &revisedPost, &storedPost)
+	if _, ok := app.checkIfMatch(w, r, storedPost, "UpdateBlogPostHandler"); !ok {
+		return
+	}
+
+	if revisedPost.Status == model.PUBLISHED && storedPost.Status != model.PUBLISHED && !app.checkCanPublish(w, r, "UpdateBlogPostHandler", userID) {
+		return
+	}
+
+	err = app.BlogService.UpdateBlogPost(r.Context(), userID, &revisedPost, &storedPost)
 	if err != nil {
 		// TODO: typed errors for better client responses
 		app.Logger.Error("failed to persist blog post updates", "error", err, "location", "UpdateBlogPostHandler")
-		httputils.RespondWithJsonError(w, "internal service error", 500)
+		switch {
+		case errors.Is(err, db.ErrBlogPostAlreadyExists):
+			httputils.RespondWithJsonError(w, "cannot update blog post - title already in use", 400)
+		case errors.Is(err, db.ErrInvalidStatus):
+			httputils.RespondWithJsonError(w, "cannot update blog post - invalid status", 400)
+		case errors.Is(err, db.ErrInvalidTags):
+			httputils.RespondWithJsonError(w, fmt.Sprintf("cannot update blog post - %v", err), 400)
+		case errors.Is(err, db.ErrVersionConflict):
+			httputils.RespondWithJsonError(w, "blog post has been modified since it was fetched", 412)
+		default:
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+		}
 		return
 	}
 
@@ -148,6 +274,7 @@ func (app *App) UpdateBlogPostHandler(w http.ResponseWriter, r *http.Request) {
 		Post model.BlogPost `json:"post"`
 	}
 
+	w.Header().Set("ETag", httputils.ETag(storedPost.Version))
 	httputils.RespondWithJson(w, Response{
 		Post: storedPost,
 	}, 200)
@@ -164,12 +291,7 @@ func (app *App) DeleteBlogPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// validate user owns resource
-	userID, err := httputils.GetUserFromContext(r.Context())
-	if err != nil {
-		app.Logger.Error("failed to identify user", "error", err, "location", "DeleteBlogPostHandler")
-		httputils.RespondWithJsonError(w, "internal service error", 500)
-		return
-	}
+	userID := auth.UserID(r.Context())
 
 	if storedPost.AuthorID != userID {
 		app.Logger.Error("requestor does not own the blog post they are editing", "location", "DeleteBlogPostHandler", "originalAuthor", storedPost.AuthorID, "requestor", userID)
@@ -177,7 +299,21 @@ func (app *App) DeleteBlogPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.BlogService.DeleteBlogPost(r.Context(), postID)
+	expectedVersion, ok := app.checkIfMatch(w, r, storedPost, "DeleteBlogPostHandler")
+	if !ok {
+		return
+	}
+
+	err = app.BlogService.DeleteBlogPost(r.Context(), userID, postID, expectedVersion)
+	if err != nil {
+		app.Logger.Error("failed to delete blog post", "error", err, "location", "DeleteBlogPostHandler")
+		if errors.Is(err, db.ErrVersionConflict) {
+			httputils.RespondWithJsonError(w, "blog post has been modified since it was fetched", 412)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
 
 	type Response struct {
 		PostID string `json:"post_id"`
@@ -198,7 +334,12 @@ func (app *App) AdminDeleteBlogPostHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	app.BlogService.DeleteBlogPost(r.Context(), postID)
+	err = app.BlogService.DeleteBlogPost(r.Context(), auth.UserID(r.Context()), postID, db.AnyVersion)
+	if err != nil {
+		app.Logger.Error("failed to delete blog post", "error", err, "location", "AdminDeleteBlogPostHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
 
 	type Response struct {
 		PostID string `json:"post_id"`
@@ -208,3 +349,46 @@ func (app *App) AdminDeleteBlogPostHandler(w http.ResponseWriter, r *http.Reques
 		PostID: postID,
 	}, 204)
 }
+
+// checkIfMatch validates the If-Match precondition of a write against the stored post, responding with
+// an error if the write should not proceed. The returned version should be passed on to the BlogService
+// so a concurrent write between the check and the store is still caught.
+func (app *App) checkIfMatch(w http.ResponseWriter, r *http.Request, storedPost model.BlogPost, location string) (expectedVersion int, ok bool) {
+	matches, provided := httputils.MatchesIfMatch(r, httputils.ETag(storedPost.Version))
+	if !provided {
+		if app.RequireIfMatch {
+			app.Logger.Error("If-Match header missing", "location", location)
+			httputils.RespondWithJsonError(w, "If-Match header is required to modify this resource", 428)
+			return 0, false
+		}
+		return db.AnyVersion, true
+	}
+
+	if !matches {
+		app.Logger.Error("If-Match header does not match current version", "location", location, "ifMatch", r.Header.Get("If-Match"), "version", storedPost.Version)
+		httputils.RespondWithJsonError(w, "blog post has been modified since it was fetched", 412)
+		return 0, false
+	}
+	return storedPost.Version, true
+}
+
+// maxBlogPostBytes bounds the size of a blog post payload, so a single request cannot exhaust memory
+const maxBlogPostBytes = 1 << 20
+
+// readBlogPost decodes a blog post from the request body, responding with an error if it cannot
+func (app *App) readBlogPost(w http.ResponseWriter, r *http.Request, location string) (model.BlogPost, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBlogPostBytes)
+
+	var post model.BlogPost
+	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
+		app.Logger.Error("failed to read blog post payload", "error", err, "location", location)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httputils.RespondWithJsonError(w, fmt.Sprintf("blog post must not be larger than %d bytes", maxBlogPostBytes), 413)
+			return model.BlogPost{}, false
+		}
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return model.BlogPost{}, false
+	}
+	return post, true
+}
@@ -8,9 +8,11 @@ import (
 	"log/slog"
 	"net/http/httptest"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 
-	"github.com/James-D-Wood/blog-api/internal/constant"
+	"github.com/James-D-Wood/blog-api/internal/auth"
 	"github.com/James-D-Wood/blog-api/internal/db"
 	"github.com/James-D-Wood/blog-api/internal/model"
 )
@@ -20,19 +22,19 @@ var TestUserMap = map[string]*model.User{
 		ID:       "0197aaed-4a35-74da-8574-4165524a1111",
 		Username: "kishiguro",
 		Name:     "Kazuo Ishiguro",
-		IsAdmin:  false,
+		Role:     model.RoleAuthor,
 	},
 	"dsedaris": {
 		ID:       "0197aaed-4a35-74da-8574-4165524a2222",
 		Username: "dsedaris",
 		Name:     "David Sedaris",
-		IsAdmin:  false,
+		Role:     model.RoleAuthor,
 	},
 	"admin": {
 		ID:       "0197aaed-4a35-74da-8574-4165524a3333",
 		Username: "admin",
 		Name:     "James Wood",
-		IsAdmin:  true,
+		Role:     model.RoleAdmin,
 	},
 }
 
@@ -76,6 +78,26 @@ var createBlogPostTestCases = []struct {
 		User:         "0197aaed-4a35-74da-8574-4165524a1111",
 		ResponseCode: 400,
 	},
+	{
+		Name: "Too Large",
+		RequestBody: map[string]string{
+			"title":    "My NEW riveting blog post",
+			"status":   "DRAFT",
+			"summary":  "Some summary under N chars",
+			"contents": strings.Repeat("a", maxBlogPostBytes),
+		},
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		ResponseCode: 413,
+	},
+}
+
+// withUser returns ctx as the auth middleware leaves it for a request by userID, or for an anonymous request
+// if userID is empty
+func withUser(ctx context.Context, userID string) context.Context {
+	if userID == "" {
+		return ctx
+	}
+	return auth.NewContext(ctx, &auth.Principal{UserID: userID, Role: model.DefaultRole, Method: auth.MethodAccessToken})
 }
 
 func TestCreateBlogPostHandler(t *testing.T) {
@@ -99,7 +121,7 @@ func TestCreateBlogPostHandler(t *testing.T) {
 			b, _ := json.Marshal(tt.RequestBody)
 
 			req := httptest.NewRequest("POST", "/api/v1/posts", bytes.NewReader(b))
-			ctx := context.WithValue(req.Context(), constant.UserIDKey, tt.User)
+			ctx := withUser(req.Context(), tt.User)
 			req = req.WithContext(ctx)
 			rr := httptest.NewRecorder()
 
@@ -191,7 +213,7 @@ func TestFetchBlogPostHandler(t *testing.T) {
 			req.SetPathValue("id", postID)
 
 			// set user identity
-			ctx := context.WithValue(req.Context(), constant.UserIDKey, tt.User)
+			ctx := withUser(req.Context(), tt.User)
 			req = req.WithContext(ctx)
 			rr := httptest.NewRecorder()
 
@@ -199,16 +221,178 @@ func TestFetchBlogPostHandler(t *testing.T) {
 			if rr.Result().StatusCode != tt.ResponseCode {
 				t.Errorf("got %d, want %d", rr.Result().StatusCode, tt.ResponseCode)
 			}
+			if tt.ResponseCode == 200 && rr.Result().Header.Get("ETag") != `"1"` {
+				t.Errorf("got ETag %s, want %s", rr.Result().Header.Get("ETag"), `"1"`)
+			}
 		})
 	}
 }
 
-var updateBlogPostTestCases = []struct {
+var fetchBlogPostsTestCases = []struct {
 	Name         string
-	PostID       string
-	User         string
-	RequestBody  map[string]string
+	Query        string
 	ResponseCode int
+	Posts        int
+}{
+	{
+		Name:         "No Parameters",
+		ResponseCode: 200,
+		Posts:        3,
+	},
+	{
+		Name:         "Limit",
+		Query:        "?limit=2",
+		ResponseCode: 200,
+		Posts:        2,
+	},
+	{
+		Name:         "Author Filter",
+		Query:        "?author=0197aaed-4a35-74da-8574-4165524a2222",
+		ResponseCode: 200,
+		Posts:        1,
+	},
+	{
+		Name:         "Published Range",
+		Query:        "?published_after=2000-01-01T00:00:00Z&published_before=2001-01-01T00:00:00Z",
+		ResponseCode: 200,
+		Posts:        0,
+	},
+	{
+		Name:         "Sort By Updated",
+		Query:        "?sort=updated",
+		ResponseCode: 200,
+		Posts:        3,
+	},
+	{
+		Name:         "Invalid Limit",
+		Query:        "?limit=ten",
+		ResponseCode: 400,
+	},
+	{
+		Name:         "Invalid Timestamp",
+		Query:        "?published_after=yesterday",
+		ResponseCode: 400,
+	},
+	{
+		Name:         "Invalid Author",
+		Query:        "?author=foo",
+		ResponseCode: 400,
+	},
+	{
+		Name:         "Invalid Sort",
+		Query:        "?sort=title",
+		ResponseCode: 400,
+	},
+	{
+		Name:         "Invalid Cursor",
+		Query:        "?cursor=abc",
+		ResponseCode: 400,
+	},
+}
+
+// seedPublishedPosts creates two published posts for kishiguro and one for dsedaris
+func seedPublishedPosts(t *testing.T, app *App) {
+	t.Helper()
+
+	for i, author := range []string{
+		"0197aaed-4a35-74da-8574-4165524a1111",
+		"0197aaed-4a35-74da-8574-4165524a1111",
+		"0197aaed-4a35-74da-8574-4165524a2222",
+	} {
+		post := &model.BlogPost{Title: fmt.Sprintf("post %d", i), Status: model.PUBLISHED}
+		if err := app.BlogService.CreateBlogPost(context.TODO(), author, post); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type fetchBlogPostsResponse struct {
+	Posts      []model.BlogPost `json:"posts"`
+	NextCursor string           `json:"next_cursor"`
+	Next       string           `json:"next"`
+}
+
+func TestFetchBlogPostsHandler(t *testing.T) {
+	for _, tt := range fetchBlogPostsTestCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			app := &App{
+				Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				BlogService: db.NewInMemoryBlogService(),
+				UserService: &db.InMemoryUserService{},
+			}
+			seedPublishedPosts(t, app)
+
+			req := httptest.NewRequest("GET", "/api/v1/posts"+tt.Query, nil)
+			rr := httptest.NewRecorder()
+
+			app.FetchBlogPostsHandler(rr, req)
+			if rr.Result().StatusCode != tt.ResponseCode {
+				t.Fatalf("got %d, want %d", rr.Result().StatusCode, tt.ResponseCode)
+			}
+			if tt.ResponseCode != 200 {
+				return
+			}
+
+			var resp fetchBlogPostsResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Posts) != tt.Posts {
+				t.Errorf("got %d posts, want %d", len(resp.Posts), tt.Posts)
+			}
+		})
+	}
+}
+
+func TestFetchBlogPostsHandlerPaging(t *testing.T) {
+	app := &App{
+		Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		BlogService: db.NewInMemoryBlogService(),
+		UserService: &db.InMemoryUserService{},
+	}
+	seedPublishedPosts(t, app)
+
+	seen := map[string]bool{}
+	next := "/api/v1/posts?limit=2&author=0197aaed-4a35-74da-8574-4165524a1111"
+	for pages := 0; next != ""; pages++ {
+		if pages > 2 {
+			t.Fatal("got more pages than posts")
+		}
+
+		req := httptest.NewRequest("GET", next, nil)
+		rr := httptest.NewRecorder()
+		app.FetchBlogPostsHandler(rr, req)
+
+		var resp fetchBlogPostsResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		for _, post := range resp.Posts {
+			if seen[post.ID] {
+				t.Errorf("got post %s on more than one page", post.ID)
+			}
+			seen[post.ID] = true
+		}
+		if (resp.Next == "") != (resp.NextCursor == "") {
+			t.Errorf("got next %q and next_cursor %q, want both or neither", resp.Next, resp.NextCursor)
+		}
+		next = resp.Next
+	}
+
+	// the author filter is carried over to following pages
+	if len(seen) != 2 {
+		t.Errorf("got %d posts, want 2", len(seen))
+	}
+}
+
+var updateBlogPostTestCases = []struct {
+	Name           string
+	PostID         string
+	User           string
+	IfMatch        string
+	RequireIfMatch bool
+	RequestBody    map[string]string
+	ResponseCode   int
 }{
 	{
 		Name: "Same Owner",
@@ -254,6 +438,54 @@ var updateBlogPostTestCases = []struct {
 		},
 		ResponseCode: 403,
 	},
+	{
+		Name:    "If-Match Current Version",
+		User:    "0197aaed-4a35-74da-8574-4165524a1111",
+		IfMatch: `"1"`,
+		RequestBody: map[string]string{
+			"title":    "Some title",
+			"status":   "DRAFT",
+			"summary":  "Some summary under N chars",
+			"contents": "Some really long string",
+		},
+		ResponseCode: 200,
+	},
+	{
+		Name:    "If-Match Wildcard",
+		User:    "0197aaed-4a35-74da-8574-4165524a1111",
+		IfMatch: "*",
+		RequestBody: map[string]string{
+			"title":    "Some title",
+			"status":   "DRAFT",
+			"summary":  "Some summary under N chars",
+			"contents": "Some really long string",
+		},
+		ResponseCode: 200,
+	},
+	{
+		Name:    "If-Match Stale Version",
+		User:    "0197aaed-4a35-74da-8574-4165524a1111",
+		IfMatch: `"0"`,
+		RequestBody: map[string]string{
+			"title":    "Some title",
+			"status":   "DRAFT",
+			"summary":  "Some summary under N chars",
+			"contents": "Some really long string",
+		},
+		ResponseCode: 412,
+	},
+	{
+		Name:           "If-Match Required But Missing",
+		User:           "0197aaed-4a35-74da-8574-4165524a1111",
+		RequireIfMatch: true,
+		RequestBody: map[string]string{
+			"title":    "Some title",
+			"status":   "DRAFT",
+			"summary":  "Some summary under N chars",
+			"contents": "Some really long string",
+		},
+		ResponseCode: 428,
+	},
 }
 
 func TestUpdateBlogPostHandler(t *testing.T) {
@@ -267,6 +499,7 @@ func TestUpdateBlogPostHandler(t *testing.T) {
 				UserService: &db.InMemoryUserService{
 					Users: TestUserMap,
 				},
+				RequireIfMatch: tt.RequireIfMatch,
 			}
 
 			// seed an existing post beforehand
@@ -285,9 +518,12 @@ func TestUpdateBlogPostHandler(t *testing.T) {
 			b, _ := json.Marshal(tt.RequestBody)
 			req := httptest.NewRequest("PUT", fmt.Sprintf("/api/v1/posts/%s", postID), bytes.NewReader(b))
 			req.SetPathValue("id", postID)
+			if tt.IfMatch != "" {
+				req.Header.Set("If-Match", tt.IfMatch)
+			}
 
 			// set user identity
-			ctx := context.WithValue(req.Context(), constant.UserIDKey, tt.User)
+			ctx := withUser(req.Context(), tt.User)
 			req = req.WithContext(ctx)
 			rr := httptest.NewRecorder()
 
@@ -295,14 +531,55 @@ func TestUpdateBlogPostHandler(t *testing.T) {
 			if rr.Result().StatusCode != tt.ResponseCode {
 				t.Errorf("got %d, want %d", rr.Result().StatusCode, tt.ResponseCode)
 			}
+			if tt.ResponseCode == 200 && rr.Result().Header.Get("ETag") != `"2"` {
+				t.Errorf("got ETag %s, want %s", rr.Result().Header.Get("ETag"), `"2"`)
+			}
 		})
 	}
 }
 
+func TestBlogPostTags(t *testing.T) {
+	h := newTestServer(t, nil)
+	author := mustLogIn(t, h, "kishiguro")
+
+	rr := serve(h, "POST", "/api/v1/posts", author.Token, `{"title": "Never Let Me Go", "status": "PUBLISHED", "tags": ["Fiction", "novels", "fiction"]}`)
+	if rr.Result().StatusCode != 201 {
+		t.Fatalf("got %d, want %d: %s", rr.Result().StatusCode, 201, rr.Body.String())
+	}
+	var resp struct {
+		Post model.BlogPost `json:"post"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"fiction", "novels"}; !slices.Equal(resp.Post.Tags, want) {
+		t.Errorf("got tags %q, want %q", resp.Post.Tags, want)
+	}
+
+	rr = serve(h, "POST", "/api/v1/posts", author.Token, `{"title": "Klara and the Sun", "tags": ["science fiction"]}`)
+	if rr.Result().StatusCode != 400 {
+		t.Errorf("got %d creating a post with an invalid tag, want %d", rr.Result().StatusCode, 400)
+	}
+	rr = serve(h, "PUT", "/api/v1/posts/"+resp.Post.ID, author.Token, `{"title": "Never Let Me Go", "status": "PUBLISHED", "tags": ["science fiction"]}`)
+	if rr.Result().StatusCode != 400 {
+		t.Errorf("got %d updating a post with an invalid tag, want %d", rr.Result().StatusCode, 400)
+	}
+
+	// updates replace every editable field, so tags left out are cleared
+	rr = serve(h, "PUT", "/api/v1/posts/"+resp.Post.ID, author.Token, `{"title": "Never Let Me Go", "status": "PUBLISHED"}`)
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+	if post := mustFetchPost(t, h, author.Token, resp.Post.ID); post.Tags == nil || len(post.Tags) != 0 {
+		t.Errorf("got tags %#v, want an empty list", post.Tags)
+	}
+}
+
 var deleteBlogPostTestCases = []struct {
 	Name         string
 	PostID       string
 	User         string
+	IfMatch      string
 	ResponseCode int
 }{
 	{
@@ -321,6 +598,18 @@ var deleteBlogPostTestCases = []struct {
 		User:         "0197aaed-4a35-74da-8574-4165524a1111",
 		ResponseCode: 404,
 	},
+	{
+		Name:         "If-Match Current Version",
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		IfMatch:      `"1"`,
+		ResponseCode: 204,
+	},
+	{
+		Name:         "If-Match Stale Version",
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		IfMatch:      `"2", "3"`,
+		ResponseCode: 412,
+	},
 }
 
 func TestDeleteBlogPostHandler(t *testing.T) {
@@ -351,9 +640,12 @@ func TestDeleteBlogPostHandler(t *testing.T) {
 
 			req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/v1/posts/%s", postID), nil)
 			req.SetPathValue("id", postID)
+			if tt.IfMatch != "" {
+				req.Header.Set("If-Match", tt.IfMatch)
+			}
 
 			// set user identity
-			ctx := context.WithValue(req.Context(), constant.UserIDKey, tt.User)
+			ctx := withUser(req.Context(), tt.User)
 			req = req.WithContext(ctx)
 			rr := httptest.NewRecorder()
 
@@ -369,7 +661,6 @@ var adminDeleteBlogPostTestCases = []struct {
 	Name         string
 	PostID       string
 	User         string
-	IsAdmin      bool
 	ResponseCode int
 }{
 	{
@@ -380,7 +671,6 @@ var adminDeleteBlogPostTestCases = []struct {
 		Name:         "Admin - Post Does Not Exist",
 		PostID:       "efbfa286-ca55-4ded-a28e-9881118186c8",
 		User:         "0197aaed-4a35-74da-8574-4165524a2222",
-		IsAdmin:      true,
 		ResponseCode: 404,
 	},
 }
@@ -415,8 +705,7 @@ func TestAdminDeleteBlogPostHandler(t *testing.T) {
 			req.SetPathValue("id", postID)
 
 			// set user identity
-			ctx := context.WithValue(req.Context(), constant.UserIDKey, tt.User)
-			ctx = context.WithValue(ctx, constant.AdminKey, tt.IsAdmin)
+			ctx := withUser(req.Context(), tt.User)
 			req = req.WithContext(ctx)
 			rr := httptest.NewRecorder()
 
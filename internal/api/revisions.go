@@ -0,0 +1,227 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/James-D-Wood/blog-api/internal/auth"
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/diff"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// RevisionDiff describes the changes between two revisions of a post - fields that did not change are omitted
+type RevisionDiff struct {
+	From     int         `json:"from"`
+	To       int         `json:"to"`
+	Status   []diff.Line `json:"status,omitempty"`
+	Title    []diff.Line `json:"title,omitempty"`
+	Summary  []diff.Line `json:"summary,omitempty"`
+	Contents []diff.Line `json:"contents,omitempty"`
+}
+
+func (app *App) FetchBlogPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.fetchOwnedBlogPost(w, r, "FetchBlogPostRevisionsHandler")
+	if !ok {
+		return
+	}
+
+	revisions, err := app.BlogService.FetchBlogPostRevisions(r.Context(), post.ID)
+	if err != nil {
+		app.Logger.Error("failed to fetch blog post revisions", "error", err, "location", "FetchBlogPostRevisionsHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	type Response struct {
+		Revisions []model.BlogPostRevision `json:"revisions"`
+	}
+
+	httputils.RespondWithJson(w, Response{
+		Revisions: revisions,
+	}, 200)
+}
+
+func (app *App) FetchBlogPostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.fetchOwnedBlogPost(w, r, "FetchBlogPostRevisionHandler")
+	if !ok {
+		return
+	}
+
+	revision, ok := app.fetchRevision(w, r, post.ID, r.PathValue("rev"), "FetchBlogPostRevisionHandler")
+	if !ok {
+		return
+	}
+
+	type Response struct {
+		Revision model.BlogPostRevision `json:"revision"`
+	}
+
+	httputils.RespondWithJson(w, Response{
+		Revision: revision,
+	}, 200)
+}
+
+func (app *App) DiffBlogPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.fetchOwnedBlogPost(w, r, "DiffBlogPostRevisionsHandler")
+	if !ok {
+		return
+	}
+
+	from, ok := app.fetchRevision(w, r, post.ID, r.PathValue("rev"), "DiffBlogPostRevisionsHandler")
+	if !ok {
+		return
+	}
+	to, ok := app.fetchRevision(w, r, post.ID, r.PathValue("other"), "DiffBlogPostRevisionsHandler")
+	if !ok {
+		return
+	}
+
+	d := RevisionDiff{
+		From: from.Revision,
+		To:   to.Revision,
+	}
+	fields := []struct {
+		from, to string
+		lines    *[]diff.Line
+	}{
+		{string(from.Status), string(to.Status), &d.Status},
+		{from.Title, to.Title, &d.Title},
+		{from.Summary, to.Summary, &d.Summary},
+		{from.Contents, to.Contents, &d.Contents},
+	}
+	for _, f := range fields {
+		lines, err := diff.Lines(f.from, f.to)
+		if err != nil {
+			app.Logger.Error("failed to diff blog post revisions", "error", err, "location", "DiffBlogPostRevisionsHandler")
+			httputils.RespondWithJsonError(w, fmt.Sprintf("cannot diff revisions - fields longer than %d lines are not supported", diff.MaxLines), 422)
+			return
+		}
+		if diff.Changed(lines) {
+			*f.lines = lines
+		}
+	}
+
+	type Response struct {
+		Diff RevisionDiff `json:"diff"`
+	}
+
+	httputils.RespondWithJson(w, Response{
+		Diff: d,
+	}, 200)
+}
+
+// RestoreBlogPostRevisionHandler makes an old revision the current version of a post, recording the
+// restore as a new revision so no history is lost
+func (app *App) RestoreBlogPostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.fetchOwnedBlogPost(w, r, "RestoreBlogPostRevisionHandler")
+	if !ok {
+		return
+	}
+
+	revision, ok := app.fetchRevision(w, r, post.ID, r.PathValue("rev"), "RestoreBlogPostRevisionHandler")
+	if !ok {
+		return
+	}
+
+	if _, ok := app.checkIfMatch(w, r, post, "RestoreBlogPostRevisionHandler"); !ok {
+		return
+	}
+
+	// posts are only moved to the trash by deleting them, so the revision recording that cannot be restored
+	if revision.Status == model.DELETED {
+		app.Logger.Error("attempted to restore a deleted revision", "revision", revision.Revision, "location", "RestoreBlogPostRevisionHandler")
+		httputils.RespondWithJsonError(w, "cannot restore revision - it records the post being deleted", 400)
+		return
+	}
+
+	if revision.Status == model.PUBLISHED && post.Status != model.PUBLISHED && !app.checkCanPublish(w, r, "RestoreBlogPostRevisionHandler", post.AuthorID) {
+		return
+	}
+
+	restored := model.BlogPost{
+		Status:   revision.Status,
+		Title:    revision.Title,
+		Summary:  revision.Summary,
+		Contents: revision.Contents,
+		Tags:     revision.Tags,
+	}
+	err := app.BlogService.UpdateBlogPost(r.Context(), auth.UserID(r.Context()), &restored, &post)
+	if err != nil {
+		app.Logger.Error("failed to restore blog post revision", "error", err, "location", "RestoreBlogPostRevisionHandler")
+		switch {
+		case errors.Is(err, db.ErrBlogPostAlreadyExists):
+			httputils.RespondWithJsonError(w, "cannot restore revision - title already in use", 400)
+		case errors.Is(err, db.ErrInvalidStatus):
+			httputils.RespondWithJsonError(w, "cannot restore revision - invalid status", 400)
+		case errors.Is(err, db.ErrVersionConflict):
+			httputils.RespondWithJsonError(w, "blog post has been modified since it was fetched", 412)
+		default:
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+		}
+		return
+	}
+
+	type Response struct {
+		Post model.BlogPost `json:"post"`
+	}
+
+	w.Header().Set("ETag", httputils.ETag(post.Version))
+	httputils.RespondWithJson(w, Response{
+		Post: post,
+	}, 200)
+}
+
+// fetchOwnedBlogPost loads the post named in the path and verifies the requestor is its author,
+// responding with an error if not
+func (app *App) fetchOwnedBlogPost(w http.ResponseWriter, r *http.Request, location string) (model.BlogPost, bool) {
+	postID := r.PathValue("id")
+
+	post, err := app.BlogService.FetchBlogPost(r.Context(), postID)
+	if err != nil {
+		app.Logger.Error("failed to fetch blog post", "error", err, "location", location)
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: blog post with ID %s does not exist", postID), 404)
+			return model.BlogPost{}, false
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return model.BlogPost{}, false
+	}
+
+	userID := auth.UserID(r.Context())
+
+	// revisions can hold unpublished drafts so history is only available to the author
+	if post.AuthorID != userID {
+		app.Logger.Error("requestor does not own the blog post", "location", location, "originalAuthor", post.AuthorID, "requestor", userID)
+		httputils.RespondWithJsonError(w, "not authorized to access this resource", 403)
+		return model.BlogPost{}, false
+	}
+
+	return post, true
+}
+
+// fetchRevision parses a revision number from the path and loads it, responding with an error if it cannot
+func (app *App) fetchRevision(w http.ResponseWriter, r *http.Request, postID, rawRevision, location string) (model.BlogPostRevision, bool) {
+	rev, err := strconv.Atoi(rawRevision)
+	if err != nil || rev < 1 {
+		app.Logger.Error("invalid revision number", "revision", rawRevision, "location", location)
+		httputils.RespondWithJsonError(w, fmt.Sprintf("invalid revision %q", rawRevision), 400)
+		return model.BlogPostRevision{}, false
+	}
+
+	revision, err := app.BlogService.FetchBlogPostRevision(r.Context(), postID, rev)
+	if err != nil {
+		app.Logger.Error("failed to fetch blog post revision", "error", err, "location", location)
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, fmt.Sprintf("revision %d of blog post %s does not exist", rev, postID), 404)
+			return model.BlogPostRevision{}, false
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return model.BlogPostRevision{}, false
+	}
+
+	return revision, true
+}
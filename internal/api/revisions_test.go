@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/diff"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// seedRevisedPost creates a post owned by kishiguro with two revisions
+func seedRevisedPost(t *testing.T, app *App) model.BlogPost {
+	t.Helper()
+
+	post := &model.BlogPost{Title: "first title", Contents: "line one\nline two", Status: model.DRAFT}
+	err := app.BlogService.CreateBlogPost(context.TODO(), "0197aaed-4a35-74da-8574-4165524a1111", post)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := *post
+	err = app.BlogService.UpdateBlogPost(context.TODO(), "0197aaed-4a35-74da-8574-4165524a1111", &model.BlogPost{
+		Title:    "second title",
+		Contents: "line one\nline 2",
+		Status:   model.DRAFT,
+	}, &stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+var revisionsTestCases = []struct {
+	Name         string
+	Method       string
+	Path         string
+	Handler      func(app *App) http.HandlerFunc
+	User         string
+	ResponseCode int
+}{
+	{
+		Name:         "List - Same Owner",
+		Path:         "/revisions",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchBlogPostRevisionsHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		ResponseCode: 200,
+	},
+	{
+		Name:         "List - Different Owner",
+		Path:         "/revisions",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchBlogPostRevisionsHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a2222",
+		ResponseCode: 403,
+	},
+	{
+		Name:         "Fetch - Same Owner",
+		Path:         "/revisions/1",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchBlogPostRevisionHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		ResponseCode: 200,
+	},
+	{
+		Name:         "Fetch - Revision Does Not Exist",
+		Path:         "/revisions/3",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchBlogPostRevisionHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		ResponseCode: 404,
+	},
+	{
+		Name:         "Fetch - Invalid Revision",
+		Path:         "/revisions/latest",
+		Handler:      func(app *App) http.HandlerFunc { return app.FetchBlogPostRevisionHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		ResponseCode: 400,
+	},
+	{
+		Name:         "Diff - Same Owner",
+		Path:         "/revisions/1/diff/2",
+		Handler:      func(app *App) http.HandlerFunc { return app.DiffBlogPostRevisionsHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		ResponseCode: 200,
+	},
+	{
+		Name:         "Restore - Same Owner",
+		Method:       "POST",
+		Path:         "/revisions/1/restore",
+		Handler:      func(app *App) http.HandlerFunc { return app.RestoreBlogPostRevisionHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a1111",
+		ResponseCode: 200,
+	},
+	{
+		Name:         "Restore - Different Owner",
+		Method:       "POST",
+		Path:         "/revisions/1/restore",
+		Handler:      func(app *App) http.HandlerFunc { return app.RestoreBlogPostRevisionHandler },
+		User:         "0197aaed-4a35-74da-8574-4165524a2222",
+		ResponseCode: 403,
+	},
+}
+
+func TestRevisionHandlers(t *testing.T) {
+	for _, tt := range revisionsTestCases {
+		t.Run(tt.Name, func(t *testing.T) {
+
+			// InMemory implementations double as mock test implementations for unit tests
+			app := &App{
+				Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				BlogService: db.NewInMemoryBlogService(),
+				UserService: &db.InMemoryUserService{
+					Users: TestUserMap,
+				},
+			}
+			post := seedRevisedPost(t, app)
+
+			method := tt.Method
+			if method == "" {
+				method = "GET"
+			}
+
+			// register on a mux so path values are parsed the same way as in RegisterRoutes
+			mux := http.NewServeMux()
+			mux.HandleFunc(fmt.Sprintf("%s /posts/{id}/revisions", method), tt.Handler(app))
+			mux.HandleFunc(fmt.Sprintf("%s /posts/{id}/revisions/{rev}", method), tt.Handler(app))
+			mux.HandleFunc(fmt.Sprintf("%s /posts/{id}/revisions/{rev}/diff/{other}", method), tt.Handler(app))
+			mux.HandleFunc(fmt.Sprintf("%s /posts/{id}/revisions/{rev}/restore", method), tt.Handler(app))
+
+			req := httptest.NewRequest(method, fmt.Sprintf("/posts/%s%s", post.ID, tt.Path), nil)
+
+			// set user identity
+			ctx := withUser(req.Context(), tt.User)
+			req = req.WithContext(ctx)
+			rr := httptest.NewRecorder()
+
+			mux.ServeHTTP(rr, req)
+			if rr.Result().StatusCode != tt.ResponseCode {
+				t.Errorf("got %d, want %d", rr.Result().StatusCode, tt.ResponseCode)
+			}
+		})
+	}
+}
+
+func TestDiffBlogPostRevisionsHandler(t *testing.T) {
+	app := &App{
+		Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		BlogService: db.NewInMemoryBlogService(),
+	}
+	post := seedRevisedPost(t, app)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/v1/posts/%s/revisions/1/diff/2", post.ID), nil)
+	req.SetPathValue("id", post.ID)
+	req.SetPathValue("rev", "1")
+	req.SetPathValue("other", "2")
+	req = req.WithContext(withUser(req.Context(), post.AuthorID))
+	rr := httptest.NewRecorder()
+
+	app.DiffBlogPostRevisionsHandler(rr, req)
+
+	var resp struct {
+		Diff RevisionDiff `json:"diff"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Diff.Status != nil || resp.Diff.Summary != nil {
+		t.Errorf("got %+v, want unchanged fields omitted", resp.Diff)
+	}
+	if len(resp.Diff.Title) != 2 || len(resp.Diff.Contents) != 3 {
+		t.Errorf("got %+v, want title and contents changes", resp.Diff)
+	}
+}
+
+func TestDiffBlogPostRevisionsHandlerTooLarge(t *testing.T) {
+	app := &App{
+		Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		BlogService: db.NewInMemoryBlogService(),
+	}
+	post := seedRevisedPost(t, app)
+	err := app.BlogService.UpdateBlogPost(context.TODO(), "0197aaed-4a35-74da-8574-4165524a1111", &model.BlogPost{
+		Title:    post.Title,
+		Contents: strings.Repeat("line\n", diff.MaxLines),
+		Status:   model.DRAFT,
+	}, &post)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/v1/posts/%s/revisions/2/diff/3", post.ID), nil)
+	req.SetPathValue("id", post.ID)
+	req.SetPathValue("rev", "2")
+	req.SetPathValue("other", "3")
+	req = req.WithContext(withUser(req.Context(), post.AuthorID))
+	rr := httptest.NewRecorder()
+
+	app.DiffBlogPostRevisionsHandler(rr, req)
+	if rr.Result().StatusCode != 422 {
+		t.Errorf("got %d, want %d", rr.Result().StatusCode, 422)
+	}
+}
+
+func TestRestoreBlogPostRevisionHandler(t *testing.T) {
+	app := &App{
+		Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		BlogService: db.NewInMemoryBlogService(),
+	}
+	post := seedRevisedPost(t, app)
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/api/v1/posts/%s/revisions/1/restore", post.ID), nil)
+	req.SetPathValue("id", post.ID)
+	req.SetPathValue("rev", "1")
+	req = req.WithContext(withUser(req.Context(), post.AuthorID))
+	rr := httptest.NewRecorder()
+
+	app.RestoreBlogPostRevisionHandler(rr, req)
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d, want %d", rr.Result().StatusCode, 200)
+	}
+
+	restored, err := app.BlogService.FetchBlogPost(context.TODO(), post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Title != "first title" || restored.Version != 3 {
+		t.Errorf("got %+v, want revision 1 restored as version 3", restored)
+	}
+
+	revisions, err := app.BlogService.FetchBlogPostRevisions(context.TODO(), post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 {
+		t.Errorf("got %d revisions, want the restore recorded as a third", len(revisions))
+	}
+}
+
+func TestRestoreDeletedBlogPostRevision(t *testing.T) {
+	h := newTestServer(t, nil)
+	author := mustLogIn(t, h, "kishiguro")
+	postID := mustCreatePost(t, h, author.Token, "Never Let Me Go")
+
+	// deleting and restoring the post leaves a revision recording it in the trash
+	if rr := serve(h, "DELETE", "/api/v1/posts/"+postID, author.Token, ""); rr.Result().StatusCode != 204 {
+		t.Fatalf("got %d deleting the post, want %d", rr.Result().StatusCode, 204)
+	}
+	if rr := serve(h, "POST", "/api/v1/posts/"+postID+"/restore", author.Token, ""); rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d restoring the post, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+
+	rr := serve(h, "POST", "/api/v1/posts/"+postID+"/revisions/2/restore", author.Token, "")
+	if rr.Result().StatusCode != 400 {
+		t.Fatalf("got %d restoring the deleted revision, want %d: %s", rr.Result().StatusCode, 400, rr.Body.String())
+	}
+	if post := mustFetchPost(t, h, author.Token, postID); post.Status != model.DRAFT || post.Version != 3 {
+		t.Errorf("got %+v, want the restored draft left as it was", post)
+	}
+}
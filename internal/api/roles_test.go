@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/api/middleware"
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+func TestRequirePermission(t *testing.T) {
+	hash, err := db.HashPassword("a long password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := map[string]*model.User{}
+	for _, role := range model.Roles {
+		users[string(role)] = &model.User{ID: roleTestUserID(role), Username: string(role), PasswordHash: hash, Role: role}
+	}
+
+	app := App{
+		Logger:                 slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		BlogService:            db.NewInMemoryBlogService(),
+		UserService:            &db.InMemoryUserService{Users: users},
+		RefreshTokenService:    db.NewInMemoryRefreshTokenService(),
+		TokenRevocationService: db.NewInMemoryTokenRevocationService(),
+		APITokenService:        db.NewInMemoryAPITokenService(),
+		RefreshTokenTTL:        time.Hour,
+	}
+	h := middleware.LoggerMiddleware(app.RegisterRoutes(), app.Logger)
+
+	// each request is allowed for the listed roles, and forbidden for the rest
+	tt := []struct {
+		Name    string
+		Request func(t *testing.T) (method, path, body string)
+		Allowed []model.Role
+	}{
+		{
+			Name: "Create Post",
+			Request: func(t *testing.T) (string, string, string) {
+				return "POST", "/api/v1/posts", fmt.Sprintf(`{"title": %q, "contents": "Contents"}`, t.Name())
+			},
+			Allowed: []model.Role{model.RoleAuthor, model.RoleEditor, model.RoleAdmin},
+		},
+		{
+			Name: "Moderate Post",
+			Request: func(t *testing.T) (string, string, string) {
+				post := &model.BlogPost{Title: t.Name(), Contents: "Contents"}
+				if err := app.BlogService.CreateBlogPost(context.Background(), users["author"].ID, post); err != nil {
+					t.Fatal(err)
+				}
+				return "DELETE", "/api/v1/admin/posts/" + post.ID, ""
+			},
+			Allowed: []model.Role{model.RoleEditor, model.RoleAdmin},
+		},
+		{
+			Name: "Bulk Moderate Posts",
+			Request: func(t *testing.T) (string, string, string) {
+				post := &model.BlogPost{Title: t.Name(), Contents: "Contents"}
+				if err := app.BlogService.CreateBlogPost(context.Background(), users["author"].ID, post); err != nil {
+					t.Fatal(err)
+				}
+				return "POST", "/api/v1/admin/posts/bulk", fmt.Sprintf(`{"action": "delete", "post_ids": [%q]}`, post.ID)
+			},
+			Allowed: []model.Role{model.RoleEditor, model.RoleAdmin},
+		},
+		{
+			Name: "Transfer Posts",
+			Request: func(t *testing.T) (string, string, string) {
+				return "POST", fmt.Sprintf("/api/v1/admin/users/%s/posts/transfer", users["reader"].ID), fmt.Sprintf(`{"author_id": %q}`, users["author"].ID)
+			},
+			Allowed: []model.Role{model.RoleAdmin},
+		},
+		{
+			Name: "Manage Users",
+			Request: func(t *testing.T) (string, string, string) {
+				return "POST", fmt.Sprintf("/api/v1/admin/users/%s/revoke-tokens", users["reader"].ID), ""
+			},
+			Allowed: []model.Role{model.RoleAdmin},
+		},
+	}
+
+	for _, tc := range tt {
+		for _, role := range model.Roles {
+			t.Run(fmt.Sprintf("%s As %s", tc.Name, role), func(t *testing.T) {
+				wantAllowed := false
+				for _, allowed := range tc.Allowed {
+					wantAllowed = wantAllowed || allowed == role
+				}
+
+				login := mustLogIn(t, h, string(role))
+				method, path, body := tc.Request(t)
+				rr := serve(h, method, path, login.Token, body)
+				if gotAllowed := rr.Result().StatusCode != http.StatusForbidden; gotAllowed != wantAllowed {
+					t.Errorf("got %d, want allowed: %t", rr.Result().StatusCode, wantAllowed)
+				}
+				if wantAllowed && rr.Result().StatusCode >= 400 {
+					t.Errorf("got %d for an allowed request: %s", rr.Result().StatusCode, rr.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func roleTestUserID(role model.Role) string {
+	return map[model.Role]string{
+		model.RoleReader: "0197aaed-4a35-74da-8574-4165524a4444",
+		model.RoleAuthor: "0197aaed-4a35-74da-8574-4165524a1111",
+		model.RoleEditor: "0197aaed-4a35-74da-8574-4165524a2222",
+		model.RoleAdmin:  "0197aaed-4a35-74da-8574-4165524a3333",
+	}[role]
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+)
+
+const (
+	SessionModeBearer = "bearer"
+	SessionModeCookie = "cookie"
+
+	sessionCookiePath = "/api/v1"
+	// refreshCookiePath keeps the refresh token from being sent anywhere but where it is used
+	refreshCookiePath = "/api/v1/token/refresh"
+	// csrfCookiePath lets scripts on any page of the site read the CSRF token
+	csrfCookiePath = "/"
+)
+
+// SessionCookies configures the cookies browsers are logged in with, instead of handling the tokens themselves,
+// when cookie sessions are enabled
+type SessionCookies struct {
+	// Secure only sends the cookies over HTTPS
+	Secure   bool
+	SameSite http.SameSite
+	// Domain shares the cookies with subdomains when set, ie: a frontend on www.example.com calling
+	// api.example.com - otherwise they are only sent to the host that set them
+	Domain string
+	// CSRFKey signs the CSRF token of each session, so that a CSRF cookie planted by a sibling subdomain only
+	// passes for the session it was issued to
+	CSRFKey []byte
+}
+
+// setSessionCookies logs a browser in with the given access and refresh tokens from the session with the given
+// family ID, alongside the session's CSRF token, returning the CSRF token
+func (app *App) setSessionCookies(w http.ResponseWriter, accessToken, refreshToken, familyID string) string {
+	csrfToken := httputils.CSRFToken(app.SessionCookies.CSRFKey, familyID)
+
+	http.SetCookie(w, app.sessionCookie(httputils.SessionCookie, accessToken, sessionCookiePath, int(httputils.AccessTokens.TTL.Seconds())))
+	http.SetCookie(w, app.sessionCookie(httputils.RefreshCookie, refreshToken, refreshCookiePath, int(app.RefreshTokenTTL.Seconds())))
+	http.SetCookie(w, app.sessionCookie(httputils.CSRFCookie, csrfToken, csrfCookiePath, int(app.RefreshTokenTTL.Seconds())))
+	return csrfToken
+}
+
+// clearSessionCookies logs a browser out
+func (app *App) clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, app.sessionCookie(httputils.SessionCookie, "", sessionCookiePath, -1))
+	http.SetCookie(w, app.sessionCookie(httputils.RefreshCookie, "", refreshCookiePath, -1))
+	http.SetCookie(w, app.sessionCookie(httputils.CSRFCookie, "", csrfCookiePath, -1))
+}
+
+func (app *App) sessionCookie(name, value, path string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:   name,
+		Value:  value,
+		Path:   path,
+		Domain: app.SessionCookies.Domain,
+		MaxAge: maxAge,
+		// the CSRF token is the only one scripts need to read
+		HttpOnly: name != httputils.CSRFCookie,
+		Secure:   app.SessionCookies.Secure,
+		SameSite: app.SessionCookies.SameSite,
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+)
+
+// newCookieTestServer serves the full API with cookie sessions enabled
+func newCookieTestServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	return newTestServer(t, func(app *App) {
+		app.SessionCookies = &SessionCookies{Secure: true, SameSite: http.SameSiteStrictMode, CSRFKey: []byte("csrf key")}
+	})
+}
+
+// browser holds on to the cookies set by a server, like a browser would
+type browser map[string]*http.Cookie
+
+// serve makes a request sending the browser's cookies, and the CSRF header when csrf is true
+func (b browser) serve(h http.Handler, method, path string, csrf bool, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for _, cookie := range b {
+		if strings.HasPrefix(path, cookie.Path) {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+	}
+	if cookie, ok := b[httputils.CSRFCookie]; ok && csrf {
+		req.Header.Set(httputils.CSRFHeader, cookie.Value)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(b, cookie.Name)
+			continue
+		}
+		b[cookie.Name] = cookie
+	}
+	return rr
+}
+
+// mustLogInWithCookies logs in as kishiguro, returning the browser holding the cookies set and the response
+func mustLogInWithCookies(t *testing.T, h http.Handler) (browser, LoginResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/api/v1/login", nil)
+	req.SetBasicAuth("kishiguro", "a long password")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d logging in, want %d", rr.Result().StatusCode, 200)
+	}
+
+	b := browser{}
+	for _, cookie := range rr.Result().Cookies() {
+		b[cookie.Name] = cookie
+	}
+	var login LoginResponse
+	if err := json.NewDecoder(rr.Body).Decode(&login); err != nil {
+		t.Fatal(err)
+	}
+	return b, login
+}
+
+func TestCookieSessions(t *testing.T) {
+	h := newCookieTestServer(t)
+	b, login := mustLogInWithCookies(t, h)
+
+	if login.Token != "" || login.RefreshToken != "" {
+		t.Errorf("got tokens %+v in the response, want them only set as cookies", login)
+	}
+	for _, name := range []string{httputils.SessionCookie, httputils.RefreshCookie, httputils.CSRFCookie} {
+		cookie, ok := b[name]
+		if !ok {
+			t.Fatalf("no %s cookie set on login", name)
+		}
+		if !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+			t.Errorf("got %s cookie %+v, want it secure and same site", name, cookie)
+		}
+		// only the CSRF token is readable by scripts
+		if cookie.HttpOnly != (name != httputils.CSRFCookie) {
+			t.Errorf("got %s cookie HttpOnly %t", name, cookie.HttpOnly)
+		}
+	}
+	if b[httputils.CSRFCookie].Value != login.CSRFToken {
+		t.Errorf("got CSRF token %q in the response, want the cookie's %q", login.CSRFToken, b[httputils.CSRFCookie].Value)
+	}
+
+	// reads only need the session cookie, writes need the CSRF token too
+	if rr := b.serve(h, "GET", "/api/v1/me/posts", false, ""); rr.Result().StatusCode != 200 {
+		t.Errorf("got %d reading, want %d", rr.Result().StatusCode, 200)
+	}
+	post := `{"title": "Klara and the Sun", "status": "DRAFT"}`
+	if rr := b.serve(h, "POST", "/api/v1/posts", false, post); rr.Result().StatusCode != 403 {
+		t.Errorf("got %d writing without the CSRF token, want %d", rr.Result().StatusCode, 403)
+	}
+	if rr := b.serve(h, "POST", "/api/v1/posts", true, post); rr.Result().StatusCode != 201 {
+		t.Errorf("got %d writing with the CSRF token, want %d", rr.Result().StatusCode, 201)
+	}
+
+	// refreshing uses the refresh cookie
+	session := b[httputils.SessionCookie].Value
+	if rr := b.serve(h, "POST", "/api/v1/token/refresh", false, ""); rr.Result().StatusCode != 403 {
+		t.Errorf("got %d refreshing without the CSRF token, want %d", rr.Result().StatusCode, 403)
+	}
+	if rr := b.serve(h, "POST", "/api/v1/token/refresh", true, ""); rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d refreshing, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+	if b[httputils.SessionCookie].Value == session {
+		t.Error("expected a new session cookie on refresh")
+	}
+
+	// logging out revokes the session and clears the cookies
+	session = b[httputils.SessionCookie].Value
+	if rr := b.serve(h, "POST", "/api/v1/logout", true, ""); rr.Result().StatusCode != 204 {
+		t.Fatalf("got %d logging out, want %d", rr.Result().StatusCode, 204)
+	}
+	if len(b) != 0 {
+		t.Errorf("got cookies %v left after logging out, want none", b)
+	}
+	b[httputils.SessionCookie] = &http.Cookie{Name: httputils.SessionCookie, Value: session, Path: sessionCookiePath}
+	if rr := b.serve(h, "GET", "/api/v1/me/posts", false, ""); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d reusing the session cookie after logging out, want %d", rr.Result().StatusCode, 401)
+	}
+}
+
+func TestCookieSessionsAcceptBearerTokens(t *testing.T) {
+	h := newCookieTestServer(t)
+
+	b, _ := mustLogInWithCookies(t, h)
+
+	// clients other than browsers can still authenticate with an API token
+	rr := b.serve(h, "POST", "/api/v1/me/tokens", true, `{"name": "script", "scopes": ["posts:write"]}`)
+	if rr.Result().StatusCode != 201 {
+		t.Fatalf("got %d creating an API token, want %d: %s", rr.Result().StatusCode, 201, rr.Body.String())
+	}
+	var created struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	// bearer tokens cannot be sent by another site, so need no CSRF token
+	if rr := serve(h, "POST", "/api/v1/posts", created.Token, `{"title": "Klara and the Sun", "status": "DRAFT"}`); rr.Result().StatusCode != 201 {
+		t.Errorf("got %d writing with an API token, want %d", rr.Result().StatusCode, 201)
+	}
+}
+
+func TestCookieSessionsRejectPlantedCSRFToken(t *testing.T) {
+	h := newCookieTestServer(t)
+	victim, _ := mustLogInWithCookies(t, h)
+	attacker, _ := mustLogInWithCookies(t, h)
+
+	// a sibling subdomain sharing the cookies overwrites the victim's CSRF cookie with one it knows, and echoes it
+	victim[httputils.CSRFCookie] = attacker[httputils.CSRFCookie]
+	if rr := victim.serve(h, "POST", "/api/v1/posts", true, `{"title": "Klara and the Sun", "status": "DRAFT"}`); rr.Result().StatusCode != 403 {
+		t.Errorf("got %d writing with a planted CSRF token, want %d", rr.Result().StatusCode, 403)
+	}
+	if rr := victim.serve(h, "POST", "/api/v1/token/refresh", true, ""); rr.Result().StatusCode != 403 {
+		t.Errorf("got %d refreshing with a planted CSRF token, want %d", rr.Result().StatusCode, 403)
+	}
+}
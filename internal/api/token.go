@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and a new refresh token. Each
+// refresh token can only be used once, and using one again revokes every token issued since the login. With
+// cookie sessions enabled, browsers send their refresh token as a cookie instead.
+func (app *App) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req RefreshTokenRequest
+	fromCookie := false
+	if cookie, err := r.Cookie(httputils.RefreshCookie); app.SessionCookies != nil && err == nil {
+		req.RefreshToken = cookie.Value
+		fromCookie = true
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		app.Logger.Error("failed to read refresh token payload", "error", err, "location", "RefreshTokenHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+
+	// the token is looked up before it is used up, so the request can be turned away without rotating it
+	token, err := app.RefreshTokenService.FetchRefreshToken(r.Context(), db.HashRefreshToken(req.RefreshToken))
+	if err != nil {
+		app.Logger.Error("failed to fetch refresh token", "error", err, "location", "RefreshTokenHandler")
+		if errors.Is(err, db.ErrInvalidRefreshToken) {
+			httputils.RespondWithJsonError(w, "invalid refresh token", 401)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	// the browser sends the cookie whoever makes it call here, so the CSRF token of its session is checked
+	if fromCookie {
+		if err := httputils.CheckCSRFToken(r, app.SessionCookies.CSRFKey, token.FamilyID); err != nil {
+			app.Logger.Error("rejected refresh cookie", "error", err, "location", "RefreshTokenHandler")
+			httputils.RespondWithJsonError(w, "missing or invalid CSRF token - send the "+httputils.CSRFCookie+" cookie in the "+httputils.CSRFHeader+" header", 403)
+			return
+		}
+	}
+
+	// fetch the user again so the new access token reflects any changes since the login
+	user, err := app.UserService.FetchUserByID(r.Context(), token.UserID)
+	if err != nil {
+		app.Logger.Error("failed to fetch user", "error", err, "location", "RefreshTokenHandler")
+		if errors.Is(err, db.ErrEntityNotFound) {
+			app.RefreshTokenService.RevokeRefreshTokenFamily(r.Context(), token.FamilyID)
+			httputils.RespondWithJsonError(w, "invalid refresh token", 401)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	// suspended users are turned away before the token is used up, so that they are never issued another. Tokens
+	// that can no longer be used are left for RotateRefreshToken to reject, as reusing one revokes its family.
+	if token.Usable(time.Now()) && !app.checkNotSuspended(w, "RefreshTokenHandler", user) {
+		return
+	}
+
+	refreshToken, next, err := db.NewRefreshToken("", app.RefreshTokenTTL)
+	if err != nil {
+		app.Logger.Error("failed to generate refresh token", "error", err, "location", "RefreshTokenHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	err = app.RefreshTokenService.RotateRefreshToken(r.Context(), db.HashRefreshToken(req.RefreshToken), &next)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrRefreshTokenReused):
+			app.Logger.Warn("refresh token reused - revoked its family", "location", "RefreshTokenHandler")
+			httputils.RespondWithJsonError(w, "invalid refresh token", 401)
+		case errors.Is(err, db.ErrInvalidRefreshToken):
+			app.Logger.Error("failed to rotate refresh token", "error", err, "location", "RefreshTokenHandler")
+			httputils.RespondWithJsonError(w, "invalid refresh token", 401)
+		default:
+			app.Logger.Error("failed to rotate refresh token", "error", err, "location", "RefreshTokenHandler")
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+		}
+		return
+	}
+
+	app.respondWithTokens(w, "RefreshTokenHandler", user, refreshToken, next.FamilyID)
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// newRefreshTestApp returns an app with a single user, and a refresh token issued to them on login
+func newRefreshTestApp(t *testing.T) (*App, string) {
+	t.Helper()
+
+	user := &model.User{ID: "0197aaed-4a35-74da-8574-4165524a1111", Username: "kishiguro"}
+	app := &App{
+		Logger: slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		UserService: &db.InMemoryUserService{
+			Users: map[string]*model.User{"kishiguro": user},
+		},
+		RefreshTokenService: db.NewInMemoryRefreshTokenService(),
+		RefreshTokenTTL:     time.Hour,
+	}
+
+	refreshToken, stored, err := db.NewRefreshToken(user.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RefreshTokenService.CreateRefreshToken(context.Background(), &stored); err != nil {
+		t.Fatal(err)
+	}
+	return app, refreshToken
+}
+
+func refresh(app *App, refreshToken string) (*httptest.ResponseRecorder, LoginResponse) {
+	body := fmt.Sprintf(`{"refresh_token": %q}`, refreshToken)
+	req := httptest.NewRequest("POST", "/api/v1/token/refresh", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	app.RefreshTokenHandler(rr, req)
+
+	var resp LoginResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	return rr, resp
+}
+
+func TestRefreshTokenHandler(t *testing.T) {
+	app, refreshToken := newRefreshTestApp(t)
+
+	rr, resp := refresh(app, refreshToken)
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d, want %d", rr.Result().StatusCode, 200)
+	}
+	if resp.Token == "" || resp.RefreshToken == "" || resp.RefreshToken == refreshToken {
+		t.Fatalf("got %+v, want a new access token and a rotated refresh token", resp)
+	}
+
+	// the rotated token can be used in turn
+	rr, _ = refresh(app, resp.RefreshToken)
+	if rr.Result().StatusCode != 200 {
+		t.Errorf("got %d refreshing with the rotated token, want %d", rr.Result().StatusCode, 200)
+	}
+}
+
+func TestRefreshTokenHandlerReuse(t *testing.T) {
+	app, refreshToken := newRefreshTestApp(t)
+
+	_, resp := refresh(app, refreshToken)
+
+	// presenting the original token again revokes the token it was rotated into
+	if rr, _ := refresh(app, refreshToken); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d reusing a refresh token, want %d", rr.Result().StatusCode, 401)
+	}
+	if rr, _ := refresh(app, resp.RefreshToken); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d refreshing after reuse, want %d", rr.Result().StatusCode, 401)
+	}
+}
+
+func TestRefreshTokenHandlerSuspendedUser(t *testing.T) {
+	app, refreshToken := newRefreshTestApp(t)
+	userID := "0197aaed-4a35-74da-8574-4165524a1111"
+	if err := app.UserService.SuspendUser(context.Background(), userID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr, _ := refresh(app, refreshToken); rr.Result().StatusCode != 403 {
+		t.Fatalf("got %d refreshing while suspended, want %d", rr.Result().StatusCode, 403)
+	}
+
+	// the token was not used up, so it still works once the suspension is lifted
+	if err := app.UserService.ReactivateUser(context.Background(), userID); err != nil {
+		t.Fatal(err)
+	}
+	if rr, _ := refresh(app, refreshToken); rr.Result().StatusCode != 200 {
+		t.Errorf("got %d refreshing once reactivated, want %d", rr.Result().StatusCode, 200)
+	}
+}
+
+// countingRefreshTokenService counts the refresh tokens issued through it
+type countingRefreshTokenService struct {
+	db.RefreshTokenService
+	issued int
+}
+
+func (s *countingRefreshTokenService) CreateRefreshToken(ctx context.Context, token *db.RefreshToken) error {
+	s.issued++
+	return s.RefreshTokenService.CreateRefreshToken(ctx, token)
+}
+
+func TestLoginSuspendedUserIssuesNoRefreshToken(t *testing.T) {
+	var app *App
+	h := newTestServer(t, func(a *App) {
+		app = a
+		app.RefreshTokenService = &countingRefreshTokenService{RefreshTokenService: app.RefreshTokenService}
+	})
+	if err := app.UserService.SuspendUser(context.Background(), authorTestUserID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/v1/login", nil)
+	req.SetBasicAuth("kishiguro", "a long password")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Result().StatusCode != 403 {
+		t.Errorf("got %d logging in while suspended, want %d", rr.Result().StatusCode, 403)
+	}
+	if issued := app.RefreshTokenService.(*countingRefreshTokenService).issued; issued != 0 {
+		t.Errorf("got %d refresh tokens issued, want none", issued)
+	}
+}
+
+func TestRefreshTokenHandlerErrors(t *testing.T) {
+	tests := []struct {
+		Name         string
+		Body         string
+		DeleteUser   bool
+		ResponseCode int
+	}{
+		{Name: "Unknown Token", Body: `{"refresh_token": "unknown"}`, ResponseCode: 401},
+		{Name: "Missing Token", Body: `{}`, ResponseCode: 400},
+		{Name: "Invalid Body", Body: `{"refresh_token": `, ResponseCode: 400},
+		{Name: "User Deleted", DeleteUser: true, ResponseCode: 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			app, refreshToken := newRefreshTestApp(t)
+			if tt.Body == "" {
+				tt.Body = fmt.Sprintf(`{"refresh_token": %q}`, refreshToken)
+			}
+			if tt.DeleteUser {
+				app.UserService = &db.InMemoryUserService{}
+			}
+
+			req := httptest.NewRequest("POST", "/api/v1/token/refresh", strings.NewReader(tt.Body))
+			rr := httptest.NewRecorder()
+
+			app.RefreshTokenHandler(rr, req)
+			if rr.Result().StatusCode != tt.ResponseCode {
+				t.Errorf("got %d, want %d", rr.Result().StatusCode, tt.ResponseCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/James-D-Wood/blog-api/internal/auth"
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+func (app *App) FetchDeletedBlogPostsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		app.Logger.Error("failed to identify user", "location", "FetchDeletedBlogPostsHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	userID := principal.UserID
+
+	posts, err := app.BlogService.FetchDeletedBlogPosts(r.Context(), userID)
+	if err != nil {
+		app.Logger.Error("failed to fetch deleted blog posts", "error", err, "location", "FetchDeletedBlogPostsHandler")
+		httputils.RespondWithJsonError(w, "failed to fetch deleted blog posts", 500)
+		return
+	}
+
+	type Response struct {
+		Posts []model.BlogPost `json:"posts"`
+	}
+
+	httputils.RespondWithJson(w, Response{
+		Posts: posts,
+	}, 200)
+}
+
+func (app *App) RestoreBlogPostHandler(w http.ResponseWriter, r *http.Request) {
+	postID := r.PathValue("id")
+
+	storedPost, err := app.BlogService.FetchDeletedBlogPost(r.Context(), postID)
+	if err != nil {
+		app.Logger.Error("failed to fetch deleted blog post", "error", err, "location", "RestoreBlogPostHandler")
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: deleted blog post with ID %s does not exist", postID), 404)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	// validate user owns resource
+	userID := auth.UserID(r.Context())
+
+	if storedPost.AuthorID != userID {
+		app.Logger.Error("requestor does not own the blog post they are restoring", "location", "RestoreBlogPostHandler", "originalAuthor", storedPost.AuthorID, "requestor", userID)
+		httputils.RespondWithJsonError(w, "not authorized to update this resource", 403)
+		return
+	}
+
+	if _, ok := app.checkIfMatch(w, r, storedPost, "RestoreBlogPostHandler"); !ok {
+		return
+	}
+
+	err = app.BlogService.RestoreBlogPost(r.Context(), userID, &storedPost)
+	if err != nil {
+		app.Logger.Error("failed to restore blog post", "error", err, "location", "RestoreBlogPostHandler")
+		switch {
+		case errors.Is(err, db.ErrEntityNotFound):
+			httputils.RespondWithJsonError(w, fmt.Sprintf("invalid request: deleted blog post with ID %s does not exist", postID), 404)
+		case errors.Is(err, db.ErrVersionConflict):
+			httputils.RespondWithJsonError(w, "blog post has been modified since it was fetched", 412)
+		default:
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+		}
+		return
+	}
+
+	type Response struct {
+		Post model.BlogPost `json:"post"`
+	}
+
+	w.Header().Set("ETag", httputils.ETag(storedPost.Version))
+	httputils.RespondWithJson(w, Response{
+		Post: storedPost,
+	}, 200)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// seedDeletedPost creates a post owned by kishiguro and moves it to the trash
+func seedDeletedPost(t *testing.T, app *App) model.BlogPost {
+	t.Helper()
+
+	post := &model.BlogPost{Title: "deleted", Status: model.PUBLISHED}
+	err := app.BlogService.CreateBlogPost(context.TODO(), "0197aaed-4a35-74da-8574-4165524a1111", post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.BlogService.DeleteBlogPost(context.TODO(), post.AuthorID, post.ID, db.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := app.BlogService.FetchDeletedBlogPost(context.TODO(), post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deleted
+}
+
+func TestRestoreBlogPostHandler(t *testing.T) {
+	tests := []struct {
+		Name         string
+		User         string
+		IfMatch      string
+		Live         bool
+		ResponseCode int
+	}{
+		{
+			Name:         "Same Owner",
+			User:         "0197aaed-4a35-74da-8574-4165524a1111",
+			ResponseCode: 200,
+		},
+		{
+			Name:         "Same Owner - Current If-Match",
+			User:         "0197aaed-4a35-74da-8574-4165524a1111",
+			IfMatch:      `"2"`,
+			ResponseCode: 200,
+		},
+		{
+			Name:         "Same Owner - Stale If-Match",
+			User:         "0197aaed-4a35-74da-8574-4165524a1111",
+			IfMatch:      `"1"`,
+			ResponseCode: 412,
+		},
+		{
+			Name:         "Different Owner",
+			User:         "0197aaed-4a35-74da-8574-4165524a2222",
+			ResponseCode: 403,
+		},
+		{
+			Name:         "Post Not In Trash",
+			User:         "0197aaed-4a35-74da-8574-4165524a1111",
+			Live:         true,
+			ResponseCode: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			app := &App{
+				Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				BlogService: db.NewInMemoryBlogService(),
+			}
+			post := seedDeletedPost(t, app)
+			if tt.Live {
+				if err := app.BlogService.RestoreBlogPost(context.TODO(), post.AuthorID, &post); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req := httptest.NewRequest("POST", fmt.Sprintf("/api/v1/posts/%s/restore", post.ID), nil)
+			req.SetPathValue("id", post.ID)
+			if tt.IfMatch != "" {
+				req.Header.Set("If-Match", tt.IfMatch)
+			}
+			req = req.WithContext(withUser(req.Context(), tt.User))
+			rr := httptest.NewRecorder()
+
+			app.RestoreBlogPostHandler(rr, req)
+			if rr.Result().StatusCode != tt.ResponseCode {
+				t.Fatalf("got %d, want %d", rr.Result().StatusCode, tt.ResponseCode)
+			}
+			if tt.ResponseCode != 200 {
+				return
+			}
+
+			restored, err := app.BlogService.FetchBlogPost(context.TODO(), post.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored.Status != model.DRAFT {
+				t.Errorf("got Status %q, want %q", restored.Status, model.DRAFT)
+			}
+			if etag := rr.Header().Get("ETag"); etag != `"3"` {
+				t.Errorf("got ETag %s, want %s", etag, `"3"`)
+			}
+		})
+	}
+}
+
+func TestFetchDeletedBlogPostsHandler(t *testing.T) {
+	app := &App{
+		Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		BlogService: db.NewInMemoryBlogService(),
+	}
+	post := seedDeletedPost(t, app)
+
+	for user, want := range map[string]int{
+		"0197aaed-4a35-74da-8574-4165524a1111": 1,
+		"0197aaed-4a35-74da-8574-4165524a2222": 0,
+	} {
+		req := httptest.NewRequest("GET", "/api/v1/posts/trash", nil)
+		req = req.WithContext(withUser(req.Context(), user))
+		rr := httptest.NewRecorder()
+
+		app.FetchDeletedBlogPostsHandler(rr, req)
+		if rr.Result().StatusCode != 200 {
+			t.Fatalf("got %d, want %d", rr.Result().StatusCode, 200)
+		}
+
+		var resp struct {
+			Posts []model.BlogPost `json:"posts"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Posts) != want {
+			t.Errorf("got %d posts in the trash of %s, want %d", len(resp.Posts), user, want)
+		}
+		if want > 0 && resp.Posts[0].ID != post.ID {
+			t.Errorf("got %+v, want %s", resp.Posts[0], post.ID)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
+	"github.com/James-D-Wood/blog-api/internal/totp"
+)
+
+// errInvalidSecondFactor is returned by verifySecondFactor when the code or recovery code is wrong
+var errInvalidSecondFactor = errors.New("invalid two-factor code")
+
+// TwoFactorCodeRequest carries the second factor proving a user is who they say they are
+type TwoFactorCodeRequest struct {
+	// Code is the current code from the user's authenticator app
+	Code string `json:"code"`
+	// RecoveryCode can be sent instead of Code by users who have lost their device. Each one only works once.
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type EnrollTwoFactorResponse struct {
+	Secret string `json:"secret"`
+	// OTPAuthURI enrolls the secret in an authenticator app, usually by being shown as a QR code
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type ConfirmTwoFactorResponse struct {
+	// RecoveryCodes are only ever returned here, as only their hashes are stored
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorChallengeResponse is returned instead of tokens when a user with two-factor authentication enabled
+// logs in with their password
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	// ExpiresIn is the number of seconds until ChallengeToken expires
+	ExpiresIn int `json:"expires_in"`
+}
+
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	TwoFactorCodeRequest
+}
+
+// EnrollTwoFactorHandler generates a TOTP secret for the user, which does not guard their logins until it is
+// confirmed with a code from it
+func (app *App) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := app.sessionPrincipal(w, r, "EnrollTwoFactorHandler")
+	if !ok {
+		return
+	}
+
+	user, err := app.UserService.FetchUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		app.Logger.Error("failed to fetch user", "error", err, "location", "EnrollTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.Logger.Error("failed to generate TOTP secret", "error", err, "location", "EnrollTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	err = app.TwoFactorService.CreateTOTPEnrollment(r.Context(), &db.TOTPEnrollment{
+		UserID:    user.ID,
+		Secret:    secret,
+		CreatedTS: time.Now(),
+	})
+	if err != nil {
+		app.Logger.Error("failed to persist TOTP enrollment", "error", err, "location", "EnrollTwoFactorHandler")
+		if errors.Is(err, db.ErrTwoFactorEnabled) {
+			httputils.RespondWithJsonError(w, "two-factor authentication is already enabled - disable it first", 409)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.RespondWithJson(w, EnrollTwoFactorResponse{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(httputils.AccessTokens.Issuer, user.Username, secret),
+	}, 200)
+}
+
+// ConfirmTwoFactorHandler enables two-factor authentication once the user proves their authenticator app has
+// the secret, responding with their recovery codes
+func (app *App) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := app.sessionPrincipal(w, r, "ConfirmTwoFactorHandler")
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.Logger.Error("failed to read two-factor payload", "error", err, "location", "ConfirmTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+
+	enrollment, err := app.TwoFactorService.FetchTOTPEnrollment(r.Context(), principal.UserID)
+	if err != nil {
+		app.Logger.Error("failed to fetch TOTP enrollment", "error", err, "location", "ConfirmTwoFactorHandler")
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, "invalid request: enroll in two-factor authentication first", 404)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	if enrollment.Enabled() {
+		app.Logger.Error("TOTP enrollment already confirmed", "location", "ConfirmTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "two-factor authentication is already enabled", 409)
+		return
+	}
+
+	now := time.Now()
+	step, ok := totp.Validate(enrollment.Secret, req.Code, now)
+	if !ok {
+		app.Logger.Error("invalid TOTP code", "location", "ConfirmTwoFactorHandler")
+		httputils.RespondWithJsonError(w, errInvalidSecondFactor.Error(), 400)
+		return
+	}
+
+	codes, hashes, err := db.NewRecoveryCodes()
+	if err != nil {
+		app.Logger.Error("failed to generate recovery codes", "error", err, "location", "ConfirmTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	err = app.TwoFactorService.ConfirmTOTPEnrollment(r.Context(), principal.UserID, now, step, hashes)
+	if err != nil {
+		app.Logger.Error("failed to confirm TOTP enrollment", "error", err, "location", "ConfirmTwoFactorHandler")
+		if errors.Is(err, db.ErrTwoFactorEnabled) {
+			httputils.RespondWithJsonError(w, "two-factor authentication is already enabled", 409)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	app.Logger.Info("enabled two-factor authentication", "userID", principal.UserID)
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.RespondWithJson(w, ConfirmTwoFactorResponse{RecoveryCodes: codes}, 200)
+}
+
+// DisableTwoFactorHandler turns off two-factor authentication, which takes a code or recovery code so that a
+// stolen session cannot be used to do so
+func (app *App) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := app.sessionPrincipal(w, r, "DisableTwoFactorHandler")
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.Logger.Error("failed to read two-factor payload", "error", err, "location", "DisableTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+
+	enrollment, err := app.TwoFactorService.FetchTOTPEnrollment(r.Context(), principal.UserID)
+	if err != nil && !errors.Is(err, db.ErrEntityNotFound) {
+		app.Logger.Error("failed to fetch TOTP enrollment", "error", err, "location", "DisableTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	if err != nil || !enrollment.Enabled() {
+		app.Logger.Error("two-factor authentication not enabled", "location", "DisableTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "invalid request: two-factor authentication is not enabled", 404)
+		return
+	}
+
+	err = app.verifySecondFactor(r.Context(), enrollment, req)
+	if err != nil {
+		app.Logger.Error("failed to verify second factor", "error", err, "location", "DisableTwoFactorHandler")
+		if errors.Is(err, errInvalidSecondFactor) {
+			httputils.RespondWithJsonError(w, errInvalidSecondFactor.Error(), 403)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	err = app.TwoFactorService.DeleteTOTPEnrollment(r.Context(), principal.UserID)
+	if err != nil && !errors.Is(err, db.ErrEntityNotFound) {
+		app.Logger.Error("failed to delete TOTP enrollment", "error", err, "location", "DisableTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	app.Logger.Info("disabled two-factor authentication", "userID", principal.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginTwoFactorHandler completes the login of a user with two-factor authentication enabled, exchanging the
+// challenge token from LoginHandler and a code for tokens
+func (app *App) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req LoginTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+		app.Logger.Error("failed to read two-factor login payload", "error", err, "location", "LoginTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+
+	var claims httputils.ChallengeClaims
+	if err := httputils.ExtractChallengeClaims(req.ChallengeToken, &claims); err != nil {
+		app.Logger.Error("failed to verify challenge token", "error", err, "location", "LoginTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "invalid or expired challenge token - log in again", 401)
+		return
+	}
+	revoked, err := app.TokenRevocationService.IsTokenRevoked(r.Context(), claims.TokenID, claims.UserID, time.Unix(claims.IssuedAt, 0))
+	if err != nil {
+		app.Logger.Error("failed to check token revocation", "error", err, "location", "LoginTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	if revoked {
+		app.Logger.Error("challenge token has been used or revoked", "location", "LoginTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "invalid or expired challenge token - log in again", 401)
+		return
+	}
+
+	user, err := app.UserService.FetchUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		app.Logger.Error("failed to fetch user", "error", err, "location", "LoginTwoFactorHandler")
+		if errors.Is(err, db.ErrEntityNotFound) {
+			httputils.RespondWithJsonError(w, "invalid or expired challenge token - log in again", 401)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	// guesses at codes count towards the same lockouts as guesses at passwords
+	var lockouts []loginLockout
+	if app.LockoutService != nil {
+		lockouts = app.loginLockouts(r, user.Username)
+		if !app.checkLoginLockouts(w, r, "LoginTwoFactorHandler", lockouts) {
+			return
+		}
+	}
+
+	enrollment, err := app.TwoFactorService.FetchTOTPEnrollment(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, db.ErrEntityNotFound) {
+		app.Logger.Error("failed to fetch TOTP enrollment", "error", err, "location", "LoginTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+	// two-factor authentication was disabled since the challenge was issued
+	if err != nil || !enrollment.Enabled() {
+		app.Logger.Error("two-factor authentication not enabled", "location", "LoginTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "invalid or expired challenge token - log in again", 401)
+		return
+	}
+
+	err = app.verifySecondFactor(r.Context(), enrollment, req.TwoFactorCodeRequest)
+	if err != nil {
+		app.Logger.Error("failed to verify second factor", "error", err, "location", "LoginTwoFactorHandler")
+		if errors.Is(err, errInvalidSecondFactor) {
+			if app.LockoutService != nil && app.recordLoginFailure(w, r, "LoginTwoFactorHandler", lockouts) {
+				return
+			}
+			httputils.RespondWithJsonError(w, errInvalidSecondFactor.Error(), 401)
+			return
+		}
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	// each challenge can only be used to log in once
+	err = app.TokenRevocationService.RevokeToken(r.Context(), claims.TokenID, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		app.Logger.Error("failed to revoke challenge token", "error", err, "location", "LoginTwoFactorHandler")
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	if app.LockoutService != nil && !app.clearLoginLockout(w, r, "LoginTwoFactorHandler", lockouts) {
+		return
+	}
+
+	app.startSession(w, r, "LoginTwoFactorHandler", user)
+}
+
+// twoFactorEnabled reports whether logging in as userID takes a second factor
+func (app *App) twoFactorEnabled(ctx context.Context, userID string) (bool, error) {
+	enrollment, err := app.TwoFactorService.FetchTOTPEnrollment(ctx, userID)
+	if err != nil {
+		if errors.Is(err, db.ErrEntityNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return enrollment.Enabled(), nil
+}
+
+// checkSecondFactor responds with a challenge and returns false if user has two-factor authentication enabled,
+// as they have to enter a code before they are logged in
+func (app *App) checkSecondFactor(w http.ResponseWriter, r *http.Request, location string, user *model.User) bool {
+	if app.TwoFactorService == nil {
+		return true
+	}
+
+	enabled, err := app.twoFactorEnabled(r.Context(), user.ID)
+	if err != nil {
+		app.Logger.Error("failed to fetch TOTP enrollment", "error", err, "location", location)
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return false
+	}
+	if enabled {
+		app.respondWithChallenge(w, location, user)
+		return false
+	}
+	return true
+}
+
+// respondWithChallenge responds with a challenge token for user to exchange for tokens along with a code
+func (app *App) respondWithChallenge(w http.ResponseWriter, location string, user *model.User) {
+	token, err := httputils.GenerateChallengeToken(user.ID)
+	if err != nil {
+		app.Logger.Error("failed to generate challenge token", "error", err, "location", location)
+		httputils.RespondWithJsonError(w, "internal service error", 500)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.RespondWithJson(w, TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresIn:         int(httputils.ChallengeTokenTTL.Seconds()),
+	}, 200)
+}
+
+// verifySecondFactor checks the code or recovery code in req against enrollment, using it up so that it cannot
+// be replayed. Returns an error wrapping errInvalidSecondFactor if it is wrong or has been used.
+func (app *App) verifySecondFactor(ctx context.Context, enrollment *db.TOTPEnrollment, req TwoFactorCodeRequest) error {
+	now := time.Now()
+
+	switch {
+	case req.Code != "":
+		step, ok := totp.Validate(enrollment.Secret, req.Code, now)
+		if !ok {
+			return errInvalidSecondFactor
+		}
+		err := app.TwoFactorService.UseTOTPStep(ctx, enrollment.UserID, step)
+		if errors.Is(err, db.ErrTOTPCodeReused) {
+			return fmt.Errorf("%w: %w", errInvalidSecondFactor, err)
+		}
+		return err
+	case req.RecoveryCode != "":
+		err := app.TwoFactorService.UseRecoveryCode(ctx, enrollment.UserID, db.HashRecoveryCode(req.RecoveryCode), now)
+		if errors.Is(err, db.ErrInvalidRecoveryCode) {
+			return fmt.Errorf("%w: %w", errInvalidSecondFactor, err)
+		}
+		if err == nil {
+			app.Logger.Warn("used a recovery code", "userID", enrollment.UserID)
+		}
+		return err
+	default:
+		return fmt.Errorf("%w: no code provided", errInvalidSecondFactor)
+	}
+}
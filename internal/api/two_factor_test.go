@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/model"
+	"github.com/James-D-Wood/blog-api/internal/totp"
+)
+
+// newTwoFactorTestServer returns a server with two-factor authentication, locking out usernames after 3 failed
+// logins
+func newTwoFactorTestServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	return newTestServer(t, func(app *App) {
+		policy := db.LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, ResetAfter: 24 * time.Hour}
+		app.LockoutService = db.NewInMemoryLockoutService()
+		app.UsernameLockouts = policy
+		app.IPLockouts = policy
+		app.TwoFactorService = db.NewInMemoryTwoFactorService()
+	})
+}
+
+// mustEnableTwoFactor enrolls and confirms the user the access token belongs to, returning their secret and
+// recovery codes along with the time step of the code used to confirm
+func mustEnableTwoFactor(t *testing.T, h http.Handler, accessToken string) (string, []string, int64) {
+	t.Helper()
+
+	rr := serve(h, "POST", "/api/v1/me/2fa/enroll", accessToken, "")
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d enrolling, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+	var enrolled EnrollTwoFactorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&enrolled); err != nil {
+		t.Fatal(err)
+	}
+
+	step := totp.Step(time.Now())
+	rr = serve(h, "POST", "/api/v1/me/2fa/confirm", accessToken, codeBody(t, enrolled.Secret, step))
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d confirming, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+	var confirmed ConfirmTwoFactorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&confirmed); err != nil {
+		t.Fatal(err)
+	}
+	return enrolled.Secret, confirmed.RecoveryCodes, step
+}
+
+// codeBody returns a request body with the code for the given time step
+func codeBody(t *testing.T, secret string, step int64) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf(`{"code": %q}`, code)
+}
+
+// mustGetChallenge logs in with a password as a user with two-factor authentication enabled
+func mustGetChallenge(t *testing.T, h http.Handler, username string) string {
+	t.Helper()
+
+	rr := logIn(h, "192.0.2.10", username, "a long password")
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d logging in, want %d", rr.Result().StatusCode, 200)
+	}
+	var resp TwoFactorChallengeResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.TwoFactorRequired || resp.ChallengeToken == "" {
+		t.Fatalf("got %+v, want a challenge", resp)
+	}
+	return resp.ChallengeToken
+}
+
+func loginTwoFactor(h http.Handler, challenge, field, code string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"challenge_token": %q, %q: %q}`, challenge, field, code)
+	return serve(h, "POST", "/api/v1/login/2fa", "", body)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	h := newTwoFactorTestServer(t)
+	secret, recoveryCodes, step := mustEnableTwoFactor(t, h, mustLogIn(t, h, "admin").Token)
+	if len(recoveryCodes) == 0 {
+		t.Fatal("expected recovery codes")
+	}
+
+	challenge := mustGetChallenge(t, h, "admin")
+
+	// the challenge is no good as an access token
+	if rr := serve(h, "GET", "/api/v1/me/posts", challenge, ""); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d using the challenge as an access token, want %d", rr.Result().StatusCode, 401)
+	}
+
+	// the code used to confirm cannot be replayed
+	code, _ := totp.Code(secret, step)
+	if rr := loginTwoFactor(h, challenge, "code", code); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d replaying the confirming code, want %d", rr.Result().StatusCode, 401)
+	}
+
+	code, _ = totp.Code(secret, step+1)
+	rr := loginTwoFactor(h, challenge, "code", code)
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d with a valid code, want %d: %s", rr.Result().StatusCode, 200, rr.Body.String())
+	}
+	var login LoginResponse
+	if err := json.NewDecoder(rr.Body).Decode(&login); err != nil {
+		t.Fatal(err)
+	}
+	assertSession(t, h, login, true)
+
+	// each challenge can only be used once
+	if rr := loginTwoFactor(h, challenge, "recovery_code", recoveryCodes[0]); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d reusing the challenge, want %d", rr.Result().StatusCode, 401)
+	}
+
+	// each recovery code only works once, however it is written
+	if rr := loginTwoFactor(h, mustGetChallenge(t, h, "admin"), "recovery_code", recoveryCodes[0]); rr.Result().StatusCode != 200 {
+		t.Errorf("got %d with a recovery code, want %d", rr.Result().StatusCode, 200)
+	}
+	if rr := loginTwoFactor(h, mustGetChallenge(t, h, "admin"), "recovery_code", strings.ToUpper(recoveryCodes[0])); rr.Result().StatusCode != 401 {
+		t.Errorf("got %d reusing a recovery code, want %d", rr.Result().StatusCode, 401)
+	}
+}
+
+func TestTwoFactorLoginLockout(t *testing.T) {
+	h := newTwoFactorTestServer(t)
+	mustEnableTwoFactor(t, h, mustLogIn(t, h, "admin").Token)
+	challenge := mustGetChallenge(t, h, "admin")
+
+	for i := range 2 {
+		if rr := loginTwoFactor(h, challenge, "code", "000000"); rr.Result().StatusCode != 401 {
+			t.Fatalf("got %d for wrong code %d, want %d", rr.Result().StatusCode, i+1, 401)
+		}
+	}
+	if rr := loginTwoFactor(h, challenge, "code", "000000"); rr.Result().StatusCode != 429 {
+		t.Fatalf("got %d for the wrong code reaching the threshold, want %d", rr.Result().StatusCode, 429)
+	}
+	if rr := logIn(h, "192.0.2.10", "admin", "a long password"); rr.Result().StatusCode != 429 {
+		t.Errorf("got %d logging in while locked out, want %d", rr.Result().StatusCode, 429)
+	}
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	h := newTwoFactorTestServer(t)
+	login := mustLogIn(t, h, "dsedaris")
+
+	if rr := serve(h, "POST", "/api/v1/me/2fa/confirm", login.Token, `{"code": "123456"}`); rr.Result().StatusCode != 404 {
+		t.Errorf("got %d confirming before enrolling, want %d", rr.Result().StatusCode, 404)
+	}
+	if rr := serve(h, "POST", "/api/v1/me/2fa/disable", login.Token, `{"code": "123456"}`); rr.Result().StatusCode != 404 {
+		t.Errorf("got %d disabling before enrolling, want %d", rr.Result().StatusCode, 404)
+	}
+
+	// API tokens cannot be used to manage two-factor authentication
+	apiToken := mustCreateAPIToken(t, h, login.Token, string(model.PermWritePosts))
+	if rr := serve(h, "POST", "/api/v1/me/2fa/enroll", apiToken.Token, ""); rr.Result().StatusCode != 403 {
+		t.Errorf("got %d enrolling with an API token, want %d", rr.Result().StatusCode, 403)
+	}
+
+	rr := serve(h, "POST", "/api/v1/me/2fa/enroll", login.Token, "")
+	if rr.Result().StatusCode != 200 {
+		t.Fatalf("got %d enrolling, want %d", rr.Result().StatusCode, 200)
+	}
+	var enrolled EnrollTwoFactorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&enrolled); err != nil {
+		t.Fatal(err)
+	}
+	if want := "otpauth://totp/blog-api:dsedaris?"; !strings.HasPrefix(enrolled.OTPAuthURI, want) {
+		t.Errorf("got URI %s, want it to start with %s", enrolled.OTPAuthURI, want)
+	}
+
+	// an unconfirmed enrollment does not guard logins
+	mustLogIn(t, h, "dsedaris")
+
+	if rr := serve(h, "POST", "/api/v1/me/2fa/confirm", login.Token, `{"code": "not a code"}`); rr.Result().StatusCode != 400 {
+		t.Errorf("got %d confirming with a wrong code, want %d", rr.Result().StatusCode, 400)
+	}
+
+	secret, _, step := mustEnableTwoFactor(t, h, login.Token)
+	if rr := serve(h, "POST", "/api/v1/me/2fa/enroll", login.Token, ""); rr.Result().StatusCode != 409 {
+		t.Errorf("got %d enrolling again, want %d", rr.Result().StatusCode, 409)
+	}
+
+	if rr := serve(h, "POST", "/api/v1/me/2fa/disable", login.Token, `{"code": "000000"}`); rr.Result().StatusCode != 403 {
+		t.Errorf("got %d disabling with a wrong code, want %d", rr.Result().StatusCode, 403)
+	}
+	if rr := serve(h, "POST", "/api/v1/me/2fa/disable", login.Token, codeBody(t, secret, step+1)); rr.Result().StatusCode != 204 {
+		t.Fatalf("got %d disabling, want %d", rr.Result().StatusCode, 204)
+	}
+	mustLogIn(t, h, "dsedaris")
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	// Email is required when mail is enabled, and has to be verified before the user can publish. Otherwise it is
+	// ignored.
+	Email string `json:"email"`
+}
+
+func (app *App) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.Logger.Error("failed to read user payload", "error", err, "location", "CreateUserHandler")
+		httputils.RespondWithJsonError(w, "invalid request body", 400)
+		return
+	}
+
+	user, err := db.NewUser(req.Username, req.Name, req.Password)
+	if err != nil {
+		app.Logger.Error("invalid user details", "error", err, "location", "CreateUserHandler")
+		switch {
+		case errors.Is(err, db.ErrInvalidUsername), errors.Is(err, db.ErrInvalidName), errors.Is(err, db.ErrWeakPassword):
+			httputils.RespondWithJsonError(w, err.Error(), 400)
+		default:
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+		}
+		return
+	}
+
+	if app.Mailer != nil {
+		user.Email, err = db.NormalizeEmail(req.Email)
+		if err != nil {
+			app.Logger.Error("invalid email address", "error", err, "location", "CreateUserHandler")
+			httputils.RespondWithJsonError(w, err.Error(), 400)
+			return
+		}
+	}
+
+	err = app.UserService.CreateUser(r.Context(), user)
+	if err != nil {
+		app.Logger.Error("failed to persist user", "error", err, "location", "CreateUserHandler")
+		switch {
+		case errors.Is(err, db.ErrUserAlreadyExists):
+			httputils.RespondWithJsonError(w, "cannot create user - username is already taken", 400)
+		case errors.Is(err, db.ErrEmailAlreadyInUse):
+			httputils.RespondWithJsonError(w, "cannot create user - email address is already in use", 400)
+		default:
+			httputils.RespondWithJsonError(w, "internal service error", 500)
+		}
+		return
+	}
+
+	if app.Mailer != nil {
+		// sent without holding up sign up, and the user can ask for another if it never arrives
+		created := *user
+		app.goBackground(r, func(ctx context.Context) {
+			if err := app.sendVerificationEmail(ctx, &created); err != nil {
+				app.Logger.Error("failed to send verification email", "error", err, "location", "CreateUserHandler")
+			}
+		})
+	}
+
+	type Response struct {
+		User model.User `json:"user"`
+	}
+
+	httputils.RespondWithJson(w, Response{
+		User: *user,
+	}, 201)
+}
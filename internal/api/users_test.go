@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+var createUserTestCases = []struct {
+	Name         string
+	Body         string
+	ResponseCode int
+}{
+	{
+		Name:         "Happy Path",
+		Body:         `{"username": "gsaunders", "name": "George Saunders", "password": "lincoln in the bardo"}`,
+		ResponseCode: 201,
+	},
+	{
+		Name:         "Username Taken",
+		Body:         `{"username": "kishiguro", "name": "Kazuo Ishiguro", "password": "klara and the sun"}`,
+		ResponseCode: 400,
+	},
+	{
+		Name:         "Username Taken Different Case",
+		Body:         `{"username": "KIshiguro", "name": "Kazuo Ishiguro", "password": "klara and the sun"}`,
+		ResponseCode: 400,
+	},
+	{
+		Name:         "Invalid Username",
+		Body:         `{"username": "g saunders", "name": "George Saunders", "password": "lincoln in the bardo"}`,
+		ResponseCode: 400,
+	},
+	{
+		Name:         "Missing Name",
+		Body:         `{"username": "gsaunders", "password": "lincoln in the bardo"}`,
+		ResponseCode: 400,
+	},
+	{
+		Name:         "Weak Password",
+		Body:         `{"username": "gsaunders", "name": "George Saunders", "password": "short"}`,
+		ResponseCode: 400,
+	},
+	{
+		Name:         "Invalid Body",
+		Body:         `{"username": `,
+		ResponseCode: 400,
+	},
+}
+
+func TestCreateUserHandler(t *testing.T) {
+	for _, tt := range createUserTestCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			users := &db.InMemoryUserService{
+				Users: map[string]*model.User{
+					"kishiguro": {ID: "0197aaed-4a35-74da-8574-4165524a1111", Username: "kishiguro"},
+				},
+			}
+			app := App{
+				Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				UserService: users,
+			}
+
+			req := httptest.NewRequest("POST", "/api/v1/users", strings.NewReader(tt.Body))
+			rr := httptest.NewRecorder()
+
+			app.CreateUserHandler(rr, req)
+			if rr.Result().StatusCode != tt.ResponseCode {
+				t.Fatalf("got %d, want %d", rr.Result().StatusCode, tt.ResponseCode)
+			}
+			if tt.ResponseCode != 201 {
+				return
+			}
+
+			var resp struct {
+				User map[string]any `json:"user"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.User["id"] == "" || resp.User["username"] != "gsaunders" {
+				t.Errorf("got %v, want the created user", resp.User)
+			}
+			if _, ok := resp.User["password_hash"]; ok {
+				t.Error("the password hash must not be returned")
+			}
+
+			// the new user can log in straight away
+			if _, err := users.AuthenticateUser("gsaunders", "lincoln in the bardo"); err != nil {
+				t.Errorf("got %v logging in, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Package auth identifies who a request was made by, from whichever kind of credential it carries
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+var (
+	// ErrNoCredentials is returned when a request does not carry any credentials, or none of the kind an
+	// Extractor looks for
+	ErrNoCredentials = errors.New("no credentials provided")
+	// ErrInvalidCredentials is returned, usually wrapped, when a request carries credentials that cannot be verified
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrTokenRevoked is returned when a request carries an access token that has been revoked
+	ErrTokenRevoked = fmt.Errorf("%w: token has been revoked", ErrInvalidCredentials)
+	// ErrUserSuspended is returned when a request carries credentials of a user an admin has suspended
+	ErrUserSuspended = fmt.Errorf("%w: user is suspended", ErrInvalidCredentials)
+)
+
+// Method is the kind of credential a request was authenticated with
+type Method string
+
+const (
+	MethodAccessToken   Method = "access_token"
+	MethodAPIToken      Method = "api_token"
+	MethodSessionCookie Method = "session_cookie"
+)
+
+// Principal is the user a request was made by, and how they proved it
+type Principal struct {
+	UserID string
+	Role   model.Role
+	Method Method
+	// TokenID identifies the access token or API token the request was made with
+	TokenID string
+	// SessionID and ExpiresAt describe the access token of MethodAccessToken and MethodSessionCookie requests,
+	// so that it can be revoked on logout
+	SessionID string
+	ExpiresAt time.Time
+	// Scopes limits what a MethodAPIToken request can do
+	Scopes []model.Permission
+}
+
+// Can reports whether the principal is allowed perm, by both their role and the scopes of their credential
+func (p *Principal) Can(perm model.Permission) bool {
+	return p.Role.Can(perm) && p.HasScope(perm)
+}
+
+// HasScope reports whether the credential the principal authenticated with may be used for perm. Only API
+// tokens are limited to scopes.
+func (p *Principal) HasScope(perm model.Permission) bool {
+	return p.Method != MethodAPIToken || slices.Contains(p.Scopes, perm)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying principal
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal a request was authenticated as, reporting false for anonymous requests
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// UserID returns the ID of the user a request was authenticated as, or an empty string for anonymous requests
+func UserID(ctx context.Context) string {
+	if principal, ok := FromContext(ctx); ok {
+		return principal.UserID
+	}
+	return ""
+}
+
+// Extractor finds and verifies one kind of credential in a request
+type Extractor interface {
+	// Extract returns ErrNoCredentials if the request does not carry the kind of credential the Extractor looks
+	// for, and an error wrapping ErrInvalidCredentials if it carries one that cannot be verified
+	Extract(r *http.Request) (*Principal, error)
+}
+
+// Authenticator identifies the principal of a request using the first of its extractors to find credentials
+type Authenticator struct {
+	extractors []Extractor
+}
+
+// NewAuthenticator returns an Authenticator trying extractors in the given order
+func NewAuthenticator(extractors ...Extractor) *Authenticator {
+	return &Authenticator{extractors: extractors}
+}
+
+// Authenticate returns the principal of r, or ErrNoCredentials if it is anonymous
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	for _, extractor := range a.extractors {
+		principal, err := extractor.Extract(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// AccessTokenExtractor verifies the access tokens issued on login, sent as bearer tokens. The user is read on
+// every request, so suspending them or changing their role applies straight away rather than once the token
+// expires.
+type AccessTokenExtractor struct {
+	revocations db.TokenRevocationService
+	users       db.UserService
+}
+
+func NewAccessTokenExtractor(revocations db.TokenRevocationService, users db.UserService) *AccessTokenExtractor {
+	return &AccessTokenExtractor{revocations: revocations, users: users}
+}
+
+func (e *AccessTokenExtractor) Extract(r *http.Request) (*Principal, error) {
+	token, err := httputils.DecodeBearerAuth(r)
+	if err != nil {
+		if errors.Is(err, httputils.ErrAuthHeaderMissing) {
+			return nil, ErrNoCredentials
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	return verifyAccessToken(r, e.revocations, e.users, token, MethodAccessToken)
+}
+
+// SessionCookieExtractor verifies the access tokens issued on login as a cookie, when cookie sessions are
+// enabled. Browsers send the cookie with requests other sites make them send too, so state-changing requests
+// must also send the session's CSRF token, signed with csrfKey, in a header.
+type SessionCookieExtractor struct {
+	revocations db.TokenRevocationService
+	users       db.UserService
+	csrfKey     []byte
+}
+
+func NewSessionCookieExtractor(revocations db.TokenRevocationService, users db.UserService, csrfKey []byte) *SessionCookieExtractor {
+	return &SessionCookieExtractor{revocations: revocations, users: users, csrfKey: csrfKey}
+}
+
+func (e *SessionCookieExtractor) Extract(r *http.Request) (*Principal, error) {
+	cookie, err := r.Cookie(httputils.SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, ErrNoCredentials
+	}
+
+	principal, err := verifyAccessToken(r, e.revocations, e.users, cookie.Value, MethodSessionCookie)
+	if err != nil {
+		return nil, err
+	}
+	if err := httputils.CheckCSRFToken(r, e.csrfKey, principal.SessionID); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	return principal, nil
+}
+
+// verifyAccessToken verifies an access token issued on login, returning the principal it was issued to
+func verifyAccessToken(r *http.Request, revocations db.TokenRevocationService, users db.UserService, token string, method Method) (*Principal, error) {
+	var claims httputils.AuthClaims
+	if err := httputils.ExtractJWTClaims(token, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	if claims.UserID == "" {
+		return nil, fmt.Errorf("%w: user ID came out empty", ErrInvalidCredentials)
+	}
+	// tokens without an ID could never be revoked
+	if claims.TokenID == "" {
+		return nil, fmt.Errorf("%w: token ID came out empty", ErrInvalidCredentials)
+	}
+
+	revoked, err := revocations.IsTokenRevoked(r.Context(), claims.TokenID, claims.UserID, time.Unix(claims.IssuedAt, 0))
+	if err != nil {
+		return nil, fmt.Errorf("error checking token revocation: %w", err)
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	user, err := activeUser(r, users, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{
+		UserID:    user.ID,
+		Role:      user.Role,
+		Method:    method,
+		TokenID:   claims.TokenID,
+		SessionID: claims.SessionID,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+// APITokenExtractor verifies API tokens, sent as bearer tokens. Like access tokens, the user is read on every
+// request.
+type APITokenExtractor struct {
+	apiTokens db.APITokenService
+	users     db.UserService
+}
+
+func NewAPITokenExtractor(apiTokens db.APITokenService, users db.UserService) *APITokenExtractor {
+	return &APITokenExtractor{apiTokens: apiTokens, users: users}
+}
+
+func (e *APITokenExtractor) Extract(r *http.Request) (*Principal, error) {
+	token, err := httputils.DecodeBearerAuth(r)
+	// anything else is left for the other extractors
+	if err != nil || !strings.HasPrefix(token, db.APITokenPrefix) {
+		return nil, ErrNoCredentials
+	}
+
+	apiToken, err := e.apiTokens.AuthenticateAPIToken(r.Context(), db.HashAPIToken(token), time.Now())
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidAPIToken) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+		}
+		return nil, fmt.Errorf("error authenticating API token: %w", err)
+	}
+
+	user, err := activeUser(r, e.users, apiToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{
+		UserID:  user.ID,
+		Role:    user.Role,
+		Method:  MethodAPIToken,
+		TokenID: apiToken.ID,
+		Scopes:  apiToken.Scopes,
+	}, nil
+}
+
+// activeUser returns the user a credential was issued to, failing if they no longer exist or are suspended
+func activeUser(r *http.Request, users db.UserService, userID string) (*model.User, error) {
+	user, err := users.FetchUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, db.ErrEntityNotFound) {
+			return nil, fmt.Errorf("%w: user %s does not exist", ErrInvalidCredentials, userID)
+		}
+		return nil, fmt.Errorf("error fetching user %s: %w", userID, err)
+	}
+	if user.Suspended {
+		return nil, ErrUserSuspended
+	}
+	return user, nil
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// APITokenPrefix starts every API token, so they can be told apart from access tokens and found by secret scanners
+const APITokenPrefix = "blog_pat_"
+
+// apiTokenLastUsedPrecision limits how often the last used time of a token is written, so that a script
+// making many requests does not make a write for each of them
+const apiTokenLastUsedPrecision = time.Minute
+
+var (
+	// ErrInvalidAPIToken is returned when an API token is unknown or has been deleted
+	ErrInvalidAPIToken = errors.New("invalid API token")
+	// ErrInvalidAPITokenName is returned when an API token's name is empty or too long
+	ErrInvalidAPITokenName = errors.New("API token names must be between 1 and 64 characters")
+	// ErrInvalidScopes is returned when an API token has no scopes, or an unknown one
+	ErrInvalidScopes = errors.New("API tokens must have at least one scope")
+)
+
+// APIToken is a long-lived credential a user creates for scripts and automation. It can only be used for the
+// permissions in its scopes which the user's role also grants. Only a hash of the token is stored.
+type APIToken struct {
+	ID        string             `json:"id"`
+	UserID    string             `json:"-"`
+	Name      string             `json:"name"`
+	Hash      string             `json:"-"`
+	Scopes    []model.Permission `json:"scopes"`
+	CreatedTS time.Time          `json:"created_ts"`
+	// LastUsedTS is nil until the token is first used, and only updated once a minute
+	LastUsedTS *time.Time `json:"last_used_ts"`
+}
+
+// HasScope reports whether the token may be used for perm
+func (t *APIToken) HasScope(perm model.Permission) bool {
+	return slices.Contains(t.Scopes, perm)
+}
+
+// NewAPIToken generates an API token for userID, returning the token to show the user once along with the
+// representation to store
+func NewAPIToken(userID, name string, scopes []string) (string, APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 64 {
+		return "", APIToken{}, ErrInvalidAPITokenName
+	}
+
+	if len(scopes) == 0 {
+		return "", APIToken{}, ErrInvalidScopes
+	}
+	perms := make([]model.Permission, 0, len(scopes))
+	for _, scope := range scopes {
+		perm, err := model.ParsePermission(scope)
+		if err != nil {
+			return "", APIToken{}, fmt.Errorf("%w: %w", ErrInvalidScopes, err)
+		}
+		if !slices.Contains(perms, perm) {
+			perms = append(perms, perm)
+		}
+	}
+	sort.Slice(perms, func(i, j int) bool { return perms[i] < perms[j] })
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", APIToken{}, fmt.Errorf("error generating API token: %w", err)
+	}
+	token := APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	return token, APIToken{
+		UserID:    userID,
+		Name:      name,
+		Hash:      HashAPIToken(token),
+		Scopes:    perms,
+		CreatedTS: time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+// HashAPIToken returns the stored form of an API token. Like refresh tokens, they are random so a fast hash
+// is enough.
+func HashAPIToken(token string) string {
+	return HashRefreshToken(token)
+}
+
+// APITokenService stores the API tokens users create
+type APITokenService interface {
+	// CreateAPIToken stores a new token, assigning its ID
+	CreateAPIToken(ctx context.Context, token *APIToken) error
+	// ListAPITokens returns the tokens of a user, oldest first
+	ListAPITokens(ctx context.Context, userID string) ([]APIToken, error)
+	// DeleteAPIToken deletes the token with the given ID, or fails with ErrEntityNotFound if the user has no such token
+	DeleteAPIToken(ctx context.Context, userID, id string) error
+	// DeleteUserAPITokens deletes every token of the user
+	DeleteUserAPITokens(ctx context.Context, userID string) error
+	// AuthenticateAPIToken returns the token with the given hash, recording that it was used at now, or fails with
+	// ErrInvalidAPIToken
+	AuthenticateAPIToken(ctx context.Context, hash string, now time.Time) (*APIToken, error)
+}
+
+// InMemoryAPITokenService implements APITokenService for the in-memory data store
+type InMemoryAPITokenService struct {
+	mu sync.Mutex
+	// tokens maps token hash to token
+	tokens map[string]*APIToken
+}
+
+func NewInMemoryAPITokenService() *InMemoryAPITokenService {
+	return &InMemoryAPITokenService{tokens: map[string]*APIToken{}}
+}
+
+func (s *InMemoryAPITokenService) CreateAPIToken(ctx context.Context, token *APIToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token.ID = assignUUID()
+	s.tokens[token.Hash] = copyAPIToken(token)
+	return nil
+}
+
+func (s *InMemoryAPITokenService) ListAPITokens(ctx context.Context, userID string) ([]APIToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := []APIToken{}
+	for _, token := range s.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, *copyAPIToken(token))
+		}
+	}
+	// IDs are time ordered, so break ties in creation time by them
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedTS.Equal(tokens[j].CreatedTS) {
+			return tokens[i].CreatedTS.Before(tokens[j].CreatedTS)
+		}
+		return tokens[i].ID < tokens[j].ID
+	})
+	return tokens, nil
+}
+
+func (s *InMemoryAPITokenService) DeleteAPIToken(ctx context.Context, userID, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, token := range s.tokens {
+		if token.ID == id && token.UserID == userID {
+			delete(s.tokens, hash)
+			return nil
+		}
+	}
+	return ErrEntityNotFound
+}
+
+func (s *InMemoryAPITokenService) DeleteUserAPITokens(ctx context.Context, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, token := range s.tokens {
+		if token.UserID == userID {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryAPITokenService) AuthenticateAPIToken(ctx context.Context, hash string, now time.Time) (*APIToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, ErrInvalidAPIToken
+	}
+	now = now.UTC().Truncate(time.Second)
+	if token.LastUsedTS == nil || now.Sub(*token.LastUsedTS) >= apiTokenLastUsedPrecision {
+		token.LastUsedTS = &now
+	}
+	return copyAPIToken(token), nil
+}
+
+// copyAPIToken copies token so that callers and the store cannot modify each other's copies
+func copyAPIToken(token *APIToken) *APIToken {
+	t := *token
+	t.Scopes = slices.Clone(token.Scopes)
+	if token.LastUsedTS != nil {
+		lastUsed := *token.LastUsedTS
+		t.LastUsedTS = &lastUsed
+	}
+	return &t
+}
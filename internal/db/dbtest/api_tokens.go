@@ -0,0 +1,188 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// APITokenServiceFactory returns a new APITokenService with no tokens for a single test, along with the
+// UserService that its tokens' users have to exist in
+type APITokenServiceFactory func(t *testing.T) (db.APITokenService, db.UserService)
+
+// RunAPITokenServiceSuite asserts the db.APITokenService contract against the implementation returned by newService
+func RunAPITokenServiceSuite(t *testing.T, newService APITokenServiceFactory) {
+	tests := []struct {
+		Name string
+		Run  func(t *testing.T, svc db.APITokenService, userID, otherUserID string)
+	}{
+		{"Create And List", testCreateAPIToken},
+		{"Authenticate", testAuthenticateAPIToken},
+		{"Authenticate Unknown Token", testAuthenticateUnknownAPIToken},
+		{"Last Used Is Throttled", testAPITokenLastUsed},
+		{"Delete", testDeleteAPIToken},
+		{"Delete Other User's Token", testDeleteOtherUsersAPIToken},
+		{"Delete User Tokens", testDeleteUserAPITokens},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			svc, users := newService(t)
+
+			user := mustNewUser(t, "kishiguro", "klara and the sun")
+			mustCreateUser(t, users, user)
+			other := mustNewUser(t, "dsedaris", "me talk pretty one day")
+			mustCreateUser(t, users, other)
+
+			tt.Run(t, svc, user.ID, other.ID)
+		})
+	}
+}
+
+// mustCreateAPIToken stores a token for userID, returning the token to present and its stored form
+func mustCreateAPIToken(t *testing.T, svc db.APITokenService, userID, name string) (string, db.APIToken) {
+	t.Helper()
+
+	secret, token, err := db.NewAPIToken(userID, name, []string{"posts:write", "posts:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreateAPIToken(context.Background(), &token); err != nil {
+		t.Fatal(err)
+	}
+	if token.ID == "" {
+		t.Fatal("expected ID to be assigned")
+	}
+	return secret, token
+}
+
+func testCreateAPIToken(t *testing.T, svc db.APITokenService, userID, otherUserID string) {
+	_, first := mustCreateAPIToken(t, svc, userID, "ci")
+	_, second := mustCreateAPIToken(t, svc, userID, "backups")
+	mustCreateAPIToken(t, svc, otherUserID, "ci")
+
+	tokens, err := svc.ListAPITokens(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []db.APIToken{first, second}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("got %+v, want %+v", tokens, want)
+	}
+	if want := []model.Permission{model.PermReadPosts, model.PermWritePosts}; !reflect.DeepEqual(tokens[0].Scopes, want) {
+		t.Errorf("got scopes %v, want %v", tokens[0].Scopes, want)
+	}
+}
+
+func testAuthenticateAPIToken(t *testing.T, svc db.APITokenService, userID, otherUserID string) {
+	secret, stored := mustCreateAPIToken(t, svc, userID, "ci")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	token, err := svc.AuthenticateAPIToken(context.Background(), db.HashAPIToken(secret), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ID != stored.ID || token.UserID != userID || !token.HasScope(model.PermWritePosts) || token.HasScope(model.PermModeratePosts) {
+		t.Errorf("got %+v, want %+v", *token, stored)
+	}
+	if token.LastUsedTS == nil || !token.LastUsedTS.Equal(now) {
+		t.Errorf("got LastUsedTS %v, want %s", token.LastUsedTS, now)
+	}
+}
+
+func testAuthenticateUnknownAPIToken(t *testing.T, svc db.APITokenService, userID, otherUserID string) {
+	mustCreateAPIToken(t, svc, userID, "ci")
+
+	_, err := svc.AuthenticateAPIToken(context.Background(), db.HashAPIToken(db.APITokenPrefix+"unknown"), time.Now())
+	if !errors.Is(err, db.ErrInvalidAPIToken) {
+		t.Errorf("got %v, want %v", err, db.ErrInvalidAPIToken)
+	}
+}
+
+func testAPITokenLastUsed(t *testing.T, svc db.APITokenService, userID, otherUserID string) {
+	secret, _ := mustCreateAPIToken(t, svc, userID, "ci")
+	hash := db.HashAPIToken(secret)
+	first := time.Now().UTC().Truncate(time.Second)
+
+	for _, tc := range []struct {
+		Used time.Time
+		Want time.Time
+	}{
+		{first, first},
+		// uses within a minute of the recorded one are not written
+		{first.Add(30 * time.Second), first},
+		{first.Add(2 * time.Minute), first.Add(2 * time.Minute)},
+	} {
+		if _, err := svc.AuthenticateAPIToken(context.Background(), hash, tc.Used); err != nil {
+			t.Fatal(err)
+		}
+		tokens, err := svc.ListAPITokens(context.Background(), userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tokens[0].LastUsedTS; got == nil || !got.Equal(tc.Want) {
+			t.Errorf("got LastUsedTS %v after use at %s, want %s", got, tc.Used, tc.Want)
+		}
+	}
+}
+
+func testDeleteAPIToken(t *testing.T, svc db.APITokenService, userID, otherUserID string) {
+	secret, token := mustCreateAPIToken(t, svc, userID, "ci")
+	_, kept := mustCreateAPIToken(t, svc, userID, "backups")
+
+	if err := svc.DeleteAPIToken(context.Background(), userID, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.AuthenticateAPIToken(context.Background(), db.HashAPIToken(secret), time.Now()); !errors.Is(err, db.ErrInvalidAPIToken) {
+		t.Errorf("got %v authenticating a deleted token, want %v", err, db.ErrInvalidAPIToken)
+	}
+	if err := svc.DeleteAPIToken(context.Background(), userID, token.ID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v deleting it again, want %v", err, db.ErrEntityNotFound)
+	}
+	if err := svc.DeleteAPIToken(context.Background(), userID, "not-a-uuid"); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v deleting an invalid ID, want %v", err, db.ErrEntityNotFound)
+	}
+
+	tokens, err := svc.ListAPITokens(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != kept.ID {
+		t.Errorf("got %+v, want only %+v", tokens, kept)
+	}
+}
+
+func testDeleteOtherUsersAPIToken(t *testing.T, svc db.APITokenService, userID, otherUserID string) {
+	secret, token := mustCreateAPIToken(t, svc, userID, "ci")
+
+	if err := svc.DeleteAPIToken(context.Background(), otherUserID, token.ID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+	if _, err := svc.AuthenticateAPIToken(context.Background(), db.HashAPIToken(secret), time.Now()); err != nil {
+		t.Errorf("got %v, want the token to still work", err)
+	}
+}
+
+func testDeleteUserAPITokens(t *testing.T, svc db.APITokenService, userID, otherUserID string) {
+	mustCreateAPIToken(t, svc, userID, "ci")
+	mustCreateAPIToken(t, svc, userID, "backups")
+	otherSecret, _ := mustCreateAPIToken(t, svc, otherUserID, "ci")
+
+	if err := svc.DeleteUserAPITokens(context.Background(), userID); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := svc.ListAPITokens(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("got %d tokens, want none", len(tokens))
+	}
+	if _, err := svc.AuthenticateAPIToken(context.Background(), db.HashAPIToken(otherSecret), time.Now()); err != nil {
+		t.Errorf("got %v, want other users' tokens to still work", err)
+	}
+}
@@ -0,0 +1,108 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+)
+
+// EmailTokenServiceFactory returns a new EmailTokenService with no tokens for a single test, along with the
+// UserService that token owners have to exist in
+type EmailTokenServiceFactory func(t *testing.T) (db.EmailTokenService, db.UserService)
+
+// RunEmailTokenServiceSuite asserts the db.EmailTokenService contract against the implementation returned by newService
+func RunEmailTokenServiceSuite(t *testing.T, newService EmailTokenServiceFactory) {
+	tests := []struct {
+		Name string
+		Run  func(t *testing.T, svc db.EmailTokenService, userID string)
+	}{
+		{"Create And Fetch", testCreateEmailToken},
+		{"Expired", testExpiredEmailToken},
+		{"Single Use", testConsumeEmailToken},
+		{"Latest Token Replaces Earlier Ones", testReplaceEmailToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			svc, users := newService(t)
+
+			user := mustNewUser(t, "kishiguro", "klara and the sun")
+			mustCreateUser(t, users, user)
+
+			tt.Run(t, svc, user.ID)
+		})
+	}
+}
+
+func mustCreateEmailToken(t *testing.T, svc db.EmailTokenService, userID string, purpose db.EmailTokenPurpose) db.EmailToken {
+	t.Helper()
+
+	_, token, err := db.NewEmailToken(userID, "kazuo@example.com", purpose, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreateEmailToken(context.Background(), &token); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func testCreateEmailToken(t *testing.T, svc db.EmailTokenService, userID string) {
+	token := mustCreateEmailToken(t, svc, userID, db.PurposePasswordReset)
+
+	stored, err := svc.FetchEmailToken(context.Background(), token.Hash, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stored != token {
+		t.Errorf("got %+v, want %+v", *stored, token)
+	}
+
+	if _, err := svc.FetchEmailToken(context.Background(), db.HashRefreshToken("unknown"), time.Now()); !errors.Is(err, db.ErrInvalidEmailToken) {
+		t.Errorf("got %v for an unknown token, want %v", err, db.ErrInvalidEmailToken)
+	}
+}
+
+func testExpiredEmailToken(t *testing.T, svc db.EmailTokenService, userID string) {
+	token := mustCreateEmailToken(t, svc, userID, db.PurposePasswordReset)
+
+	if _, err := svc.FetchEmailToken(context.Background(), token.Hash, token.ExpiresTS); !errors.Is(err, db.ErrInvalidEmailToken) {
+		t.Errorf("got %v once expired, want %v", err, db.ErrInvalidEmailToken)
+	}
+}
+
+func testConsumeEmailToken(t *testing.T, svc db.EmailTokenService, userID string) {
+	ctx := context.Background()
+	token := mustCreateEmailToken(t, svc, userID, db.PurposeEmailVerification)
+
+	if err := svc.ConsumeEmailToken(ctx, token.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ConsumeEmailToken(ctx, token.Hash); !errors.Is(err, db.ErrInvalidEmailToken) {
+		t.Errorf("got %v consuming twice, want %v", err, db.ErrInvalidEmailToken)
+	}
+	if _, err := svc.FetchEmailToken(ctx, token.Hash, time.Now()); !errors.Is(err, db.ErrInvalidEmailToken) {
+		t.Errorf("got %v fetching once consumed, want %v", err, db.ErrInvalidEmailToken)
+	}
+}
+
+func testReplaceEmailToken(t *testing.T, svc db.EmailTokenService, userID string) {
+	ctx := context.Background()
+
+	first := mustCreateEmailToken(t, svc, userID, db.PurposePasswordReset)
+	verification := mustCreateEmailToken(t, svc, userID, db.PurposeEmailVerification)
+	second := mustCreateEmailToken(t, svc, userID, db.PurposePasswordReset)
+
+	if _, err := svc.FetchEmailToken(ctx, first.Hash, time.Now()); !errors.Is(err, db.ErrInvalidEmailToken) {
+		t.Errorf("got %v for the replaced token, want %v", err, db.ErrInvalidEmailToken)
+	}
+	// tokens for other purposes are left alone
+	for _, token := range []db.EmailToken{second, verification} {
+		if _, err := svc.FetchEmailToken(ctx, token.Hash, time.Now()); err != nil {
+			t.Errorf("got %v for the %s token, want nil", err, token.Purpose)
+		}
+	}
+}
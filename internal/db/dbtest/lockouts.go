@@ -0,0 +1,163 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+)
+
+// LockoutServiceFactory returns a new LockoutService with no failures recorded for a single test
+type LockoutServiceFactory func(t *testing.T) db.LockoutService
+
+// testLockoutPolicy locks a key out for a minute after its third failure, doubling with each one after
+var testLockoutPolicy = db.LockoutPolicy{
+	Threshold:  3,
+	BaseDelay:  time.Minute,
+	MaxDelay:   time.Hour,
+	ResetAfter: 24 * time.Hour,
+}
+
+// RunLockoutServiceSuite asserts the db.LockoutService contract against the implementation returned by newService
+func RunLockoutServiceSuite(t *testing.T, newService LockoutServiceFactory) {
+	tests := []struct {
+		Name string
+		Run  func(t *testing.T, svc db.LockoutService)
+	}{
+		{"Record Failures", testRecordLoginFailures},
+		{"Failures Reset When Quiet", testLoginFailuresReset},
+		{"Fetch Unknown Key", testFetchUnknownLockout},
+		{"List", testListLockouts},
+		{"Clear", testClearLockout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.Run(t, newService(t))
+		})
+	}
+}
+
+// mustRecordLoginFailures records n failures for key, a second apart starting at start, returning the last count
+func mustRecordLoginFailures(t *testing.T, svc db.LockoutService, key string, start time.Time, n int) *db.Lockout {
+	t.Helper()
+
+	var lockout *db.Lockout
+	for i := range n {
+		var err error
+		lockout, err = svc.RecordLoginFailure(context.Background(), key, start.Add(time.Duration(i)*time.Second), testLockoutPolicy)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return lockout
+}
+
+func testRecordLoginFailures(t *testing.T, svc db.LockoutService) {
+	start := time.Now().UTC().Truncate(time.Second)
+
+	lockout := mustRecordLoginFailures(t, svc, "username:kishiguro", start, 2)
+	if lockout.Failures != 2 || lockout.LockedUntilTS != nil {
+		t.Fatalf("got %d failures locked until %v, want 2 failures and no lockout", lockout.Failures, lockout.LockedUntilTS)
+	}
+
+	// the third failure locks the key out
+	lockout = mustRecordLoginFailures(t, svc, "username:kishiguro", start.Add(2*time.Second), 1)
+	wantLockedUntil := start.Add(2*time.Second + time.Minute)
+	if lockout.Failures != 3 || lockout.LockedUntilTS == nil || !lockout.LockedUntilTS.Equal(wantLockedUntil) {
+		t.Fatalf("got %d failures locked until %v, want 3 failures locked until %s", lockout.Failures, lockout.LockedUntilTS, wantLockedUntil)
+	}
+
+	// and each one after doubles the lockout
+	lockout = mustRecordLoginFailures(t, svc, "username:kishiguro", start.Add(3*time.Second), 1)
+	wantLockedUntil = start.Add(3*time.Second + 2*time.Minute)
+	if lockout.LockedUntilTS == nil || !lockout.LockedUntilTS.Equal(wantLockedUntil) {
+		t.Fatalf("got locked until %v, want %s", lockout.LockedUntilTS, wantLockedUntil)
+	}
+
+	fetched, err := svc.FetchLockout(context.Background(), "username:kishiguro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched.Key != "username:kishiguro" || fetched.Failures != 4 || !fetched.LastFailureTS.Equal(start.Add(3*time.Second)) {
+		t.Errorf("got %+v, want the recorded failures", fetched)
+	}
+	if fetched.LockedUntilTS == nil || !fetched.LockedUntilTS.Equal(wantLockedUntil) {
+		t.Errorf("got locked until %v, want %s", fetched.LockedUntilTS, wantLockedUntil)
+	}
+
+	// other keys are counted separately
+	other := mustRecordLoginFailures(t, svc, "ip:192.0.2.1", start, 1)
+	if other.Failures != 1 {
+		t.Errorf("got %d failures for another key, want 1", other.Failures)
+	}
+}
+
+func testLoginFailuresReset(t *testing.T, svc db.LockoutService) {
+	start := time.Now().UTC().Truncate(time.Second)
+	mustRecordLoginFailures(t, svc, "username:kishiguro", start, 2)
+
+	lockout := mustRecordLoginFailures(t, svc, "username:kishiguro", start.Add(testLockoutPolicy.ResetAfter+time.Hour), 1)
+	if lockout.Failures != 1 {
+		t.Errorf("got %d failures after going quiet, want 1", lockout.Failures)
+	}
+}
+
+func testFetchUnknownLockout(t *testing.T, svc db.LockoutService) {
+	if _, err := svc.FetchLockout(context.Background(), "username:nobody"); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+}
+
+func testListLockouts(t *testing.T, svc db.LockoutService) {
+	ctx := context.Background()
+
+	lockouts, err := svc.ListLockouts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lockouts) != 0 {
+		t.Fatalf("got %d lockouts, want none", len(lockouts))
+	}
+
+	start := time.Now().UTC().Truncate(time.Second)
+	mustRecordLoginFailures(t, svc, "username:kishiguro", start, 1)
+	mustRecordLoginFailures(t, svc, "ip:192.0.2.1", start.Add(time.Minute), 3)
+
+	lockouts, err = svc.ListLockouts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lockouts) != 2 {
+		t.Fatalf("got %d lockouts, want 2", len(lockouts))
+	}
+	if lockouts[0].Key != "ip:192.0.2.1" || lockouts[1].Key != "username:kishiguro" {
+		t.Errorf("got keys %s, %s, want the most recent failure first", lockouts[0].Key, lockouts[1].Key)
+	}
+	if lockouts[0].LockedUntilTS == nil || lockouts[1].LockedUntilTS != nil {
+		t.Errorf("got locked until %v and %v, want only the first locked out", lockouts[0].LockedUntilTS, lockouts[1].LockedUntilTS)
+	}
+}
+
+func testClearLockout(t *testing.T, svc db.LockoutService) {
+	ctx := context.Background()
+	mustRecordLoginFailures(t, svc, "username:kishiguro", time.Now(), 3)
+
+	if err := svc.ClearLockout(ctx, "username:kishiguro"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FetchLockout(ctx, "username:kishiguro"); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v after clearing, want %v", err, db.ErrEntityNotFound)
+	}
+	if err := svc.ClearLockout(ctx, "username:kishiguro"); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v clearing twice, want %v", err, db.ErrEntityNotFound)
+	}
+
+	// failures are counted from scratch afterwards
+	lockout := mustRecordLoginFailures(t, svc, "username:kishiguro", time.Now(), 1)
+	if lockout.Failures != 1 || lockout.LockedUntilTS != nil {
+		t.Errorf("got %d failures locked until %v, want 1 failure and no lockout", lockout.Failures, lockout.LockedUntilTS)
+	}
+}
@@ -0,0 +1,234 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+)
+
+// RefreshTokenServiceFactory returns a new RefreshTokenService with no tokens for a single test, along with
+// the UserService that its tokens' users have to exist in
+type RefreshTokenServiceFactory func(t *testing.T) (db.RefreshTokenService, db.UserService)
+
+// RunRefreshTokenServiceSuite asserts the db.RefreshTokenService contract against the implementation returned by newService
+func RunRefreshTokenServiceSuite(t *testing.T, newService RefreshTokenServiceFactory) {
+	tests := []struct {
+		Name string
+		Run  func(t *testing.T, svc db.RefreshTokenService, userID string)
+	}{
+		{"Fetch", testFetchRefreshToken},
+		{"Rotate", testRotateRefreshToken},
+		{"Rotate Unknown Token", testRotateUnknownRefreshToken},
+		{"Rotate Expired Token", testRotateExpiredRefreshToken},
+		{"Reuse Revokes Family", testRefreshTokenReuse},
+		{"Revoke Family", testRevokeRefreshTokenFamily},
+		{"Revoke User Tokens", testRevokeUserRefreshTokens},
+		{"Concurrent Rotations", testConcurrentRefreshTokenRotations},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			svc, users := newService(t)
+
+			user := mustNewUser(t, "kishiguro", "klara and the sun")
+			mustCreateUser(t, users, user)
+
+			tt.Run(t, svc, user.ID)
+		})
+	}
+}
+
+// mustLogIn stores a refresh token as if userID had just logged in, returning its hash
+func mustLogIn(t *testing.T, svc db.RefreshTokenService, userID string, ttl time.Duration) string {
+	t.Helper()
+
+	_, token, err := db.NewRefreshToken(userID, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreateRefreshToken(context.Background(), &token); err != nil {
+		t.Fatal(err)
+	}
+	return token.Hash
+}
+
+// rotate exchanges the token with the given hash for a new one, returning the new token
+func rotate(svc db.RefreshTokenService, hash string) (db.RefreshToken, error) {
+	_, next, err := db.NewRefreshToken("", time.Hour)
+	if err != nil {
+		return db.RefreshToken{}, err
+	}
+	err = svc.RotateRefreshToken(context.Background(), hash, &next)
+	return next, err
+}
+
+func testFetchRefreshToken(t *testing.T, svc db.RefreshTokenService, userID string) {
+	_, first, err := db.NewRefreshToken(userID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreateRefreshToken(context.Background(), &first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotate(svc, first.Hash); err != nil {
+		t.Fatal(err)
+	}
+
+	// used tokens can still be fetched
+	token, err := svc.FetchRefreshToken(context.Background(), first.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.UserID != userID || token.FamilyID != first.FamilyID || token.UsedTS.IsZero() {
+		t.Errorf("got %+v, want the used token of user %q in family %q", token, userID, first.FamilyID)
+	}
+
+	if _, err := svc.FetchRefreshToken(context.Background(), db.HashRefreshToken("unknown")); !errors.Is(err, db.ErrInvalidRefreshToken) {
+		t.Errorf("got %v, want %v", err, db.ErrInvalidRefreshToken)
+	}
+}
+
+func testRotateRefreshToken(t *testing.T, svc db.RefreshTokenService, userID string) {
+	_, first, err := db.NewRefreshToken(userID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreateRefreshToken(context.Background(), &first); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := rotate(svc, first.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.UserID != userID || second.FamilyID != first.FamilyID {
+		t.Errorf("got user %q and family %q, want %q and %q", second.UserID, second.FamilyID, userID, first.FamilyID)
+	}
+
+	// the new token can be rotated in turn
+	third, err := rotate(svc, second.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.UserID != userID || third.FamilyID != first.FamilyID {
+		t.Errorf("got user %q and family %q, want %q and %q", third.UserID, third.FamilyID, userID, first.FamilyID)
+	}
+}
+
+func testRotateUnknownRefreshToken(t *testing.T, svc db.RefreshTokenService, userID string) {
+	if _, err := rotate(svc, db.HashRefreshToken("unknown")); !errors.Is(err, db.ErrInvalidRefreshToken) {
+		t.Errorf("got %v, want %v", err, db.ErrInvalidRefreshToken)
+	}
+}
+
+func testRotateExpiredRefreshToken(t *testing.T, svc db.RefreshTokenService, userID string) {
+	hash := mustLogIn(t, svc, userID, -time.Minute)
+
+	if _, err := rotate(svc, hash); !errors.Is(err, db.ErrInvalidRefreshToken) {
+		t.Errorf("got %v, want %v", err, db.ErrInvalidRefreshToken)
+	}
+}
+
+func testRefreshTokenReuse(t *testing.T, svc db.RefreshTokenService, userID string) {
+	hash := mustLogIn(t, svc, userID, time.Hour)
+	other := mustLogIn(t, svc, userID, time.Hour)
+
+	next, err := rotate(svc, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rotate(svc, hash); !errors.Is(err, db.ErrRefreshTokenReused) {
+		t.Fatalf("got %v, want %v", err, db.ErrRefreshTokenReused)
+	}
+
+	// the token issued by the first rotation is revoked along with the rest of its family
+	if _, err := rotate(svc, next.Hash); !errors.Is(err, db.ErrInvalidRefreshToken) {
+		t.Errorf("got %v, want %v", err, db.ErrInvalidRefreshToken)
+	}
+
+	// other logins are unaffected
+	if _, err := rotate(svc, other); err != nil {
+		t.Errorf("got %v rotating a token from another login, want nil", err)
+	}
+}
+
+func testRevokeRefreshTokenFamily(t *testing.T, svc db.RefreshTokenService, userID string) {
+	hash := mustLogIn(t, svc, userID, time.Hour)
+	next, err := rotate(svc, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.RevokeRefreshTokenFamily(context.Background(), next.FamilyID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotate(svc, next.Hash); !errors.Is(err, db.ErrInvalidRefreshToken) {
+		t.Errorf("got %v, want %v", err, db.ErrInvalidRefreshToken)
+	}
+}
+
+func testRevokeUserRefreshTokens(t *testing.T, svc db.RefreshTokenService, userID string) {
+	first := mustLogIn(t, svc, userID, time.Hour)
+	second := mustLogIn(t, svc, userID, time.Hour)
+
+	if err := svc.RevokeUserRefreshTokens(context.Background(), userID); err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{first, second} {
+		if _, err := rotate(svc, hash); !errors.Is(err, db.ErrInvalidRefreshToken) {
+			t.Errorf("got %v, want %v", err, db.ErrInvalidRefreshToken)
+		}
+	}
+
+	// logging in again afterwards works as normal
+	if _, err := rotate(svc, mustLogIn(t, svc, userID, time.Hour)); err != nil {
+		t.Errorf("got %v rotating a token issued after the revocation, want nil", err)
+	}
+}
+
+func testConcurrentRefreshTokenRotations(t *testing.T, svc db.RefreshTokenService, userID string) {
+	const n = 5
+	hash := mustLogIn(t, svc, userID, time.Hour)
+
+	type result struct {
+		next db.RefreshToken
+		err  error
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan result, n)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			next, err := rotate(svc, hash)
+			results <- result{next, err}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var rotated []db.RefreshToken
+	for res := range results {
+		switch {
+		case res.err == nil:
+			rotated = append(rotated, res.next)
+		// once the reuse has revoked the family, later attempts find a revoked token
+		case !errors.Is(res.err, db.ErrRefreshTokenReused) && !errors.Is(res.err, db.ErrInvalidRefreshToken):
+			t.Errorf("got %v, want nil, %v or %v", res.err, db.ErrRefreshTokenReused, db.ErrInvalidRefreshToken)
+		}
+	}
+	if len(rotated) != 1 {
+		t.Fatalf("got %d successful rotations of the same token, want 1", len(rotated))
+	}
+
+	// the losing rotations were reuses, so the winner's token has been revoked too
+	if _, err := rotate(svc, rotated[0].Hash); !errors.Is(err, db.ErrInvalidRefreshToken) {
+		t.Errorf("got %v, want %v", err, db.ErrInvalidRefreshToken)
+	}
+}
@@ -0,0 +1,92 @@
+package dbtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/google/uuid"
+)
+
+// TokenRevocationServiceFactory returns a new TokenRevocationService with nothing revoked for a single test,
+// along with the UserService that the users whose tokens are revoked have to exist in
+type TokenRevocationServiceFactory func(t *testing.T) (db.TokenRevocationService, db.UserService)
+
+// RunTokenRevocationServiceSuite asserts the db.TokenRevocationService contract against the implementation returned by newService
+func RunTokenRevocationServiceSuite(t *testing.T, newService TokenRevocationServiceFactory) {
+	tests := []struct {
+		Name string
+		Run  func(t *testing.T, svc db.TokenRevocationService, userID string)
+	}{
+		{"Revoke Token", testRevokeToken},
+		{"Revoke Token Twice", testRevokeTokenTwice},
+		{"Revoke User Tokens", testRevokeUserTokens},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			svc, users := newService(t)
+
+			user := mustNewUser(t, "kishiguro", "klara and the sun")
+			mustCreateUser(t, users, user)
+
+			tt.Run(t, svc, user.ID)
+		})
+	}
+}
+
+func mustBeRevoked(t *testing.T, svc db.TokenRevocationService, tokenID, userID string, issuedTS time.Time, want bool) {
+	t.Helper()
+
+	revoked, err := svc.IsTokenRevoked(context.Background(), tokenID, userID, issuedTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked != want {
+		t.Errorf("got revoked %t for token %s issued at %s, want %t", revoked, tokenID, issuedTS, want)
+	}
+}
+
+func testRevokeToken(t *testing.T, svc db.TokenRevocationService, userID string) {
+	now := time.Now()
+	revoked, other := uuid.NewString(), uuid.NewString()
+
+	if err := svc.RevokeToken(context.Background(), revoked, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	mustBeRevoked(t, svc, revoked, userID, now, true)
+	mustBeRevoked(t, svc, other, userID, now, false)
+}
+
+func testRevokeTokenTwice(t *testing.T, svc db.TokenRevocationService, userID string) {
+	now := time.Now()
+	tokenID := uuid.NewString()
+
+	for range 2 {
+		if err := svc.RevokeToken(context.Background(), tokenID, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustBeRevoked(t, svc, tokenID, userID, now, true)
+}
+
+func testRevokeUserTokens(t *testing.T, svc db.TokenRevocationService, userID string) {
+	revokedTS := time.Now().Truncate(time.Second)
+
+	if err := svc.RevokeUserTokens(context.Background(), userID, revokedTS); err != nil {
+		t.Fatal(err)
+	}
+
+	mustBeRevoked(t, svc, uuid.NewString(), userID, revokedTS.Add(-time.Hour), true)
+	mustBeRevoked(t, svc, uuid.NewString(), userID, revokedTS, true)
+	mustBeRevoked(t, svc, uuid.NewString(), userID, revokedTS.Add(time.Second), false)
+	mustBeRevoked(t, svc, uuid.NewString(), missingID, revokedTS.Add(-time.Hour), false)
+
+	// an earlier revocation does not bring tokens back
+	if err := svc.RevokeUserTokens(context.Background(), userID, revokedTS.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	mustBeRevoked(t, svc, uuid.NewString(), userID, revokedTS.Add(-time.Minute), true)
+}
@@ -0,0 +1,1380 @@
+// Package dbtest provides a conformance suite that every db.BlogService implementation is expected to pass
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// BlogServiceFactory returns a new, empty BlogService for a single test
+type BlogServiceFactory func(t *testing.T) db.BlogService
+
+const (
+	authorA = "0197aaed-4a35-74da-8574-4165524a1111"
+	authorB = "0197aaed-4a35-74da-8574-4165524a2222"
+	// adminID moderates the posts of others, so the changes they make are attributed to them
+	adminID = "0197aaed-4a35-74da-8574-4165524a3333"
+
+	// a well formed ID that is never assigned to a post
+	missingID = "efbfa286-ca55-4ded-a28e-9881118186c8"
+)
+
+// RunBlogServiceSuite asserts the db.BlogService contract against the implementation returned by newService
+func RunBlogServiceSuite(t *testing.T, newService BlogServiceFactory) {
+	tests := []struct {
+		Name string
+		Run  func(t *testing.T, svc db.BlogService)
+	}{
+		{"Create Assigns Generated Fields", testCreateAssignsGeneratedFields},
+		{"Create Published Sets PublishedTS", testCreatePublishedSetsPublishedTS},
+		{"Create Ignores Client PublishedTS", testCreateIgnoresClientPublishedTS},
+		{"Create Duplicate Title", testCreateDuplicateTitle},
+		{"Fetch Not Found", testFetchNotFound},
+		{"Fetch Published Excludes Drafts", testFetchPublishedExcludesDrafts},
+		{"Fetch Published Pagination", testFetchPublishedPagination},
+		{"Fetch Published Filters", testFetchPublishedFilters},
+		{"Fetch Published Invalid Query", testFetchPublishedInvalidQuery},
+		{"Fetch Author Posts", testFetchAuthorPosts},
+		{"Update Persists Fields", testUpdatePersistsFields},
+		{"Update Publishing Sets PublishedTS", testUpdatePublishingSetsPublishedTS},
+		{"Update Validation", testUpdateValidation},
+		{"Deleted Status Rejected", testDeletedStatusRejected},
+		{"Tags", testTags},
+		{"Delete", testDelete},
+		{"Trash", testTrash},
+		{"Restore", testRestore},
+		{"Purge", testPurge},
+		{"Transfer", testTransfer},
+		{"Transfer Author Posts", testTransferAuthorPosts},
+		{"Bulk Action", testBulkAction},
+		{"Bulk Action Failure", testBulkActionFailure},
+		{"Bulk Retag", testBulkRetag},
+		{"Versioning", testVersioning},
+		{"Stale Update", testStaleUpdate},
+		{"Stale Delete", testStaleDelete},
+		{"Revisions", testRevisions},
+		{"Revisions Not Found", testRevisionsNotFound},
+		{"Concurrent Creates", testConcurrentCreates},
+		{"Concurrent Duplicate Creates", testConcurrentDuplicateCreates},
+		{"Concurrent Reads And Writes", testConcurrentReadsAndWrites},
+		{"Cancelled Context", testCancelledContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.Run(t, newService(t))
+		})
+	}
+}
+
+func mustCreate(t *testing.T, svc db.BlogService, authorID string, post *model.BlogPost) {
+	t.Helper()
+	if err := svc.CreateBlogPost(context.Background(), authorID, post); err != nil {
+		t.Fatalf("failed to create post %q: %v", post.Title, err)
+	}
+}
+
+func mustFetch(t *testing.T, svc db.BlogService, id string) model.BlogPost {
+	t.Helper()
+	post, err := svc.FetchBlogPost(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to fetch post %s: %v", id, err)
+	}
+	return post
+}
+
+// mustFetchPublished follows every page of query and returns all of the posts
+func mustFetchPublished(t *testing.T, svc db.BlogService, query db.BlogPostQuery) []model.BlogPost {
+	t.Helper()
+	return mustFetchPages(t, query, svc.FetchPublishedBlogPosts)
+}
+
+// mustFetchPages follows every page of query returned by fetch and returns all of the posts
+func mustFetchPages(t *testing.T, query db.BlogPostQuery, fetch func(context.Context, db.BlogPostQuery) (db.BlogPostPage, error)) []model.BlogPost {
+	t.Helper()
+
+	posts := []model.BlogPost{}
+	for {
+		page, err := fetch(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query.Limit > 0 && len(page.Posts) > query.Limit {
+			t.Fatalf("got %d posts, want at most %d per page", len(page.Posts), query.Limit)
+		}
+		posts = append(posts, page.Posts...)
+
+		if page.NextCursor == "" {
+			return posts
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+func mustParseTS(t *testing.T, field, ts string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		t.Fatalf("%s %q is not an RFC3339 timestamp: %v", field, ts, err)
+	}
+	return parsed
+}
+
+func testCreateAssignsGeneratedFields(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{
+		ID:        "client-provided",
+		AuthorID:  authorB,
+		Title:     "title",
+		Summary:   "summary",
+		Contents:  "contents",
+		Status:    model.DRAFT,
+		CreatedTS: "2000-01-01T00:00:00Z",
+		Version:   42,
+	}
+	mustCreate(t, svc, authorA, post)
+
+	if post.ID == "" || post.ID == "client-provided" {
+		t.Errorf("got ID %q, want a generated ID", post.ID)
+	}
+	if post.AuthorID != authorA {
+		t.Errorf("got AuthorID %q, want %q", post.AuthorID, authorA)
+	}
+	created := mustParseTS(t, "CreatedTS", post.CreatedTS)
+	if time.Since(created) > time.Minute {
+		t.Errorf("got CreatedTS %s, want the current time", post.CreatedTS)
+	}
+	if post.UpdatedTS != post.CreatedTS {
+		t.Errorf("got UpdatedTS %q, want %q", post.UpdatedTS, post.CreatedTS)
+	}
+	if post.PublishedTS != "" {
+		t.Errorf("got PublishedTS %q for a draft, want none", post.PublishedTS)
+	}
+	if post.Version != 1 {
+		t.Errorf("got Version %d, want 1", post.Version)
+	}
+
+	stored := mustFetch(t, svc, post.ID)
+	if !reflect.DeepEqual(stored, *post) {
+		t.Errorf("got %+v, want %+v", stored, *post)
+	}
+}
+
+func testCreatePublishedSetsPublishedTS(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorA, post)
+
+	if post.PublishedTS != post.CreatedTS {
+		t.Errorf("got PublishedTS %q, want %q", post.PublishedTS, post.CreatedTS)
+	}
+	if stored := mustFetch(t, svc, post.ID); stored.PublishedTS != post.PublishedTS {
+		t.Errorf("got stored PublishedTS %q, want %q", stored.PublishedTS, post.PublishedTS)
+	}
+}
+
+// testCreateIgnoresClientPublishedTS pins down that PublishedTS is always generated on create: a post created as
+// published is published at its creation time, and any other post is unpublished, whatever the client sent
+func testCreateIgnoresClientPublishedTS(t *testing.T, svc db.BlogService) {
+	for _, status := range []model.BlogPostStatus{model.DRAFT, model.PUBLISHED} {
+		post := &model.BlogPost{Title: string(status), Status: status, PublishedTS: "2000-01-01T00:00:00Z"}
+		mustCreate(t, svc, authorA, post)
+
+		want := ""
+		if status == model.PUBLISHED {
+			want = post.CreatedTS
+		}
+		if post.PublishedTS != want {
+			t.Errorf("got PublishedTS %q for a %s post, want %q", post.PublishedTS, status, want)
+		}
+		if stored := mustFetch(t, svc, post.ID); stored.PublishedTS != want {
+			t.Errorf("got stored PublishedTS %q for a %s post, want %q", stored.PublishedTS, status, want)
+		}
+	}
+}
+
+func testCreateDuplicateTitle(t *testing.T, svc db.BlogService) {
+	mustCreate(t, svc, authorA, &model.BlogPost{Title: "title"})
+
+	err := svc.CreateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "title"})
+	if !errors.Is(err, db.ErrBlogPostAlreadyExists) {
+		t.Errorf("got %v for same author, want %v", err, db.ErrBlogPostAlreadyExists)
+	}
+
+	// titles only need to be unique per author
+	mustCreate(t, svc, authorB, &model.BlogPost{Title: "title"})
+}
+
+func testFetchNotFound(t *testing.T, svc db.BlogService) {
+	for _, id := range []string{missingID, "not-a-uuid", ""} {
+		_, err := svc.FetchBlogPost(context.Background(), id)
+		if !errors.Is(err, db.ErrEntityNotFound) {
+			t.Errorf("got %v for ID %q, want %v", err, id, db.ErrEntityNotFound)
+		}
+	}
+}
+
+func testFetchPublishedExcludesDrafts(t *testing.T, svc db.BlogService) {
+	page, err := svc.FetchPublishedBlogPosts(context.Background(), db.BlogPostQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Posts == nil || len(page.Posts) != 0 || page.NextCursor != "" {
+		t.Errorf("got %+v, want an empty page", page)
+	}
+
+	published := &model.BlogPost{Title: "published", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorA, published)
+	mustCreate(t, svc, authorA, &model.BlogPost{Title: "draft", Status: model.DRAFT})
+
+	posts := mustFetchPublished(t, svc, db.BlogPostQuery{})
+	if len(posts) != 1 || posts[0].ID != published.ID {
+		t.Errorf("got %+v, want only %s", posts, published.ID)
+	}
+}
+
+func testFetchPublishedPagination(t *testing.T, svc db.BlogService) {
+	const n = 7
+
+	created := map[string]bool{}
+	for i := range n {
+		post := &model.BlogPost{Title: fmt.Sprintf("title %d", i), Status: model.PUBLISHED}
+		mustCreate(t, svc, authorA, post)
+		created[post.ID] = true
+	}
+	mustCreate(t, svc, authorA, &model.BlogPost{Title: "draft", Status: model.DRAFT})
+
+	for _, sort := range []db.BlogPostSort{db.SortPublished, db.SortUpdated} {
+		t.Run(string(sort), func(t *testing.T) {
+			posts := mustFetchPublished(t, svc, db.BlogPostQuery{Limit: 2, Sort: sort})
+			if len(posts) != n {
+				t.Fatalf("got %d posts across all pages, want %d", len(posts), n)
+			}
+
+			seen := map[string]bool{}
+			for i, post := range posts {
+				if !created[post.ID] || seen[post.ID] {
+					t.Errorf("got unexpected or repeated post %s", post.ID)
+				}
+				seen[post.ID] = true
+
+				if i == 0 {
+					continue
+				}
+				// posts created within the same second are ordered by their time ordered IDs
+				prev, cur := posts[i-1], post
+				prevTS, curTS := prev.PublishedTS, cur.PublishedTS
+				if sort == db.SortUpdated {
+					prevTS, curTS = prev.UpdatedTS, cur.UpdatedTS
+				}
+				prevKey, curKey := mustParseTS(t, "sort key", prevTS), mustParseTS(t, "sort key", curTS)
+				if prevKey.Before(curKey) || (prevKey.Equal(curKey) && prev.ID < cur.ID) {
+					t.Errorf("got %s before %s, want newest first", prev.ID, cur.ID)
+				}
+			}
+
+			// the unpaged listing is in the same order
+			all := mustFetchPublished(t, svc, db.BlogPostQuery{Sort: sort})
+			for i := range all {
+				if all[i].ID != posts[i].ID {
+					t.Fatalf("got %s at position %d, want %s", all[i].ID, i, posts[i].ID)
+				}
+			}
+		})
+	}
+
+	// the last page has no cursor even when it is full
+	page, err := svc.FetchPublishedBlogPosts(context.Background(), db.BlogPostQuery{Limit: n})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Posts) != n || page.NextCursor != "" {
+		t.Errorf("got %d posts and cursor %q, want %d posts and no cursor", len(page.Posts), page.NextCursor, n)
+	}
+}
+
+func testFetchPublishedFilters(t *testing.T, svc db.BlogService) {
+	mine := &model.BlogPost{Title: "mine", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorA, mine)
+	theirs := &model.BlogPost{Title: "theirs", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorB, theirs)
+
+	posts := mustFetchPublished(t, svc, db.BlogPostQuery{AuthorID: authorA})
+	if len(posts) != 1 || posts[0].ID != mine.ID {
+		t.Errorf("got %+v, want only %s", posts, mine.ID)
+	}
+
+	publishedTS := mustParseTS(t, "PublishedTS", mine.PublishedTS)
+	tests := []struct {
+		Name  string
+		Query db.BlogPostQuery
+		Want  int
+	}{
+		{"After Is Inclusive", db.BlogPostQuery{PublishedAfter: publishedTS}, 2},
+		{"After Excludes Earlier", db.BlogPostQuery{PublishedAfter: publishedTS.Add(time.Hour)}, 0},
+		{"Before Is Exclusive", db.BlogPostQuery{PublishedBefore: publishedTS}, 0},
+		{"Before Includes Earlier", db.BlogPostQuery{PublishedBefore: publishedTS.Add(time.Hour)}, 2},
+		{"Range", db.BlogPostQuery{PublishedAfter: publishedTS.Add(-time.Hour), PublishedBefore: publishedTS.Add(time.Hour), AuthorID: authorB}, 1},
+		{"Excluded Author", db.BlogPostQuery{ExcludeAuthorIDs: []string{authorA}}, 1},
+		{"Every Author Excluded", db.BlogPostQuery{ExcludeAuthorIDs: []string{authorA, authorB}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if posts := mustFetchPublished(t, svc, tt.Query); len(posts) != tt.Want {
+				t.Errorf("got %d posts, want %d", len(posts), tt.Want)
+			}
+		})
+	}
+}
+
+func testFetchPublishedInvalidQuery(t *testing.T, svc db.BlogService) {
+	for i := range 3 {
+		mustCreate(t, svc, authorA, &model.BlogPost{Title: fmt.Sprintf("title %d", i), Status: model.PUBLISHED})
+	}
+
+	page, err := svc.FetchPublishedBlogPosts(context.Background(), db.BlogPostQuery{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name  string
+		Query db.BlogPostQuery
+		Want  error
+	}{
+		{"Unknown Sort", db.BlogPostQuery{Sort: "title"}, db.ErrInvalidQuery},
+		{"Negative Limit", db.BlogPostQuery{Limit: -1}, db.ErrInvalidQuery},
+		{"Malformed Author", db.BlogPostQuery{AuthorID: "not-a-uuid"}, db.ErrInvalidQuery},
+		{"Malformed Cursor", db.BlogPostQuery{Cursor: "not a cursor"}, db.ErrInvalidCursor},
+		{"Cursor For Another Sort", db.BlogPostQuery{Cursor: page.NextCursor, Sort: db.SortUpdated}, db.ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if _, err := svc.FetchPublishedBlogPosts(context.Background(), tt.Query); !errors.Is(err, tt.Want) {
+				t.Errorf("got %v, want %v", err, tt.Want)
+			}
+		})
+	}
+}
+
+func testFetchAuthorPosts(t *testing.T, svc db.BlogService) {
+	published := &model.BlogPost{Title: "published", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorA, published)
+	draft := &model.BlogPost{Title: "draft", Status: model.DRAFT}
+	mustCreate(t, svc, authorA, draft)
+	trashed := &model.BlogPost{Title: "trashed", Status: model.DRAFT}
+	mustCreate(t, svc, authorA, trashed)
+	if err := svc.DeleteBlogPost(context.Background(), authorA, trashed.ID, db.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, svc, authorB, &model.BlogPost{Title: "other published", Status: model.PUBLISHED})
+	mustCreate(t, svc, authorB, &model.BlogPost{Title: "other draft", Status: model.DRAFT})
+
+	fetch := func(includeDrafts bool) func(context.Context, db.BlogPostQuery) (db.BlogPostPage, error) {
+		return func(ctx context.Context, query db.BlogPostQuery) (db.BlogPostPage, error) {
+			return svc.FetchAuthorBlogPosts(ctx, authorA, includeDrafts, query)
+		}
+	}
+
+	tests := []struct {
+		Name          string
+		IncludeDrafts bool
+		Query         db.BlogPostQuery
+		Want          []string
+	}{
+		{"Published Only", false, db.BlogPostQuery{}, []string{published.ID}},
+		{"Including Drafts", true, db.BlogPostQuery{Limit: 1}, []string{draft.ID, published.ID}},
+		{"Explicit Updated Sort", true, db.BlogPostQuery{Sort: db.SortUpdated}, []string{draft.ID, published.ID}},
+		{"Author Filter Is Ignored", true, db.BlogPostQuery{AuthorID: authorB}, []string{draft.ID, published.ID}},
+		{"Drafts Never Match A Published Range", true, db.BlogPostQuery{PublishedBefore: time.Now().Add(time.Hour)}, []string{published.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			posts := mustFetchPages(t, tt.Query, fetch(tt.IncludeDrafts))
+			if len(posts) != len(tt.Want) {
+				t.Fatalf("got %d posts, want %d", len(posts), len(tt.Want))
+			}
+			// posts created in the same second fall back to their time ordered IDs
+			for i := range tt.Want {
+				if posts[i].ID != tt.Want[i] {
+					t.Errorf("got %s at position %d, want %s", posts[i].ID, i, tt.Want[i])
+				}
+			}
+		})
+	}
+
+	_, err := svc.FetchAuthorBlogPosts(context.Background(), authorA, true, db.BlogPostQuery{Sort: db.SortPublished})
+	if !errors.Is(err, db.ErrInvalidQuery) {
+		t.Errorf("got %v sorting drafts by publish date, want %v", err, db.ErrInvalidQuery)
+	}
+}
+
+func testUpdatePersistsFields(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title", Summary: "summary", Contents: "contents", Status: model.DRAFT}
+	mustCreate(t, svc, authorA, post)
+
+	stored := mustFetch(t, svc, post.ID)
+	err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{
+		ID:        "ignored",
+		AuthorID:  authorB,
+		Title:     "new title",
+		Summary:   "new summary",
+		Contents:  "new contents",
+		Status:    model.DRAFT,
+		CreatedTS: "2000-01-01T00:00:00Z",
+	}, &stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := mustFetch(t, svc, post.ID)
+	if !reflect.DeepEqual(updated, stored) {
+		t.Errorf("got stored %+v, want %+v", updated, stored)
+	}
+	if updated.Title != "new title" || updated.Summary != "new summary" || updated.Contents != "new contents" {
+		t.Errorf("got %+v, want editable fields updated", updated)
+	}
+	if updated.ID != post.ID || updated.AuthorID != authorA || updated.CreatedTS != post.CreatedTS {
+		t.Errorf("got %+v, want ID, AuthorID and CreatedTS unchanged from %+v", updated, *post)
+	}
+	mustParseTS(t, "UpdatedTS", updated.UpdatedTS)
+}
+
+func testUpdatePublishingSetsPublishedTS(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title", Status: model.DRAFT}
+	mustCreate(t, svc, authorA, post)
+
+	stored := mustFetch(t, svc, post.ID)
+	err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "title", Status: model.PUBLISHED}, &stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published := mustFetch(t, svc, post.ID)
+	if published.Status != model.PUBLISHED {
+		t.Errorf("got status %s, want %s", published.Status, model.PUBLISHED)
+	}
+	mustParseTS(t, "PublishedTS", published.PublishedTS)
+
+	// further edits keep the original publication date
+	err = svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "edited", Status: model.PUBLISHED}, &published)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited := mustFetch(t, svc, post.ID); edited.PublishedTS != published.PublishedTS {
+		t.Errorf("got PublishedTS %q, want %q", edited.PublishedTS, published.PublishedTS)
+	}
+}
+
+func testUpdateValidation(t *testing.T, svc db.BlogService) {
+	mustCreate(t, svc, authorA, &model.BlogPost{Title: "taken"})
+	post := &model.BlogPost{Title: "title"}
+	mustCreate(t, svc, authorA, post)
+
+	stored := mustFetch(t, svc, post.ID)
+	if err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: ""}, &stored); err == nil {
+		t.Error("expected an error for an empty title")
+	}
+
+	stored = mustFetch(t, svc, post.ID)
+	err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "taken"}, &stored)
+	if !errors.Is(err, db.ErrBlogPostAlreadyExists) {
+		t.Errorf("got %v, want %v", err, db.ErrBlogPostAlreadyExists)
+	}
+	if unchanged := mustFetch(t, svc, post.ID); unchanged.Title != "title" {
+		t.Errorf("got title %q after a rejected update, want %q", unchanged.Title, "title")
+	}
+
+	missing := model.BlogPost{ID: missingID, AuthorID: authorA, Title: "missing"}
+	err = svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "missing"}, &missing)
+	if !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+	if _, err := svc.FetchBlogPost(context.Background(), missingID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("updating a missing post created it: got %v", err)
+	}
+}
+
+func testDeletedStatusRejected(t *testing.T, svc db.BlogService) {
+	err := svc.CreateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "trashed", Status: model.DELETED})
+	if !errors.Is(err, db.ErrInvalidStatus) {
+		t.Errorf("got %v creating a deleted post, want %v", err, db.ErrInvalidStatus)
+	}
+
+	post := &model.BlogPost{Title: "title"}
+	mustCreate(t, svc, authorA, post)
+
+	stored := mustFetch(t, svc, post.ID)
+	err = svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "title", Status: model.DELETED}, &stored)
+	if !errors.Is(err, db.ErrInvalidStatus) {
+		t.Errorf("got %v updating a post to deleted, want %v", err, db.ErrInvalidStatus)
+	}
+	if unchanged := mustFetch(t, svc, post.ID); unchanged.Status == model.DELETED {
+		t.Error("post was moved to the trash by an update")
+	}
+}
+
+func testTags(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title", Tags: []string{"Go", " databases ", "go"}}
+	mustCreate(t, svc, authorA, post)
+	if stored := mustFetch(t, svc, post.ID); !slices.Equal(stored.Tags, []string{"databases", "go"}) {
+		t.Errorf("got tags %q, want them lowercased, deduplicated and sorted", stored.Tags)
+	}
+
+	untagged := &model.BlogPost{Title: "untagged"}
+	mustCreate(t, svc, authorA, untagged)
+	if stored := mustFetch(t, svc, untagged.ID); stored.Tags == nil || len(stored.Tags) != 0 {
+		t.Errorf("got tags %#v, want an empty list", stored.Tags)
+	}
+
+	// updates replace the tags
+	stored := mustFetch(t, svc, post.ID)
+	if err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "title", Tags: []string{"sql"}}, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if updated := mustFetch(t, svc, post.ID); !slices.Equal(updated.Tags, []string{"sql"}) {
+		t.Errorf("got tags %q, want them replaced", updated.Tags)
+	}
+	revisions, err := svc.FetchBlogPostRevisions(context.Background(), post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || !slices.Equal(revisions[0].Tags, []string{"databases", "go"}) || !slices.Equal(revisions[1].Tags, []string{"sql"}) {
+		t.Errorf("got revisions %+v, want the tags of each recorded", revisions)
+	}
+
+	tooMany := make([]string, db.MaxPostTags+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag-%d", i)
+	}
+	for _, tags := range [][]string{{""}, {"two words"}, {"a,b"}, {strings.Repeat("a", db.MaxTagLength+1)}, tooMany} {
+		err := svc.CreateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "invalid", Tags: tags})
+		if !errors.Is(err, db.ErrInvalidTags) {
+			t.Errorf("got %v creating a post tagged %q, want %v", err, tags, db.ErrInvalidTags)
+		}
+
+		stored := mustFetch(t, svc, post.ID)
+		err = svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "title", Tags: tags}, &stored)
+		if !errors.Is(err, db.ErrInvalidTags) {
+			t.Errorf("got %v updating a post to be tagged %q, want %v", err, tags, db.ErrInvalidTags)
+		}
+	}
+}
+
+func testDelete(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorA, post)
+
+	if err := svc.DeleteBlogPost(context.Background(), authorA, post.ID, db.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FetchBlogPost(context.Background(), post.ID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+
+	posts := mustFetchPublished(t, svc, db.BlogPostQuery{})
+	if len(posts) != 0 {
+		t.Errorf("got %+v, want deleted post excluded", posts)
+	}
+
+	trashed, err := svc.FetchDeletedBlogPost(context.Background(), post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trashed.Status != model.DELETED {
+		t.Errorf("got Status %q, want %q", trashed.Status, model.DELETED)
+	}
+	if trashed.Version != post.Version+1 {
+		t.Errorf("got Version %d, want %d", trashed.Version, post.Version+1)
+	}
+	if trashed.DeletedTS == "" {
+		t.Error("expected DeletedTS to be set")
+	}
+	mustParseTS(t, "DeletedTS", trashed.DeletedTS)
+	if trashed.PublishedTS != post.PublishedTS {
+		t.Errorf("got PublishedTS %q, want it kept as %q", trashed.PublishedTS, post.PublishedTS)
+	}
+
+	// posts in the trash cannot be edited
+	stale := trashed
+	if err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "edited"}, &stale); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v updating a deleted post, want %v", err, db.ErrEntityNotFound)
+	}
+
+	// the title stays reserved until the post is purged
+	err = svc.CreateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "title"})
+	if !errors.Is(err, db.ErrBlogPostAlreadyExists) {
+		t.Errorf("got %v, want %v", err, db.ErrBlogPostAlreadyExists)
+	}
+
+	// deleting a post that is already in the trash or does not exist is not an error
+	if err := svc.DeleteBlogPost(context.Background(), authorA, post.ID, db.AnyVersion); err != nil {
+		t.Errorf("got %v deleting a deleted post, want nil", err)
+	}
+	if again, _ := svc.FetchDeletedBlogPost(context.Background(), post.ID); !reflect.DeepEqual(again, trashed) {
+		t.Errorf("got %+v after deleting twice, want %+v", again, trashed)
+	}
+	if err := svc.DeleteBlogPost(context.Background(), authorA, missingID, db.AnyVersion); err != nil {
+		t.Errorf("got %v deleting a missing post, want nil", err)
+	}
+}
+
+func testTrash(t *testing.T, svc db.BlogService) {
+	live := &model.BlogPost{Title: "live"}
+	mustCreate(t, svc, authorA, live)
+
+	want := map[string]bool{}
+	for _, title := range []string{"first", "second"} {
+		post := &model.BlogPost{Title: title}
+		mustCreate(t, svc, authorA, post)
+		if err := svc.DeleteBlogPost(context.Background(), authorA, post.ID, db.AnyVersion); err != nil {
+			t.Fatal(err)
+		}
+		want[post.ID] = true
+	}
+
+	other := &model.BlogPost{Title: "other"}
+	mustCreate(t, svc, authorB, other)
+	if err := svc.DeleteBlogPost(context.Background(), authorA, other.ID, db.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, err := svc.FetchDeletedBlogPosts(context.Background(), authorA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != len(want) {
+		t.Fatalf("got %d posts in the trash, want %d", len(posts), len(want))
+	}
+	for i, post := range posts {
+		if !want[post.ID] {
+			t.Errorf("got unexpected post %+v in the trash", post)
+		}
+		if i > 0 && posts[i-1].DeletedTS < post.DeletedTS {
+			t.Errorf("got %q before %q, want most recently deleted first", posts[i-1].DeletedTS, post.DeletedTS)
+		}
+	}
+
+	if _, err := svc.FetchDeletedBlogPost(context.Background(), live.ID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v fetching a live post from the trash, want %v", err, db.ErrEntityNotFound)
+	}
+	for _, id := range []string{missingID, "not-a-uuid"} {
+		if _, err := svc.FetchDeletedBlogPost(context.Background(), id); !errors.Is(err, db.ErrEntityNotFound) {
+			t.Errorf("got %v fetching %q from the trash, want %v", err, id, db.ErrEntityNotFound)
+		}
+	}
+
+	empty, err := svc.FetchDeletedBlogPosts(context.Background(), missingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty == nil || len(empty) != 0 {
+		t.Errorf("got %#v, want an empty, non-nil slice", empty)
+	}
+}
+
+func testRestore(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorA, post)
+	// moderators can delete the posts of others, and the deletion is attributed to them
+	if err := svc.DeleteBlogPost(context.Background(), authorB, post.ID, db.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	trashed, err := svc.FetchDeletedBlogPost(context.Background(), post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale := trashed
+	stale.Version--
+	if err := svc.RestoreBlogPost(context.Background(), authorA, &stale); !errors.Is(err, db.ErrVersionConflict) {
+		t.Errorf("got %v, want %v", err, db.ErrVersionConflict)
+	}
+
+	restored := trashed
+	if err := svc.RestoreBlogPost(context.Background(), authorA, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Status != model.DRAFT {
+		t.Errorf("got Status %q, want restored posts to be drafts", restored.Status)
+	}
+	if restored.DeletedTS != "" {
+		t.Errorf("got DeletedTS %q, want it cleared", restored.DeletedTS)
+	}
+	if restored.Version != trashed.Version+1 {
+		t.Errorf("got Version %d, want %d", restored.Version, trashed.Version+1)
+	}
+	if stored := mustFetch(t, svc, post.ID); !reflect.DeepEqual(stored, restored) {
+		t.Errorf("got %+v, want %+v", stored, restored)
+	}
+
+	// deleting and restoring are both part of the history
+	revisions, err := svc.FetchBlogPostRevisions(context.Background(), post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("got %d revisions, want 3", len(revisions))
+	}
+	if revisions[1].Status != model.DELETED || revisions[1].AuthorID != authorB || !reflect.DeepEqual(revisions[2], model.NewBlogPostRevision(restored, authorA)) {
+		t.Errorf("got revisions %+v, want a deleted revision followed by the restored one", revisions)
+	}
+
+	// only posts in the trash can be restored
+	again := restored
+	if err := svc.RestoreBlogPost(context.Background(), authorA, &again); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v restoring a live post, want %v", err, db.ErrEntityNotFound)
+	}
+	missing := model.BlogPost{ID: missingID, Version: 2}
+	if err := svc.RestoreBlogPost(context.Background(), authorA, &missing); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v restoring a missing post, want %v", err, db.ErrEntityNotFound)
+	}
+}
+
+func testPurge(t *testing.T, svc db.BlogService) {
+	live := &model.BlogPost{Title: "live"}
+	mustCreate(t, svc, authorA, live)
+	post := &model.BlogPost{Title: "title"}
+	mustCreate(t, svc, authorA, post)
+	if err := svc.DeleteBlogPost(context.Background(), authorA, post.ID, db.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := svc.PurgeDeletedBlogPosts(context.Background(), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("purged %d posts deleted after the cutoff, want 0", n)
+	}
+	if _, err := svc.FetchDeletedBlogPost(context.Background(), post.ID); err != nil {
+		t.Fatalf("got %v, want the post kept in the trash", err)
+	}
+
+	n, err = svc.PurgeDeletedBlogPosts(context.Background(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("purged %d posts, want 1", n)
+	}
+	if _, err := svc.FetchDeletedBlogPost(context.Background(), post.ID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+	mustFetch(t, svc, live.ID)
+
+	// purged posts release their title and history
+	mustCreate(t, svc, authorA, &model.BlogPost{Title: "title"})
+	if _, err := svc.FetchBlogPostRevision(context.Background(), post.ID, 1); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+}
+
+func testTransfer(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorA, post)
+
+	transferred, err := svc.TransferBlogPost(context.Background(), adminID, post.ID, authorB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transferred.AuthorID != authorB || transferred.Version != post.Version+1 {
+		t.Errorf("got %+v, want it transferred to %s at the next version", transferred, authorB)
+	}
+	if stored := mustFetch(t, svc, post.ID); !reflect.DeepEqual(stored, transferred) {
+		t.Errorf("got %+v, want %+v", stored, transferred)
+	}
+	revisions, err := svc.FetchBlogPostRevisions(context.Background(), post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || !reflect.DeepEqual(revisions[1], model.NewBlogPostRevision(transferred, adminID)) {
+		t.Errorf("got revisions %+v, want the transfer recorded", revisions)
+	}
+
+	// transferring to the current author changes nothing
+	again, err := svc.TransferBlogPost(context.Background(), adminID, post.ID, authorB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, transferred) {
+		t.Errorf("got %+v, want %+v", again, transferred)
+	}
+
+	// posts in the trash can be transferred too, but not onto a title the new author uses
+	mustCreate(t, svc, authorA, &model.BlogPost{Title: "title"})
+	trashed := &model.BlogPost{Title: "trashed"}
+	mustCreate(t, svc, authorA, trashed)
+	if err := svc.DeleteBlogPost(context.Background(), authorA, trashed.ID, db.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.TransferBlogPost(context.Background(), adminID, trashed.ID, authorB); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, _ := svc.FetchDeletedBlogPosts(context.Background(), authorB); len(deleted) != 1 || deleted[0].ID != trashed.ID {
+		t.Errorf("got %+v in the new author's trash, want the transferred post", deleted)
+	}
+	if _, err := svc.TransferBlogPost(context.Background(), adminID, post.ID, authorA); !errors.Is(err, db.ErrBlogPostAlreadyExists) {
+		t.Errorf("got %v, want %v", err, db.ErrBlogPostAlreadyExists)
+	}
+
+	for _, id := range []string{missingID, "not-a-uuid"} {
+		if _, err := svc.TransferBlogPost(context.Background(), adminID, id, authorB); !errors.Is(err, db.ErrEntityNotFound) {
+			t.Errorf("got %v transferring %q, want %v", err, id, db.ErrEntityNotFound)
+		}
+	}
+}
+
+func testTransferAuthorPosts(t *testing.T, svc db.BlogService) {
+	ids := []string{}
+	for _, status := range []model.BlogPostStatus{model.PUBLISHED, model.DRAFT, model.DELETED} {
+		post := &model.BlogPost{Title: string(status)}
+		if status != model.DELETED {
+			post.Status = status
+		}
+		mustCreate(t, svc, authorA, post)
+		if status == model.DELETED {
+			if err := svc.DeleteBlogPost(context.Background(), authorA, post.ID, db.AnyVersion); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ids = append(ids, post.ID)
+	}
+	kept := &model.BlogPost{Title: "kept"}
+	mustCreate(t, svc, authorB, kept)
+
+	// a title the new author already uses stops every post from being transferred
+	conflict := &model.BlogPost{Title: string(model.DRAFT)}
+	mustCreate(t, svc, authorB, conflict)
+	if _, err := svc.TransferAuthorBlogPosts(context.Background(), adminID, authorA, authorB); !errors.Is(err, db.ErrBlogPostAlreadyExists) {
+		t.Fatalf("got %v, want %v", err, db.ErrBlogPostAlreadyExists)
+	}
+	if post := mustFetch(t, svc, ids[0]); post.AuthorID != authorA || post.Version != 1 {
+		t.Errorf("got %+v after a failed transfer, want it unchanged", post)
+	}
+	stored := mustFetch(t, svc, conflict.ID)
+	if err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "renamed"}, &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := svc.TransferAuthorBlogPosts(context.Background(), adminID, authorA, authorB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(ids) {
+		t.Errorf("transferred %d posts, want %d", n, len(ids))
+	}
+	for _, id := range ids[:2] {
+		if post := mustFetch(t, svc, id); post.AuthorID != authorB {
+			t.Errorf("got author %s for %q, want %s", post.AuthorID, post.Title, authorB)
+		}
+		revisions, err := svc.FetchBlogPostRevisions(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last := revisions[len(revisions)-1]; last.AuthorID != adminID {
+			t.Errorf("got transfer of %s attributed to %s, want %s", id, last.AuthorID, adminID)
+		}
+	}
+	if deleted, _ := svc.FetchDeletedBlogPosts(context.Background(), authorB); len(deleted) != 1 || deleted[0].ID != ids[2] {
+		t.Errorf("got %+v in the new author's trash, want the transferred post", deleted)
+	}
+	if post := mustFetch(t, svc, kept.ID); post.Version != 1 {
+		t.Errorf("got %+v, want the new author's own posts unchanged", post)
+	}
+
+	for _, from := range []string{authorA, missingID, "not-a-uuid"} {
+		if n, err := svc.TransferAuthorBlogPosts(context.Background(), adminID, from, authorB); err != nil || n != 0 {
+			t.Errorf("got %d, %v transferring from %q, want nothing transferred", n, err, from)
+		}
+	}
+}
+
+func testBulkAction(t *testing.T, svc db.BlogService) {
+	published := &model.BlogPost{Title: "published", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorA, published)
+	draft := &model.BlogPost{Title: "draft", Status: model.DRAFT}
+	mustCreate(t, svc, authorB, draft)
+
+	results, err := svc.ApplyBulkAction(context.Background(), adminID, db.BulkUnpublish, []string{published.ID, draft.ID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []db.BulkActionResult{{PostID: published.ID, Changed: true}, {PostID: draft.ID}}
+	if !slices.Equal(results, want) {
+		t.Errorf("got %+v, want %+v", results, want)
+	}
+	unpublished := mustFetch(t, svc, published.ID)
+	if unpublished.Status != model.DRAFT || unpublished.PublishedTS != published.PublishedTS || unpublished.Version != 2 {
+		t.Errorf("got %+v, want a draft that keeps its published time", unpublished)
+	}
+	if stored := mustFetch(t, svc, draft.ID); !reflect.DeepEqual(stored, *draft) {
+		t.Errorf("got %+v, want drafts left as they are", stored)
+	}
+
+	// repeating a post applies the action once
+	results, err = svc.ApplyBulkAction(context.Background(), adminID, db.BulkDelete, []string{published.ID, draft.ID, published.ID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []db.BulkActionResult{{PostID: published.ID, Changed: true}, {PostID: draft.ID, Changed: true}, {PostID: published.ID}}
+	if !slices.Equal(results, want) {
+		t.Errorf("got %+v, want %+v", results, want)
+	}
+	for _, id := range []string{published.ID, draft.ID} {
+		if _, err := svc.FetchDeletedBlogPost(context.Background(), id); err != nil {
+			t.Errorf("got %v, want %s in the trash", err, id)
+		}
+	}
+
+	results, err = svc.ApplyBulkAction(context.Background(), adminID, db.BulkRestore, []string{draft.ID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].Changed {
+		t.Errorf("got %+v, want the post restored", results)
+	}
+	restored := mustFetch(t, svc, draft.ID)
+	if restored.Status != model.DRAFT || restored.DeletedTS != "" {
+		t.Errorf("got %+v, want it restored as a draft", restored)
+	}
+	revisions, err := svc.FetchBlogPostRevisions(context.Background(), draft.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 || !reflect.DeepEqual(revisions[2], model.NewBlogPostRevision(restored, adminID)) {
+		t.Errorf("got revisions %+v, want each action recorded", revisions)
+	}
+
+	if _, err := svc.ApplyBulkAction(context.Background(), adminID, db.BulkAction("archive"), []string{draft.ID}, nil); !errors.Is(err, db.ErrInvalidBulkAction) {
+		t.Errorf("got %v, want %v", err, db.ErrInvalidBulkAction)
+	}
+}
+
+func testBulkRetag(t *testing.T, svc db.BlogService) {
+	tagged := &model.BlogPost{Title: "tagged", Status: model.PUBLISHED, Tags: []string{"news"}}
+	mustCreate(t, svc, authorA, tagged)
+	untagged := &model.BlogPost{Title: "untagged", Status: model.DRAFT}
+	mustCreate(t, svc, authorB, untagged)
+
+	results, err := svc.ApplyBulkAction(context.Background(), adminID, db.BulkRetag, []string{tagged.ID, untagged.ID}, []string{" News ", "go", "news"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []db.BulkActionResult{{PostID: tagged.ID, Changed: true}, {PostID: untagged.ID, Changed: true}}
+	if !slices.Equal(results, want) {
+		t.Errorf("got %+v, want %+v", results, want)
+	}
+	for _, id := range []string{tagged.ID, untagged.ID} {
+		stored := mustFetch(t, svc, id)
+		if !slices.Equal(stored.Tags, []string{"go", "news"}) || stored.Version != 2 {
+			t.Errorf("got %+v, want the tags normalized and replaced", stored)
+		}
+		revisions, err := svc.FetchBlogPostRevisions(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != 2 || !reflect.DeepEqual(revisions[1], model.NewBlogPostRevision(stored, adminID)) {
+			t.Errorf("got revisions %+v, want the retag recorded", revisions)
+		}
+	}
+
+	// posts that already have the tags are left as they are
+	results, err = svc.ApplyBulkAction(context.Background(), adminID, db.BulkRetag, []string{tagged.ID}, []string{"go", "news"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Changed {
+		t.Errorf("got %+v, want the post unchanged", results)
+	}
+
+	// retagging with no tags clears them
+	if _, err := svc.ApplyBulkAction(context.Background(), adminID, db.BulkRetag, []string{tagged.ID}, []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := mustFetch(t, svc, tagged.ID); len(stored.Tags) != 0 {
+		t.Errorf("got tags %v, want none", stored.Tags)
+	}
+
+	// posts in the trash cannot be retagged, in which case none are
+	if err := svc.DeleteBlogPost(context.Background(), authorB, untagged.ID, db.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	results, err = svc.ApplyBulkAction(context.Background(), adminID, db.BulkRetag, []string{tagged.ID, untagged.ID}, []string{"archive"})
+	if !errors.Is(err, db.ErrBulkActionFailed) {
+		t.Fatalf("got %v, want %v", err, db.ErrBulkActionFailed)
+	}
+	if len(results) != 2 || results[0].Err != nil || !errors.Is(results[1].Err, db.ErrEntityNotFound) {
+		t.Errorf("got %+v, want only the trashed post to fail", results)
+	}
+	if stored := mustFetch(t, svc, tagged.ID); len(stored.Tags) != 0 {
+		t.Errorf("got tags %v, want the retag rolled back", stored.Tags)
+	}
+
+	if _, err := svc.ApplyBulkAction(context.Background(), adminID, db.BulkRetag, []string{tagged.ID}, []string{"not a tag"}); !errors.Is(err, db.ErrInvalidTags) {
+		t.Errorf("got %v, want %v", err, db.ErrInvalidTags)
+	}
+}
+
+func testBulkActionFailure(t *testing.T, svc db.BlogService) {
+	published := &model.BlogPost{Title: "published", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorA, published)
+	trashed := &model.BlogPost{Title: "trashed", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorA, trashed)
+	if err := svc.DeleteBlogPost(context.Background(), authorA, trashed.ID, db.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	// posts in the trash cannot be unpublished
+	ids := []string{published.ID, trashed.ID, missingID, "not-a-uuid"}
+	results, err := svc.ApplyBulkAction(context.Background(), adminID, db.BulkUnpublish, ids, nil)
+	if !errors.Is(err, db.ErrBulkActionFailed) {
+		t.Fatalf("got %v, want %v", err, db.ErrBulkActionFailed)
+	}
+	if len(results) != len(ids) {
+		t.Fatalf("got %d results, want %d", len(results), len(ids))
+	}
+	for i, result := range results {
+		if result.PostID != ids[i] {
+			t.Errorf("got result for %s at %d, want %s", result.PostID, i, ids[i])
+		}
+		if wantErr := i > 0; errors.Is(result.Err, db.ErrEntityNotFound) != wantErr {
+			t.Errorf("got error %v for %s, want not found: %t", result.Err, ids[i], wantErr)
+		}
+	}
+
+	// nothing was applied
+	if stored := mustFetch(t, svc, published.ID); !reflect.DeepEqual(stored, *published) {
+		t.Errorf("got %+v, want %+v", stored, *published)
+	}
+	revisions, err := svc.FetchBlogPostRevisions(context.Background(), published.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 {
+		t.Errorf("got %d revisions, want the failed action left out of the history", len(revisions))
+	}
+}
+
+func testVersioning(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title"}
+	mustCreate(t, svc, authorA, post)
+
+	stored := mustFetch(t, svc, post.ID)
+	for want := 2; want <= 3; want++ {
+		err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "title"}, &stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Version != want {
+			t.Errorf("got Version %d returned from update, want %d", stored.Version, want)
+		}
+		stored = mustFetch(t, svc, post.ID)
+		if stored.Version != want {
+			t.Errorf("got stored Version %d, want %d", stored.Version, want)
+		}
+	}
+}
+
+func testStaleUpdate(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title"}
+	mustCreate(t, svc, authorA, post)
+
+	first := mustFetch(t, svc, post.ID)
+	second := mustFetch(t, svc, post.ID)
+
+	if err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "first"}, &first); err != nil {
+		t.Fatal(err)
+	}
+
+	err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "second"}, &second)
+	if !errors.Is(err, db.ErrVersionConflict) {
+		t.Errorf("got %v, want %v", err, db.ErrVersionConflict)
+	}
+	if stored := mustFetch(t, svc, post.ID); !reflect.DeepEqual(stored, first) {
+		t.Errorf("got %+v, want the first update %+v", stored, first)
+	}
+}
+
+func testStaleDelete(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title"}
+	mustCreate(t, svc, authorA, post)
+
+	stored := mustFetch(t, svc, post.ID)
+	if err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "edited"}, &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	err := svc.DeleteBlogPost(context.Background(), authorA, post.ID, post.Version)
+	if !errors.Is(err, db.ErrVersionConflict) {
+		t.Errorf("got %v, want %v", err, db.ErrVersionConflict)
+	}
+	mustFetch(t, svc, post.ID)
+
+	if err := svc.DeleteBlogPost(context.Background(), authorA, post.ID, stored.Version); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FetchBlogPost(context.Background(), post.ID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+
+	// a versioned delete of a post that does not exist is still not an error
+	if err := svc.DeleteBlogPost(context.Background(), authorA, missingID, 1); err != nil {
+		t.Errorf("got %v deleting a missing post, want nil", err)
+	}
+}
+
+func testRevisions(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "first", Summary: "summary", Contents: "contents", Status: model.DRAFT}
+	mustCreate(t, svc, authorA, post)
+
+	// revisions record who made each change rather than who the post belongs to
+	stored := mustFetch(t, svc, post.ID)
+	err := svc.UpdateBlogPost(context.Background(), authorB, &model.BlogPost{Title: "second", Contents: "new contents", Status: model.PUBLISHED}, &stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rejected updates leave no trace in the history
+	stale := *post
+	if err := svc.UpdateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "stale"}, &stale); !errors.Is(err, db.ErrVersionConflict) {
+		t.Fatalf("got %v, want %v", err, db.ErrVersionConflict)
+	}
+
+	revisions, err := svc.FetchBlogPostRevisions(context.Background(), post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.BlogPostRevision{
+		model.NewBlogPostRevision(*post, authorA),
+		model.NewBlogPostRevision(stored, authorB),
+	}
+	if len(revisions) != len(want) {
+		t.Fatalf("got %d revisions, want %d", len(revisions), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(revisions[i], want[i]) {
+			t.Errorf("got revision %+v, want %+v", revisions[i], want[i])
+		}
+
+		revision, err := svc.FetchBlogPostRevision(context.Background(), post.ID, want[i].Revision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(revision, want[i]) {
+			t.Errorf("got revision %+v, want %+v", revision, want[i])
+		}
+	}
+
+	// returned history cannot be used to rewrite the stored history
+	revisions[0].Title = "rewritten"
+	if original, _ := svc.FetchBlogPostRevision(context.Background(), post.ID, 1); original.Title != "first" {
+		t.Errorf("got title %q for revision 1, want %q", original.Title, "first")
+	}
+
+	// the history of a post in the trash is hidden with it
+	if err := svc.DeleteBlogPost(context.Background(), authorA, post.ID, db.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FetchBlogPostRevision(context.Background(), post.ID, 1); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+}
+
+func testRevisionsNotFound(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title"}
+	mustCreate(t, svc, authorA, post)
+
+	if _, err := svc.FetchBlogPostRevision(context.Background(), post.ID, 2); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v for a future revision, want %v", err, db.ErrEntityNotFound)
+	}
+	for _, id := range []string{missingID, "not-a-uuid"} {
+		if _, err := svc.FetchBlogPostRevisions(context.Background(), id); !errors.Is(err, db.ErrEntityNotFound) {
+			t.Errorf("got %v listing revisions of %q, want %v", err, id, db.ErrEntityNotFound)
+		}
+		if _, err := svc.FetchBlogPostRevision(context.Background(), id, 1); !errors.Is(err, db.ErrEntityNotFound) {
+			t.Errorf("got %v fetching a revision of %q, want %v", err, id, db.ErrEntityNotFound)
+		}
+	}
+}
+
+func testConcurrentCreates(t *testing.T, svc db.BlogService) {
+	const n = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			post := &model.BlogPost{Title: fmt.Sprintf("title %d", i), Status: model.PUBLISHED}
+			errs <- svc.CreateBlogPost(context.Background(), authorA, post)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent create failed: %v", err)
+		}
+	}
+
+	posts := mustFetchPublished(t, svc, db.BlogPostQuery{})
+	if len(posts) != n {
+		t.Errorf("got %d posts, want %d", len(posts), n)
+	}
+}
+
+func testConcurrentDuplicateCreates(t *testing.T, svc db.BlogService) {
+	const n = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- svc.CreateBlogPost(context.Background(), authorA, &model.BlogPost{Title: "title"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, db.ErrBlogPostAlreadyExists):
+			t.Errorf("got %v, want nil or %v", err, db.ErrBlogPostAlreadyExists)
+		}
+	}
+	if created != 1 {
+		t.Errorf("got %d posts created with the same title, want 1", created)
+	}
+}
+
+func testConcurrentReadsAndWrites(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title", Status: model.PUBLISHED}
+	mustCreate(t, svc, authorA, post)
+
+	const n = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	updates := make(chan error, n)
+	for i := range n {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, err := svc.FetchBlogPost(context.Background(), post.ID)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := svc.FetchPublishedBlogPosts(context.Background(), db.BlogPostQuery{})
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			stored, err := svc.FetchBlogPost(context.Background(), post.ID)
+			if err != nil {
+				updates <- err
+				return
+			}
+			revision := &model.BlogPost{Title: "title", Summary: fmt.Sprintf("revision %d", i), Status: model.PUBLISHED}
+			updates <- svc.UpdateBlogPost(context.Background(), authorA, revision, &stored)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	close(updates)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent read failed: %v", err)
+		}
+	}
+
+	// racing writers may lose to each other but never silently overwrite one another
+	applied := 0
+	for err := range updates {
+		switch {
+		case err == nil:
+			applied++
+		case !errors.Is(err, db.ErrVersionConflict):
+			t.Errorf("concurrent update failed: %v", err)
+		}
+	}
+	if applied == 0 {
+		t.Error("expected at least one concurrent update to succeed")
+	}
+	if stored := mustFetch(t, svc, post.ID); stored.Version != 1+applied {
+		t.Errorf("got Version %d after %d updates, want %d", stored.Version, applied, 1+applied)
+	}
+}
+
+func testCancelledContext(t *testing.T, svc db.BlogService) {
+	post := &model.BlogPost{Title: "title"}
+	mustCreate(t, svc, authorA, post)
+	stored := mustFetch(t, svc, post.ID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := svc.FetchBlogPost(ctx, post.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("FetchBlogPost: got %v, want %v", err, context.Canceled)
+	}
+	if _, err := svc.FetchPublishedBlogPosts(ctx, db.BlogPostQuery{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("FetchPublishedBlogPosts: got %v, want %v", err, context.Canceled)
+	}
+
+	err := svc.CreateBlogPost(ctx, authorA, &model.BlogPost{Title: "cancelled", Status: model.PUBLISHED})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateBlogPost: got %v, want %v", err, context.Canceled)
+	}
+
+	revision := stored
+	err = svc.UpdateBlogPost(ctx, authorA, &model.BlogPost{Title: "cancelled"}, &revision)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("UpdateBlogPost: got %v, want %v", err, context.Canceled)
+	}
+
+	if err := svc.DeleteBlogPost(ctx, authorA, post.ID, db.AnyVersion); !errors.Is(err, context.Canceled) {
+		t.Errorf("DeleteBlogPost: got %v, want %v", err, context.Canceled)
+	}
+	if _, err := svc.FetchDeletedBlogPosts(ctx, authorA); !errors.Is(err, context.Canceled) {
+		t.Errorf("FetchDeletedBlogPosts: got %v, want %v", err, context.Canceled)
+	}
+	if _, err := svc.PurgeDeletedBlogPosts(ctx, time.Now()); !errors.Is(err, context.Canceled) {
+		t.Errorf("PurgeDeletedBlogPosts: got %v, want %v", err, context.Canceled)
+	}
+	if _, err := svc.TransferBlogPost(ctx, adminID, post.ID, authorB); !errors.Is(err, context.Canceled) {
+		t.Errorf("TransferBlogPost: got %v, want %v", err, context.Canceled)
+	}
+	if _, err := svc.TransferAuthorBlogPosts(ctx, adminID, authorA, authorB); !errors.Is(err, context.Canceled) {
+		t.Errorf("TransferAuthorBlogPosts: got %v, want %v", err, context.Canceled)
+	}
+	if _, err := svc.ApplyBulkAction(ctx, adminID, db.BulkUnpublish, []string{post.ID}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("ApplyBulkAction: got %v, want %v", err, context.Canceled)
+	}
+
+	// nothing should have changed
+	if unchanged := mustFetch(t, svc, post.ID); !reflect.DeepEqual(unchanged, stored) {
+		t.Errorf("got %+v, want %+v", unchanged, stored)
+	}
+	posts := mustFetchPublished(t, svc, db.BlogPostQuery{})
+	if len(posts) != 0 {
+		t.Errorf("got %+v, want no posts created with a cancelled context", posts)
+	}
+}
@@ -0,0 +1,186 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+)
+
+// TwoFactorServiceFactory returns a new TwoFactorService with no enrollments for a single test, along with the
+// UserService that enrolled users have to exist in
+type TwoFactorServiceFactory func(t *testing.T) (db.TwoFactorService, db.UserService)
+
+// RunTwoFactorServiceSuite asserts the db.TwoFactorService contract against the implementation returned by newService
+func RunTwoFactorServiceSuite(t *testing.T, newService TwoFactorServiceFactory) {
+	tests := []struct {
+		Name string
+		Run  func(t *testing.T, svc db.TwoFactorService, userID string)
+	}{
+		{"Enroll And Confirm", testEnrollTOTP},
+		{"Re-enroll Before Confirming", testReenrollTOTP},
+		{"Confirm Without Enrolling", testConfirmTOTPWithoutEnrolling},
+		{"Codes Cannot Be Reused", testUseTOTPStep},
+		{"Recovery Codes", testUseRecoveryCode},
+		{"Disable", testDeleteTOTPEnrollment},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			svc, users := newService(t)
+
+			user := mustNewUser(t, "kishiguro", "klara and the sun")
+			mustCreateUser(t, users, user)
+
+			tt.Run(t, svc, user.ID)
+		})
+	}
+}
+
+// mustEnableTOTP enrolls and confirms userID with the given secret and recovery code hashes
+func mustEnableTOTP(t *testing.T, svc db.TwoFactorService, userID, secret string, recoveryCodeHashes []string) {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := svc.CreateTOTPEnrollment(ctx, &db.TOTPEnrollment{UserID: userID, Secret: secret, CreatedTS: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ConfirmTOTPEnrollment(ctx, userID, time.Now(), 100, recoveryCodeHashes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testEnrollTOTP(t *testing.T, svc db.TwoFactorService, userID string) {
+	ctx := context.Background()
+
+	if _, err := svc.FetchTOTPEnrollment(ctx, userID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Fatalf("got %v before enrolling, want %v", err, db.ErrEntityNotFound)
+	}
+
+	createdTS := time.Now().UTC().Truncate(time.Second)
+	if err := svc.CreateTOTPEnrollment(ctx, &db.TOTPEnrollment{UserID: userID, Secret: "SECRET", CreatedTS: createdTS}); err != nil {
+		t.Fatal(err)
+	}
+	enrollment, err := svc.FetchTOTPEnrollment(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enrollment.Secret != "SECRET" || !enrollment.CreatedTS.Equal(createdTS) || enrollment.Enabled() {
+		t.Fatalf("got %+v, want an unconfirmed enrollment", enrollment)
+	}
+
+	if err := svc.ConfirmTOTPEnrollment(ctx, userID, createdTS, 100, nil); err != nil {
+		t.Fatal(err)
+	}
+	enrollment, err = svc.FetchTOTPEnrollment(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enrollment.Enabled() || !enrollment.ConfirmedTS.Equal(createdTS) || enrollment.LastUsedStep != 100 {
+		t.Errorf("got %+v, want a confirmed enrollment with step 100 used", enrollment)
+	}
+
+	// once enabled the secret cannot be replaced or confirmed again
+	if err := svc.CreateTOTPEnrollment(ctx, &db.TOTPEnrollment{UserID: userID, Secret: "OTHER", CreatedTS: createdTS}); !errors.Is(err, db.ErrTwoFactorEnabled) {
+		t.Errorf("got %v enrolling again, want %v", err, db.ErrTwoFactorEnabled)
+	}
+	if err := svc.ConfirmTOTPEnrollment(ctx, userID, createdTS, 101, nil); !errors.Is(err, db.ErrTwoFactorEnabled) {
+		t.Errorf("got %v confirming again, want %v", err, db.ErrTwoFactorEnabled)
+	}
+}
+
+func testReenrollTOTP(t *testing.T, svc db.TwoFactorService, userID string) {
+	ctx := context.Background()
+
+	for _, secret := range []string{"FIRST", "SECOND"} {
+		if err := svc.CreateTOTPEnrollment(ctx, &db.TOTPEnrollment{UserID: userID, Secret: secret, CreatedTS: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	enrollment, err := svc.FetchTOTPEnrollment(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enrollment.Secret != "SECOND" {
+		t.Errorf("got secret %s, want the latest enrollment's", enrollment.Secret)
+	}
+}
+
+func testConfirmTOTPWithoutEnrolling(t *testing.T, svc db.TwoFactorService, userID string) {
+	if err := svc.ConfirmTOTPEnrollment(context.Background(), userID, time.Now(), 100, nil); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+}
+
+func testUseTOTPStep(t *testing.T, svc db.TwoFactorService, userID string) {
+	ctx := context.Background()
+
+	if err := svc.UseTOTPStep(ctx, userID, 101); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v before enrolling, want %v", err, db.ErrEntityNotFound)
+	}
+
+	mustEnableTOTP(t, svc, userID, "SECRET", nil)
+
+	// the code confirming the enrollment is already used
+	if err := svc.UseTOTPStep(ctx, userID, 100); !errors.Is(err, db.ErrTOTPCodeReused) {
+		t.Errorf("got %v for the confirming step, want %v", err, db.ErrTOTPCodeReused)
+	}
+	if err := svc.UseTOTPStep(ctx, userID, 101); err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []int64{101, 99} {
+		if err := svc.UseTOTPStep(ctx, userID, step); !errors.Is(err, db.ErrTOTPCodeReused) {
+			t.Errorf("got %v for step %d, want %v", err, step, db.ErrTOTPCodeReused)
+		}
+	}
+}
+
+func testUseRecoveryCode(t *testing.T, svc db.TwoFactorService, userID string) {
+	ctx := context.Background()
+
+	codes, hashes, err := db.NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustEnableTOTP(t, svc, userID, "SECRET", hashes)
+
+	if err := svc.UseRecoveryCode(ctx, userID, db.HashRecoveryCode(codes[0]), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.UseRecoveryCode(ctx, userID, db.HashRecoveryCode(codes[0]), time.Now()); !errors.Is(err, db.ErrInvalidRecoveryCode) {
+		t.Errorf("got %v using a code twice, want %v", err, db.ErrInvalidRecoveryCode)
+	}
+	if err := svc.UseRecoveryCode(ctx, userID, db.HashRecoveryCode("not-a-code"), time.Now()); !errors.Is(err, db.ErrInvalidRecoveryCode) {
+		t.Errorf("got %v for an unknown code, want %v", err, db.ErrInvalidRecoveryCode)
+	}
+	if err := svc.UseRecoveryCode(ctx, missingID, db.HashRecoveryCode(codes[1]), time.Now()); !errors.Is(err, db.ErrInvalidRecoveryCode) {
+		t.Errorf("got %v for another user's code, want %v", err, db.ErrInvalidRecoveryCode)
+	}
+}
+
+func testDeleteTOTPEnrollment(t *testing.T, svc db.TwoFactorService, userID string) {
+	ctx := context.Background()
+
+	if err := svc.DeleteTOTPEnrollment(ctx, userID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v before enrolling, want %v", err, db.ErrEntityNotFound)
+	}
+
+	codes, hashes, err := db.NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustEnableTOTP(t, svc, userID, "SECRET", hashes)
+
+	if err := svc.DeleteTOTPEnrollment(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FetchTOTPEnrollment(ctx, userID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v after disabling, want %v", err, db.ErrEntityNotFound)
+	}
+	if err := svc.UseRecoveryCode(ctx, userID, db.HashRecoveryCode(codes[0]), time.Now()); !errors.Is(err, db.ErrInvalidRecoveryCode) {
+		t.Errorf("got %v using a recovery code after disabling, want %v", err, db.ErrInvalidRecoveryCode)
+	}
+}
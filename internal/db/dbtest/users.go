@@ -0,0 +1,492 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// UserServiceFactory returns a new UserService with no users for a single test
+type UserServiceFactory func(t *testing.T) db.UserService
+
+// RunUserServiceSuite asserts the db.UserService contract against the implementation returned by newService
+func RunUserServiceSuite(t *testing.T, newService UserServiceFactory) {
+	tests := []struct {
+		Name string
+		Run  func(t *testing.T, svc db.UserService)
+	}{
+		{"Create Assigns ID", testCreateUserAssignsID},
+		{"Create Duplicate Username", testCreateDuplicateUsername},
+		{"Fetch By ID", testFetchUserByID},
+		{"Created Users Can Log In", testCreatedUsersCanLogIn},
+		{"Update", testUpdateUser},
+		{"Update Not Found", testUpdateUserNotFound},
+		{"List", testListUsers},
+		{"Concurrent Duplicate Creates", testConcurrentDuplicateUserCreates},
+		{"External Users", testExternalUsers},
+		{"External User Identity Taken", testExternalUserIdentityTaken},
+		{"External User Username Taken", testExternalUserUsernameTaken},
+		{"Email Addresses", testUserEmails},
+		{"Email Address Taken", testUserEmailTaken},
+		{"Suspend", testSuspendUser},
+		{"Delete", testDeleteUser},
+		{"Not Found", testUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.Run(t, newService(t))
+		})
+	}
+}
+
+func mustNewUser(t *testing.T, username, password string) *model.User {
+	t.Helper()
+
+	user, err := db.NewUser(username, "Name of "+username, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func mustCreateUser(t *testing.T, svc db.UserService, user *model.User) {
+	t.Helper()
+
+	if err := svc.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testCreateUserAssignsID(t *testing.T, svc db.UserService) {
+	user := mustNewUser(t, "kishiguro", "klara and the sun")
+	mustCreateUser(t, svc, user)
+
+	if user.ID == "" {
+		t.Fatal("expected ID to be assigned")
+	}
+
+	stored, err := svc.FetchUser("kishiguro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stored != *user {
+		t.Errorf("got %+v, want %+v", *stored, *user)
+	}
+	if stored.Role != model.DefaultRole {
+		t.Errorf("got Role %q, want %q", stored.Role, model.DefaultRole)
+	}
+}
+
+func testCreateDuplicateUsername(t *testing.T, svc db.UserService) {
+	mustCreateUser(t, svc, mustNewUser(t, "kishiguro", "klara and the sun"))
+
+	err := svc.CreateUser(context.Background(), mustNewUser(t, "kishiguro", "never let me go"))
+	if !errors.Is(err, db.ErrUserAlreadyExists) {
+		t.Errorf("got %v, want %v", err, db.ErrUserAlreadyExists)
+	}
+}
+
+func testFetchUserByID(t *testing.T, svc db.UserService) {
+	user := mustNewUser(t, "kishiguro", "klara and the sun")
+	mustCreateUser(t, svc, user)
+
+	stored, err := svc.FetchUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stored != *user {
+		t.Errorf("got %+v, want %+v", *stored, *user)
+	}
+
+	for _, id := range []string{missingID, "not-a-uuid"} {
+		if _, err := svc.FetchUserByID(context.Background(), id); !errors.Is(err, db.ErrEntityNotFound) {
+			t.Errorf("got %v fetching %q, want %v", err, id, db.ErrEntityNotFound)
+		}
+	}
+}
+
+func testCreatedUsersCanLogIn(t *testing.T, svc db.UserService) {
+	mustCreateUser(t, svc, mustNewUser(t, "kishiguro", "klara and the sun"))
+
+	user, err := svc.AuthenticateUser("kishiguro", "klara and the sun")
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if user.Username != "kishiguro" || user.ID == "" {
+		t.Errorf("got %+v, want the created user", *user)
+	}
+	if _, err := svc.AuthenticateUser("kishiguro", "never let me go"); !errors.Is(err, db.ErrInvalidCredentials) {
+		t.Errorf("got %v, want %v", err, db.ErrInvalidCredentials)
+	}
+}
+
+func testUpdateUser(t *testing.T, svc db.UserService) {
+	user := mustNewUser(t, "kishiguro", "klara and the sun")
+	mustCreateUser(t, svc, user)
+
+	hash, err := db.HashPassword("never let me go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// usernames cannot be changed
+	updated := model.User{ID: user.ID, Username: "renamed", Name: "Kazuo Ishiguro", Role: model.RoleEditor, PasswordHash: hash}
+	if err := svc.UpdateUser(context.Background(), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Username != user.Username {
+		t.Errorf("got Username %q, want %q", updated.Username, user.Username)
+	}
+
+	stored, err := svc.FetchUser("kishiguro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stored != updated {
+		t.Errorf("got %+v, want %+v", *stored, updated)
+	}
+	if _, err := svc.FetchUser("renamed"); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+	if _, err := svc.AuthenticateUser("kishiguro", "never let me go"); err != nil {
+		t.Errorf("got %v logging in with the new password, want nil", err)
+	}
+}
+
+func testUpdateUserNotFound(t *testing.T, svc db.UserService) {
+	for _, id := range []string{missingID, "not-a-uuid"} {
+		err := svc.UpdateUser(context.Background(), &model.User{ID: id, Name: "nobody"})
+		if !errors.Is(err, db.ErrEntityNotFound) {
+			t.Errorf("got %v updating %q, want %v", err, id, db.ErrEntityNotFound)
+		}
+	}
+}
+
+func testListUsers(t *testing.T, svc db.UserService) {
+	users, err := svc.ListUsers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users == nil || len(users) != 0 {
+		t.Errorf("got %#v, want an empty, non-nil slice", users)
+	}
+
+	for _, username := range []string{"dsedaris", "kishiguro", "admin"} {
+		mustCreateUser(t, svc, mustNewUser(t, username, "a long password"))
+	}
+
+	users, err = svc.ListUsers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"admin", "dsedaris", "kishiguro"}
+	if len(users) != len(want) {
+		t.Fatalf("got %d users, want %d", len(users), len(want))
+	}
+	for i := range want {
+		if users[i].Username != want[i] {
+			t.Errorf("got %q at position %d, want %q", users[i].Username, i, want[i])
+		}
+	}
+}
+
+func testConcurrentDuplicateUserCreates(t *testing.T, svc db.UserService) {
+	const n = 5
+
+	// hash once up front as bcrypt is deliberately slow
+	user := mustNewUser(t, "kishiguro", "klara and the sun")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u := *user
+			errs <- svc.CreateUser(context.Background(), &u)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, db.ErrUserAlreadyExists):
+			t.Errorf("got %v, want nil or %v", err, db.ErrUserAlreadyExists)
+		}
+	}
+	if created != 1 {
+		t.Errorf("got %d users created with the same username, want 1", created)
+	}
+}
+
+const (
+	testIssuer  = "https://id.example.com"
+	testSubject = "248289761001"
+)
+
+func mustNewExternalUser(t *testing.T, username string) *model.User {
+	t.Helper()
+
+	user, err := db.NewExternalUser(username, "Name of "+username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func testExternalUsers(t *testing.T, svc db.UserService) {
+	ctx := context.Background()
+
+	user := mustNewExternalUser(t, "kishiguro")
+	if err := svc.CreateExternalUser(ctx, user, testIssuer, testSubject); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == "" {
+		t.Fatal("expected ID to be assigned")
+	}
+
+	stored, err := svc.FetchUserByIdentity(ctx, testIssuer, testSubject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stored != *user {
+		t.Errorf("got %+v, want %+v", *stored, *user)
+	}
+
+	// subjects are only unique per issuer
+	if _, err := svc.FetchUserByIdentity(ctx, "https://other.example.com", testSubject); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+
+	// external users have no password to log in with
+	if _, err := svc.AuthenticateUser("kishiguro", ""); !errors.Is(err, db.ErrInvalidCredentials) {
+		t.Errorf("got %v, want %v", err, db.ErrInvalidCredentials)
+	}
+}
+
+func testExternalUserIdentityTaken(t *testing.T, svc db.UserService) {
+	ctx := context.Background()
+
+	if err := svc.CreateExternalUser(ctx, mustNewExternalUser(t, "kishiguro"), testIssuer, testSubject); err != nil {
+		t.Fatal(err)
+	}
+
+	err := svc.CreateExternalUser(ctx, mustNewExternalUser(t, "kishiguro-2"), testIssuer, testSubject)
+	if !errors.Is(err, db.ErrIdentityAlreadyLinked) {
+		t.Fatalf("got %v, want %v", err, db.ErrIdentityAlreadyLinked)
+	}
+	if _, err := svc.FetchUser("kishiguro-2"); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want the user not to be stored", err)
+	}
+}
+
+func testExternalUserUsernameTaken(t *testing.T, svc db.UserService) {
+	ctx := context.Background()
+
+	mustCreateUser(t, svc, mustNewUser(t, "kishiguro", "klara and the sun"))
+
+	err := svc.CreateExternalUser(ctx, mustNewExternalUser(t, "kishiguro"), testIssuer, testSubject)
+	if !errors.Is(err, db.ErrUserAlreadyExists) {
+		t.Fatalf("got %v, want %v", err, db.ErrUserAlreadyExists)
+	}
+	if _, err := svc.FetchUserByIdentity(ctx, testIssuer, testSubject); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want the identity not to be linked", err)
+	}
+}
+
+func testUserEmails(t *testing.T, svc db.UserService) {
+	ctx := context.Background()
+
+	user := mustNewUser(t, "kishiguro", "klara and the sun")
+	user.Email = "kazuo@example.com"
+	mustCreateUser(t, svc, user)
+
+	// users without an email address do not conflict with each other
+	mustCreateUser(t, svc, mustNewUser(t, "dsedaris", "a long password"))
+	mustCreateUser(t, svc, mustNewUser(t, "admin", "a long password"))
+
+	stored, err := svc.FetchUserByEmail(ctx, "kazuo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stored != *user {
+		t.Errorf("got %+v, want %+v", *stored, *user)
+	}
+	if stored.EmailVerified || stored.CanPublish() {
+		t.Errorf("got %+v, want the email address unverified", *stored)
+	}
+	for _, email := range []string{"", "nobody@example.com"} {
+		if _, err := svc.FetchUserByEmail(ctx, email); !errors.Is(err, db.ErrEntityNotFound) {
+			t.Errorf("got %v fetching %q, want %v", err, email, db.ErrEntityNotFound)
+		}
+	}
+
+	stored.EmailVerified = true
+	if err := svc.UpdateUser(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = svc.FetchUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.EmailVerified || !stored.CanPublish() {
+		t.Errorf("got %+v, want the email address verified", *stored)
+	}
+
+	// clearing the email address frees it up
+	stored.Email = ""
+	if err := svc.UpdateUser(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FetchUserByEmail(ctx, "kazuo@example.com"); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrEntityNotFound)
+	}
+}
+
+func testUserEmailTaken(t *testing.T, svc db.UserService) {
+	ctx := context.Background()
+
+	user := mustNewUser(t, "kishiguro", "klara and the sun")
+	user.Email = "kazuo@example.com"
+	mustCreateUser(t, svc, user)
+
+	other := mustNewUser(t, "dsedaris", "a long password")
+	other.Email = "kazuo@example.com"
+	if err := svc.CreateUser(ctx, other); !errors.Is(err, db.ErrEmailAlreadyInUse) {
+		t.Errorf("got %v creating a user, want %v", err, db.ErrEmailAlreadyInUse)
+	}
+
+	other.Email = "david@example.com"
+	mustCreateUser(t, svc, other)
+	other.Email = "kazuo@example.com"
+	if err := svc.UpdateUser(ctx, other); !errors.Is(err, db.ErrEmailAlreadyInUse) {
+		t.Errorf("got %v updating a user, want %v", err, db.ErrEmailAlreadyInUse)
+	}
+
+	// a user can keep their own address
+	if err := svc.UpdateUser(ctx, user); err != nil {
+		t.Errorf("got %v updating a user with their own address, want nil", err)
+	}
+}
+
+func testSuspendUser(t *testing.T, svc db.UserService) {
+	ctx := context.Background()
+
+	user := mustNewUser(t, "kishiguro", "klara and the sun")
+	mustCreateUser(t, svc, user)
+	other := mustNewUser(t, "dsedaris", "a long password")
+	mustCreateUser(t, svc, other)
+
+	assertHidden := func(want ...string) {
+		t.Helper()
+		ids, err := svc.FetchHiddenAuthorIDs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids == nil || !slices.Equal(ids, want) {
+			t.Errorf("got hidden authors %#v, want %#v", ids, want)
+		}
+	}
+	assertHidden()
+
+	if err := svc.SuspendUser(ctx, user.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := svc.FetchUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Suspended || stored.PostsHidden {
+		t.Errorf("got %+v, want the user suspended with their posts shown", *stored)
+	}
+	assertHidden()
+
+	// updating a user leaves their suspension as it is
+	stored.Name = "Kazuo Ishiguro"
+	stored.Suspended = false
+	if err := svc.UpdateUser(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err = svc.FetchUser("kishiguro"); err != nil || !stored.Suspended {
+		t.Errorf("got %+v, %v, want the user still suspended", stored, err)
+	}
+
+	if err := svc.SuspendUser(ctx, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	assertHidden(user.ID)
+
+	if err := svc.ReactivateUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = svc.FetchUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Suspended || stored.PostsHidden {
+		t.Errorf("got %+v, want the user reactivated with their posts shown", *stored)
+	}
+	assertHidden()
+}
+
+func testDeleteUser(t *testing.T, svc db.UserService) {
+	ctx := context.Background()
+
+	user := mustNewExternalUser(t, "kishiguro")
+	user.Email = "kazuo@example.com"
+	if err := svc.CreateExternalUser(ctx, user, testIssuer, testSubject); err != nil {
+		t.Fatal(err)
+	}
+	other := mustNewUser(t, "dsedaris", "a long password")
+	mustCreateUser(t, svc, other)
+
+	if err := svc.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FetchUserByID(ctx, user.ID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v fetching the deleted user, want %v", err, db.ErrEntityNotFound)
+	}
+	if _, err := svc.FetchUserByIdentity(ctx, testIssuer, testSubject); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v fetching the deleted user's identity, want %v", err, db.ErrEntityNotFound)
+	}
+	if _, err := svc.FetchUser("dsedaris"); err != nil {
+		t.Errorf("got %v fetching another user, want nil", err)
+	}
+
+	// the username, email address and identity are free to be used again
+	again := mustNewExternalUser(t, "kishiguro")
+	again.Email = "kazuo@example.com"
+	if err := svc.CreateExternalUser(ctx, again, testIssuer, testSubject); err != nil {
+		t.Errorf("got %v recreating the deleted user, want nil", err)
+	}
+
+	if err := svc.DeleteUser(ctx, user.ID); !errors.Is(err, db.ErrEntityNotFound) {
+		t.Errorf("got %v deleting the user twice, want %v", err, db.ErrEntityNotFound)
+	}
+}
+
+func testUserNotFound(t *testing.T, svc db.UserService) {
+	ctx := context.Background()
+
+	for _, id := range []string{missingID, "not-a-uuid"} {
+		if err := svc.SuspendUser(ctx, id, true); !errors.Is(err, db.ErrEntityNotFound) {
+			t.Errorf("got %v suspending %q, want %v", err, id, db.ErrEntityNotFound)
+		}
+		if err := svc.ReactivateUser(ctx, id); !errors.Is(err, db.ErrEntityNotFound) {
+			t.Errorf("got %v reactivating %q, want %v", err, id, db.ErrEntityNotFound)
+		}
+		if err := svc.DeleteUser(ctx, id); !errors.Is(err, db.ErrEntityNotFound) {
+			t.Errorf("got %v deleting %q, want %v", err, id, db.ErrEntityNotFound)
+		}
+	}
+}
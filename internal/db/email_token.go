@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrInvalidEmailToken is returned when an email token is unknown, expired or has already been used
+var ErrInvalidEmailToken = errors.New("invalid email token")
+
+// EmailTokenPurpose is what an email token can be used for
+type EmailTokenPurpose string
+
+const (
+	PurposePasswordReset     EmailTokenPurpose = "password_reset"
+	PurposeEmailVerification EmailTokenPurpose = "email_verification"
+)
+
+// EmailToken is a single use token emailed to a user to prove they can read mail sent to Email. Only a hash
+// of the token is stored.
+type EmailToken struct {
+	Hash    string
+	UserID  string
+	Purpose EmailTokenPurpose
+	// Email is the address the token was sent to, so that it proves nothing once the user's address changes
+	Email     string
+	CreatedTS time.Time
+	ExpiresTS time.Time
+}
+
+// NewEmailToken generates a token for purpose that is valid for ttl, to be sent to the user's email address. It
+// returns the token to send along with the representation to store.
+func NewEmailToken(userID, email string, purpose EmailTokenPurpose, ttl time.Duration) (string, EmailToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", EmailToken{}, fmt.Errorf("error generating email token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	// timestamps are stored to the second
+	now := time.Now().UTC().Truncate(time.Second)
+	return token, EmailToken{
+		Hash:      HashRefreshToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		CreatedTS: now,
+		ExpiresTS: now.Add(ttl),
+	}, nil
+}
+
+// EmailTokenService stores the tokens emailed to users to reset their password or verify their email address
+type EmailTokenService interface {
+	// CreateEmailToken stores a token, replacing any earlier token for the same user and purpose so that only the
+	// latest one sent works
+	CreateEmailToken(ctx context.Context, token *EmailToken) error
+	// FetchEmailToken returns the token with the given hash if it has not expired at now, or fails with
+	// ErrInvalidEmailToken
+	FetchEmailToken(ctx context.Context, hash string, now time.Time) (*EmailToken, error)
+	// ConsumeEmailToken deletes the token with the given hash so that it cannot be used again, or fails with
+	// ErrInvalidEmailToken if it already has been. Concurrent uses of a token race to a single winner.
+	ConsumeEmailToken(ctx context.Context, hash string) error
+}
+
+// InMemoryEmailTokenService implements EmailTokenService for the in-memory data store
+type InMemoryEmailTokenService struct {
+	mu sync.Mutex
+	// tokens maps token hash to token
+	tokens map[string]EmailToken
+}
+
+func NewInMemoryEmailTokenService() *InMemoryEmailTokenService {
+	return &InMemoryEmailTokenService{tokens: map[string]EmailToken{}}
+}
+
+func (s *InMemoryEmailTokenService) CreateEmailToken(ctx context.Context, token *EmailToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, stored := range s.tokens {
+		if stored.UserID == token.UserID && stored.Purpose == token.Purpose {
+			delete(s.tokens, hash)
+		}
+	}
+	s.tokens[token.Hash] = *token
+	return nil
+}
+
+func (s *InMemoryEmailTokenService) FetchEmailToken(ctx context.Context, hash string, now time.Time) (*EmailToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok || !now.Before(token.ExpiresTS) {
+		return nil, ErrInvalidEmailToken
+	}
+	return &token, nil
+}
+
+func (s *InMemoryEmailTokenService) ConsumeEmailToken(ctx context.Context, hash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[hash]; !ok {
+		return ErrInvalidEmailToken
+	}
+	delete(s.tokens, hash)
+	return nil
+}
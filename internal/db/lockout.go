@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LockoutPolicy decides when repeated failed logins lock a key out, and for how long
+type LockoutPolicy struct {
+	// Threshold is how many failures in a row lock the key out
+	Threshold int
+	// BaseDelay is how long the first lockout lasts, doubling with every further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// ResetAfter forgets the failures of a key once it has gone this long without one
+	ResetAfter time.Duration
+}
+
+// LockedUntil returns when a key with the given number of failures, the last of them at lastFailureTS, can be
+// tried again, or the zero time if it is not locked out
+func (p LockoutPolicy) LockedUntil(failures int, lastFailureTS time.Time) time.Time {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return time.Time{}
+	}
+
+	delay := p.BaseDelay
+	for range failures - p.Threshold {
+		if delay >= p.MaxDelay {
+			break
+		}
+		delay *= 2
+	}
+	return lastFailureTS.Add(min(delay, p.MaxDelay))
+}
+
+// Lockout counts the failed logins for a key - a username or an IP address
+type Lockout struct {
+	Key           string    `json:"key"`
+	Failures      int       `json:"failures"`
+	LastFailureTS time.Time `json:"last_failure_ts"`
+	// LockedUntilTS is nil until the key has had enough failures to be locked out
+	LockedUntilTS *time.Time `json:"locked_until_ts"`
+}
+
+// RetryAfter returns how long until the key can be tried again, or zero if it is not locked out at now
+func (l *Lockout) RetryAfter(now time.Time) time.Duration {
+	if l.LockedUntilTS == nil || !l.LockedUntilTS.After(now) {
+		return 0
+	}
+	return l.LockedUntilTS.Sub(now)
+}
+
+// LockoutService stores failed login counts
+type LockoutService interface {
+	// RecordLoginFailure counts a failed login for key at now, locking it out as policy decides, and returns the
+	// updated count
+	RecordLoginFailure(ctx context.Context, key string, now time.Time, policy LockoutPolicy) (*Lockout, error)
+	// FetchLockout returns the failures of key, or fails with ErrEntityNotFound if it has none
+	FetchLockout(ctx context.Context, key string) (*Lockout, error)
+	// ListLockouts returns every key with failures, the most recent failure first
+	ListLockouts(ctx context.Context) ([]Lockout, error)
+	// ClearLockout forgets the failures of key, or fails with ErrEntityNotFound if it has none
+	ClearLockout(ctx context.Context, key string) error
+}
+
+// InMemoryLockoutService implements LockoutService for the in-memory data store
+type InMemoryLockoutService struct {
+	mu sync.Mutex
+	// lockouts maps key to its failures
+	lockouts map[string]*Lockout
+}
+
+func NewInMemoryLockoutService() *InMemoryLockoutService {
+	return &InMemoryLockoutService{lockouts: map[string]*Lockout{}}
+}
+
+func (s *InMemoryLockoutService) RecordLoginFailure(ctx context.Context, key string, now time.Time, policy LockoutPolicy) (*Lockout, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now = now.UTC().Truncate(time.Second)
+
+	// forget keys that have gone quiet, which also restarts the count for key if it has
+	for k, lockout := range s.lockouts {
+		if isStaleLockout(lockout, now, policy) {
+			delete(s.lockouts, k)
+		}
+	}
+
+	lockout, ok := s.lockouts[key]
+	if !ok {
+		lockout = &Lockout{Key: key}
+		s.lockouts[key] = lockout
+	}
+	lockout.Failures++
+	lockout.LastFailureTS = now
+	if lockedUntil := policy.LockedUntil(lockout.Failures, now); !lockedUntil.IsZero() {
+		lockout.LockedUntilTS = &lockedUntil
+	}
+	return copyLockout(lockout), nil
+}
+
+func (s *InMemoryLockoutService) FetchLockout(ctx context.Context, key string) (*Lockout, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lockout, ok := s.lockouts[key]
+	if !ok {
+		return nil, ErrEntityNotFound
+	}
+	return copyLockout(lockout), nil
+}
+
+func (s *InMemoryLockoutService) ListLockouts(ctx context.Context) ([]Lockout, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lockouts := make([]Lockout, 0, len(s.lockouts))
+	for _, lockout := range s.lockouts {
+		lockouts = append(lockouts, *copyLockout(lockout))
+	}
+	sort.Slice(lockouts, func(i, j int) bool {
+		if !lockouts[i].LastFailureTS.Equal(lockouts[j].LastFailureTS) {
+			return lockouts[i].LastFailureTS.After(lockouts[j].LastFailureTS)
+		}
+		return lockouts[i].Key < lockouts[j].Key
+	})
+	return lockouts, nil
+}
+
+func (s *InMemoryLockoutService) ClearLockout(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lockouts[key]; !ok {
+		return ErrEntityNotFound
+	}
+	delete(s.lockouts, key)
+	return nil
+}
+
+// isStaleLockout reports whether the failures of lockout can be forgotten at now
+func isStaleLockout(lockout *Lockout, now time.Time, policy LockoutPolicy) bool {
+	return now.Sub(lockout.LastFailureTS) > policy.ResetAfter && lockout.RetryAfter(now) == 0
+}
+
+// copyLockout copies lockout so that callers and the store cannot modify each other's copies
+func copyLockout(lockout *Lockout) *Lockout {
+	l := *lockout
+	if lockout.LockedUntilTS != nil {
+		lockedUntil := *lockout.LockedUntilTS
+		l.LockedUntilTS = &lockedUntil
+	}
+	return &l
+}
@@ -0,0 +1,284 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+var ErrNoMigrationsApplied = errors.New("no migrations have been applied")
+
+// migrationLockKey identifies the PostgreSQL advisory lock held while migrating. Any value works, as long as
+// every instance uses the same one.
+const migrationLockKey = 0x626c6f67
+
+// migration files are named <version>_<name>.<up|down>.sql, ie: 0001_create_posts.up.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied to the database
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads the migration files in the root of fsys and returns them ordered by version
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+
+		b, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %q: %w", entry.Name(), err)
+		}
+
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator applies and reverts schema migrations, tracking progress in the schema_migrations table
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator for the migrations embedded in this package
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	fsys, err := fs.Sub(embeddedMigrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// migrationQuerier is satisfied by the database, and by the transaction holding the migration lock
+type migrationQuerier interface {
+	querier
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func (m *Migrator) ensureMigrationsTable(ctx context.Context, q migrationQuerier) error {
+	_, err := q.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at timestamp NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns the time each applied migration version was run
+func (m *Migrator) appliedMigrations(ctx context.Context, q migrationQuerier) (map[int]time.Time, error) {
+	if err := m.ensureMigrationsTable(ctx, q); err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// withLock runs fn in a transaction holding a lock that keeps other processes from migrating the database at
+// the same time, ie: several instances starting with db.auto_migrate. Which migrations have been applied has to
+// be read within fn, as another process may have applied some while it waited for the lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(q migrationQuerier) error) error {
+	if _, ok := m.db.Driver().(*sqlite.Driver); !ok {
+		return withTx(ctx, m.db, func(tx *sql.Tx) error {
+			// released when the transaction ends, so it cannot outlive a failed migration on a pooled connection
+			if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockKey); err != nil {
+				return fmt.Errorf("error locking database for migration: %w", err)
+			}
+			return fn(tx)
+		})
+	}
+
+	// SQLite has no advisory locks, but an exclusive transaction keeps out every other writer. database/sql
+	// cannot begin one, so it is run by hand on a connection of its own.
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `BEGIN EXCLUSIVE`); err != nil {
+		return fmt.Errorf("error locking database for migration: %w", err)
+	}
+	if err := fn(conn); err != nil {
+		conn.ExecContext(context.WithoutCancel(ctx), `ROLLBACK`)
+		return err
+	}
+	_, err = conn.ExecContext(ctx, `COMMIT`)
+	return err
+}
+
+// Up applies every pending migration in order and returns the ones that were run. They are applied in a single
+// transaction, so if one fails none of them are.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	ran := []Migration{}
+	err := m.withLock(ctx, func(q migrationQuerier) error {
+		applied, err := m.appliedMigrations(ctx, q)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			if _, err := q.ExecContext(ctx, migration.Up); err != nil {
+				return fmt.Errorf("error applying migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			_, err := q.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+				migration.Version, migration.Name, time.Now().UTC(),
+			)
+			if err != nil {
+				return fmt.Errorf("error applying migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			ran = append(ran, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ran, nil
+}
+
+// Down reverts the most recently applied migration
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	var reverted Migration
+	err := m.withLock(ctx, func(q migrationQuerier) error {
+		applied, err := m.appliedMigrations(ctx, q)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if _, err := q.ExecContext(ctx, migration.Down); err != nil {
+				return fmt.Errorf("error reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			if _, err := q.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version); err != nil {
+				return fmt.Errorf("error reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = migration
+			return nil
+		}
+		return ErrNoMigrationsApplied
+	})
+	if err != nil {
+		return Migration{}, err
+	}
+
+	return reverted, nil
+}
+
+// Status lists every known migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.appliedMigrations(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, MigrationStatus{
+			Migration: migration,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+	return statuses, nil
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	m, err := NewMigrator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.migrations) == 0 {
+		t.Fatal("expected embedded migrations to be found")
+	}
+	for i, migration := range m.migrations {
+		if migration.Version != i+1 {
+			t.Errorf("got version %d at position %d, want %d", migration.Version, i, i+1)
+		}
+	}
+}
+
+var loadMigrationsTestCases = []struct {
+	Name     string
+	Files    fstest.MapFS
+	Versions []int
+	WantErr  bool
+}{
+	{
+		Name: "Sorted By Version",
+		Files: fstest.MapFS{
+			"0010_add_tags.up.sql":       {Data: []byte("up")},
+			"0010_add_tags.down.sql":     {Data: []byte("down")},
+			"0002_add_index.up.sql":      {Data: []byte("up")},
+			"0002_add_index.down.sql":    {Data: []byte("down")},
+			"0001_create_posts.up.sql":   {Data: []byte("up")},
+			"0001_create_posts.down.sql": {Data: []byte("down")},
+		},
+		Versions: []int{1, 2, 10},
+	},
+	{
+		Name: "Missing Down File",
+		Files: fstest.MapFS{
+			"0001_create_posts.up.sql": {Data: []byte("up")},
+		},
+		WantErr: true,
+	},
+	{
+		Name: "Conflicting Names",
+		Files: fstest.MapFS{
+			"0001_create_posts.up.sql":   {Data: []byte("up")},
+			"0001_create_users.down.sql": {Data: []byte("down")},
+		},
+		WantErr: true,
+	},
+	{
+		Name: "Invalid File Name",
+		Files: fstest.MapFS{
+			"create_posts.sql": {Data: []byte("up")},
+		},
+		WantErr: true,
+	},
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for _, tt := range loadMigrationsTestCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			migrations, err := LoadMigrations(tt.Files)
+			if tt.WantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(migrations) != len(tt.Versions) {
+				t.Fatalf("got %d migrations, want %d", len(migrations), len(tt.Versions))
+			}
+			for i, v := range tt.Versions {
+				if migrations[i].Version != v {
+					t.Errorf("got version %d at position %d, want %d", migrations[i].Version, i, v)
+				}
+			}
+		})
+	}
+}
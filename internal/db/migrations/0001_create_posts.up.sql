@@ -0,0 +1,16 @@
+-- IF NOT EXISTS lets databases bootstrapped from the old db/seed.sql adopt the migration history
+CREATE TABLE IF NOT EXISTS posts (
+    id UUID PRIMARY KEY,
+    status TEXT NOT NULL,
+    title TEXT NOT NULL,
+    summary TEXT NOT NULL,
+    content TEXT NOT NULL,
+    author_id UUID NOT NULL,
+    created_ts timestamp NOT NULL,
+    published_ts timestamp,
+    updated_ts timestamp NOT NULL
+);
+
+-- an author cannot have two posts with the same title. This is an index of its own rather than part of the
+-- table, so that an adopted table which was created without it gets it too.
+CREATE UNIQUE INDEX IF NOT EXISTS posts_author_id_title_idx ON posts (author_id, title);
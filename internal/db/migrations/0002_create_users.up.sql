@@ -0,0 +1,6 @@
+CREATE TABLE users (
+    id UUID PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE
+);
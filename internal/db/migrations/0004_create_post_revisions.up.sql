@@ -0,0 +1,15 @@
+CREATE TABLE post_revisions (
+    post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    author_id UUID NOT NULL,
+    status TEXT NOT NULL,
+    title TEXT NOT NULL,
+    summary TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created_ts timestamp NOT NULL,
+    PRIMARY KEY (post_id, revision)
+);
+
+-- existing posts start their history at their current version
+INSERT INTO post_revisions (post_id, revision, author_id, status, title, summary, content, created_ts)
+SELECT id, version, author_id, status, title, summary, content, updated_ts FROM posts;
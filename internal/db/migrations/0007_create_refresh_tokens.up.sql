@@ -0,0 +1,12 @@
+CREATE TABLE refresh_tokens (
+    -- only a hash of the token is stored
+    token_hash TEXT PRIMARY KEY,
+    family_id UUID NOT NULL,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_ts timestamp NOT NULL,
+    expires_ts timestamp NOT NULL,
+    used_ts timestamp,
+    revoked_ts timestamp
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
@@ -0,0 +1,12 @@
+-- access tokens revoked individually, ie: on logout
+CREATE TABLE revoked_tokens (
+    token_id TEXT PRIMARY KEY,
+    -- the token only has to be remembered until it expires
+    expires_ts timestamp NOT NULL
+);
+
+-- tokens issued to the user at or before revoked_ts are revoked
+CREATE TABLE user_token_revocations (
+    user_id UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    revoked_ts timestamp NOT NULL
+);
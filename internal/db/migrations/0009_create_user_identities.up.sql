@@ -0,0 +1,10 @@
+-- links users to the subjects of external identity providers they log in through
+CREATE TABLE user_identities (
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_ts timestamp NOT NULL,
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET is_admin = TRUE WHERE role = 'admin';
+ALTER TABLE users DROP COLUMN role;
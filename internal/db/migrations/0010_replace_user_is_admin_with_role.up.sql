@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'author';
+UPDATE users SET role = 'admin' WHERE is_admin;
+ALTER TABLE users DROP COLUMN is_admin;
@@ -0,0 +1,13 @@
+CREATE TABLE api_tokens (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    -- only a hash of the token is stored
+    token_hash TEXT NOT NULL UNIQUE,
+    -- space separated permissions
+    scopes TEXT NOT NULL,
+    created_ts timestamp NOT NULL,
+    last_used_ts timestamp
+);
+
+CREATE INDEX api_tokens_user_id_idx ON api_tokens (user_id);
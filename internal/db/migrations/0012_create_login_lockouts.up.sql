@@ -0,0 +1,7 @@
+CREATE TABLE login_lockouts (
+    -- a username or IP address, ie: username:kishiguro or ip:192.0.2.1
+    lockout_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_ts timestamp NOT NULL,
+    locked_until_ts timestamp
+);
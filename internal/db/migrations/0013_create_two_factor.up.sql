@@ -0,0 +1,17 @@
+CREATE TABLE totp_enrollments (
+    user_id UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    created_ts timestamp NOT NULL,
+    -- two-factor authentication is only enabled once the enrollment is confirmed
+    confirmed_ts timestamp,
+    -- the time step of the last code accepted, so that a code cannot be used twice
+    last_used_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE recovery_codes (
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- only a hash of the code is stored
+    code_hash TEXT NOT NULL,
+    used_ts timestamp,
+    PRIMARY KEY (user_id, code_hash)
+);
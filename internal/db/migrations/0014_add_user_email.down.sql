@@ -0,0 +1,4 @@
+DROP INDEX users_email_idx;
+
+ALTER TABLE users DROP COLUMN email_verified;
+ALTER TABLE users DROP COLUMN email;
@@ -0,0 +1,5 @@
+-- users without an email address have NULL rather than '' so that they do not conflict
+ALTER TABLE users ADD COLUMN email TEXT;
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX users_email_idx ON users (email);
@@ -0,0 +1,13 @@
+CREATE TABLE email_tokens (
+    -- only a hash of the token is stored
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- password_reset or email_verification
+    purpose TEXT NOT NULL,
+    -- the address the token was sent to
+    email TEXT NOT NULL,
+    created_ts timestamp NOT NULL,
+    expires_ts timestamp NOT NULL,
+    -- only the latest token for each purpose works
+    UNIQUE (user_id, purpose)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN posts_hidden;
+ALTER TABLE users DROP COLUMN suspended;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN suspended BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN posts_hidden BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+ALTER TABLE post_revisions DROP COLUMN tags;
+ALTER TABLE posts DROP COLUMN tags;
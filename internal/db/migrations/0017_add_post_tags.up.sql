@@ -0,0 +1,3 @@
+-- tags are stored as a JSON array of strings
+ALTER TABLE posts ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE post_revisions ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidCredentials is returned when a username and password do not match a user. It deliberately
+	// does not say which of the two was wrong.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrWeakPassword is returned when a new password does not meet the password policy
+	ErrWeakPassword = fmt.Errorf("passwords must be %d to %d bytes long and must not contain the username", minPasswordLength, maxPasswordLength)
+)
+
+// bcrypt ignores anything past 72 bytes, so longer passwords are rejected rather than silently truncated
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// dummyPasswordHash is compared against when a user does not exist so that unknown usernames take as
+// long to reject as wrong passwords
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// HashPassword returns the bcrypt hash of password for storing on a model.User
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// ValidatePassword checks a new password for username against the password policy
+func ValidatePassword(username, password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return ErrWeakPassword
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+// validatePasswordHash checks that hash is a bcrypt hash so misconfigured users are caught on start up
+// rather than at login
+func validatePasswordHash(hash string) error {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return fmt.Errorf("invalid password hash: %w", err)
+	}
+	return nil
+}
+
+// checkPassword compares password against hash in constant time, returning ErrInvalidCredentials if
+// they do not match. An empty hash never matches.
+func checkPassword(hash, password string) error {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return ErrInvalidCredentials
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return fmt.Errorf("error checking password: %w", err)
+	}
+	return nil
+}
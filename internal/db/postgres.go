@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+)
+
+// postgres error codes we translate into package errors
+// see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation           = "23505"
+	pgInvalidTextRepresentation = "22P02"
+)
+
+var postgresDialect = sqlDialect{
+	isUniqueViolation: func(err error) bool {
+		return hasPostgresCode(err, pgUniqueViolation)
+	},
+	isInvalidID: func(err error) bool {
+		return hasPostgresCode(err, pgInvalidTextRepresentation)
+	},
+}
+
+// OpenPostgres opens a connection pool to PostgreSQL and verifies it is reachable
+func OpenPostgres(ctx context.Context, cfg config.DBConfig) (*sql.DB, error) {
+	if cfg.DSN == "" {
+		return nil, errors.New("no DSN provided for database connection")
+	}
+
+	conn, err := sql.Open("pgx", cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database connection: %w", err)
+	}
+
+	conn.SetMaxOpenConns(cfg.MaxOpenConns)
+	conn.SetMaxIdleConns(cfg.MaxIdleConns)
+	conn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	return conn, nil
+}
+
+// PostgresBlogService implements BlogService against the posts table in PostgreSQL
+type PostgresBlogService struct {
+	sqlBlogService
+}
+
+func NewPostgresBlogService(db *sql.DB) *PostgresBlogService {
+	return &PostgresBlogService{sqlBlogService{db: db, dialect: postgresDialect}}
+}
+
+// PostgresUserService implements UserService against the users table in PostgreSQL
+type PostgresUserService struct {
+	sqlUserService
+}
+
+func NewPostgresUserService(db *sql.DB) *PostgresUserService {
+	return &PostgresUserService{sqlUserService{db: db, dialect: postgresDialect}}
+}
+
+// PostgresRefreshTokenService implements RefreshTokenService against the refresh_tokens table in PostgreSQL
+type PostgresRefreshTokenService struct {
+	sqlRefreshTokenService
+}
+
+func NewPostgresRefreshTokenService(db *sql.DB) *PostgresRefreshTokenService {
+	return &PostgresRefreshTokenService{sqlRefreshTokenService{db: db}}
+}
+
+// PostgresTokenRevocationService implements TokenRevocationService against the token revocation tables in PostgreSQL
+type PostgresTokenRevocationService struct {
+	sqlTokenRevocationService
+}
+
+func NewPostgresTokenRevocationService(db *sql.DB) *PostgresTokenRevocationService {
+	return &PostgresTokenRevocationService{sqlTokenRevocationService{db: db}}
+}
+
+// PostgresAPITokenService implements APITokenService against the api_tokens table in PostgreSQL
+type PostgresAPITokenService struct {
+	sqlAPITokenService
+}
+
+func NewPostgresAPITokenService(db *sql.DB) *PostgresAPITokenService {
+	return &PostgresAPITokenService{sqlAPITokenService{db: db, dialect: postgresDialect}}
+}
+
+// PostgresLockoutService implements LockoutService against the login_lockouts table in PostgreSQL
+type PostgresLockoutService struct {
+	sqlLockoutService
+}
+
+func NewPostgresLockoutService(db *sql.DB) *PostgresLockoutService {
+	return &PostgresLockoutService{sqlLockoutService{db: db}}
+}
+
+// PostgresTwoFactorService implements TwoFactorService against the totp_enrollments and recovery_codes tables in PostgreSQL
+type PostgresTwoFactorService struct {
+	sqlTwoFactorService
+}
+
+func NewPostgresTwoFactorService(db *sql.DB) *PostgresTwoFactorService {
+	return &PostgresTwoFactorService{sqlTwoFactorService{db: db, dialect: postgresDialect}}
+}
+
+// PostgresEmailTokenService implements EmailTokenService against the email_tokens table in PostgreSQL
+type PostgresEmailTokenService struct {
+	sqlEmailTokenService
+}
+
+func NewPostgresEmailTokenService(db *sql.DB) *PostgresEmailTokenService {
+	return &PostgresEmailTokenService{sqlEmailTokenService{db: db}}
+}
+
+func hasPostgresCode(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
@@ -3,99 +3,739 @@ package db
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/James-D-Wood/blog-api/internal/model"
 )
 
-// TODO: database implementation of BlogService interface
-
 var (
 	ErrEntityNotFound        = errors.New("entity not found")
 	ErrBlogPostAlreadyExists = errors.New("blog post already exists")
+	// ErrVersionConflict is returned when a write is based on a version of a post that is no longer current
+	ErrVersionConflict = errors.New("blog post has been modified since it was read")
+	// ErrInvalidStatus is returned when a post is written with a status clients cannot set directly
+	ErrInvalidStatus = errors.New("posts can only be moved to the trash by deleting them")
+	// ErrInvalidTags is returned when a post is written with too many tags or a tag that is not allowed
+	ErrInvalidTags = errors.New("invalid tags")
+	// ErrInvalidBulkAction is returned when a bulk action is not one of BulkActions
+	ErrInvalidBulkAction = errors.New("invalid bulk action")
+	// ErrBulkActionFailed is returned when a bulk action could not be applied to every post, in which case
+	// it was applied to none of them
+	ErrBulkActionFailed = errors.New("bulk action failed for some posts")
+)
+
+// AnyVersion can be passed as an expected version to skip the optimistic concurrency check
+const AnyVersion = 0
+
+// MaxBulkActionPosts is the most posts a single bulk action can be applied to
+const MaxBulkActionPosts = 100
+
+// MaxPostTags is the most tags a post can have
+const MaxPostTags = 20
+
+// MaxTagLength is the most characters a tag can have
+const MaxTagLength = 32
+
+// BulkAction is a change that can be applied to many posts at once
+type BulkAction string
+
+const (
+	// BulkUnpublish moves published posts back to drafts
+	BulkUnpublish BulkAction = "unpublish"
+	// BulkDelete moves posts to the trash
+	BulkDelete BulkAction = "delete"
+	// BulkRestore takes posts out of the trash as drafts
+	BulkRestore BulkAction = "restore"
+	// BulkRetag replaces the tags of live posts
+	BulkRetag BulkAction = "retag"
 )
 
+// BulkActions lists every bulk action
+var BulkActions = []BulkAction{BulkUnpublish, BulkDelete, BulkRestore, BulkRetag}
+
+// BulkActionResult is the outcome of a bulk action for a single post
+type BulkActionResult struct {
+	PostID string
+	// Changed is false if the post was already in the state the action moves posts to
+	Changed bool
+	// Err is why the action could not be applied to the post, ie: ErrEntityNotFound
+	Err error
+}
+
+// BlogService persists blog posts. Posts in the trash are treated as not found by every method other
+// than the ones dedicated to the trash. Methods that change a post take the ID of the user making the change,
+// which is recorded in the revision they produce.
 type BlogService interface {
 	FetchBlogPost(ctx context.Context, id string) (model.BlogPost, error)
-	FetchPublishedBlogPosts(ctx context.Context) ([]model.BlogPost, error)
+	// FetchPublishedBlogPosts returns a page of the published posts matching query
+	FetchPublishedBlogPosts(ctx context.Context, query BlogPostQuery) (BlogPostPage, error)
+	// FetchAuthorBlogPosts returns a page of the author's posts matching query, including their drafts
+	// if includeDrafts is set. Listings that include drafts default to being sorted by updated time.
+	FetchAuthorBlogPosts(ctx context.Context, authorID string, includeDrafts bool, query BlogPostQuery) (BlogPostPage, error)
 	CreateBlogPost(ctx context.Context, userID string, blog *model.BlogPost) error
-	UpdateBlogPost(ctx context.Context, newVersion *model.BlogPost, previousVersion *model.BlogPost) error
-	DeleteBlogPost(ctx context.Context, id string) error
+	// UpdateBlogPost applies newVersion on top of previousVersion, failing with ErrVersionConflict
+	// if previousVersion.Version is no longer the stored version
+	UpdateBlogPost(ctx context.Context, editorID string, newVersion *model.BlogPost, previousVersion *model.BlogPost) error
+	// DeleteBlogPost moves a post to the trash, failing with ErrVersionConflict if expectedVersion is not
+	// AnyVersion and does not match the stored version. Trashed posts keep their title until purged.
+	DeleteBlogPost(ctx context.Context, editorID, id string, expectedVersion int) error
+	FetchDeletedBlogPost(ctx context.Context, id string) (model.BlogPost, error)
+	// FetchDeletedBlogPosts lists the author's posts in the trash, most recently deleted first
+	FetchDeletedBlogPosts(ctx context.Context, authorID string) ([]model.BlogPost, error)
+	// RestoreBlogPost takes a post out of the trash as a draft, failing with ErrVersionConflict if
+	// post.Version is no longer the stored version
+	RestoreBlogPost(ctx context.Context, editorID string, post *model.BlogPost) error
+	// PurgeDeletedBlogPosts permanently removes posts trashed before deletedBefore along with their history
+	PurgeDeletedBlogPosts(ctx context.Context, deletedBefore time.Time) (int, error)
+	// FetchBlogPostRevisions lists every revision of a post, oldest first - creating and updating a post
+	// each record a revision numbered after the version they produce
+	FetchBlogPostRevisions(ctx context.Context, postID string) ([]model.BlogPostRevision, error)
+	FetchBlogPostRevision(ctx context.Context, postID string, revision int) (model.BlogPostRevision, error)
+	// TransferBlogPost makes toAuthorID the author of a post, whether it is live or in the trash, returning the
+	// updated post. It fails with ErrBlogPostAlreadyExists if they already have a post with the same title.
+	TransferBlogPost(ctx context.Context, editorID, id, toAuthorID string) (model.BlogPost, error)
+	// TransferAuthorBlogPosts makes toAuthorID the author of every post of fromAuthorID, including the ones
+	// in the trash, returning how many were transferred. Either every post is transferred or none are.
+	TransferAuthorBlogPosts(ctx context.Context, editorID, fromAuthorID, toAuthorID string) (int, error)
+	// ApplyBulkAction applies action to the posts with the given IDs in a single transaction, returning the
+	// result for each in order. If it cannot be applied to some post nothing is changed, and the results are
+	// returned alongside ErrBulkActionFailed. Tags are the tags BulkRetag gives each post, and are ignored
+	// by the other actions.
+	ApplyBulkAction(ctx context.Context, editorID string, action BulkAction, ids []string, tags []string) ([]BulkActionResult, error)
 }
 
-// InMemoryBlogService implements BlogService using an in process data store
+// InMemoryBlogService implements BlogService using an in process data store and is safe for concurrent use
 type InMemoryBlogService struct {
-	m map[string]model.BlogPost
+	mu sync.RWMutex
+	m  map[string]model.BlogPost
+	// revisions maps post ID to the post's revisions in order
+	revisions map[string][]model.BlogPostRevision
+	// version is incremented on every write so snapshots can be skipped when nothing changed
+	version uint64
+	// Logger reports posts that are skipped because they are corrupt, and defaults to slog.Default()
+	Logger *slog.Logger
 }
 
 func NewInMemoryBlogService() *InMemoryBlogService {
-	return &InMemoryBlogService{m: map[string]model.BlogPost{}}
+	return &InMemoryBlogService{
+		m:         map[string]model.BlogPost{},
+		revisions: map[string][]model.BlogPostRevision{},
+	}
+}
+
+func (s *InMemoryBlogService) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
 }
 
 func (s *InMemoryBlogService) FetchBlogPost(ctx context.Context, id string) (model.BlogPost, error) {
-	if blog, ok := s.m[id]; ok {
+	if err := ctx.Err(); err != nil {
+		return model.BlogPost{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if blog, ok := s.m[id]; ok && blog.Status != model.DELETED {
 		return blog, nil
 	}
 	return model.BlogPost{}, ErrEntityNotFound
 }
 
-func (s *InMemoryBlogService) FetchPublishedBlogPosts(ctx context.Context) ([]model.BlogPost, error) {
+func (s *InMemoryBlogService) FetchPublishedBlogPosts(ctx context.Context, query BlogPostQuery) (BlogPostPage, error) {
+	return s.fetchBlogPosts(ctx, query, SortPublished, []model.BlogPostStatus{model.PUBLISHED})
+}
+
+func (s *InMemoryBlogService) FetchAuthorBlogPosts(ctx context.Context, authorID string, includeDrafts bool, query BlogPostQuery) (BlogPostPage, error) {
+	statuses, defaultSort, err := query.forAuthor(authorID, includeDrafts)
+	if err != nil {
+		return BlogPostPage{}, err
+	}
+	return s.fetchBlogPosts(ctx, query, defaultSort, statuses)
+}
+
+// fetchBlogPosts returns a page of the posts with one of the given statuses matching query
+func (s *InMemoryBlogService) fetchBlogPosts(ctx context.Context, query BlogPostQuery, defaultSort BlogPostSort, statuses []model.BlogPostStatus) (BlogPostPage, error) {
+	if err := ctx.Err(); err != nil {
+		return BlogPostPage{}, err
+	}
+
+	cursor, err := query.normalize(defaultSort)
+	if err != nil {
+		return BlogPostPage{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type sortablePost struct {
+		key  time.Time
+		post model.BlogPost
+	}
+
+	blogs := []sortablePost{}
+	for _, blog := range s.m {
+		if !slices.Contains(statuses, blog.Status) {
+			continue
+		}
+		if query.AuthorID != "" && blog.AuthorID != query.AuthorID {
+			continue
+		}
+		if slices.Contains(query.ExcludeAuthorIDs, blog.AuthorID) {
+			continue
+		}
+
+		// unpublished posts never match a published date range
+		publishedTS, err := time.Parse(time.RFC3339, blog.PublishedTS)
+		if err != nil && (!query.PublishedAfter.IsZero() || !query.PublishedBefore.IsZero()) {
+			continue
+		}
+		if !query.PublishedAfter.IsZero() && publishedTS.Before(query.PublishedAfter) {
+			continue
+		}
+		if !query.PublishedBefore.IsZero() && !publishedTS.Before(query.PublishedBefore) {
+			continue
+		}
+
+		key, _ := time.Parse(time.RFC3339, query.sortKey(blog))
+		if cursor.after(key, blog.ID) {
+			blogs = append(blogs, sortablePost{key: key, post: blog})
+		}
+	}
+
+	sort.Slice(blogs, func(i, j int) bool {
+		if !blogs[i].key.Equal(blogs[j].key) {
+			return blogs[i].key.After(blogs[j].key)
+		}
+		return blogs[i].post.ID > blogs[j].post.ID
+	})
+
+	posts := make([]model.BlogPost, 0, min(len(blogs), query.Limit+1))
+	for _, blog := range blogs[:min(len(blogs), query.Limit+1)] {
+		posts = append(posts, blog.post)
+	}
+	return newBlogPostPage(query, posts)
+}
+
+func (s *InMemoryBlogService) CreateBlogPost(ctx context.Context, userID string, post *model.BlogPost) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// TODO: add required field validation - ie: title, description, contents
+	if err := applyBlogPostCreate(userID, post, time.Now()); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// check that blog does not already exist
+	if s.titleTaken(post.AuthorID, post.Title, post.ID) {
+		return ErrBlogPostAlreadyExists
+	}
+
+	s.m[post.ID] = *post
+	s.revisions[post.ID] = []model.BlogPostRevision{model.NewBlogPostRevision(*post, userID)}
+	s.version++
+	return nil
+}
+
+func (s *InMemoryBlogService) UpdateBlogPost(ctx context.Context, editorID string, newVersion *model.BlogPost, previousVersion *model.BlogPost) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.m[previousVersion.ID]
+	if !ok || stored.Status == model.DELETED {
+		return ErrEntityNotFound
+	}
+	if stored.Version != previousVersion.Version {
+		return ErrVersionConflict
+	}
+	if s.titleTaken(previousVersion.AuthorID, newVersion.Title, previousVersion.ID) {
+		return ErrBlogPostAlreadyExists
+	}
+
+	if err := applyBlogPostUpdate(newVersion, previousVersion, time.Now()); err != nil {
+		return err
+	}
+
+	s.m[previousVersion.ID] = *previousVersion
+	s.revisions[previousVersion.ID] = append(s.revisions[previousVersion.ID], model.NewBlogPostRevision(*previousVersion, editorID))
+	s.version++
+
+	return nil
+}
+
+func (s *InMemoryBlogService) DeleteBlogPost(ctx context.Context, editorID, id string, expectedVersion int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.m[id]
+	if !ok || stored.Status == model.DELETED {
+		return nil
+	}
+	if expectedVersion != AnyVersion && stored.Version != expectedVersion {
+		return ErrVersionConflict
+	}
+
+	applyBlogPostDelete(&stored, time.Now())
+	s.m[id] = stored
+	s.revisions[id] = append(s.revisions[id], model.NewBlogPostRevision(stored, editorID))
+	s.version++
+	return nil
+}
+
+func (s *InMemoryBlogService) FetchDeletedBlogPost(ctx context.Context, id string) (model.BlogPost, error) {
+	if err := ctx.Err(); err != nil {
+		return model.BlogPost{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if blog, ok := s.m[id]; ok && blog.Status == model.DELETED {
+		return blog, nil
+	}
+	return model.BlogPost{}, ErrEntityNotFound
+}
+
+func (s *InMemoryBlogService) FetchDeletedBlogPosts(ctx context.Context, authorID string) ([]model.BlogPost, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	blogs := []model.BlogPost{}
 	for _, blog := range s.m {
-		if blog.Status == model.PUBLISHED {
+		if blog.Status == model.DELETED && blog.AuthorID == authorID {
 			blogs = append(blogs, blog)
 		}
 	}
+
+	sort.Slice(blogs, func(i, j int) bool {
+		if blogs[i].DeletedTS != blogs[j].DeletedTS {
+			return blogs[i].DeletedTS > blogs[j].DeletedTS
+		}
+		return blogs[i].ID > blogs[j].ID
+	})
 	return blogs, nil
 }
 
-func (s *InMemoryBlogService) CreateBlogPost(ctx context.Context, userID string, post *model.BlogPost) error {
-	// TODO: add required field validation - ie: title, description, contents
+func (s *InMemoryBlogService) RestoreBlogPost(ctx context.Context, editorID string, post *model.BlogPost) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// set generated values
+	stored, ok := s.m[post.ID]
+	if !ok || stored.Status != model.DELETED {
+		return ErrEntityNotFound
+	}
+	if stored.Version != post.Version {
+		return ErrVersionConflict
+	}
+
+	applyBlogPostRestore(post, time.Now())
+	s.m[post.ID] = *post
+	s.revisions[post.ID] = append(s.revisions[post.ID], model.NewBlogPostRevision(*post, editorID))
+	s.version++
+	return nil
+}
+
+func (s *InMemoryBlogService) PurgeDeletedBlogPosts(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, blog := range s.m {
+		if blog.Status != model.DELETED {
+			continue
+		}
+
+		deletedTS, err := time.Parse(time.RFC3339, blog.DeletedTS)
+		if err != nil {
+			// the post is kept, as when it was deleted is unknown
+			s.logger().Error("skipped purging deleted post with malformed timestamp", "error", err, "postID", id, "location", "PurgeDeletedBlogPosts")
+			continue
+		}
+		if deletedTS.Before(deletedBefore) {
+			delete(s.m, id)
+			delete(s.revisions, id)
+			purged++
+		}
+	}
+
+	if purged > 0 {
+		s.version++
+	}
+	return purged, nil
+}
+
+func (s *InMemoryBlogService) FetchBlogPostRevisions(ctx context.Context, postID string) ([]model.BlogPostRevision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if blog, ok := s.m[postID]; !ok || blog.Status == model.DELETED {
+		return nil, ErrEntityNotFound
+	}
+
+	// copy so callers cannot modify history
+	revisions := make([]model.BlogPostRevision, len(s.revisions[postID]))
+	copy(revisions, s.revisions[postID])
+	return revisions, nil
+}
+
+func (s *InMemoryBlogService) FetchBlogPostRevision(ctx context.Context, postID string, revision int) (model.BlogPostRevision, error) {
+	if err := ctx.Err(); err != nil {
+		return model.BlogPostRevision{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if blog, ok := s.m[postID]; !ok || blog.Status == model.DELETED {
+		return model.BlogPostRevision{}, ErrEntityNotFound
+	}
+
+	for _, r := range s.revisions[postID] {
+		if r.Revision == revision {
+			return r, nil
+		}
+	}
+	return model.BlogPostRevision{}, ErrEntityNotFound
+}
+
+func (s *InMemoryBlogService) TransferBlogPost(ctx context.Context, editorID, id, toAuthorID string) (model.BlogPost, error) {
+	if err := ctx.Err(); err != nil {
+		return model.BlogPost{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.m[id]
+	if !ok {
+		return model.BlogPost{}, ErrEntityNotFound
+	}
+	if stored.AuthorID == toAuthorID {
+		return stored, nil
+	}
+	if s.titleTaken(toAuthorID, stored.Title, id) {
+		return model.BlogPost{}, ErrBlogPostAlreadyExists
+	}
+
+	applyBlogPostTransfer(&stored, toAuthorID, time.Now())
+	s.m[id] = stored
+	s.revisions[id] = append(s.revisions[id], model.NewBlogPostRevision(stored, editorID))
+	s.version++
+	return stored, nil
+}
+
+func (s *InMemoryBlogService) TransferAuthorBlogPosts(ctx context.Context, editorID, fromAuthorID, toAuthorID string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if fromAuthorID == toAuthorID {
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// check every post before transferring any, so that a conflict leaves them all with their author
+	transferred := []model.BlogPost{}
+	for _, blog := range s.m {
+		if blog.AuthorID != fromAuthorID {
+			continue
+		}
+		if s.titleTaken(toAuthorID, blog.Title, blog.ID) {
+			return 0, ErrBlogPostAlreadyExists
+		}
+		transferred = append(transferred, blog)
+	}
+
+	now := time.Now()
+	for _, blog := range transferred {
+		applyBlogPostTransfer(&blog, toAuthorID, now)
+		s.m[blog.ID] = blog
+		s.revisions[blog.ID] = append(s.revisions[blog.ID], model.NewBlogPostRevision(blog, editorID))
+	}
+	if len(transferred) > 0 {
+		s.version++
+	}
+	return len(transferred), nil
+}
+
+func (s *InMemoryBlogService) ApplyBulkAction(ctx context.Context, editorID string, action BulkAction, ids []string, tags []string) ([]BulkActionResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tags, err := checkBulkAction(action, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// changes are staged until every post has succeeded, so that a failure changes nothing
+	now := time.Now()
+	staged := map[string]model.BlogPost{}
+	results := make([]BulkActionResult, len(ids))
+	failed := false
+	for i, id := range ids {
+		results[i].PostID = id
+
+		blog, ok := staged[id]
+		if !ok {
+			blog, ok = s.m[id]
+		}
+		var post *model.BlogPost
+		if ok {
+			post = &blog
+		}
+
+		results[i].Changed, results[i].Err = applyBulkAction(action, tags, post, now)
+		if results[i].Err != nil {
+			failed = true
+		} else if results[i].Changed {
+			staged[id] = blog
+		}
+	}
+	if failed {
+		return results, ErrBulkActionFailed
+	}
+
+	for _, result := range results {
+		if result.Changed {
+			s.m[result.PostID] = staged[result.PostID]
+			s.revisions[result.PostID] = append(s.revisions[result.PostID], model.NewBlogPostRevision(staged[result.PostID], editorID))
+		}
+	}
+	if len(staged) > 0 {
+		s.version++
+	}
+	return results, nil
+}
+
+// titleTaken reports whether the author has a post other than excludeID with the given title, including
+// posts in the trash - callers must hold the lock
+func (s *InMemoryBlogService) titleTaken(authorID, title, excludeID string) bool {
+	for _, p := range s.m {
+		if p.ID != excludeID && p.AuthorID == authorID && p.Title == title {
+			return true
+		}
+	}
+	return false
+}
+
+// applyBlogPostCreate sets the generated fields of a new post so all BlogService implementations
+// share the same creation rules
+func applyBlogPostCreate(userID string, post *model.BlogPost, now time.Time) error {
+	if post.Status == model.DELETED {
+		return ErrInvalidStatus
+	}
+	tags, err := normalizeTags(post.Tags)
+	if err != nil {
+		return err
+	}
+	post.Tags = tags
+
+	ts := now.Format(time.RFC3339)
 	post.ID = assignUUID()
 	post.AuthorID = userID
-	ts := time.Now().Format(time.RFC3339)
 	post.CreatedTS = ts
 	post.UpdatedTS = ts
+	post.Version = 1
 
-	// check that blog does not already exist
-	for _, p := range s.m {
-		if p.AuthorID == post.AuthorID && p.Title == post.Title {
-			return ErrBlogPostAlreadyExists
-		}
+	// posts created as published are published immediately
+	post.PublishedTS = ""
+	if post.Status == model.PUBLISHED {
+		post.PublishedTS = ts
 	}
+	post.DeletedTS = ""
 
-	s.m[post.ID] = *post
 	return nil
 }
 
-func (s *InMemoryBlogService) UpdateBlogPost(ctx context.Context, newVersion *model.BlogPost, previousVersion *model.BlogPost) error {
+// applyBlogPostUpdate copies the user editable fields of newVersion onto previousVersion so all
+// BlogService implementations share the same update rules
+func applyBlogPostUpdate(newVersion *model.BlogPost, previousVersion *model.BlogPost, now time.Time) error {
 	// TODO: improve required field validations
 	if newVersion.Title == "" {
 		return errors.New("title cannot be empty")
 	}
+	if newVersion.Status == model.DELETED {
+		return ErrInvalidStatus
+	}
+	tags, err := normalizeTags(newVersion.Tags)
+	if err != nil {
+		return err
+	}
 
-	ts := time.Now().Format(time.RFC3339)
+	ts := now.Format(time.RFC3339)
 	previousVersion.UpdatedTS = ts
+	previousVersion.Version++
+
+	// automatically add publication date
+	if newVersion.Status != previousVersion.Status && newVersion.Status == model.PUBLISHED {
+		previousVersion.PublishedTS = ts
+	}
 
 	// only allow certain fields to be updated
 	previousVersion.Title = newVersion.Title
 	previousVersion.Summary = newVersion.Summary
 	previousVersion.Contents = newVersion.Contents
+	previousVersion.Tags = tags
 	previousVersion.Status = newVersion.Status
 
-	// automatically add publication date
-	if newVersion.Status != previousVersion.Status && newVersion.Status == model.PUBLISHED {
-		previousVersion.PublishedTS = ts
+	return nil
+}
+
+// applyBlogPostDelete moves post to the trash
+func applyBlogPostDelete(post *model.BlogPost, now time.Time) {
+	ts := now.Format(time.RFC3339)
+	post.Status = model.DELETED
+	post.DeletedTS = ts
+	post.UpdatedTS = ts
+	post.Version++
+}
+
+// applyBlogPostRestore takes post out of the trash - restored posts come back as drafts so they are
+// never republished by accident
+func applyBlogPostRestore(post *model.BlogPost, now time.Time) {
+	post.Status = model.DRAFT
+	post.DeletedTS = ""
+	post.UpdatedTS = now.Format(time.RFC3339)
+	post.Version++
+}
+
+// applyBlogPostUnpublish moves post back to a draft, keeping the time it was first published
+func applyBlogPostUnpublish(post *model.BlogPost, now time.Time) {
+	post.Status = model.DRAFT
+	post.UpdatedTS = now.Format(time.RFC3339)
+	post.Version++
+}
+
+// applyBlogPostRetag replaces the tags of post with tags, which must already be normalized
+func applyBlogPostRetag(post *model.BlogPost, tags []string, now time.Time) {
+	post.Tags = tags
+	post.UpdatedTS = now.Format(time.RFC3339)
+	post.Version++
+}
+
+// applyBlogPostTransfer makes toAuthorID the author of post
+func applyBlogPostTransfer(post *model.BlogPost, toAuthorID string, now time.Time) {
+	post.AuthorID = toAuthorID
+	post.UpdatedTS = now.Format(time.RFC3339)
+	post.Version++
+}
+
+// applyBulkAction applies action to post, which is nil if there is no such post, reporting whether it changed
+// so all BlogService implementations share the same bulk action rules. Posts already in the state the action
+// moves them to are left as they are.
+func applyBulkAction(action BulkAction, tags []string, post *model.BlogPost, now time.Time) (bool, error) {
+	if post == nil {
+		return false, ErrEntityNotFound
 	}
 
-	s.m[previousVersion.ID] = *previousVersion
+	switch action {
+	case BulkUnpublish:
+		// posts in the trash are not found, as for every other action on live posts
+		if post.Status == model.DELETED {
+			return false, ErrEntityNotFound
+		}
+		if post.Status != model.PUBLISHED {
+			return false, nil
+		}
+		applyBlogPostUnpublish(post, now)
+	case BulkDelete:
+		if post.Status == model.DELETED {
+			return false, nil
+		}
+		applyBlogPostDelete(post, now)
+	case BulkRestore:
+		if post.Status != model.DELETED {
+			return false, nil
+		}
+		applyBlogPostRestore(post, now)
+	case BulkRetag:
+		if post.Status == model.DELETED {
+			return false, ErrEntityNotFound
+		}
+		if slices.Equal(post.Tags, tags) {
+			return false, nil
+		}
+		applyBlogPostRetag(post, tags, now)
+	default:
+		return false, fmt.Errorf("%w: unknown action %q", ErrInvalidBulkAction, action)
+	}
+	return true, nil
+}
 
-	return nil
+// checkBulkAction validates action before it is applied, returning tags normalized if it is BulkRetag
+func checkBulkAction(action BulkAction, tags []string) ([]string, error) {
+	if !slices.Contains(BulkActions, action) {
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidBulkAction, action)
+	}
+	if action != BulkRetag {
+		return nil, nil
+	}
+	return normalizeTags(tags)
 }
 
-func (s *InMemoryBlogService) DeleteBlogPost(ctx context.Context, id string) error {
-	delete(s.m, id)
-	return nil
+// normalizeTags lowercases and trims tags, removing duplicates and sorting them so all BlogService
+// implementations store tags the same way. Tags can only contain letters, digits and hyphens.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength {
+			return nil, fmt.Errorf("%w: tags must be between 1 and %d characters", ErrInvalidTags, MaxTagLength)
+		}
+		for _, r := range tag {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' {
+				return nil, fmt.Errorf("%w: tag %q can only contain letters, digits and hyphens", ErrInvalidTags, tag)
+			}
+		}
+		normalized = append(normalized, tag)
+	}
+
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	if len(normalized) > MaxPostTags {
+		return nil, fmt.Errorf("%w: posts can have at most %d tags", ErrInvalidTags, MaxPostTags)
+	}
+	return normalized, nil
 }
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+	"github.com/google/uuid"
+)
+
+// page sizes for BlogPostQuery.Limit
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var (
+	// ErrInvalidCursor is returned when a cursor was not issued by this package or was issued for a different sort
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidQuery is returned when a query's fields cannot be satisfied, ie: an unknown sort
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// BlogPostSort is the order posts are listed in - every sort is newest first, with ties broken by ID
+type BlogPostSort string
+
+const (
+	SortPublished BlogPostSort = "published"
+	SortUpdated   BlogPostSort = "updated"
+)
+
+// BlogPostQuery filters and pages through a list of posts. The zero value returns the first page of
+// every matching post, most recently published first.
+type BlogPostQuery struct {
+	// Limit is the maximum number of posts per page - zero uses DefaultPageSize and it is capped at MaxPageSize
+	Limit int
+	// Cursor is the NextCursor of the previous page, or empty for the first page
+	Cursor   string
+	AuthorID string
+	// ExcludeAuthorIDs leaves out the posts of these authors, ie: suspended users whose posts are hidden
+	ExcludeAuthorIDs []string
+	// PublishedAfter and PublishedBefore bound the published timestamp, inclusive and exclusive respectively
+	PublishedAfter  time.Time
+	PublishedBefore time.Time
+	Sort            BlogPostSort
+}
+
+// BlogPostPage is a single page of a BlogPostQuery
+type BlogPostPage struct {
+	Posts []model.BlogPost
+	// NextCursor fetches the following page, and is empty on the last page
+	NextCursor string
+}
+
+// normalize validates q and fills in defaults, returning the decoded cursor if there is one
+func (q *BlogPostQuery) normalize(defaultSort BlogPostSort) (*blogPostCursor, error) {
+	switch q.Sort {
+	case "":
+		q.Sort = defaultSort
+	case SortPublished, SortUpdated:
+	default:
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidQuery, q.Sort)
+	}
+
+	// the ID is passed on to the database so it has to be well formed
+	if q.AuthorID != "" {
+		if _, err := uuid.Parse(q.AuthorID); err != nil {
+			return nil, fmt.Errorf("%w: author %q is not a user ID", ErrInvalidQuery, q.AuthorID)
+		}
+	}
+
+	switch {
+	case q.Limit < 0:
+		return nil, fmt.Errorf("%w: negative limit", ErrInvalidQuery)
+	case q.Limit == 0:
+		q.Limit = DefaultPageSize
+	case q.Limit > MaxPageSize:
+		q.Limit = MaxPageSize
+	}
+
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	return decodeCursor(q.Cursor, q.Sort)
+}
+
+// forAuthor restricts q to a single author's posts, returning the statuses to list and the default sort.
+// Drafts have not been published so listings that include them cannot be sorted by publish date.
+func (q *BlogPostQuery) forAuthor(authorID string, includeDrafts bool) ([]model.BlogPostStatus, BlogPostSort, error) {
+	q.AuthorID = authorID
+	if !includeDrafts {
+		return []model.BlogPostStatus{model.PUBLISHED}, SortPublished, nil
+	}
+
+	if q.Sort == SortPublished {
+		return nil, "", fmt.Errorf("%w: listings including drafts cannot be sorted by %q", ErrInvalidQuery, SortPublished)
+	}
+	return []model.BlogPostStatus{model.PUBLISHED, model.DRAFT}, SortUpdated, nil
+}
+
+// sortKey returns the timestamp post is ordered by
+func (q *BlogPostQuery) sortKey(post model.BlogPost) string {
+	if q.Sort == SortUpdated {
+		return post.UpdatedTS
+	}
+	return post.PublishedTS
+}
+
+// blogPostCursor identifies the last post of a page. IDs are UUIDv7 so they are ordered by creation time,
+// which keeps pages stable when several posts share a timestamp.
+type blogPostCursor struct {
+	Sort BlogPostSort `json:"s"`
+	TS   time.Time    `json:"t"`
+	ID   string       `json:"i"`
+}
+
+func encodeCursor(sort BlogPostSort, ts string, id string) (string, error) {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return "", fmt.Errorf("invalid timestamp %q: %w", ts, err)
+	}
+
+	b, err := json.Marshal(blogPostCursor{Sort: sort, TS: t.UTC(), ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(cursor string, sort BlogPostSort) (*blogPostCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c blogPostCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+	// the ID is passed on to the database so it has to be well formed
+	if _, err := uuid.Parse(c.ID); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c.TS = c.TS.UTC()
+	return &c, nil
+}
+
+// after reports whether a post with the given sort key and ID comes after the cursor
+func (c *blogPostCursor) after(ts time.Time, id string) bool {
+	if c == nil {
+		return true
+	}
+	return ts.Before(c.TS) || (ts.Equal(c.TS) && id < c.ID)
+}
+
+// newBlogPostPage builds a page from up to query.Limit+1 sorted posts, where the extra post signals
+// that there is another page to fetch
+func newBlogPostPage(query BlogPostQuery, posts []model.BlogPost) (BlogPostPage, error) {
+	if len(posts) <= query.Limit {
+		return BlogPostPage{Posts: posts}, nil
+	}
+
+	posts = posts[:query.Limit]
+	last := posts[len(posts)-1]
+	cursor, err := encodeCursor(query.Sort, query.sortKey(last), last.ID)
+	if err != nil {
+		return BlogPostPage{}, err
+	}
+	return BlogPostPage{Posts: posts, NextCursor: cursor}, nil
+}
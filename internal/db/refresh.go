@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or revoked
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token that has already been rotated is presented again.
+	// Only one of the two parties holding it can be the legitimate client, so its whole family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// RefreshToken is a long-lived credential that is exchanged for access tokens. Only a hash of the token
+// is stored. Each rotation replaces the token with a new one in the same family, so a family traces back
+// to a single login.
+type RefreshToken struct {
+	Hash      string
+	FamilyID  string
+	UserID    string
+	CreatedTS time.Time
+	ExpiresTS time.Time
+	// UsedTS is set once the token has been rotated
+	UsedTS    time.Time
+	RevokedTS time.Time
+}
+
+// check reports why the token cannot be rotated at now, if it cannot be
+func (t *RefreshToken) check(now time.Time) error {
+	switch {
+	case !t.RevokedTS.IsZero():
+		return ErrInvalidRefreshToken
+	case !t.UsedTS.IsZero():
+		return ErrRefreshTokenReused
+	case !now.Before(t.ExpiresTS):
+		return ErrInvalidRefreshToken
+	}
+	return nil
+}
+
+// Usable reports whether the token can still be rotated at now
+func (t *RefreshToken) Usable(now time.Time) bool {
+	return t.check(now) == nil
+}
+
+// NewRefreshToken generates a refresh token for userID that is valid for ttl, in a family of its own. It
+// returns the token to hand to the client along with the representation to store.
+func NewRefreshToken(userID string, ttl time.Duration) (string, RefreshToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", RefreshToken{}, fmt.Errorf("error generating refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	// timestamps are stored to the second
+	now := time.Now().UTC().Truncate(time.Second)
+	return token, RefreshToken{
+		Hash:      HashRefreshToken(token),
+		FamilyID:  assignUUID(),
+		UserID:    userID,
+		CreatedTS: now,
+		ExpiresTS: now.Add(ttl),
+	}, nil
+}
+
+// HashRefreshToken returns the stored form of a refresh token. Tokens are random, so unlike passwords they
+// do not need a slow, salted hash.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RefreshTokenService stores the refresh tokens issued to users
+type RefreshTokenService interface {
+	// CreateRefreshToken stores a token issued on login
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	// FetchRefreshToken returns the token with the given hash, whether or not it can still be used. It fails
+	// with ErrInvalidRefreshToken if there is no such token.
+	FetchRefreshToken(ctx context.Context, hash string) (RefreshToken, error)
+	// RotateRefreshToken marks the token with the given hash as used and stores next in its place, moving next
+	// into the same family and assigning it the same user. It fails with ErrInvalidRefreshToken if the token
+	// cannot be used, or ErrRefreshTokenReused if it has already been rotated.
+	RotateRefreshToken(ctx context.Context, hash string, next *RefreshToken) error
+	// RevokeRefreshTokenFamily revokes every token descended from the same login
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	// RevokeUserRefreshTokens revokes every refresh token issued to the user
+	RevokeUserRefreshTokens(ctx context.Context, userID string) error
+}
+
+// InMemoryRefreshTokenService implements RefreshTokenService for the in-memory data store
+type InMemoryRefreshTokenService struct {
+	mu sync.Mutex
+	// tokens maps token hash to token
+	tokens map[string]*RefreshToken
+}
+
+func NewInMemoryRefreshTokenService() *InMemoryRefreshTokenService {
+	return &InMemoryRefreshTokenService{tokens: map[string]*RefreshToken{}}
+}
+
+func (s *InMemoryRefreshTokenService) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := *token
+	s.tokens[token.Hash] = &t
+	return nil
+}
+
+func (s *InMemoryRefreshTokenService) FetchRefreshToken(ctx context.Context, hash string) (RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return RefreshToken{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return RefreshToken{}, ErrInvalidRefreshToken
+	}
+	return *token, nil
+}
+
+func (s *InMemoryRefreshTokenService) RotateRefreshToken(ctx context.Context, hash string, next *RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return ErrInvalidRefreshToken
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := token.check(now); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			s.revokeFamily(token.FamilyID, now)
+		}
+		return err
+	}
+
+	token.UsedTS = now
+	next.FamilyID = token.FamilyID
+	next.UserID = token.UserID
+	t := *next
+	s.tokens[next.Hash] = &t
+	return nil
+}
+
+func (s *InMemoryRefreshTokenService) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeFamily(familyID, time.Now().UTC().Truncate(time.Second))
+	return nil
+}
+
+func (s *InMemoryRefreshTokenService) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, token := range s.tokens {
+		if token.UserID == userID && token.RevokedTS.IsZero() {
+			token.RevokedTS = now
+		}
+	}
+	return nil
+}
+
+// revokeFamily must be called with s.mu held
+func (s *InMemoryRefreshTokenService) revokeFamily(familyID string, now time.Time) {
+	for _, token := range s.tokens {
+		if token.FamilyID == familyID && token.RevokedTS.IsZero() {
+			token.RevokedTS = now
+		}
+	}
+}
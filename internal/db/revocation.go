@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenRevocationService records access tokens that must no longer be accepted, even though they have not expired
+type TokenRevocationService interface {
+	// RevokeToken revokes the access token with the given ID, which only has to be remembered until it expires
+	RevokeToken(ctx context.Context, tokenID string, expiresTS time.Time) error
+	// RevokeUserTokens revokes every access token issued to the user at or before revokedTS
+	RevokeUserTokens(ctx context.Context, userID string, revokedTS time.Time) error
+	// IsTokenRevoked reports whether the access token with the given ID, issued to userID at issuedTS, has been revoked
+	IsTokenRevoked(ctx context.Context, tokenID, userID string, issuedTS time.Time) (bool, error)
+}
+
+// InMemoryTokenRevocationService implements TokenRevocationService for the in-memory data store
+type InMemoryTokenRevocationService struct {
+	mu sync.RWMutex
+	// tokens maps token ID to when the token expires
+	tokens map[string]time.Time
+	// users maps user ID to when their tokens were last revoked
+	users map[string]time.Time
+}
+
+func NewInMemoryTokenRevocationService() *InMemoryTokenRevocationService {
+	return &InMemoryTokenRevocationService{
+		tokens: map[string]time.Time{},
+		users:  map[string]time.Time{},
+	}
+}
+
+func (s *InMemoryTokenRevocationService) RevokeToken(ctx context.Context, tokenID string, expiresTS time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// expired tokens are rejected anyway, so stop remembering them
+	now := time.Now()
+	for id, expires := range s.tokens {
+		if expires.Before(now) {
+			delete(s.tokens, id)
+		}
+	}
+
+	s.tokens[tokenID] = expiresTS
+	return nil
+}
+
+func (s *InMemoryTokenRevocationService) RevokeUserTokens(ctx context.Context, userID string, revokedTS time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if revokedTS.After(s.users[userID]) {
+		s.users[userID] = revokedTS
+	}
+	return nil
+}
+
+func (s *InMemoryTokenRevocationService) IsTokenRevoked(ctx context.Context, tokenID, userID string, issuedTS time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tokens[tokenID]; ok {
+		return true, nil
+	}
+	revokedTS, ok := s.users[userID]
+	return ok && !issuedTS.After(revokedTS), nil
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// blogSnapshot is the on disk representation of an InMemoryBlogService
+type blogSnapshot struct {
+	Posts     []model.BlogPost         `json:"posts"`
+	Revisions []model.BlogPostRevision `json:"revisions"`
+}
+
+// LoadInMemoryBlogService returns an InMemoryBlogService populated from the snapshot at path,
+// or an empty one if no snapshot has been written yet
+func LoadInMemoryBlogService(path string) (*InMemoryBlogService, error) {
+	s := NewInMemoryBlogService()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("error reading snapshot: %w", err)
+	}
+
+	var snapshot blogSnapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return nil, fmt.Errorf("error parsing snapshot %s: %w", path, err)
+	}
+
+	for _, post := range snapshot.Posts {
+		// snapshots written before posts were versioned
+		if post.Version == AnyVersion {
+			post.Version = 1
+		}
+		// snapshots written before posts were tagged
+		if post.Tags == nil {
+			post.Tags = []string{}
+		}
+		s.m[post.ID] = post
+	}
+
+	for _, revision := range snapshot.Revisions {
+		if revision.Tags == nil {
+			revision.Tags = []string{}
+		}
+		s.revisions[revision.PostID] = append(s.revisions[revision.PostID], revision)
+	}
+	for id, post := range s.m {
+		// snapshots written before revisions were tracked start their history at the current version
+		if len(s.revisions[id]) == 0 {
+			s.revisions[id] = []model.BlogPostRevision{model.NewBlogPostRevision(post, post.AuthorID)}
+		}
+		sort.Slice(s.revisions[id], func(i, j int) bool {
+			return s.revisions[id][i].Revision < s.revisions[id][j].Revision
+		})
+	}
+	return s, nil
+}
+
+// Snapshot writes every post to path as JSON, replacing the file atomically so a crash mid-write
+// never leaves a corrupt snapshot behind
+func (s *InMemoryBlogService) Snapshot(path string) error {
+	s.mu.RLock()
+	snapshot := blogSnapshot{Posts: make([]model.BlogPost, 0, len(s.m))}
+	for _, post := range s.m {
+		snapshot.Posts = append(snapshot.Posts, post)
+		snapshot.Revisions = append(snapshot.Revisions, s.revisions[post.ID]...)
+	}
+	s.mu.RUnlock()
+
+	// keep the output stable so snapshots are easy to diff
+	sort.Slice(snapshot.Posts, func(i, j int) bool {
+		return snapshot.Posts[i].ID < snapshot.Posts[j].ID
+	})
+	sort.Slice(snapshot.Revisions, func(i, j int) bool {
+		a, b := snapshot.Revisions[i], snapshot.Revisions[j]
+		if a.PostID != b.PostID {
+			return a.PostID < b.PostID
+		}
+		return a.Revision < b.Revision
+	})
+
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+	// the contents have to reach the disk before the rename does, or a crash can leave an empty snapshot behind
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing snapshot: %w", err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("error replacing snapshot: %w", err)
+	}
+	return nil
+}
+
+// syncDir flushes the entries of dir to disk, so that a file renamed into it survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// RunSnapshots writes a snapshot to path every interval if posts have changed, and once more when
+// ctx is cancelled, blocking until then
+func (s *InMemoryBlogService) RunSnapshots(ctx context.Context, path string, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var written uint64
+	snapshot := func() {
+		s.mu.RLock()
+		version := s.version
+		s.mu.RUnlock()
+
+		if version == written {
+			return
+		}
+
+		if err := s.Snapshot(path); err != nil {
+			logger.Error("failed to snapshot posts", "error", err, "location", "RunSnapshots")
+			return
+		}
+		written = version
+		logger.Debug("snapshotted posts", "path", path)
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			snapshot()
+		case <-ctx.Done():
+			snapshot()
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	ctx := context.Background()
+
+	// no snapshot yet
+	s, err := LoadInMemoryBlogService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := []*model.BlogPost{
+		{Title: "draft", Status: model.DRAFT},
+		{Title: "published", Status: model.PUBLISHED},
+	}
+	for _, post := range posts {
+		if err := s.CreateBlogPost(ctx, "0197aaed-4a35-74da-8574-4165524a1111", post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Snapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadInMemoryBlogService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range posts {
+		stored, err := reloaded.FetchBlogPost(ctx, post.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(stored, *post) {
+			t.Errorf("got %+v, want %+v", stored, *post)
+		}
+	}
+
+	// reloaded stores keep enforcing the same rules
+	err = reloaded.CreateBlogPost(ctx, "0197aaed-4a35-74da-8574-4165524a1111", &model.BlogPost{Title: "draft"})
+	if err != ErrBlogPostAlreadyExists {
+		t.Errorf("got %v, want %v", err, ErrBlogPostAlreadyExists)
+	}
+}
+
+func TestLoadCorruptSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadInMemoryBlogService(path); err == nil {
+		t.Error("expected an error loading a corrupt snapshot")
+	}
+}
+
+func TestRunSnapshots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewInMemoryBlogService()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.RunSnapshots(ctx, path, time.Hour, logger)
+		close(done)
+	}()
+
+	post := &model.BlogPost{Title: "title"}
+	if err := s.CreateBlogPost(context.Background(), "0197aaed-4a35-74da-8574-4165524a1111", post); err != nil {
+		t.Fatal(err)
+	}
+
+	// cancelling flushes pending changes even before the interval elapses
+	cancel()
+	<-done
+
+	reloaded, err := LoadInMemoryBlogService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.FetchBlogPost(context.Background(), post.ID); err != nil {
+		t.Errorf("got %v, want post to be snapshotted on shutdown", err)
+	}
+}
@@ -0,0 +1,695 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+	"github.com/James-D-Wood/blog-api/internal/model"
+	"github.com/google/uuid"
+)
+
+// supported values for config.DBConfig.Driver
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Open connects to the database selected by cfg.Driver
+func Open(ctx context.Context, cfg config.DBConfig) (*sql.DB, error) {
+	switch cfg.Driver {
+	case DriverPostgres:
+		return OpenPostgres(ctx, cfg)
+	case DriverSQLite:
+		return OpenSQLite(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+}
+
+// sqlDialect captures the differences between the database/sql drivers we support
+type sqlDialect struct {
+	// isUniqueViolation reports whether err was caused by a unique constraint
+	isUniqueViolation func(err error) bool
+	// isInvalidID reports whether err was caused by an ID the database could not parse
+	isInvalidID func(err error) bool
+}
+
+// sqlBlogService implements BlogService against the posts table for any supported SQL database
+type sqlBlogService struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+const selectBlogPostColumns = `SELECT id, status, title, summary, content, tags, author_id, created_ts, published_ts, updated_ts, version, deleted_ts FROM posts`
+
+func (s *sqlBlogService) FetchBlogPost(ctx context.Context, id string) (model.BlogPost, error) {
+	row := s.db.QueryRowContext(ctx, selectBlogPostColumns+` WHERE id = $1 AND status <> $2`, id, model.DELETED)
+	post, err := scanBlogPost(row)
+	if err != nil {
+		return model.BlogPost{}, s.mapError(err)
+	}
+	return post, nil
+}
+
+func (s *sqlBlogService) FetchPublishedBlogPosts(ctx context.Context, query BlogPostQuery) (BlogPostPage, error) {
+	return s.fetchBlogPosts(ctx, query, SortPublished, []model.BlogPostStatus{model.PUBLISHED})
+}
+
+func (s *sqlBlogService) FetchAuthorBlogPosts(ctx context.Context, authorID string, includeDrafts bool, query BlogPostQuery) (BlogPostPage, error) {
+	statuses, defaultSort, err := query.forAuthor(authorID, includeDrafts)
+	if err != nil {
+		return BlogPostPage{}, err
+	}
+	return s.fetchBlogPosts(ctx, query, defaultSort, statuses)
+}
+
+// fetchBlogPosts returns a page of the posts with one of the given statuses matching query
+func (s *sqlBlogService) fetchBlogPosts(ctx context.Context, query BlogPostQuery, defaultSort BlogPostSort, statuses []model.BlogPostStatus) (BlogPostPage, error) {
+	cursor, err := query.normalize(defaultSort)
+	if err != nil {
+		return BlogPostPage{}, err
+	}
+
+	sortColumn := "published_ts"
+	if query.Sort == SortUpdated {
+		sortColumn = "updated_ts"
+	}
+
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	placeholders := make([]string, len(statuses))
+	for i, status := range statuses {
+		placeholders[i] = arg(status)
+	}
+
+	where := []string{"status IN (" + strings.Join(placeholders, ", ") + ")"}
+	if query.AuthorID != "" {
+		where = append(where, "author_id = "+arg(query.AuthorID))
+	}
+	if len(query.ExcludeAuthorIDs) > 0 {
+		excluded := make([]string, len(query.ExcludeAuthorIDs))
+		for i, id := range query.ExcludeAuthorIDs {
+			excluded[i] = arg(id)
+		}
+		where = append(where, "author_id NOT IN ("+strings.Join(excluded, ", ")+")")
+	}
+	if !query.PublishedAfter.IsZero() {
+		where = append(where, "published_ts >= "+arg(query.PublishedAfter.UTC()))
+	}
+	if !query.PublishedBefore.IsZero() {
+		where = append(where, "published_ts < "+arg(query.PublishedBefore.UTC()))
+	}
+	if cursor != nil {
+		ts, id := arg(cursor.TS), arg(cursor.ID)
+		where = append(where, fmt.Sprintf("(%[1]s < %[2]s OR (%[1]s = %[2]s AND id < %[3]s))", sortColumn, ts, id))
+	}
+
+	// fetch one extra row to find out whether there is another page
+	rows, err := s.db.QueryContext(ctx,
+		selectBlogPostColumns+` WHERE `+strings.Join(where, " AND ")+
+			fmt.Sprintf(` ORDER BY %s DESC, id DESC LIMIT %s`, sortColumn, arg(query.Limit+1)),
+		args...,
+	)
+	if err != nil {
+		return BlogPostPage{}, s.mapError(err)
+	}
+	defer rows.Close()
+
+	blogs := []model.BlogPost{}
+	for rows.Next() {
+		post, err := scanBlogPost(rows)
+		if err != nil {
+			return BlogPostPage{}, err
+		}
+		blogs = append(blogs, post)
+	}
+	if err := rows.Err(); err != nil {
+		return BlogPostPage{}, s.mapError(err)
+	}
+	return newBlogPostPage(query, blogs)
+}
+
+func (s *sqlBlogService) CreateBlogPost(ctx context.Context, userID string, post *model.BlogPost) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := applyBlogPostCreate(userID, post, now); err != nil {
+		return err
+	}
+
+	publishedTS, err := parseNullTime(post.PublishedTS)
+	if err != nil {
+		return err
+	}
+	tags, err := encodeTags(post.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// duplicate titles per author are rejected by a unique constraint on the table
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO posts (id, status, title, summary, content, tags, author_id, created_ts, published_ts, updated_ts, version)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			post.ID, post.Status, post.Title, post.Summary, post.Contents, tags, post.AuthorID, now, publishedTS, now, post.Version,
+		)
+		if err != nil {
+			return err
+		}
+		return insertRevision(ctx, tx, model.NewBlogPostRevision(*post, userID), now)
+	})
+	if err != nil {
+		return s.mapError(err)
+	}
+	return nil
+}
+
+func (s *sqlBlogService) UpdateBlogPost(ctx context.Context, editorID string, newVersion *model.BlogPost, previousVersion *model.BlogPost) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	expectedVersion := previousVersion.Version
+	if err := applyBlogPostUpdate(newVersion, previousVersion, now); err != nil {
+		return err
+	}
+
+	publishedTS, err := parseNullTime(previousVersion.PublishedTS)
+	if err != nil {
+		return err
+	}
+	tags, err := encodeTags(previousVersion.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE posts SET status = $2, title = $3, summary = $4, content = $5, tags = $6, published_ts = $7, updated_ts = $8, version = $9
+			WHERE id = $1 AND version = $10 AND status <> $11`,
+			previousVersion.ID, previousVersion.Status, previousVersion.Title, previousVersion.Summary, previousVersion.Contents, tags, publishedTS, now,
+			previousVersion.Version, expectedVersion, model.DELETED,
+		)
+		if err != nil {
+			return err
+		}
+		if err := s.checkVersionedWrite(ctx, tx, res, previousVersion.ID, false); err != nil {
+			return err
+		}
+		return insertRevision(ctx, tx, model.NewBlogPostRevision(*previousVersion, editorID), now)
+	})
+	if err != nil {
+		return s.mapError(err)
+	}
+	return nil
+}
+
+func (s *sqlBlogService) DeleteBlogPost(ctx context.Context, editorID, id string, expectedVersion int) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, selectBlogPostColumns+` WHERE id = $1 AND status <> $2`, id, model.DELETED)
+		post, err := scanBlogPost(row)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != AnyVersion && post.Version != expectedVersion {
+			return ErrVersionConflict
+		}
+
+		storedVersion := post.Version
+		applyBlogPostDelete(&post, now)
+		res, err := tx.ExecContext(ctx,
+			`UPDATE posts SET status = $2, deleted_ts = $3, updated_ts = $3, version = $4 WHERE id = $1 AND version = $5`,
+			id, post.Status, now, post.Version, storedVersion,
+		)
+		if err != nil {
+			return err
+		}
+		if err := s.checkVersionedWrite(ctx, tx, res, id, false); err != nil {
+			return err
+		}
+		return insertRevision(ctx, tx, model.NewBlogPostRevision(post, editorID), now)
+	})
+
+	err = s.mapError(err)
+	// deleting something that does not exist or is already in the trash is a no-op, matching the in-memory store
+	if errors.Is(err, ErrEntityNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *sqlBlogService) FetchDeletedBlogPost(ctx context.Context, id string) (model.BlogPost, error) {
+	row := s.db.QueryRowContext(ctx, selectBlogPostColumns+` WHERE id = $1 AND status = $2`, id, model.DELETED)
+	post, err := scanBlogPost(row)
+	if err != nil {
+		return model.BlogPost{}, s.mapError(err)
+	}
+	return post, nil
+}
+
+func (s *sqlBlogService) FetchDeletedBlogPosts(ctx context.Context, authorID string) ([]model.BlogPost, error) {
+	rows, err := s.db.QueryContext(ctx,
+		selectBlogPostColumns+` WHERE author_id = $1 AND status = $2 ORDER BY deleted_ts DESC, id DESC`,
+		authorID, model.DELETED,
+	)
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	defer rows.Close()
+
+	blogs := []model.BlogPost{}
+	for rows.Next() {
+		post, err := scanBlogPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		blogs = append(blogs, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, s.mapError(err)
+	}
+	return blogs, nil
+}
+
+func (s *sqlBlogService) RestoreBlogPost(ctx context.Context, editorID string, post *model.BlogPost) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	expectedVersion := post.Version
+	applyBlogPostRestore(post, now)
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE posts SET status = $2, deleted_ts = NULL, updated_ts = $3, version = $4
+			WHERE id = $1 AND version = $5 AND status = $6`,
+			post.ID, post.Status, now, post.Version, expectedVersion, model.DELETED,
+		)
+		if err != nil {
+			return err
+		}
+		if err := s.checkVersionedWrite(ctx, tx, res, post.ID, true); err != nil {
+			return err
+		}
+		return insertRevision(ctx, tx, model.NewBlogPostRevision(*post, editorID), now)
+	})
+	if err != nil {
+		return s.mapError(err)
+	}
+	return nil
+}
+
+func (s *sqlBlogService) PurgeDeletedBlogPosts(ctx context.Context, deletedBefore time.Time) (int, error) {
+	// revisions are removed by the foreign key cascade
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM posts WHERE status = $1 AND deleted_ts < $2`, model.DELETED, deletedBefore.UTC(),
+	)
+	if err != nil {
+		return 0, s.mapError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func (s *sqlBlogService) TransferBlogPost(ctx context.Context, editorID, id, toAuthorID string) (model.BlogPost, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var post model.BlogPost
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		var err error
+		if post, err = s.fetchAnyBlogPost(ctx, tx, id); err != nil {
+			return err
+		}
+		return s.transferBlogPost(ctx, tx, &post, editorID, toAuthorID, now)
+	})
+	if err != nil {
+		return model.BlogPost{}, s.mapError(err)
+	}
+	return post, nil
+}
+
+func (s *sqlBlogService) TransferAuthorBlogPosts(ctx context.Context, editorID, fromAuthorID, toAuthorID string) (int, error) {
+	if fromAuthorID == toAuthorID {
+		return 0, nil
+	}
+	// a malformed ID cannot be the author of anything
+	if _, err := uuid.Parse(fromAuthorID); err != nil {
+		return 0, nil
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var transferred int
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, selectBlogPostColumns+` WHERE author_id = $1`, fromAuthorID)
+		if err != nil {
+			return err
+		}
+		posts := []model.BlogPost{}
+		for rows.Next() {
+			post, err := scanBlogPost(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			posts = append(posts, post)
+		}
+		// the rows have to be closed before the transaction can be written to
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// a title the new author already uses fails the unique constraint, rolling back every transfer
+		for i := range posts {
+			if err := s.transferBlogPost(ctx, tx, &posts[i], editorID, toAuthorID, now); err != nil {
+				return err
+			}
+		}
+		transferred = len(posts)
+		return nil
+	})
+	if err != nil {
+		return 0, s.mapError(err)
+	}
+	return transferred, nil
+}
+
+func (s *sqlBlogService) ApplyBulkAction(ctx context.Context, editorID string, action BulkAction, ids []string, tags []string) ([]BulkActionResult, error) {
+	tags, err := checkBulkAction(action, tags)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	results := make([]BulkActionResult, len(ids))
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		failed := false
+		for i, id := range ids {
+			results[i] = BulkActionResult{PostID: id}
+
+			var target *model.BlogPost
+			post, err := s.fetchAnyBlogPost(ctx, tx, id)
+			switch {
+			case err == nil:
+				target = &post
+			case !errors.Is(err, ErrEntityNotFound):
+				return err
+			}
+
+			storedVersion := post.Version
+			results[i].Changed, results[i].Err = applyBulkAction(action, tags, target, now)
+			if results[i].Err != nil {
+				failed = true
+				continue
+			}
+			// the rest are only checked once something has failed, as the transaction will be rolled back
+			if !results[i].Changed || failed {
+				continue
+			}
+			if err := s.updateBlogPostState(ctx, tx, &post, editorID, storedVersion, now); err != nil {
+				return err
+			}
+		}
+
+		if failed {
+			return ErrBulkActionFailed
+		}
+		return nil
+	})
+	if errors.Is(err, ErrBulkActionFailed) {
+		return results, err
+	}
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	return results, nil
+}
+
+// fetchAnyBlogPost returns the post with the given ID whether it is live or in the trash
+func (s *sqlBlogService) fetchAnyBlogPost(ctx context.Context, q querier, id string) (model.BlogPost, error) {
+	// checked up front, as PostgreSQL aborts the whole transaction on a malformed ID
+	if _, err := uuid.Parse(id); err != nil {
+		return model.BlogPost{}, ErrEntityNotFound
+	}
+
+	post, err := scanBlogPost(q.QueryRowContext(ctx, selectBlogPostColumns+` WHERE id = $1`, id))
+	if err != nil {
+		return model.BlogPost{}, s.mapError(err)
+	}
+	return post, nil
+}
+
+// transferBlogPost makes toAuthorID the author of post on behalf of editorID, doing nothing if they already are
+func (s *sqlBlogService) transferBlogPost(ctx context.Context, q querier, post *model.BlogPost, editorID, toAuthorID string, now time.Time) error {
+	if post.AuthorID == toAuthorID {
+		return nil
+	}
+
+	storedVersion := post.Version
+	applyBlogPostTransfer(post, toAuthorID, now)
+	return s.updateBlogPostState(ctx, q, post, editorID, storedVersion, now)
+}
+
+// updateBlogPostState writes the author, status, tags and timestamps of post, read at storedVersion in the
+// same transaction, and records the revision as made by editorID
+func (s *sqlBlogService) updateBlogPostState(ctx context.Context, q querier, post *model.BlogPost, editorID string, storedVersion int, now time.Time) error {
+	deletedTS, err := parseNullTime(post.DeletedTS)
+	if err != nil {
+		return err
+	}
+	tags, err := encodeTags(post.Tags)
+	if err != nil {
+		return err
+	}
+
+	res, err := q.ExecContext(ctx,
+		`UPDATE posts SET author_id = $2, status = $3, tags = $4, deleted_ts = $5, updated_ts = $6, version = $7 WHERE id = $1 AND version = $8`,
+		post.ID, post.AuthorID, post.Status, tags, deletedTS, now, post.Version, storedVersion,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrVersionConflict
+	}
+	return insertRevision(ctx, q, model.NewBlogPostRevision(*post, editorID), now)
+}
+
+const selectRevisionColumns = `SELECT post_id, revision, author_id, status, title, summary, content, tags, created_ts FROM post_revisions`
+
+func (s *sqlBlogService) FetchBlogPostRevisions(ctx context.Context, postID string) ([]model.BlogPostRevision, error) {
+	// distinguish a post without history from one that does not exist
+	if _, err := s.FetchBlogPost(ctx, postID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, selectRevisionColumns+` WHERE post_id = $1 ORDER BY revision`, postID)
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	defer rows.Close()
+
+	revisions := []model.BlogPostRevision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, s.mapError(err)
+	}
+	return revisions, nil
+}
+
+func (s *sqlBlogService) FetchBlogPostRevision(ctx context.Context, postID string, revision int) (model.BlogPostRevision, error) {
+	row := s.db.QueryRowContext(ctx,
+		selectRevisionColumns+` WHERE post_id = $1 AND revision = $2
+		AND EXISTS (SELECT 1 FROM posts WHERE posts.id = post_revisions.post_id AND posts.status <> $3)`,
+		postID, revision, model.DELETED,
+	)
+	r, err := scanRevision(row)
+	if err != nil {
+		return model.BlogPostRevision{}, s.mapError(err)
+	}
+	return r, nil
+}
+
+func insertRevision(ctx context.Context, q querier, revision model.BlogPostRevision, createdTS time.Time) error {
+	tags, err := encodeTags(revision.Tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx,
+		`INSERT INTO post_revisions (post_id, revision, author_id, status, title, summary, content, tags, created_ts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		revision.PostID, revision.Revision, revision.AuthorID, revision.Status, revision.Title, revision.Summary, revision.Contents, tags, createdTS,
+	)
+	return err
+}
+
+func scanRevision(row rowScanner) (model.BlogPostRevision, error) {
+	var (
+		revision  model.BlogPostRevision
+		tags      string
+		createdTS time.Time
+	)
+
+	err := row.Scan(
+		&revision.PostID, &revision.Revision, &revision.AuthorID, &revision.Status,
+		&revision.Title, &revision.Summary, &revision.Contents, &tags, &createdTS,
+	)
+	if err != nil {
+		return model.BlogPostRevision{}, err
+	}
+	if revision.Tags, err = decodeTags(tags); err != nil {
+		return model.BlogPostRevision{}, err
+	}
+
+	revision.CreatedTS = createdTS.UTC().Format(time.RFC3339)
+	return revision, nil
+}
+
+// checkVersionedWrite works out why a write guarded by id and version affected no rows, where trashed
+// says whether the write targeted a post in the trash rather than a live one
+func (s *sqlBlogService) checkVersionedWrite(ctx context.Context, q querier, res sql.Result, id string, trashed bool) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	query := `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1 AND status <> $2)`
+	if trashed {
+		query = `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1 AND status = $2)`
+	}
+
+	var exists bool
+	err = q.QueryRowContext(ctx, query, id, model.DELETED).Scan(&exists)
+	if err != nil {
+		return s.mapError(err)
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrEntityNotFound
+}
+
+// mapError translates driver errors into the errors exposed by this package
+func (s *sqlBlogService) mapError(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrEntityNotFound
+	case s.dialect.isUniqueViolation(err):
+		return ErrBlogPostAlreadyExists
+	case s.dialect.isInvalidID(err):
+		// malformed IDs can never match a stored row
+		return ErrEntityNotFound
+	}
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// withTx runs fn in a transaction, committing if it succeeds and rolling back otherwise
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanBlogPost(row rowScanner) (model.BlogPost, error) {
+	var (
+		post                 model.BlogPost
+		tags                 string
+		createdTS, updatedTS time.Time
+		publishedTS          sql.NullTime
+		deletedTS            sql.NullTime
+	)
+
+	err := row.Scan(
+		&post.ID, &post.Status, &post.Title, &post.Summary, &post.Contents, &tags, &post.AuthorID,
+		&createdTS, &publishedTS, &updatedTS, &post.Version, &deletedTS,
+	)
+	if err != nil {
+		return model.BlogPost{}, err
+	}
+	if post.Tags, err = decodeTags(tags); err != nil {
+		return model.BlogPost{}, err
+	}
+
+	post.CreatedTS = createdTS.UTC().Format(time.RFC3339)
+	post.UpdatedTS = updatedTS.UTC().Format(time.RFC3339)
+	if publishedTS.Valid {
+		post.PublishedTS = publishedTS.Time.UTC().Format(time.RFC3339)
+	}
+	if deletedTS.Valid {
+		post.DeletedTS = deletedTS.Time.UTC().Format(time.RFC3339)
+	}
+	return post, nil
+}
+
+// parseNullTime converts an optional RFC3339 model timestamp into a nullable column value
+func parseNullTime(ts string) (sql.NullTime, error) {
+	if ts == "" {
+		return sql.NullTime{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return sql.NullTime{}, fmt.Errorf("invalid timestamp %q: %w", ts, err)
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+}
+
+// encodeTags converts tags into the JSON array stored in tags columns
+func encodeTags(tags []string) (string, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	b, err := json.Marshal(tags)
+	if err != nil {
+		return "", fmt.Errorf("error encoding tags: %w", err)
+	}
+	return string(b), nil
+}
+
+// decodeTags parses the JSON array stored in tags columns
+func decodeTags(s string) ([]string, error) {
+	tags := []string{}
+	if err := json.Unmarshal([]byte(s), &tags); err != nil {
+		return nil, fmt.Errorf("error decoding tags: %w", err)
+	}
+	return tags, nil
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// sqlAPITokenService implements APITokenService against the api_tokens table for any supported SQL database
+type sqlAPITokenService struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+const selectAPITokenColumns = `SELECT id, user_id, name, token_hash, scopes, created_ts, last_used_ts FROM api_tokens`
+
+func (s *sqlAPITokenService) CreateAPIToken(ctx context.Context, token *APIToken) error {
+	id := assignUUID()
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO api_tokens (id, user_id, name, token_hash, scopes, created_ts) VALUES ($1, $2, $3, $4, $5, $6)`,
+		id, token.UserID, token.Name, token.Hash, joinScopes(token.Scopes), token.CreatedTS.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	token.ID = id
+	return nil
+}
+
+func (s *sqlAPITokenService) ListAPITokens(ctx context.Context, userID string) ([]APIToken, error) {
+	rows, err := s.db.QueryContext(ctx, selectAPITokenColumns+` WHERE user_id = $1 ORDER BY created_ts, id`, userID)
+	if err != nil {
+		if s.dialect.isInvalidID(err) {
+			return []APIToken{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *sqlAPITokenService) DeleteAPIToken(ctx context.Context, userID, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		if s.dialect.isInvalidID(err) {
+			return ErrEntityNotFound
+		}
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrEntityNotFound
+	}
+	return nil
+}
+
+func (s *sqlAPITokenService) DeleteUserAPITokens(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE user_id = $1`, userID)
+	return err
+}
+
+func (s *sqlAPITokenService) AuthenticateAPIToken(ctx context.Context, hash string, now time.Time) (*APIToken, error) {
+	token, err := scanAPIToken(s.db.QueryRowContext(ctx, selectAPITokenColumns+` WHERE token_hash = $1`, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidAPIToken
+		}
+		return nil, err
+	}
+
+	now = now.UTC().Truncate(time.Second)
+	if token.LastUsedTS == nil || now.Sub(*token.LastUsedTS) >= apiTokenLastUsedPrecision {
+		_, err := s.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_ts = $2 WHERE id = $1`, token.ID, now)
+		if err != nil {
+			return nil, err
+		}
+		token.LastUsedTS = &now
+	}
+	return &token, nil
+}
+
+// joinScopes returns the stored form of a token's scopes
+func joinScopes(scopes []model.Permission) string {
+	s := make([]string, len(scopes))
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+	return strings.Join(s, " ")
+}
+
+func scanAPIToken(row rowScanner) (APIToken, error) {
+	var (
+		token      APIToken
+		scopes     string
+		lastUsedTS sql.NullTime
+	)
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Hash, &scopes, &token.CreatedTS, &lastUsedTS)
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	for _, scope := range strings.Fields(scopes) {
+		token.Scopes = append(token.Scopes, model.Permission(scope))
+	}
+	token.CreatedTS = token.CreatedTS.UTC()
+	if lastUsedTS.Valid {
+		lastUsed := lastUsedTS.Time.UTC()
+		token.LastUsedTS = &lastUsed
+	}
+	return token, nil
+}
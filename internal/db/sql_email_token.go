@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// sqlEmailTokenService implements EmailTokenService against the email_tokens table for any supported SQL database
+type sqlEmailTokenService struct {
+	db *sql.DB
+}
+
+func (s *sqlEmailTokenService) CreateEmailToken(ctx context.Context, token *EmailToken) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM email_tokens WHERE user_id = $1 AND purpose = $2`, token.UserID, token.Purpose)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO email_tokens (token_hash, user_id, purpose, email, created_ts, expires_ts) VALUES ($1, $2, $3, $4, $5, $6)`,
+			token.Hash, token.UserID, token.Purpose, token.Email,
+			token.CreatedTS.UTC().Truncate(time.Second), token.ExpiresTS.UTC().Truncate(time.Second),
+		)
+		return err
+	})
+}
+
+func (s *sqlEmailTokenService) FetchEmailToken(ctx context.Context, hash string, now time.Time) (*EmailToken, error) {
+	var token EmailToken
+	err := s.db.QueryRowContext(ctx,
+		`SELECT token_hash, user_id, purpose, email, created_ts, expires_ts FROM email_tokens WHERE token_hash = $1`,
+		hash,
+	).Scan(&token.Hash, &token.UserID, &token.Purpose, &token.Email, &token.CreatedTS, &token.ExpiresTS)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidEmailToken
+		}
+		return nil, err
+	}
+
+	token.CreatedTS = token.CreatedTS.UTC()
+	token.ExpiresTS = token.ExpiresTS.UTC()
+	if !now.Before(token.ExpiresTS) {
+		return nil, ErrInvalidEmailToken
+	}
+	return &token, nil
+}
+
+func (s *sqlEmailTokenService) ConsumeEmailToken(ctx context.Context, hash string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM email_tokens WHERE token_hash = $1`, hash)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidEmailToken
+	}
+	return nil
+}
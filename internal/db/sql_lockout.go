@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// sqlLockoutService implements LockoutService against the login_lockouts table for any supported SQL database
+type sqlLockoutService struct {
+	db *sql.DB
+}
+
+const selectLockoutColumns = `SELECT lockout_key, failures, last_failure_ts, locked_until_ts FROM login_lockouts`
+
+func (s *sqlLockoutService) RecordLoginFailure(ctx context.Context, key string, now time.Time, policy LockoutPolicy) (*Lockout, error) {
+	now = now.UTC().Truncate(time.Second)
+
+	var lockout *Lockout
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// forget keys that have gone quiet, which also restarts the count for key if it has
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM login_lockouts WHERE last_failure_ts < $1 AND (locked_until_ts IS NULL OR locked_until_ts <= $2)`,
+			now.Add(-policy.ResetAfter), now,
+		)
+		if err != nil {
+			return err
+		}
+
+		// counting in the upsert keeps concurrent failures from overwriting each other
+		var failures int
+		err = tx.QueryRowContext(ctx,
+			`INSERT INTO login_lockouts (lockout_key, failures, last_failure_ts) VALUES ($1, 1, $2)
+			ON CONFLICT (lockout_key) DO UPDATE SET failures = login_lockouts.failures + 1, last_failure_ts = excluded.last_failure_ts
+			RETURNING failures`,
+			key, now,
+		).Scan(&failures)
+		if err != nil {
+			return err
+		}
+
+		if lockedUntil := policy.LockedUntil(failures, now); !lockedUntil.IsZero() {
+			_, err = tx.ExecContext(ctx, `UPDATE login_lockouts SET locked_until_ts = $2 WHERE lockout_key = $1`, key, lockedUntil)
+			if err != nil {
+				return err
+			}
+		}
+
+		lockout, err = scanLockout(tx.QueryRowContext(ctx, selectLockoutColumns+` WHERE lockout_key = $1`, key))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lockout, nil
+}
+
+func (s *sqlLockoutService) FetchLockout(ctx context.Context, key string) (*Lockout, error) {
+	lockout, err := scanLockout(s.db.QueryRowContext(ctx, selectLockoutColumns+` WHERE lockout_key = $1`, key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEntityNotFound
+		}
+		return nil, err
+	}
+	return lockout, nil
+}
+
+func (s *sqlLockoutService) ListLockouts(ctx context.Context) ([]Lockout, error) {
+	rows, err := s.db.QueryContext(ctx, selectLockoutColumns+` ORDER BY last_failure_ts DESC, lockout_key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockouts := []Lockout{}
+	for rows.Next() {
+		lockout, err := scanLockout(rows)
+		if err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, *lockout)
+	}
+	return lockouts, rows.Err()
+}
+
+func (s *sqlLockoutService) ClearLockout(ctx context.Context, key string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM login_lockouts WHERE lockout_key = $1`, key)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrEntityNotFound
+	}
+	return nil
+}
+
+func scanLockout(row rowScanner) (*Lockout, error) {
+	var (
+		lockout       Lockout
+		lockedUntilTS sql.NullTime
+	)
+	if err := row.Scan(&lockout.Key, &lockout.Failures, &lockout.LastFailureTS, &lockedUntilTS); err != nil {
+		return nil, err
+	}
+
+	lockout.LastFailureTS = lockout.LastFailureTS.UTC()
+	if lockedUntilTS.Valid {
+		lockedUntil := lockedUntilTS.Time.UTC()
+		lockout.LockedUntilTS = &lockedUntil
+	}
+	return &lockout, nil
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// sqlRefreshTokenService implements RefreshTokenService against the refresh_tokens table for any supported SQL database
+type sqlRefreshTokenService struct {
+	db *sql.DB
+}
+
+const selectRefreshTokenColumns = `SELECT token_hash, family_id, user_id, created_ts, expires_ts, used_ts, revoked_ts FROM refresh_tokens`
+
+func (s *sqlRefreshTokenService) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	return insertRefreshToken(ctx, s.db, token)
+}
+
+func (s *sqlRefreshTokenService) FetchRefreshToken(ctx context.Context, hash string) (RefreshToken, error) {
+	token, err := scanRefreshToken(s.db.QueryRowContext(ctx, selectRefreshTokenColumns+` WHERE token_hash = $1`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, ErrInvalidRefreshToken
+	}
+	return token, err
+}
+
+func (s *sqlRefreshTokenService) RotateRefreshToken(ctx context.Context, hash string, next *RefreshToken) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var reused bool
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// claim the token before reading anything, so that concurrent rotations queue up on the write rather
+		// than all reading an unused token, and only the first of them succeeds
+		row := tx.QueryRowContext(ctx,
+			`UPDATE refresh_tokens SET used_ts = $2
+			WHERE token_hash = $1 AND used_ts IS NULL AND revoked_ts IS NULL AND expires_ts > $2
+			RETURNING family_id, user_id`,
+			hash, now,
+		)
+		err := row.Scan(&next.FamilyID, &next.UserID)
+		if err == nil {
+			return insertRefreshToken(ctx, tx, next)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		// work out why the token could not be claimed
+		token, err := scanRefreshToken(tx.QueryRowContext(ctx, selectRefreshTokenColumns+` WHERE token_hash = $1`, hash))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		err = token.check(now)
+		if errors.Is(err, ErrRefreshTokenReused) {
+			// the revocation has to be committed, so the error is returned once the transaction is
+			reused = true
+			return revokeRefreshTokenFamily(ctx, tx, token.FamilyID, now)
+		}
+		if err == nil {
+			err = ErrInvalidRefreshToken
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if reused {
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
+
+func (s *sqlRefreshTokenService) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	return revokeRefreshTokenFamily(ctx, s.db, familyID, time.Now().UTC().Truncate(time.Second))
+}
+
+func (s *sqlRefreshTokenService) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_ts = $2 WHERE user_id = $1 AND revoked_ts IS NULL`,
+		userID, time.Now().UTC().Truncate(time.Second),
+	)
+	return err
+}
+
+func insertRefreshToken(ctx context.Context, q querier, token *RefreshToken) error {
+	_, err := q.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (token_hash, family_id, user_id, created_ts, expires_ts) VALUES ($1, $2, $3, $4, $5)`,
+		token.Hash, token.FamilyID, token.UserID, token.CreatedTS.UTC(), token.ExpiresTS.UTC(),
+	)
+	return err
+}
+
+func revokeRefreshTokenFamily(ctx context.Context, q querier, familyID string, now time.Time) error {
+	_, err := q.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_ts = $2 WHERE family_id = $1 AND revoked_ts IS NULL`,
+		familyID, now,
+	)
+	return err
+}
+
+func scanRefreshToken(row rowScanner) (RefreshToken, error) {
+	var (
+		token             RefreshToken
+		usedTS, revokedTS sql.NullTime
+	)
+	err := row.Scan(&token.Hash, &token.FamilyID, &token.UserID, &token.CreatedTS, &token.ExpiresTS, &usedTS, &revokedTS)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	token.CreatedTS = token.CreatedTS.UTC()
+	token.ExpiresTS = token.ExpiresTS.UTC()
+	if usedTS.Valid {
+		token.UsedTS = usedTS.Time.UTC()
+	}
+	if revokedTS.Valid {
+		token.RevokedTS = revokedTS.Time.UTC()
+	}
+	return token, nil
+}
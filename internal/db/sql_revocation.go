@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// sqlTokenRevocationService implements TokenRevocationService against the revoked_tokens and
+// user_token_revocations tables for any supported SQL database
+type sqlTokenRevocationService struct {
+	db *sql.DB
+}
+
+func (s *sqlTokenRevocationService) RevokeToken(ctx context.Context, tokenID string, expiresTS time.Time) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// expired tokens are rejected anyway, so stop remembering them
+		_, err := tx.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_ts < $1`, time.Now().UTC().Truncate(time.Second))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO revoked_tokens (token_id, expires_ts) VALUES ($1, $2) ON CONFLICT (token_id) DO NOTHING`,
+			tokenID, expiresTS.UTC().Truncate(time.Second),
+		)
+		return err
+	})
+}
+
+func (s *sqlTokenRevocationService) RevokeUserTokens(ctx context.Context, userID string, revokedTS time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO user_token_revocations (user_id, revoked_ts) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_ts = excluded.revoked_ts WHERE user_token_revocations.revoked_ts < excluded.revoked_ts`,
+		userID, revokedTS.UTC().Truncate(time.Second),
+	)
+	return err
+}
+
+func (s *sqlTokenRevocationService) IsTokenRevoked(ctx context.Context, tokenID, userID string, issuedTS time.Time) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE token_id = $1)
+		OR EXISTS (SELECT 1 FROM user_token_revocations WHERE user_id = $2 AND revoked_ts >= $3)`,
+		tokenID, userID, issuedTS.UTC().Truncate(time.Second),
+	).Scan(&revoked)
+	return revoked, err
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// sqlTwoFactorService implements TwoFactorService against the totp_enrollments and recovery_codes tables for
+// any supported SQL database
+type sqlTwoFactorService struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func (s *sqlTwoFactorService) CreateTOTPEnrollment(ctx context.Context, enrollment *TOTPEnrollment) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		existing, err := fetchTOTPEnrollment(ctx, tx, enrollment.UserID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if existing != nil && existing.Enabled() {
+			return ErrTwoFactorEnabled
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO totp_enrollments (user_id, secret, created_ts) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, created_ts = excluded.created_ts, last_used_step = 0`,
+			enrollment.UserID, enrollment.Secret, enrollment.CreatedTS.UTC().Truncate(time.Second),
+		)
+		return err
+	})
+}
+
+func (s *sqlTwoFactorService) FetchTOTPEnrollment(ctx context.Context, userID string) (*TOTPEnrollment, error) {
+	enrollment, err := fetchTOTPEnrollment(ctx, s.db, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || s.dialect.isInvalidID(err) {
+			return nil, ErrEntityNotFound
+		}
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+func (s *sqlTwoFactorService) ConfirmTOTPEnrollment(ctx context.Context, userID string, confirmedTS time.Time, step int64, recoveryCodeHashes []string) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		enrollment, err := fetchTOTPEnrollment(ctx, tx, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrEntityNotFound
+			}
+			return err
+		}
+		if enrollment.Enabled() {
+			return ErrTwoFactorEnabled
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE totp_enrollments SET confirmed_ts = $2, last_used_step = $3 WHERE user_id = $1`,
+			userID, confirmedTS.UTC().Truncate(time.Second), step,
+		)
+		if err != nil {
+			return err
+		}
+
+		// codes left over from an earlier enrollment must not carry over
+		if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		for _, hash := range recoveryCodeHashes {
+			_, err := tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqlTwoFactorService) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	// the condition makes concurrent uses of the same code race to a single winner
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE totp_enrollments SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`,
+		userID, step,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 1 {
+		return nil
+	}
+
+	if _, err := s.FetchTOTPEnrollment(ctx, userID); err != nil {
+		return err
+	}
+	return ErrTOTPCodeReused
+}
+
+func (s *sqlTwoFactorService) UseRecoveryCode(ctx context.Context, userID, hash string, usedTS time.Time) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE recovery_codes SET used_ts = $3 WHERE user_id = $1 AND code_hash = $2 AND used_ts IS NULL`,
+		userID, hash, usedTS.UTC().Truncate(time.Second),
+	)
+	if err != nil {
+		if s.dialect.isInvalidID(err) {
+			return ErrInvalidRecoveryCode
+		}
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidRecoveryCode
+	}
+	return nil
+}
+
+func (s *sqlTwoFactorService) DeleteTOTPEnrollment(ctx context.Context, userID string) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+			if s.dialect.isInvalidID(err) {
+				return ErrEntityNotFound
+			}
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `DELETE FROM totp_enrollments WHERE user_id = $1`, userID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrEntityNotFound
+		}
+		return nil
+	})
+}
+
+func fetchTOTPEnrollment(ctx context.Context, q querier, userID string) (*TOTPEnrollment, error) {
+	var (
+		enrollment  TOTPEnrollment
+		confirmedTS sql.NullTime
+	)
+	err := q.QueryRowContext(ctx,
+		`SELECT user_id, secret, created_ts, confirmed_ts, last_used_step FROM totp_enrollments WHERE user_id = $1`,
+		userID,
+	).Scan(&enrollment.UserID, &enrollment.Secret, &enrollment.CreatedTS, &confirmedTS, &enrollment.LastUsedStep)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment.CreatedTS = enrollment.CreatedTS.UTC()
+	if confirmedTS.Valid {
+		confirmed := confirmedTS.Time.UTC()
+		enrollment.ConfirmedTS = &confirmed
+	}
+	return &enrollment, nil
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// sqlUserService implements UserService against the users table for any supported SQL database
+type sqlUserService struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+const selectUserColumns = `SELECT id, username, name, role, password_hash, COALESCE(email, ''), email_verified, suspended, posts_hidden FROM users`
+
+// AuthenticateUser returns the user, or ErrInvalidCredentials if the username and password do not match
+func (s *sqlUserService) AuthenticateUser(username, password string) (*model.User, error) {
+	return authenticateUser(s, username, password)
+}
+
+// FetchUser returns a user by username
+func (s *sqlUserService) FetchUser(username string) (*model.User, error) {
+	user, err := scanUser(s.db.QueryRow(selectUserColumns+` WHERE username = $1`, username))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEntityNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *sqlUserService) FetchUserByID(ctx context.Context, id string) (*model.User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx, selectUserColumns+` WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || s.dialect.isInvalidID(err) {
+			return nil, ErrEntityNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *sqlUserService) FetchUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx, selectUserColumns+` WHERE email = $1`, email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEntityNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *sqlUserService) CreateUser(ctx context.Context, user *model.User) error {
+	id := assignUUID()
+	if err := s.insertUser(ctx, s.db, id, user); err != nil {
+		return err
+	}
+
+	user.ID = id
+	return nil
+}
+
+func (s *sqlUserService) insertUser(ctx context.Context, q querier, id string, user *model.User) error {
+	if err := emailInUse(ctx, q, user.Email, id); err != nil {
+		return err
+	}
+
+	_, err := q.ExecContext(ctx,
+		`INSERT INTO users (id, username, name, role, password_hash, email, email_verified) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)`,
+		id, user.Username, user.Name, user.Role, user.PasswordHash, user.Email, user.EmailVerified,
+	)
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		// an email address taken since it was checked is reported as the username, which is far more likely
+		return ErrUserAlreadyExists
+	}
+	return err
+}
+
+// emailInUse fails with ErrEmailAlreadyInUse if a user other than the one with exceptID has email. Checking
+// first tells a taken email address apart from a taken username, which both violate a unique index.
+func emailInUse(ctx context.Context, q querier, email, exceptID string) error {
+	if email == "" {
+		return nil
+	}
+
+	var n int
+	err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE email = $1 AND id <> $2`, email, exceptID).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrEmailAlreadyInUse
+	}
+	return nil
+}
+
+func (s *sqlUserService) FetchUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx,
+		`SELECT u.id, u.username, u.name, u.role, u.password_hash, COALESCE(u.email, ''), u.email_verified, u.suspended, u.posts_hidden
+		FROM users u JOIN user_identities i ON i.user_id = u.id
+		WHERE i.issuer = $1 AND i.subject = $2`,
+		issuer, subject,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEntityNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *sqlUserService) CreateExternalUser(ctx context.Context, user *model.User, issuer, subject string) error {
+	id := assignUUID()
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.insertUser(ctx, tx, id, user); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO user_identities (issuer, subject, user_id, created_ts) VALUES ($1, $2, $3, $4)`,
+			issuer, subject, id, time.Now().UTC().Truncate(time.Second),
+		)
+		if err != nil && s.dialect.isUniqueViolation(err) {
+			return ErrIdentityAlreadyLinked
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	user.ID = id
+	return nil
+}
+
+func (s *sqlUserService) UpdateUser(ctx context.Context, user *model.User) error {
+	if _, err := s.FetchUserByID(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := emailInUse(ctx, s.db, user.Email, user.ID); err != nil {
+		return err
+	}
+
+	row := s.db.QueryRowContext(ctx,
+		`UPDATE users SET name = $2, role = $3, password_hash = $4, email = NULLIF($5, ''), email_verified = $6
+		WHERE id = $1 RETURNING username`,
+		user.ID, user.Name, user.Role, user.PasswordHash, user.Email, user.EmailVerified,
+	)
+	if err := row.Scan(&user.Username); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEntityNotFound
+		case s.dialect.isUniqueViolation(err):
+			return ErrEmailAlreadyInUse
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *sqlUserService) ListUsers(ctx context.Context) ([]model.User, error) {
+	rows, err := s.db.QueryContext(ctx, selectUserColumns+` ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlUserService) SuspendUser(ctx context.Context, id string, hidePosts bool) error {
+	return s.setSuspended(ctx, id, true, hidePosts)
+}
+
+func (s *sqlUserService) ReactivateUser(ctx context.Context, id string) error {
+	return s.setSuspended(ctx, id, false, false)
+}
+
+func (s *sqlUserService) setSuspended(ctx context.Context, id string, suspended, hidePosts bool) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE users SET suspended = $2, posts_hidden = $3 WHERE id = $1`, id, suspended, hidePosts)
+	return s.mapUserWrite(res, err)
+}
+
+func (s *sqlUserService) DeleteUser(ctx context.Context, id string) error {
+	// tokens, identities and two-factor enrollments are removed along with the user by their foreign keys
+	res, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	return s.mapUserWrite(res, err)
+}
+
+// mapUserWrite maps the result of a write to a single user by ID, failing with ErrEntityNotFound if there is no
+// such user
+func (s *sqlUserService) mapUserWrite(res sql.Result, err error) error {
+	if err != nil {
+		if s.dialect.isInvalidID(err) {
+			return ErrEntityNotFound
+		}
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrEntityNotFound
+	}
+	return nil
+}
+
+func (s *sqlUserService) FetchHiddenAuthorIDs(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM users WHERE posts_hidden`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SeedUsers inserts any of the given users whose username is not already taken. Stored users are left as
+// they are, other than being given a password if they were created before passwords were stored.
+func (s *sqlUserService) SeedUsers(ctx context.Context, users map[string]*model.User) error {
+	for _, user := range users {
+		_, err := s.db.ExecContext(ctx,
+			`INSERT INTO users (id, username, name, role, password_hash) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (username) DO UPDATE SET password_hash = excluded.password_hash WHERE users.password_hash = ''`,
+			user.ID, user.Username, user.Name, user.Role, user.PasswordHash,
+		)
+		if err != nil {
+			return fmt.Errorf("error seeding user %q: %w", user.Username, err)
+		}
+	}
+	return nil
+}
+
+func scanUser(row rowScanner) (model.User, error) {
+	var user model.User
+	err := row.Scan(&user.ID, &user.Username, &user.Name, &user.Role, &user.PasswordHash, &user.Email, &user.EmailVerified, &user.Suspended, &user.PostsHidden)
+	return user, err
+}
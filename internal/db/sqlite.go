@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var sqliteDialect = sqlDialect{
+	isUniqueViolation: func(err error) bool {
+		var sqliteErr *sqlite.Error
+		if !errors.As(err, &sqliteErr) {
+			return false
+		}
+		code := sqliteErr.Code()
+		return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	},
+	// SQLite does not type check IDs, so an invalid ID simply matches no rows
+	isInvalidID: func(err error) bool {
+		return false
+	},
+}
+
+// OpenSQLite opens the SQLite database file at cfg.DSN, creating it if it does not exist
+func OpenSQLite(ctx context.Context, cfg config.DBConfig) (*sql.DB, error) {
+	if cfg.DSN == "" {
+		return nil, errors.New("no DSN provided for database connection")
+	}
+
+	// WAL and a busy timeout let concurrent requests share the file without failing on locks
+	dsn := cfg.DSN
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	dsn += sep + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_time_format=sqlite"
+
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database connection: %w", err)
+	}
+
+	conn.SetMaxOpenConns(cfg.MaxOpenConns)
+	conn.SetMaxIdleConns(cfg.MaxIdleConns)
+	conn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	// every connection to an in-memory database gets its own empty database
+	if strings.Contains(cfg.DSN, ":memory:") {
+		conn.SetMaxOpenConns(1)
+	}
+
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	return conn, nil
+}
+
+// SQLiteBlogService implements BlogService against the posts table in a SQLite database file
+type SQLiteBlogService struct {
+	sqlBlogService
+}
+
+func NewSQLiteBlogService(db *sql.DB) *SQLiteBlogService {
+	return &SQLiteBlogService{sqlBlogService{db: db, dialect: sqliteDialect}}
+}
+
+// SQLiteUserService implements UserService against the users table in a SQLite database file
+type SQLiteUserService struct {
+	sqlUserService
+}
+
+func NewSQLiteUserService(db *sql.DB) *SQLiteUserService {
+	return &SQLiteUserService{sqlUserService{db: db, dialect: sqliteDialect}}
+}
+
+// SQLiteRefreshTokenService implements RefreshTokenService against the refresh_tokens table in a SQLite database file
+type SQLiteRefreshTokenService struct {
+	sqlRefreshTokenService
+}
+
+func NewSQLiteRefreshTokenService(db *sql.DB) *SQLiteRefreshTokenService {
+	return &SQLiteRefreshTokenService{sqlRefreshTokenService{db: db}}
+}
+
+// SQLiteTokenRevocationService implements TokenRevocationService against the token revocation tables in a SQLite database file
+type SQLiteTokenRevocationService struct {
+	sqlTokenRevocationService
+}
+
+func NewSQLiteTokenRevocationService(db *sql.DB) *SQLiteTokenRevocationService {
+	return &SQLiteTokenRevocationService{sqlTokenRevocationService{db: db}}
+}
+
+// SQLiteAPITokenService implements APITokenService against the api_tokens table in a SQLite database file
+type SQLiteAPITokenService struct {
+	sqlAPITokenService
+}
+
+func NewSQLiteAPITokenService(db *sql.DB) *SQLiteAPITokenService {
+	return &SQLiteAPITokenService{sqlAPITokenService{db: db, dialect: sqliteDialect}}
+}
+
+// SQLiteLockoutService implements LockoutService against the login_lockouts table in a SQLite database file
+type SQLiteLockoutService struct {
+	sqlLockoutService
+}
+
+func NewSQLiteLockoutService(db *sql.DB) *SQLiteLockoutService {
+	return &SQLiteLockoutService{sqlLockoutService{db: db}}
+}
+
+// SQLiteTwoFactorService implements TwoFactorService against the totp_enrollments and recovery_codes tables in a SQLite database file
+type SQLiteTwoFactorService struct {
+	sqlTwoFactorService
+}
+
+func NewSQLiteTwoFactorService(db *sql.DB) *SQLiteTwoFactorService {
+	return &SQLiteTwoFactorService{sqlTwoFactorService{db: db, dialect: sqliteDialect}}
+}
+
+// SQLiteEmailTokenService implements EmailTokenService against the email_tokens table in a SQLite database file
+type SQLiteEmailTokenService struct {
+	sqlEmailTokenService
+}
+
+func NewSQLiteEmailTokenService(db *sql.DB) *SQLiteEmailTokenService {
+	return &SQLiteEmailTokenService{sqlEmailTokenService{db: db}}
+}
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+// newTestSQLiteDB returns a migrated database backed by a file in a temp directory
+func newTestSQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	conn, err := OpenSQLite(context.Background(), config.DBConfig{
+		Driver: DriverSQLite,
+		DSN:    filepath.Join(t.TempDir(), "blog.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	migrator, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	conn := newTestSQLiteDB(t)
+	ctx := context.Background()
+
+	migrator, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Errorf("migration %d_%s not applied", s.Version, s.Name)
+		}
+	}
+
+	// revert everything
+	for range statuses {
+		if _, err := migrator.Down(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := migrator.Down(ctx); !errors.Is(err, ErrNoMigrationsApplied) {
+		t.Errorf("got %v, want %v", err, ErrNoMigrationsApplied)
+	}
+
+	// and reapply
+	ran, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != len(statuses) {
+		t.Errorf("got %d migrations applied, want %d", len(ran), len(statuses))
+	}
+}
+
+func TestSQLiteMigrateAdminsToRoles(t *testing.T) {
+	conn := newTestSQLiteDB(t)
+	ctx := context.Background()
+
+	migrator, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// revert to the schema before roles replaced the admin flag
+	for {
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reverted.Version == 10 {
+			break
+		}
+	}
+
+	_, err = conn.ExecContext(ctx, `INSERT INTO users (id, username, name, is_admin) VALUES ($1, $2, $3, $4), ($5, $6, $7, $8)`,
+		assignUUID(), "kishiguro", "Kazuo Ishiguro", false,
+		assignUUID(), "admin", "James Wood", true,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewSQLiteUserService(conn)
+	for username, want := range map[string]model.Role{"kishiguro": model.RoleAuthor, "admin": model.RoleAdmin} {
+		user, err := svc.FetchUser(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != want {
+			t.Errorf("got Role %q for %s, want %q", user.Role, username, want)
+		}
+	}
+}
+
+func TestSQLiteConcurrentMigrations(t *testing.T) {
+	conn, err := OpenSQLite(context.Background(), config.DBConfig{
+		Driver: DriverSQLite,
+		DSN:    filepath.Join(t.TempDir(), "blog.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// as if several instances started up at once with db.auto_migrate
+	ran := make([][]Migration, 4)
+	errs := make([]error, len(ran))
+	var wg sync.WaitGroup
+	for i := range ran {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			migrator, err := NewMigrator(conn)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			ran[i], errs[i] = migrator.Up(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range ran {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		total += len(ran[i])
+	}
+	migrator, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != len(migrator.migrations) {
+		t.Errorf("got %d migrations applied, want each of the %d applied once", total, len(migrator.migrations))
+	}
+}
+
+func TestSQLiteAdoptLegacyPostsTable(t *testing.T) {
+	conn, err := OpenSQLite(context.Background(), config.DBConfig{
+		Driver: DriverSQLite,
+		DSN:    filepath.Join(t.TempDir(), "blog.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	ctx := context.Background()
+
+	// the table as db/seed.sql used to create it, before titles were unique per author
+	_, err = conn.ExecContext(ctx, `CREATE TABLE posts (
+		id UUID PRIMARY KEY,
+		status TEXT NOT NULL,
+		title TEXT NOT NULL,
+		summary TEXT NOT NULL,
+		content TEXT NOT NULL,
+		author_id UUID NOT NULL,
+		created_ts timestamp NOT NULL,
+		published_ts timestamp,
+		updated_ts timestamp NOT NULL
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	authorID := assignUUID()
+	for i, want := range []bool{false, true} {
+		_, err := conn.ExecContext(ctx,
+			`INSERT INTO posts (id, status, title, summary, content, author_id, created_ts, updated_ts) VALUES ($1, $2, $3, $4, $5, $6, $7, $7)`,
+			assignUUID(), model.DRAFT, "Never Let Me Go", "", "", authorID, time.Now().UTC(),
+		)
+		if got := sqliteDialect.isUniqueViolation(err); got != want {
+			t.Errorf("got unique violation %t inserting post %d, want %t: %v", got, i, want, err)
+		}
+	}
+}
+
+func TestSQLiteSeedUsers(t *testing.T) {
+	svc := NewSQLiteUserService(newTestSQLiteDB(t))
+	ctx := context.Background()
+
+	users := map[string]*model.User{
+		"admin": {ID: assignUUID(), Username: "admin", Name: "James Wood", Role: model.RoleAdmin},
+	}
+	if err := svc.SeedUsers(ctx, users); err != nil {
+		t.Fatal(err)
+	}
+
+	// seeding again must not replace the stored user
+	reseeded := map[string]*model.User{
+		"admin": {ID: assignUUID(), Username: "admin", Name: "Someone Else"},
+	}
+	if err := svc.SeedUsers(ctx, reseeded); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := svc.FetchUser("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *user != *users["admin"] {
+		t.Errorf("got %+v, want %+v", *user, *users["admin"])
+	}
+
+	if _, err := svc.FetchUser("nobody"); !errors.Is(err, ErrEntityNotFound) {
+		t.Errorf("got %v, want %v", err, ErrEntityNotFound)
+	}
+}
+
+func TestSQLiteAuthenticateUser(t *testing.T) {
+	conn := newTestSQLiteDB(t)
+	svc := NewSQLiteUserService(conn)
+	ctx := context.Background()
+
+	hash, err := HashPassword("hailsham")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// users stored before passwords were introduced are given one when next seeded
+	_, err = conn.ExecContext(ctx, `INSERT INTO users (id, username, name) VALUES ($1, $2, $3)`,
+		assignUUID(), "kishiguro", "Kazuo Ishiguro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.AuthenticateUser("kishiguro", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("got %v for a user without a password, want %v", err, ErrInvalidCredentials)
+	}
+
+	users := map[string]*model.User{
+		"kishiguro": {ID: assignUUID(), Username: "kishiguro", Name: "Kazuo Ishiguro", PasswordHash: hash},
+	}
+	if err := svc.SeedUsers(ctx, users); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.AuthenticateUser("kishiguro", "hailsham"); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if _, err := svc.AuthenticateUser("kishiguro", "password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("got %v for a wrong password, want %v", err, ErrInvalidCredentials)
+	}
+	if _, err := svc.AuthenticateUser("nobody", "hailsham"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("got %v for an unknown user, want %v", err, ErrInvalidCredentials)
+	}
+}
@@ -0,0 +1,258 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+	"github.com/James-D-Wood/blog-api/internal/db"
+	"github.com/James-D-Wood/blog-api/internal/db/dbtest"
+	"github.com/google/uuid"
+)
+
+// postgresDSNEnvVar points the suite at a PostgreSQL server, ie: the one from docker-compose.yml
+const postgresDSNEnvVar = "BLOG_API_TEST_POSTGRES_DSN"
+
+func TestInMemoryBlogService(t *testing.T) {
+	dbtest.RunBlogServiceSuite(t, func(t *testing.T) db.BlogService {
+		return db.NewInMemoryBlogService()
+	})
+}
+
+func TestSQLiteBlogService(t *testing.T) {
+	dbtest.RunBlogServiceSuite(t, func(t *testing.T) db.BlogService {
+		return db.NewSQLiteBlogService(newSQLiteDB(t))
+	})
+}
+
+func TestPostgresBlogService(t *testing.T) {
+	dsn := postgresDSN(t)
+	dbtest.RunBlogServiceSuite(t, func(t *testing.T) db.BlogService {
+		return db.NewPostgresBlogService(newPostgresDB(t, dsn))
+	})
+}
+
+func TestInMemoryUserService(t *testing.T) {
+	dbtest.RunUserServiceSuite(t, func(t *testing.T) db.UserService {
+		return &db.InMemoryUserService{}
+	})
+}
+
+func TestSQLiteUserService(t *testing.T) {
+	dbtest.RunUserServiceSuite(t, func(t *testing.T) db.UserService {
+		return db.NewSQLiteUserService(newSQLiteDB(t))
+	})
+}
+
+func TestPostgresUserService(t *testing.T) {
+	dsn := postgresDSN(t)
+	dbtest.RunUserServiceSuite(t, func(t *testing.T) db.UserService {
+		return db.NewPostgresUserService(newPostgresDB(t, dsn))
+	})
+}
+
+func TestInMemoryRefreshTokenService(t *testing.T) {
+	dbtest.RunRefreshTokenServiceSuite(t, func(t *testing.T) (db.RefreshTokenService, db.UserService) {
+		return db.NewInMemoryRefreshTokenService(), &db.InMemoryUserService{}
+	})
+}
+
+func TestSQLiteRefreshTokenService(t *testing.T) {
+	dbtest.RunRefreshTokenServiceSuite(t, func(t *testing.T) (db.RefreshTokenService, db.UserService) {
+		conn := newSQLiteDB(t)
+		return db.NewSQLiteRefreshTokenService(conn), db.NewSQLiteUserService(conn)
+	})
+}
+
+func TestPostgresRefreshTokenService(t *testing.T) {
+	dsn := postgresDSN(t)
+	dbtest.RunRefreshTokenServiceSuite(t, func(t *testing.T) (db.RefreshTokenService, db.UserService) {
+		conn := newPostgresDB(t, dsn)
+		return db.NewPostgresRefreshTokenService(conn), db.NewPostgresUserService(conn)
+	})
+}
+
+func TestInMemoryTokenRevocationService(t *testing.T) {
+	dbtest.RunTokenRevocationServiceSuite(t, func(t *testing.T) (db.TokenRevocationService, db.UserService) {
+		return db.NewInMemoryTokenRevocationService(), &db.InMemoryUserService{}
+	})
+}
+
+func TestSQLiteTokenRevocationService(t *testing.T) {
+	dbtest.RunTokenRevocationServiceSuite(t, func(t *testing.T) (db.TokenRevocationService, db.UserService) {
+		conn := newSQLiteDB(t)
+		return db.NewSQLiteTokenRevocationService(conn), db.NewSQLiteUserService(conn)
+	})
+}
+
+func TestPostgresTokenRevocationService(t *testing.T) {
+	dsn := postgresDSN(t)
+	dbtest.RunTokenRevocationServiceSuite(t, func(t *testing.T) (db.TokenRevocationService, db.UserService) {
+		conn := newPostgresDB(t, dsn)
+		return db.NewPostgresTokenRevocationService(conn), db.NewPostgresUserService(conn)
+	})
+}
+
+func TestInMemoryAPITokenService(t *testing.T) {
+	dbtest.RunAPITokenServiceSuite(t, func(t *testing.T) (db.APITokenService, db.UserService) {
+		return db.NewInMemoryAPITokenService(), &db.InMemoryUserService{}
+	})
+}
+
+func TestSQLiteAPITokenService(t *testing.T) {
+	dbtest.RunAPITokenServiceSuite(t, func(t *testing.T) (db.APITokenService, db.UserService) {
+		conn := newSQLiteDB(t)
+		return db.NewSQLiteAPITokenService(conn), db.NewSQLiteUserService(conn)
+	})
+}
+
+func TestPostgresAPITokenService(t *testing.T) {
+	dsn := postgresDSN(t)
+	dbtest.RunAPITokenServiceSuite(t, func(t *testing.T) (db.APITokenService, db.UserService) {
+		conn := newPostgresDB(t, dsn)
+		return db.NewPostgresAPITokenService(conn), db.NewPostgresUserService(conn)
+	})
+}
+
+func TestInMemoryLockoutService(t *testing.T) {
+	dbtest.RunLockoutServiceSuite(t, func(t *testing.T) db.LockoutService {
+		return db.NewInMemoryLockoutService()
+	})
+}
+
+func TestSQLiteLockoutService(t *testing.T) {
+	dbtest.RunLockoutServiceSuite(t, func(t *testing.T) db.LockoutService {
+		return db.NewSQLiteLockoutService(newSQLiteDB(t))
+	})
+}
+
+func TestPostgresLockoutService(t *testing.T) {
+	dsn := postgresDSN(t)
+	dbtest.RunLockoutServiceSuite(t, func(t *testing.T) db.LockoutService {
+		return db.NewPostgresLockoutService(newPostgresDB(t, dsn))
+	})
+}
+
+func TestInMemoryTwoFactorService(t *testing.T) {
+	dbtest.RunTwoFactorServiceSuite(t, func(t *testing.T) (db.TwoFactorService, db.UserService) {
+		return db.NewInMemoryTwoFactorService(), &db.InMemoryUserService{}
+	})
+}
+
+func TestSQLiteTwoFactorService(t *testing.T) {
+	dbtest.RunTwoFactorServiceSuite(t, func(t *testing.T) (db.TwoFactorService, db.UserService) {
+		conn := newSQLiteDB(t)
+		return db.NewSQLiteTwoFactorService(conn), db.NewSQLiteUserService(conn)
+	})
+}
+
+func TestPostgresTwoFactorService(t *testing.T) {
+	dsn := postgresDSN(t)
+	dbtest.RunTwoFactorServiceSuite(t, func(t *testing.T) (db.TwoFactorService, db.UserService) {
+		conn := newPostgresDB(t, dsn)
+		return db.NewPostgresTwoFactorService(conn), db.NewPostgresUserService(conn)
+	})
+}
+
+func TestInMemoryEmailTokenService(t *testing.T) {
+	dbtest.RunEmailTokenServiceSuite(t, func(t *testing.T) (db.EmailTokenService, db.UserService) {
+		return db.NewInMemoryEmailTokenService(), &db.InMemoryUserService{}
+	})
+}
+
+func TestSQLiteEmailTokenService(t *testing.T) {
+	dbtest.RunEmailTokenServiceSuite(t, func(t *testing.T) (db.EmailTokenService, db.UserService) {
+		conn := newSQLiteDB(t)
+		return db.NewSQLiteEmailTokenService(conn), db.NewSQLiteUserService(conn)
+	})
+}
+
+func TestPostgresEmailTokenService(t *testing.T) {
+	dsn := postgresDSN(t)
+	dbtest.RunEmailTokenServiceSuite(t, func(t *testing.T) (db.EmailTokenService, db.UserService) {
+		conn := newPostgresDB(t, dsn)
+		return db.NewPostgresEmailTokenService(conn), db.NewPostgresUserService(conn)
+	})
+}
+
+// newSQLiteDB returns a migrated database in a temporary file
+func newSQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	conn, err := db.OpenSQLite(context.Background(), config.DBConfig{
+		Driver: db.DriverSQLite,
+		DSN:    filepath.Join(t.TempDir(), "blog.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	migrate(t, conn)
+	return conn
+}
+
+// postgresDSN skips the test unless a PostgreSQL server has been provided
+func postgresDSN(t *testing.T) string {
+	t.Helper()
+
+	dsn := os.Getenv(postgresDSNEnvVar)
+	if dsn == "" {
+		t.Skipf("%s not set", postgresDSNEnvVar)
+	}
+	return dsn
+}
+
+// newPostgresDB returns a connection to a migrated schema used only by the calling test
+func newPostgresDB(t *testing.T, dsn string) *sql.DB {
+	t.Helper()
+	ctx := context.Background()
+
+	// isolate each test in its own schema
+	admin, err := db.OpenPostgres(ctx, config.DBConfig{Driver: db.DriverPostgres, DSN: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.ExecContext(ctx, fmt.Sprintf("CREATE SCHEMA %s", schema)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.ExecContext(ctx, fmt.Sprintf("DROP SCHEMA %s CASCADE", schema)) })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	conn, err := db.OpenPostgres(ctx, config.DBConfig{Driver: db.DriverPostgres, DSN: u.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	migrate(t, conn)
+	return conn
+}
+
+func migrate(t *testing.T, conn *sql.DB) {
+	t.Helper()
+
+	migrator, err := db.NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
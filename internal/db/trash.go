@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RunTrashPurge permanently removes posts that have been in the trash for longer than retention,
+// checking every interval and blocking until ctx is cancelled
+func RunTrashPurge(ctx context.Context, svc BlogService, retention, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	purge := func() {
+		n, err := svc.PurgeDeletedBlogPosts(ctx, time.Now().Add(-retention))
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("failed to purge deleted posts", "error", err, "location", "RunTrashPurge")
+			}
+			return
+		}
+		if n > 0 {
+			logger.Info("purged deleted posts", "count", n)
+		}
+	}
+
+	purge()
+	for {
+		select {
+		case <-ticker.C:
+			purge()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+func TestRunTrashPurge(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewInMemoryBlogService()
+
+	var posts []*model.BlogPost
+	for _, title := range []string{"expired", "recent"} {
+		post := &model.BlogPost{Title: title}
+		if err := s.CreateBlogPost(context.Background(), "0197aaed-4a35-74da-8574-4165524a1111", post); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.DeleteBlogPost(context.Background(), "0197aaed-4a35-74da-8574-4165524a1111", post.ID, AnyVersion); err != nil {
+			t.Fatal(err)
+		}
+		posts = append(posts, post)
+	}
+
+	// backdate the first deletion past the retention period
+	expired := s.m[posts[0].ID]
+	expired.DeletedTS = time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	s.m[expired.ID] = expired
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunTrashPurge(ctx, s, 24*time.Hour, time.Hour, logger)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the first purge runs immediately rather than waiting for the interval
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := s.FetchDeletedBlogPost(context.Background(), posts[0].ID)
+		if errors.Is(err, ErrEntityNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v, want expired post to be purged", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := s.FetchDeletedBlogPost(context.Background(), posts[1].ID); err != nil {
+		t.Errorf("got %v, want recently deleted post kept", err)
+	}
+}
+
+func TestPurgeDeletedBlogPostsMalformedTimestamp(t *testing.T) {
+	var logs bytes.Buffer
+	s := NewInMemoryBlogService()
+	s.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	post := &model.BlogPost{Title: "corrupt"}
+	if err := s.CreateBlogPost(context.Background(), "0197aaed-4a35-74da-8574-4165524a1111", post); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteBlogPost(context.Background(), "0197aaed-4a35-74da-8574-4165524a1111", post.ID, AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := s.m[post.ID]
+	corrupt.DeletedTS = "not a timestamp"
+	s.m[post.ID] = corrupt
+
+	n, err := s.PurgeDeletedBlogPosts(context.Background(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("got %d purged, want %d", n, 0)
+	}
+	if _, err := s.FetchDeletedBlogPost(context.Background(), post.ID); err != nil {
+		t.Errorf("got %v, want post with a malformed timestamp kept", err)
+	}
+	if !strings.Contains(logs.String(), post.ID) {
+		t.Errorf("got logs %q, want the skipped post logged", logs.String())
+	}
+}
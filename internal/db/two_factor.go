@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recoveryCodeCount is how many recovery codes a user is given when they enable two-factor authentication
+const recoveryCodeCount = 10
+
+var (
+	// ErrTwoFactorEnabled is returned when enrolling a user who already has two-factor authentication enabled
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTOTPCodeReused is returned when a code from the same or an earlier time step has already been accepted
+	ErrTOTPCodeReused = errors.New("TOTP code has already been used")
+	// ErrInvalidRecoveryCode is returned when a recovery code is unknown or has already been used
+	ErrInvalidRecoveryCode = errors.New("invalid recovery code")
+)
+
+// TOTPEnrollment is a user's TOTP secret, which only guards their logins once confirmed with a code from it
+type TOTPEnrollment struct {
+	UserID string
+	// Secret is stored as is, as it is needed to check codes
+	Secret      string
+	CreatedTS   time.Time
+	ConfirmedTS *time.Time
+	// LastUsedStep is the time step of the last code accepted, so that a code cannot be used twice
+	LastUsedStep int64
+}
+
+// Enabled reports whether the enrollment has been confirmed
+func (e *TOTPEnrollment) Enabled() bool {
+	return e.ConfirmedTS != nil
+}
+
+// NewRecoveryCodes generates a set of recovery codes to show the user once, along with the hashes to store
+func NewRecoveryCodes() (codes, hashes []string, err error) {
+	for range recoveryCodeCount {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("error generating recovery code: %w", err)
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		// grouped to be easier to write down
+		code = code[:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the stored form of a recovery code, ignoring case and how it is grouped
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashRefreshToken(code)
+}
+
+// TwoFactorService stores the TOTP secrets and recovery codes of users with two-factor authentication
+type TwoFactorService interface {
+	// CreateTOTPEnrollment stores an unconfirmed secret for the user, replacing any earlier unconfirmed one, or
+	// fails with ErrTwoFactorEnabled
+	CreateTOTPEnrollment(ctx context.Context, enrollment *TOTPEnrollment) error
+	// FetchTOTPEnrollment returns the user's enrollment, or fails with ErrEntityNotFound if they have none
+	FetchTOTPEnrollment(ctx context.Context, userID string) (*TOTPEnrollment, error)
+	// ConfirmTOTPEnrollment enables two-factor authentication for the user, recording step as used and storing the
+	// hashes of their recovery codes. Fails with ErrEntityNotFound if the user has not enrolled, or
+	// ErrTwoFactorEnabled if they already confirmed.
+	ConfirmTOTPEnrollment(ctx context.Context, userID string, confirmedTS time.Time, step int64, recoveryCodeHashes []string) error
+	// UseTOTPStep records that a code from step has been accepted for the user, or fails with ErrTOTPCodeReused if
+	// one from the same or a later step already has
+	UseTOTPStep(ctx context.Context, userID string, step int64) error
+	// UseRecoveryCode uses up the user's recovery code with the given hash, or fails with ErrInvalidRecoveryCode
+	UseRecoveryCode(ctx context.Context, userID, hash string, usedTS time.Time) error
+	// DeleteTOTPEnrollment disables two-factor authentication for the user, deleting their recovery codes, or fails
+	// with ErrEntityNotFound if they have not enrolled
+	DeleteTOTPEnrollment(ctx context.Context, userID string) error
+}
+
+// InMemoryTwoFactorService implements TwoFactorService for the in-memory data store
+type InMemoryTwoFactorService struct {
+	mu sync.Mutex
+	// enrollments maps user ID to enrollment
+	enrollments map[string]*TOTPEnrollment
+	// recoveryCodes maps user ID to the hashes of their unused recovery codes
+	recoveryCodes map[string]map[string]bool
+}
+
+func NewInMemoryTwoFactorService() *InMemoryTwoFactorService {
+	return &InMemoryTwoFactorService{
+		enrollments:   map[string]*TOTPEnrollment{},
+		recoveryCodes: map[string]map[string]bool{},
+	}
+}
+
+func (s *InMemoryTwoFactorService) CreateTOTPEnrollment(ctx context.Context, enrollment *TOTPEnrollment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.enrollments[enrollment.UserID]; ok && existing.Enabled() {
+		return ErrTwoFactorEnabled
+	}
+	e := *enrollment
+	e.ConfirmedTS = nil
+	e.LastUsedStep = 0
+	s.enrollments[enrollment.UserID] = &e
+	return nil
+}
+
+func (s *InMemoryTwoFactorService) FetchTOTPEnrollment(ctx context.Context, userID string) (*TOTPEnrollment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, ok := s.enrollments[userID]
+	if !ok {
+		return nil, ErrEntityNotFound
+	}
+	e := *enrollment
+	if enrollment.ConfirmedTS != nil {
+		confirmed := *enrollment.ConfirmedTS
+		e.ConfirmedTS = &confirmed
+	}
+	return &e, nil
+}
+
+func (s *InMemoryTwoFactorService) ConfirmTOTPEnrollment(ctx context.Context, userID string, confirmedTS time.Time, step int64, recoveryCodeHashes []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, ok := s.enrollments[userID]
+	if !ok {
+		return ErrEntityNotFound
+	}
+	if enrollment.Enabled() {
+		return ErrTwoFactorEnabled
+	}
+
+	confirmedTS = confirmedTS.UTC().Truncate(time.Second)
+	enrollment.ConfirmedTS = &confirmedTS
+	enrollment.LastUsedStep = step
+
+	codes := map[string]bool{}
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = true
+	}
+	s.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (s *InMemoryTwoFactorService) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, ok := s.enrollments[userID]
+	if !ok {
+		return ErrEntityNotFound
+	}
+	if step <= enrollment.LastUsedStep {
+		return ErrTOTPCodeReused
+	}
+	enrollment.LastUsedStep = step
+	return nil
+}
+
+func (s *InMemoryTwoFactorService) UseRecoveryCode(ctx context.Context, userID, hash string, usedTS time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.recoveryCodes[userID][hash] {
+		return ErrInvalidRecoveryCode
+	}
+	delete(s.recoveryCodes[userID], hash)
+	return nil
+}
+
+func (s *InMemoryTwoFactorService) DeleteTOTPEnrollment(ctx context.Context, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.enrollments[userID]; !ok {
+		return ErrEntityNotFound
+	}
+	delete(s.enrollments, userID)
+	delete(s.recoveryCodes, userID)
+	return nil
+}
@@ -1,78 +1,462 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
 
-	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/James-D-Wood/blog-api/internal/config"
 	"github.com/James-D-Wood/blog-api/internal/model"
 	"github.com/google/uuid"
 )
 
-// DefaultUserMap establishes our list of dummy users
+// DefaultUserMap establishes our list of dummy users, used by the in-memory data store when no users are
+// configured. Their passwords are public, so they are never added to a database. Their IDs are
+// fixed so posts stay owned by the same user across restarts.
 //
-// | Username  | Password    | Is Admin |
-// | --------- | ----------- | -------- |
-// | kishiguro | hailsham    | false    |
-// | dsedaris  | emeraldIsle | false    |
-// | admin     | password    | true     |
+// | Username  | Password    | Role   |
+// | --------- | ----------- | ------ |
+// | kishiguro | hailsham    | author |
+// | dsedaris  | emeraldIsle | author |
+// | admin     | password    | admin  |
 var DefaultUserMap = map[string]*model.User{
 	"kishiguro": {
-		ID:       assignUUID(),
-		Username: "kishiguro",
-		Name:     "Kazuo Ishiguro",
-		IsAdmin:  false,
+		ID:           "0197aaed-4a35-74da-8574-4165524a1111",
+		Username:     "kishiguro",
+		Name:         "Kazuo Ishiguro",
+		Role:         model.RoleAuthor,
+		PasswordHash: "$2a$10$WlvzmRxzWKxNJgbHV31nz.dq50Mb67aJPqxkz1M27hPvRm5J9NrUC",
 	},
 	"dsedaris": {
-		ID:       assignUUID(),
-		Username: "dsedaris",
-		Name:     "David Sedaris",
-		IsAdmin:  false,
+		ID:           "0197aaed-4a35-74da-8574-4165524a2222",
+		Username:     "dsedaris",
+		Name:         "David Sedaris",
+		Role:         model.RoleAuthor,
+		PasswordHash: "$2a$10$SIji74zvVCwXxUN5yU0cW.0fbFJTxYAlXEdTniaXN41Veo63CVmiC",
 	},
 	"admin": {
-		ID:       assignUUID(),
-		Username: "admin",
-		Name:     "James Wood",
-		IsAdmin:  true,
+		ID:           "0197aaed-4a35-74da-8574-4165524a3333",
+		Username:     "admin",
+		Name:         "James Wood",
+		Role:         model.RoleAdmin,
+		PasswordHash: "$2a$10$.TATrkvBjvGWCgNRxrRTduBIiKgfZH3cLaph/DgbtoRO8sChoNt3O",
 	},
 }
 
+// NewUserMap builds a user map from configured users, rejecting any without a valid password hash
+func NewUserMap(users []config.UserConfig) (map[string]*model.User, error) {
+	m := make(map[string]*model.User, len(users))
+	for _, u := range users {
+		if u.Username == "" {
+			return nil, errors.New("configured user is missing a username")
+		}
+		if _, ok := m[u.Username]; ok {
+			return nil, fmt.Errorf("user %q is configured more than once", u.Username)
+		}
+		if err := validatePasswordHash(u.PasswordHash); err != nil {
+			return nil, fmt.Errorf("user %q: %w", u.Username, err)
+		}
+		role := model.DefaultRole
+		if u.Role != "" {
+			var err error
+			if role, err = model.ParseRole(u.Role); err != nil {
+				return nil, fmt.Errorf("user %q: %w", u.Username, err)
+			}
+		}
+
+		m[u.Username] = &model.User{
+			ID:           configuredUserID(u.Username),
+			Username:     u.Username,
+			Name:         u.Name,
+			Role:         role,
+			PasswordHash: u.PasswordHash,
+		}
+	}
+	return m, nil
+}
+
 func assignUUID() string {
 	i, _ := uuid.NewV7()
 	return i.String()
 }
 
+// configuredUsersNamespace derives IDs for configured users
+var configuredUsersNamespace = uuid.MustParse("5d0c1b6e-3a57-4c1e-9a43-2f7f3c9f1e0b")
+
+// configuredUserID returns a stable ID for a configured user so their posts stay theirs across restarts
+// of the in-memory store
+func configuredUserID(username string) string {
+	return uuid.NewSHA1(configuredUsersNamespace, []byte(username)).String()
+}
+
+var (
+	// ErrUserAlreadyExists is returned when creating a user whose username is taken
+	ErrUserAlreadyExists = errors.New("username is already taken")
+	// ErrInvalidUsername is returned when a username does not match usernamePattern
+	ErrInvalidUsername = errors.New("usernames must be 3 to 32 lowercase letters, digits, '.', '_' or '-'")
+	// ErrInvalidName is returned when a display name is empty or too long
+	ErrInvalidName = errors.New("names must be between 1 and 64 characters")
+	// ErrIdentityAlreadyLinked is returned when an external identity already belongs to a user
+	ErrIdentityAlreadyLinked = errors.New("identity is already linked to a user")
+	// ErrInvalidEmail is returned when an email address cannot be parsed, or has a display name
+	ErrInvalidEmail = errors.New("invalid email address")
+	// ErrEmailAlreadyInUse is returned when storing a user with an email address another user has
+	ErrEmailAlreadyInUse = errors.New("email address is already in use")
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9._-]{3,32}$`)
+
+// NewUser validates the details of a new account with the default role and hashes its password, ready to
+// be passed to UserService.CreateUser
+func NewUser(username, name, password string) (*model.User, error) {
+	user, err := NewExternalUser(username, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ValidatePassword(user.Username, password); err != nil {
+		return nil, err
+	}
+
+	user.PasswordHash, err = HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// NewExternalUser validates the details of an account that logs in through an identity provider, ready to be
+// passed to UserService.CreateExternalUser. Without a password it can never log in with one.
+func NewExternalUser(username, name string) (*model.User, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 64 {
+		return nil, ErrInvalidName
+	}
+
+	return &model.User{Username: username, Name: name, Role: model.DefaultRole}, nil
+}
+
+// NormalizeEmail validates a bare email address, ie: kazuo@example.com, returning it in the form it is stored
+// and looked up in
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || utf8.RuneCountInString(email) > 254 {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(email), nil
+}
+
 // UserService is an abstraction over database actions that can take place on behalf of a user
 type UserService interface {
-	AuthenticateUser(id, password string) (string, error)
+	// AuthenticateUser returns the user with the given username, or ErrInvalidCredentials if the password does not match
+	AuthenticateUser(username, password string) (*model.User, error)
 	FetchUser(username string) (*model.User, error)
+	// FetchUserByID returns the user with the given ID, or ErrEntityNotFound
+	FetchUserByID(ctx context.Context, id string) (*model.User, error)
+	// FetchUserByEmail returns the user with the given email address, or ErrEntityNotFound
+	FetchUserByEmail(ctx context.Context, email string) (*model.User, error)
+	// CreateUser stores a new user, assigning its ID, or fails with ErrUserAlreadyExists or ErrEmailAlreadyInUse
+	CreateUser(ctx context.Context, user *model.User) error
+	// UpdateUser replaces the name, role, password and email of the user with user.ID - usernames cannot change.
+	// Fails with ErrEmailAlreadyInUse if another user has the email address.
+	UpdateUser(ctx context.Context, user *model.User) error
+	// ListUsers returns every user ordered by username
+	ListUsers(ctx context.Context) ([]model.User, error)
+	// SuspendUser stops the user with id from logging in until ReactivateUser, also hiding their posts if
+	// hidePosts is set. Fails with ErrEntityNotFound.
+	SuspendUser(ctx context.Context, id string, hidePosts bool) error
+	// ReactivateUser lifts the suspension of the user with id and shows their posts again, or fails with
+	// ErrEntityNotFound
+	ReactivateUser(ctx context.Context, id string) error
+	// DeleteUser permanently removes the user with id along with their linked identities, or fails with
+	// ErrEntityNotFound. Their posts are left for the caller to deal with.
+	DeleteUser(ctx context.Context, id string) error
+	// FetchHiddenAuthorIDs returns the IDs of the suspended users whose posts are hidden
+	FetchHiddenAuthorIDs(ctx context.Context) ([]string, error)
+	// FetchUserByIdentity returns the user linked to the subject of an external identity provider, or ErrEntityNotFound
+	FetchUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error)
+	// CreateExternalUser stores a new user linked to the subject of an external identity provider, assigning its
+	// ID. It fails with ErrUserAlreadyExists if the username is taken, or ErrIdentityAlreadyLinked if the identity
+	// belongs to another user, in which case nothing is stored.
+	CreateExternalUser(ctx context.Context, user *model.User, issuer, subject string) error
 }
 
 // InMemoryUserService implements UserService to mock user login functionality that would otherwise be handled by an auth service
 type InMemoryUserService struct {
+	mu sync.RWMutex
 	// Users maps username to user details
 	Users map[string]*model.User
+	// identities maps external identities to user ID
+	identities map[identityKey]string
 }
 
-// AuthenticateUser returns a JWTToken representing the user
-func (s *InMemoryUserService) AuthenticateUser(username, password string) (string, error) {
-	// a password check is not being executed here as this is just simulating what an auth service may return
-	user, err := s.FetchUser(username)
-	if err != nil {
-		return "", fmt.Errorf("error authenticating user: %s", err)
-	}
-
-	token, err := httputils.GenerateJWT(user)
-	if err != nil {
-		return "", fmt.Errorf("error generating JWT for user: %s", err)
-	}
+type identityKey struct {
+	issuer, subject string
+}
 
-	return token, nil
+// AuthenticateUser returns the user, or ErrInvalidCredentials if the username and password do not match
+func (s *InMemoryUserService) AuthenticateUser(username, password string) (*model.User, error) {
+	return authenticateUser(s, username, password)
 }
 
 // FetchUser returns a user by username
 func (s *InMemoryUserService) FetchUser(username string) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if user, ok := s.Users[username]; ok {
-		return user, nil
+		// copy so callers cannot modify the stored user
+		u := *user
+		return &u, nil
 	}
 	return nil, ErrEntityNotFound
 }
+
+func (s *InMemoryUserService) FetchUserByID(ctx context.Context, id string) (*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.Users {
+		if user.ID == id {
+			u := *user
+			return &u, nil
+		}
+	}
+	return nil, ErrEntityNotFound
+}
+
+func (s *InMemoryUserService) FetchUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.Users {
+		if email != "" && user.Email == email {
+			u := *user
+			return &u, nil
+		}
+	}
+	return nil, ErrEntityNotFound
+}
+
+// emailInUse reports whether a user other than the one with exceptID has email. It must be called with s.mu held.
+func (s *InMemoryUserService) emailInUse(email, exceptID string) bool {
+	if email == "" {
+		return false
+	}
+	for _, user := range s.Users {
+		if user.Email == email && user.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *InMemoryUserService) CreateUser(ctx context.Context, user *model.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createUser(user)
+}
+
+// createUser must be called with s.mu held
+func (s *InMemoryUserService) createUser(user *model.User) error {
+	if _, ok := s.Users[user.Username]; ok {
+		return ErrUserAlreadyExists
+	}
+	if s.emailInUse(user.Email, "") {
+		return ErrEmailAlreadyInUse
+	}
+	if s.Users == nil {
+		s.Users = map[string]*model.User{}
+	}
+
+	user.ID = assignUUID()
+	u := *user
+	s.Users[user.Username] = &u
+	return nil
+}
+
+func (s *InMemoryUserService) FetchUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	id, ok := s.identities[identityKey{issuer, subject}]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrEntityNotFound
+	}
+	return s.FetchUserByID(ctx, id)
+}
+
+func (s *InMemoryUserService) CreateExternalUser(ctx context.Context, user *model.User, issuer, subject string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey{issuer, subject}
+	if _, ok := s.identities[key]; ok {
+		return ErrIdentityAlreadyLinked
+	}
+	if err := s.createUser(user); err != nil {
+		return err
+	}
+
+	if s.identities == nil {
+		s.identities = map[identityKey]string{}
+	}
+	s.identities[key] = user.ID
+	return nil
+}
+
+func (s *InMemoryUserService) UpdateUser(ctx context.Context, user *model.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.Users {
+		if stored.ID == user.ID {
+			if s.emailInUse(user.Email, user.ID) {
+				return ErrEmailAlreadyInUse
+			}
+			stored.Name = user.Name
+			stored.Role = user.Role
+			stored.PasswordHash = user.PasswordHash
+			stored.Email = user.Email
+			stored.EmailVerified = user.EmailVerified
+			user.Username = stored.Username
+			return nil
+		}
+	}
+	return ErrEntityNotFound
+}
+
+func (s *InMemoryUserService) ListUsers(ctx context.Context) ([]model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]model.User, 0, len(s.Users))
+	for _, user := range s.Users {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+func (s *InMemoryUserService) SuspendUser(ctx context.Context, id string, hidePosts bool) error {
+	return s.setSuspended(ctx, id, true, hidePosts)
+}
+
+func (s *InMemoryUserService) ReactivateUser(ctx context.Context, id string) error {
+	return s.setSuspended(ctx, id, false, false)
+}
+
+func (s *InMemoryUserService) setSuspended(ctx context.Context, id string, suspended, hidePosts bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.Users {
+		if user.ID == id {
+			user.Suspended = suspended
+			user.PostsHidden = hidePosts
+			return nil
+		}
+	}
+	return ErrEntityNotFound
+}
+
+func (s *InMemoryUserService) DeleteUser(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for username, user := range s.Users {
+		if user.ID == id {
+			delete(s.Users, username)
+			for key, userID := range s.identities {
+				if userID == id {
+					delete(s.identities, key)
+				}
+			}
+			return nil
+		}
+	}
+	return ErrEntityNotFound
+}
+
+func (s *InMemoryUserService) FetchHiddenAuthorIDs(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []string{}
+	for _, user := range s.Users {
+		if user.PostsHidden {
+			ids = append(ids, user.ID)
+		}
+	}
+	return ids, nil
+}
+
+// authenticateUser checks password against the stored hash of the user fetched from svc
+func authenticateUser(svc UserService, username, password string) (*model.User, error) {
+	user, err := svc.FetchUser(username)
+	if err != nil {
+		if !errors.Is(err, ErrEntityNotFound) {
+			return nil, fmt.Errorf("error authenticating user: %w", err)
+		}
+		// still check a password so unknown users cannot be told apart by timing
+		user = &model.User{}
+	}
+	if err := checkPassword(user.PasswordHash, password); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+	"github.com/James-D-Wood/blog-api/internal/model"
+)
+
+func TestInMemoryAuthenticateUser(t *testing.T) {
+	hash, err := HashPassword("hailsham")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &InMemoryUserService{
+		Users: map[string]*model.User{
+			"kishiguro": {ID: assignUUID(), Username: "kishiguro", PasswordHash: hash},
+			"nopass":    {ID: assignUUID(), Username: "nopass"},
+		},
+	}
+
+	tests := []struct {
+		Name     string
+		Username string
+		Password string
+		Err      error
+	}{
+		{"Correct Password", "kishiguro", "hailsham", nil},
+		{"Wrong Password", "kishiguro", "password", ErrInvalidCredentials},
+		{"Empty Password", "kishiguro", "", ErrInvalidCredentials},
+		{"Unknown User", "nobody", "hailsham", ErrInvalidCredentials},
+		{"User Without Password", "nopass", "", ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			user, err := svc.AuthenticateUser(tt.Username, tt.Password)
+			if !errors.Is(err, tt.Err) {
+				t.Fatalf("got %v, want %v", err, tt.Err)
+			}
+			if tt.Err == nil && user.Username != tt.Username {
+				t.Errorf("got %q, want %q", user.Username, tt.Username)
+			}
+		})
+	}
+}
+
+func TestDefaultUserMapPasswords(t *testing.T) {
+	// the documented demo passwords must keep working
+	svc := &InMemoryUserService{Users: DefaultUserMap}
+	for username, password := range map[string]string{
+		"kishiguro": "hailsham",
+		"dsedaris":  "emeraldIsle",
+		"admin":     "password",
+	} {
+		if _, err := svc.AuthenticateUser(username, password); err != nil {
+			t.Errorf("got %v logging in as %s, want nil", err, username)
+		}
+	}
+}
+
+func TestNewUserMap(t *testing.T) {
+	hash, err := HashPassword("hailsham")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name    string
+		Users   []config.UserConfig
+		WantErr bool
+	}{
+		{"Valid", []config.UserConfig{{Username: "kishiguro", PasswordHash: hash}, {Username: "admin", PasswordHash: hash, Role: "admin"}}, false},
+		{"Unknown Role", []config.UserConfig{{Username: "admin", PasswordHash: hash, Role: "superuser"}}, true},
+		{"Plain Text Password", []config.UserConfig{{Username: "kishiguro", PasswordHash: "hailsham"}}, true},
+		{"Missing Password", []config.UserConfig{{Username: "kishiguro"}}, true},
+		{"Missing Username", []config.UserConfig{{PasswordHash: hash}}, true},
+		{"Duplicate Username", []config.UserConfig{{Username: "kishiguro", PasswordHash: hash}, {Username: "kishiguro", PasswordHash: hash}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			users, err := NewUserMap(tt.Users)
+			if (err != nil) != tt.WantErr {
+				t.Fatalf("got %v, want error: %t", err, tt.WantErr)
+			}
+			if err == nil && len(users) != len(tt.Users) {
+				t.Errorf("got %d users, want %d", len(users), len(tt.Users))
+			}
+		})
+	}
+}
+
+func TestNewUser(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Username string
+		UserName string
+		Password string
+		Err      error
+	}{
+		{"Valid", "kishiguro", "Kazuo Ishiguro", "klara and the sun", nil},
+		{"Username Normalized", "  KIshiguro ", "Kazuo Ishiguro", "klara and the sun", nil},
+		{"Username Too Short", "ki", "Kazuo Ishiguro", "klara and the sun", ErrInvalidUsername},
+		{"Username Invalid Characters", "k ishiguro", "Kazuo Ishiguro", "klara and the sun", ErrInvalidUsername},
+		{"Missing Name", "kishiguro", "  ", "klara and the sun", ErrInvalidName},
+		{"Password Too Short", "kishiguro", "Kazuo Ishiguro", "klara", ErrWeakPassword},
+		{"Password Too Long", "kishiguro", "Kazuo Ishiguro", strings.Repeat("a", 73), ErrWeakPassword},
+		{"Password Contains Username", "kishiguro", "Kazuo Ishiguro", "KIshiguro123", ErrWeakPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			user, err := NewUser(tt.Username, tt.UserName, tt.Password)
+			if !errors.Is(err, tt.Err) {
+				t.Fatalf("got %v, want %v", err, tt.Err)
+			}
+			if err != nil {
+				return
+			}
+			if user.Username != "kishiguro" {
+				t.Errorf("got Username %q, want %q", user.Username, "kishiguro")
+			}
+			if user.Role != model.DefaultRole {
+				t.Errorf("got Role %q, want %q", user.Role, model.DefaultRole)
+			}
+			if err := checkPassword(user.PasswordHash, tt.Password); err != nil {
+				t.Errorf("got %v checking the password, want nil", err)
+			}
+		})
+	}
+}
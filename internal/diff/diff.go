@@ -0,0 +1,95 @@
+// Package diff computes line based differences between two versions of a text
+package diff
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxLines is the most lines either side of a diff may have, as the memory needed grows with the product of the two
+const MaxLines = 2000
+
+var ErrTooLarge = errors.New("text has too many lines to diff")
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Line is a single line of a diff and how it changed
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns the edits that turn a into b using the longest common subsequence of their lines, or
+// ErrTooLarge if either has more than MaxLines lines
+func Lines(a, b string) ([]Line, error) {
+	if a == b && a == "" {
+		return []Line{}, nil
+	}
+
+	as, bs := split(a), split(b)
+	if len(as) > MaxLines || len(bs) > MaxLines {
+		return nil, ErrTooLarge
+	}
+
+	// lcs[i][j] holds the length of the longest common subsequence of as[i:] and bs[j:]
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := []Line{}
+	i, j := 0, 0
+	for i < len(as) && j < len(bs) {
+		switch {
+		case as[i] == bs[j]:
+			lines = append(lines, Line{Op: Equal, Text: as[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Op: Delete, Text: as[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: Insert, Text: bs[j]})
+			j++
+		}
+	}
+	for ; i < len(as); i++ {
+		lines = append(lines, Line{Op: Delete, Text: as[i]})
+	}
+	for ; j < len(bs); j++ {
+		lines = append(lines, Line{Op: Insert, Text: bs[j]})
+	}
+	return lines, nil
+}
+
+// Changed reports whether a diff contains any insertions or deletions
+func Changed(lines []Line) bool {
+	for _, l := range lines {
+		if l.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
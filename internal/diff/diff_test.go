@@ -0,0 +1,78 @@
+package diff
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var linesTestCases = []struct {
+	Name string
+	A, B string
+	Want []Line
+}{
+	{
+		Name: "Identical",
+		A:    "one\ntwo",
+		B:    "one\ntwo",
+		Want: []Line{{Equal, "one"}, {Equal, "two"}},
+	},
+	{
+		Name: "Both Empty",
+		Want: []Line{},
+	},
+	{
+		Name: "From Empty",
+		B:    "one\ntwo",
+		Want: []Line{{Insert, "one"}, {Insert, "two"}},
+	},
+	{
+		Name: "To Empty",
+		A:    "one",
+		Want: []Line{{Delete, "one"}},
+	},
+	{
+		Name: "Line Changed",
+		A:    "one\ntwo\nthree",
+		B:    "one\n2\nthree",
+		Want: []Line{{Equal, "one"}, {Delete, "two"}, {Insert, "2"}, {Equal, "three"}},
+	},
+	{
+		Name: "Lines Added And Removed",
+		A:    "a\nb\nc\nd",
+		B:    "b\nc\ne\nd\nf",
+		Want: []Line{{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Insert, "e"}, {Equal, "d"}, {Insert, "f"}},
+	},
+}
+
+func TestLines(t *testing.T) {
+	for _, tt := range linesTestCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			got, err := Lines(tt.A, tt.B)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.Want) {
+				t.Errorf("got %v, want %v", got, tt.Want)
+			}
+			if Changed(got) != (tt.A != tt.B) {
+				t.Errorf("got Changed %v, want %v", Changed(got), tt.A != tt.B)
+			}
+		})
+	}
+}
+
+func TestLinesTooLarge(t *testing.T) {
+	large := strings.Repeat("line\n", MaxLines)
+
+	if _, err := Lines("one", large); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want %v", err, ErrTooLarge)
+	}
+	if _, err := Lines(large, ""); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want %v", err, ErrTooLarge)
+	}
+	if _, err := Lines(strings.TrimSuffix(large, "\n"), "one"); err != nil {
+		t.Errorf("got %v diffing %d lines, want no error", err, MaxLines)
+	}
+}
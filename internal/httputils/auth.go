@@ -1,21 +1,39 @@
 package httputils
 
 import (
-	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
-	"github.com/James-D-Wood/blog-api/internal/constant"
 	"github.com/James-D-Wood/blog-api/internal/model"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-// this is insecure - ideally this secret should be managed by another secret management service
-var HMACSecret = []byte("7e59e2c4-51a1-11f0-a636-de64e30f34bb")
+// TokenSettings are the registered claims issued in, and required of, access tokens
+type TokenSettings struct {
+	Issuer   string
+	Audience string
+	// TTL is how long an access token is valid for
+	TTL time.Duration
+}
+
+// AccessTokens configures the tokens issued by GenerateJWT and accepted by ExtractJWTClaims
+var AccessTokens = TokenSettings{
+	Issuer:   "blog-api",
+	Audience: "blog-api",
+	TTL:      15 * time.Minute,
+}
+
+// ChallengeTokenTTL is how long a user has to enter their second factor after their password
+const ChallengeTokenTTL = 5 * time.Minute
+
+// clockSkew is how far the clocks of the servers issuing and accepting tokens may disagree
+const clockSkew = 30 * time.Second
 
 var (
 	ErrAuthHeaderMissing = errors.New("no Authorization header provided")
@@ -24,8 +42,24 @@ var (
 )
 
 type AuthClaims struct {
-	UserID  string `json:"user_id"`
-	IsAdmin bool   `json:"is_admin"`
+	UserID string     `json:"user_id"`
+	Role   model.Role `json:"role"`
+	// TokenID identifies the token so that it can be revoked
+	TokenID string `json:"jti"`
+	// SessionID is the family of refresh tokens issued alongside the token, so logging out can revoke them too
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// ChallengeClaims are the claims of the challenge token issued when a user with two-factor authentication
+// enabled logs in with their password
+type ChallengeClaims struct {
+	UserID string `json:"user_id"`
+	// TokenID identifies the token so that it can be revoked once used
+	TokenID   string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
 }
 
 func DecodeBasicAuth(r *http.Request) (username, password string, err error) {
@@ -44,12 +78,13 @@ func DecodeBasicAuth(r *http.Request) (username, password string, err error) {
 		return "", "", fmt.Errorf("problem decoding auth header: %s", err)
 	}
 
-	components := strings.Split(string(b), ":")
-	if len(components) != 2 {
-		return "", "", fmt.Errorf("found %d components in basic auth header - expected 2", len(components))
+	// usernames cannot contain a colon but passwords can, so only the first one separates them
+	username, password, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return "", "", errors.New("no colon separating username and password in basic auth header")
 	}
 
-	return components[0], components[1], nil
+	return username, password, nil
 }
 
 func DecodeBearerAuth(r *http.Request) (token string, err error) {
@@ -66,14 +101,34 @@ func DecodeBearerAuth(r *http.Request) (token string, err error) {
 	return token, nil
 }
 
-// ExtractJWTClaims verifies that the token was signed by this server and extracts claims about user ID
+// ExtractJWTClaims verifies that the token was signed with one of SigningKeys for this audience and has not expired,
+// and extracts claims about user ID
 func ExtractJWTClaims(token string, claims any) error {
-	jwtToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return HMACSecret, nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	return extractClaims(token, AccessTokens.Audience, claims)
+}
+
+// ExtractChallengeClaims verifies a challenge token issued by GenerateChallengeToken and extracts its claims
+func ExtractChallengeClaims(token string, claims *ChallengeClaims) error {
+	return extractClaims(token, challengeAudience(), claims)
+}
+
+// challengeAudience is the audience of challenge tokens, which keeps them from being accepted as access tokens
+func challengeAudience() string {
+	return AccessTokens.Audience + ":2fa"
+}
+
+func extractClaims(token, audience string, claims any) error {
+	jwtToken, err := jwt.Parse(token, SigningKeys.keyFunc,
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}),
+		jwt.WithIssuer(AccessTokens.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
 
 	if err != nil {
-		return fmt.Errorf("could not parse JWT token: %s", err)
+		return fmt.Errorf("could not parse JWT token: %w", err)
 	}
 
 	if jwtClaims, ok := jwtToken.Claims.(jwt.MapClaims); ok {
@@ -92,23 +147,32 @@ func ExtractJWTClaims(token string, claims any) error {
 	return nil
 }
 
-// this is insecure - ideally we should be expiring our JWTs
-func GenerateJWT(user *model.User) (string, error) {
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"user_id":  user.ID,
-			"is_admin": user.IsAdmin,
-		},
-	)
-
-	return token.SignedString(HMACSecret)
+// GenerateJWT issues an access token for user that expires after AccessTokens.TTL. sessionID is the family
+// of the refresh token issued alongside it.
+func GenerateJWT(user *model.User, sessionID string) (string, error) {
+	now := time.Now()
+	return SigningKeys.sign(jwt.MapClaims{
+		"user_id": user.ID,
+		"role":    user.Role,
+		"jti":     uuid.NewString(),
+		"sid":     sessionID,
+		"iss":     AccessTokens.Issuer,
+		"aud":     AccessTokens.Audience,
+		"iat":     now.Unix(),
+		"exp":     now.Add(AccessTokens.TTL).Unix(),
+	})
 }
 
-func GetUserFromContext(ctx context.Context) (user string, err error) {
-	userID, ok := ctx.Value(constant.UserIDKey).(string)
-	if !ok {
-		return "", errors.New("could not determine user from context")
-	}
-	return userID, nil
+// GenerateChallengeToken issues a challenge token for userID that expires after ChallengeTokenTTL, proving they
+// have entered their password but not yet their second factor
+func GenerateChallengeToken(userID string) (string, error) {
+	now := time.Now()
+	return SigningKeys.sign(jwt.MapClaims{
+		"user_id": userID,
+		"jti":     uuid.NewString(),
+		"iss":     AccessTokens.Issuer,
+		"aud":     challengeAudience(),
+		"iat":     now.Unix(),
+		"exp":     now.Add(ChallengeTokenTTL).Unix(),
+	})
 }
@@ -0,0 +1,175 @@
+package httputils
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestDecodeBasicAuth(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Header   string
+		Username string
+		Password string
+		Err      bool
+	}{
+		{Name: "Valid", Header: "Basic " + base64.StdEncoding.EncodeToString([]byte("kishiguro:secret")), Username: "kishiguro", Password: "secret"},
+		{Name: "Colon In Password", Header: "Basic " + base64.StdEncoding.EncodeToString([]byte("kishiguro:a:b::c")), Username: "kishiguro", Password: "a:b::c"},
+		{Name: "Empty Password", Header: "basic " + base64.StdEncoding.EncodeToString([]byte("kishiguro:")), Username: "kishiguro"},
+		{Name: "No Colon", Header: "Basic " + base64.StdEncoding.EncodeToString([]byte("kishiguro")), Err: true},
+		{Name: "Not Base64", Header: "Basic !!!", Err: true},
+		{Name: "Bearer", Header: "Bearer token", Err: true},
+		{Name: "Missing", Err: true},
+	}
+
+	for _, tt := range tt {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/login", nil)
+			if tt.Header != "" {
+				req.Header.Set("Authorization", tt.Header)
+			}
+
+			username, password, err := DecodeBasicAuth(req)
+			if (err != nil) != tt.Err {
+				t.Fatalf("got error %v, want error %v", err, tt.Err)
+			}
+			if username != tt.Username || password != tt.Password {
+				t.Errorf("got %q:%q, want %q:%q", username, password, tt.Username, tt.Password)
+			}
+		})
+	}
+}
+
+func TestExtractJWTClaims(t *testing.T) {
+	user := &model.User{ID: "0197aaed-4a35-74da-8574-4165524a1111", Role: model.RoleEditor}
+
+	sign := func(claims jwt.MapClaims) string {
+		token, err := SigningKeys.sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	// validClaims returns the claims GenerateJWT issues, with overrides applied
+	validClaims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		now := time.Now()
+		claims := jwt.MapClaims{
+			"user_id": user.ID,
+			"role":    user.Role,
+			"jti":     "0197aaed-4a35-74da-8574-4165524a9999",
+			"iss":     AccessTokens.Issuer,
+			"aud":     AccessTokens.Audience,
+			"iat":     now.Unix(),
+			"exp":     now.Add(time.Minute).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(claims, k)
+				continue
+			}
+			claims[k] = v
+		}
+		return claims
+	}
+
+	generated, err := GenerateJWT(user, "0197aaed-4a35-74da-8574-4165524a8888")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name    string
+		Token   string
+		WantErr bool
+	}{
+		{"Generated", generated, false},
+		{"Valid", sign(validClaims(nil)), false},
+		{"Expired", sign(validClaims(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})), true},
+		{"No Expiry", sign(validClaims(jwt.MapClaims{"exp": nil})), true},
+		{"Issued In The Future", sign(validClaims(jwt.MapClaims{"iat": time.Now().Add(time.Hour).Unix()})), true},
+		{"Wrong Issuer", sign(validClaims(jwt.MapClaims{"iss": "someone-else"})), true},
+		{"Wrong Audience", sign(validClaims(jwt.MapClaims{"aud": "another-api"})), true},
+		{"No Audience", sign(validClaims(jwt.MapClaims{"aud": nil})), true},
+		{"Not Signed By Us", func() string {
+			// same key ID, different secret
+			token, _ := NewEphemeralKeySet().sign(validClaims(nil))
+			return token
+		}(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			var claims AuthClaims
+			err := ExtractJWTClaims(tt.Token, &claims)
+			if (err != nil) != tt.WantErr {
+				t.Fatalf("got %v, want error: %t", err, tt.WantErr)
+			}
+			if err == nil && (claims.UserID != user.ID || claims.Role != user.Role || claims.TokenID == "") {
+				t.Errorf("got %+v, want identified claims about %+v", claims, *user)
+			}
+		})
+	}
+}
+
+func TestGenerateJWTSession(t *testing.T) {
+	user := &model.User{ID: "0197aaed-4a35-74da-8574-4165524a1111"}
+
+	first, err := GenerateJWT(user, "0197aaed-4a35-74da-8574-4165524a8888")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateJWT(user, "0197aaed-4a35-74da-8574-4165524a8888")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var firstClaims, secondClaims AuthClaims
+	if err := ExtractJWTClaims(first, &firstClaims); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtractJWTClaims(second, &secondClaims); err != nil {
+		t.Fatal(err)
+	}
+
+	if firstClaims.SessionID != "0197aaed-4a35-74da-8574-4165524a8888" {
+		t.Errorf("got session %q, want %q", firstClaims.SessionID, "0197aaed-4a35-74da-8574-4165524a8888")
+	}
+	// every token can be revoked on its own
+	if firstClaims.TokenID == secondClaims.TokenID {
+		t.Errorf("got the same token ID %q for two tokens", firstClaims.TokenID)
+	}
+	if firstClaims.ExpiresAt-firstClaims.IssuedAt != int64(AccessTokens.TTL.Seconds()) {
+		t.Errorf("got a lifetime of %ds, want %s", firstClaims.ExpiresAt-firstClaims.IssuedAt, AccessTokens.TTL)
+	}
+}
+
+func TestChallengeTokensAreNotAccessTokens(t *testing.T) {
+	user := &model.User{ID: "0197aaed-4a35-74da-8574-4165524a1111"}
+
+	challenge, err := GenerateChallengeToken(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var challengeClaims ChallengeClaims
+	if err := ExtractChallengeClaims(challenge, &challengeClaims); err != nil {
+		t.Fatal(err)
+	}
+	if challengeClaims.UserID != user.ID || challengeClaims.TokenID == "" {
+		t.Errorf("got %+v, want claims identifying %s", challengeClaims, user.ID)
+	}
+	if err := ExtractJWTClaims(challenge, &AuthClaims{}); err == nil {
+		t.Error("expected a challenge token to be rejected as an access token")
+	}
+
+	access, err := GenerateJWT(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtractChallengeClaims(access, &ChallengeClaims{}); err == nil {
+		t.Error("expected an access token to be rejected as a challenge token")
+	}
+}
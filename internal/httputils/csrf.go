@@ -0,0 +1,49 @@
+package httputils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+const (
+	// SessionCookie holds the access token of a browser logged in with cookie sessions
+	SessionCookie = "session"
+	// RefreshCookie holds the refresh token of a browser logged in with cookie sessions
+	RefreshCookie = "refresh_token"
+	// CSRFCookie holds the CSRF token of a browser logged in with cookie sessions. Unlike the others it can be
+	// read by scripts, which echo it in the CSRFHeader.
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+var ErrCSRFTokenInvalid = errors.New("missing or mismatched CSRF token")
+
+// CSRFToken returns the CSRF token of the session with the given ID, signed with key. The token is derived from
+// the session rather than compared to the CSRFCookie, as a sibling subdomain can plant cookies of its own.
+func CSRFToken(key []byte, sessionID string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CheckCSRFToken verifies that a state-changing request made in the session with the given ID sends the
+// session's CSRF token in the CSRFHeader. Other sites can make a browser send its cookies, but cannot read
+// them to set the header.
+func CheckCSRFToken(r *http.Request, key []byte, sessionID string) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	if len(key) == 0 || sessionID == "" {
+		return ErrCSRFTokenInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(CSRFHeader)), []byte(CSRFToken(key, sessionID))) != 1 {
+		return ErrCSRFTokenInvalid
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package httputils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckCSRFToken(t *testing.T) {
+	key := []byte("csrf key")
+	token := CSRFToken(key, "session")
+
+	tt := []struct {
+		Name    string
+		Method  string
+		Session string
+		Cookie  string
+		Header  string
+		Err     error
+	}{
+		{
+			Name:    "Safe Method Without Token",
+			Method:  "GET",
+			Session: "session",
+		},
+		{
+			Name:    "Matching Token",
+			Method:  "POST",
+			Session: "session",
+			Cookie:  token,
+			Header:  token,
+		},
+		{
+			Name:    "Missing Header",
+			Method:  "DELETE",
+			Session: "session",
+			Cookie:  token,
+			Err:     ErrCSRFTokenInvalid,
+		},
+		{
+			Name:    "Mismatched Header",
+			Method:  "PUT",
+			Session: "session",
+			Cookie:  token,
+			Header:  "something-else",
+			Err:     ErrCSRFTokenInvalid,
+		},
+		{
+			// a cookie planted by another site matches the header it sends, but not the session
+			Name:    "Token Of Another Session",
+			Method:  "POST",
+			Session: "session",
+			Cookie:  CSRFToken(key, "another session"),
+			Header:  CSRFToken(key, "another session"),
+			Err:     ErrCSRFTokenInvalid,
+		},
+		{
+			Name:   "Missing Session",
+			Method: "POST",
+			Cookie: token,
+			Header: token,
+			Err:    ErrCSRFTokenInvalid,
+		},
+	}
+
+	for _, tt := range tt {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.Method, "/api/v1/posts", nil)
+			if tt.Cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.Cookie})
+			}
+			if tt.Header != "" {
+				req.Header.Set(CSRFHeader, tt.Header)
+			}
+
+			if err := CheckCSRFToken(req, key, tt.Session); !errors.Is(err, tt.Err) {
+				t.Errorf("got %v, want %v", err, tt.Err)
+			}
+		})
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	key := []byte("csrf key")
+	if CSRFToken(key, "session") != CSRFToken(key, "session") {
+		t.Error("got different tokens for the same session")
+	}
+	if CSRFToken(key, "session") == CSRFToken(key, "another session") {
+		t.Error("got the same token for different sessions")
+	}
+	if CSRFToken(key, "session") == CSRFToken([]byte("another key"), "session") {
+		t.Error("got the same token for different keys")
+	}
+}
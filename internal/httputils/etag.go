@@ -0,0 +1,30 @@
+package httputils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETag formats an entity version as a strong entity tag
+func ETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// MatchesIfMatch reports whether the request's If-Match header permits a write to an entity with the
+// given entity tag. ok is false when no If-Match header was sent.
+func MatchesIfMatch(r *http.Request, etag string) (matches bool, ok bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return false, false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// If-Match uses the strong comparison so weak tags never match
+		if candidate == "*" || candidate == etag {
+			return true, true
+		}
+	}
+	return false, true
+}
@@ -0,0 +1,198 @@
+package httputils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signing algorithms supported for access tokens
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// key size requirements
+const (
+	minHMACSecretLength = 32
+	minRSAKeyBits       = 2048
+)
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// SigningKey signs and verifies access tokens. Keys loaded from a public key can only verify tokens, which
+// lets a retired key keep verifying the tokens it signed until they expire.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	method    jwt.SigningMethod
+	// signKey is nil for verify only keys
+	signKey   any
+	verifyKey any
+}
+
+// NewHMACSigningKey returns an HS256 key from a shared secret
+func NewHMACSigningKey(id string, secret []byte) (*SigningKey, error) {
+	if len(secret) < minHMACSecretLength {
+		return nil, fmt.Errorf("signing key %q: HS256 secrets must be at least %d bytes", id, minHMACSecretLength)
+	}
+	return &SigningKey{ID: id, Algorithm: AlgHS256, method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}, nil
+}
+
+// ParseSigningKey returns a key for the given algorithm. HS256 keys are the raw secret, while RS256 and EdDSA keys
+// are a PEM encoded private key, or a public key for a key that only verifies tokens.
+func ParseSigningKey(id, algorithm string, key []byte) (*SigningKey, error) {
+	if id == "" {
+		return nil, errors.New("signing keys must have an ID")
+	}
+
+	switch algorithm {
+	case AlgHS256:
+		return NewHMACSigningKey(id, key)
+	case AlgRS256:
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(key); err == nil {
+			if private.N.BitLen() < minRSAKeyBits {
+				return nil, fmt.Errorf("signing key %q: RSA keys must be at least %d bits", id, minRSAKeyBits)
+			}
+			return &SigningKey{ID: id, Algorithm: algorithm, method: jwt.SigningMethodRS256, signKey: private, verifyKey: &private.PublicKey}, nil
+		}
+		public, err := jwt.ParseRSAPublicKeyFromPEM(key)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: expected a PEM encoded RSA key: %w", id, err)
+		}
+		if public.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("signing key %q: RSA keys must be at least %d bits", id, minRSAKeyBits)
+		}
+		return &SigningKey{ID: id, Algorithm: algorithm, method: jwt.SigningMethodRS256, verifyKey: public}, nil
+	case AlgEdDSA:
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(key); err == nil {
+			private := private.(ed25519.PrivateKey)
+			return &SigningKey{ID: id, Algorithm: algorithm, method: jwt.SigningMethodEdDSA, signKey: private, verifyKey: private.Public()}, nil
+		}
+		public, err := jwt.ParseEdPublicKeyFromPEM(key)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: expected a PEM encoded Ed25519 key: %w", id, err)
+		}
+		return &SigningKey{ID: id, Algorithm: algorithm, method: jwt.SigningMethodEdDSA, verifyKey: public}, nil
+	default:
+		return nil, fmt.Errorf("signing key %q: unsupported algorithm %q - expected %s, %s or %s", id, algorithm, AlgHS256, AlgRS256, AlgEdDSA)
+	}
+}
+
+// KeySet holds every key access tokens may be signed with. Tokens are signed with the active key and name
+// it in their kid header, while any key in the set verifies them, so a new key can be made active without
+// invalidating the tokens signed with the old one.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+	// order is the order keys were added in, so the JWKS is stable
+	order []string
+}
+
+// NewKeySet returns a set of keys signing with the key with the given active ID
+func NewKeySet(activeID string, keys ...*SigningKey) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*SigningKey, len(keys))}
+	for _, key := range keys {
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate signing key %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+		ks.order = append(ks.order, key.ID)
+	}
+
+	active, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q: %w", activeID, ErrUnknownSigningKey)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("active signing key %q is a public key and cannot sign tokens", activeID)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+// NewEphemeralKeySet returns a set with a single random HS256 key. Tokens signed with it cannot be verified once
+// the process exits, or by any other instance of the API.
+func NewEphemeralKeySet() *KeySet {
+	secret := make([]byte, minHMACSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("failed to generate signing key: %s", err))
+	}
+
+	key, _ := NewHMACSigningKey("ephemeral", secret)
+	ks, _ := NewKeySet(key.ID, key)
+	return ks
+}
+
+// SigningKeys are the keys used by GenerateJWT and ExtractJWTClaims
+var SigningKeys = NewEphemeralKeySet()
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.signKey)
+}
+
+// keyFunc looks up the key named in a token's kid header, checking the token was signed with that key's algorithm
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSigningKey, kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("token signed with %s but key %q is %s", token.Method.Alg(), kid, key.Algorithm)
+	}
+	return key.verifyKey, nil
+}
+
+// JWK is a public key in JSON Web Key format, see RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKSet is a set of JSON Web Keys
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set so that other services can verify tokens. HS256 keys are shared
+// secrets, so they are never published.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, id := range ks.order {
+		key := ks.keys[id]
+		jwk := JWK{KeyID: key.ID, Algorithm: key.Algorithm, Use: "sig"}
+
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
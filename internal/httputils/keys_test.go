@@ -0,0 +1,283 @@
+package httputils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeys returns PEM encoded private and public keys for each asymmetric algorithm
+func testKeys(t *testing.T) map[string][2][]byte {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(private, public any) [2][]byte {
+		privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicDER, err := x509.MarshalPKIXPublicKey(public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return [2][]byte{
+			pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+			pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+		}
+	}
+	return map[string][2][]byte{
+		AlgRS256: encode(rsaKey, &rsaKey.PublicKey),
+		AlgEdDSA: encode(edPrivate, edPublic),
+	}
+}
+
+func mustParseSigningKey(t *testing.T, id, algorithm string, key []byte) *SigningKey {
+	t.Helper()
+
+	signingKey, err := ParseSigningKey(id, algorithm, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingKey
+}
+
+// useSigningKeys replaces SigningKeys for the duration of the test
+func useSigningKeys(t *testing.T, ks *KeySet) {
+	previous := SigningKeys
+	SigningKeys = ks
+	t.Cleanup(func() { SigningKeys = previous })
+}
+
+func TestParseSigningKey(t *testing.T) {
+	keys := testKeys(t)
+	weakRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakRSAPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weakRSA)})
+
+	tests := []struct {
+		Name      string
+		ID        string
+		Algorithm string
+		Key       []byte
+		CanSign   bool
+		WantErr   bool
+	}{
+		{"HS256", "hmac", AlgHS256, []byte("a secret that is at least 32 bytes long"), true, false},
+		{"HS256 Short Secret", "hmac", AlgHS256, []byte("too short"), false, true},
+		{"RS256 Private", "rsa", AlgRS256, keys[AlgRS256][0], true, false},
+		{"RS256 Public", "rsa", AlgRS256, keys[AlgRS256][1], false, false},
+		{"RS256 Weak", "rsa", AlgRS256, weakRSAPEM, false, true},
+		{"RS256 Given Ed25519 Key", "rsa", AlgRS256, keys[AlgEdDSA][0], false, true},
+		{"EdDSA Private", "ed", AlgEdDSA, keys[AlgEdDSA][0], true, false},
+		{"EdDSA Public", "ed", AlgEdDSA, keys[AlgEdDSA][1], false, false},
+		{"EdDSA Given RSA Key", "ed", AlgEdDSA, keys[AlgRS256][0], false, true},
+		{"Unsupported Algorithm", "none", "none", []byte("a secret that is at least 32 bytes long"), false, true},
+		{"Missing ID", "", AlgHS256, []byte("a secret that is at least 32 bytes long"), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			key, err := ParseSigningKey(tt.ID, tt.Algorithm, tt.Key)
+			if (err != nil) != tt.WantErr {
+				t.Fatalf("got %v, want error: %t", err, tt.WantErr)
+			}
+			if err == nil && (key.signKey != nil) != tt.CanSign {
+				t.Errorf("got can sign %t, want %t", key.signKey != nil, tt.CanSign)
+			}
+		})
+	}
+}
+
+func TestKeySetSignsWithEachAlgorithm(t *testing.T) {
+	keys := testKeys(t)
+	user := &model.User{ID: "0197aaed-4a35-74da-8574-4165524a1111"}
+
+	for _, key := range []*SigningKey{
+		mustParseSigningKey(t, "hmac", AlgHS256, []byte("a secret that is at least 32 bytes long")),
+		mustParseSigningKey(t, "rsa", AlgRS256, keys[AlgRS256][0]),
+		mustParseSigningKey(t, "ed", AlgEdDSA, keys[AlgEdDSA][0]),
+	} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			ks, err := NewKeySet(key.ID, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			useSigningKeys(t, ks)
+
+			token, err := GenerateJWT(user, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != key.ID || parsed.Header["alg"] != key.Algorithm {
+				t.Errorf("got header %v, want kid %q and alg %q", parsed.Header, key.ID, key.Algorithm)
+			}
+
+			var claims AuthClaims
+			if err := ExtractJWTClaims(token, &claims); err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID != user.ID {
+				t.Errorf("got user ID %q, want %q", claims.UserID, user.ID)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	keys := testKeys(t)
+	user := &model.User{ID: "0197aaed-4a35-74da-8574-4165524a1111"}
+
+	old := mustParseSigningKey(t, "2025-01", AlgRS256, keys[AlgRS256][0])
+	next := mustParseSigningKey(t, "2025-06", AlgEdDSA, keys[AlgEdDSA][0])
+
+	ks, err := NewKeySet(old.ID, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useSigningKeys(t, ks)
+	oldToken, err := GenerateJWT(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new key becomes active while the old one is kept as a public key to verify outstanding tokens
+	retired := mustParseSigningKey(t, old.ID, AlgRS256, keys[AlgRS256][1])
+	ks, err = NewKeySet(next.ID, retired, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useSigningKeys(t, ks)
+
+	newToken, err := GenerateJWT(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		var claims AuthClaims
+		if err := ExtractJWTClaims(token, &claims); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+	}
+
+	// once the old key is removed its tokens are rejected
+	ks, err = NewKeySet(next.ID, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useSigningKeys(t, ks)
+	var claims AuthClaims
+	if err := ExtractJWTClaims(oldToken, &claims); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("got %v, want %v", err, ErrUnknownSigningKey)
+	}
+}
+
+func TestNewKeySet(t *testing.T) {
+	keys := testKeys(t)
+	private := mustParseSigningKey(t, "rsa", AlgRS256, keys[AlgRS256][0])
+	public := mustParseSigningKey(t, "rsa-public", AlgRS256, keys[AlgRS256][1])
+
+	tests := []struct {
+		Name    string
+		Active  string
+		Keys    []*SigningKey
+		WantErr bool
+	}{
+		{"Valid", "rsa", []*SigningKey{private, public}, false},
+		{"Unknown Active Key", "other", []*SigningKey{private}, true},
+		{"Public Active Key", "rsa-public", []*SigningKey{private, public}, true},
+		{"Duplicate IDs", "rsa", []*SigningKey{private, private}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := NewKeySet(tt.Active, tt.Keys...)
+			if (err != nil) != tt.WantErr {
+				t.Errorf("got %v, want error: %t", err, tt.WantErr)
+			}
+		})
+	}
+}
+
+func TestKeySetRejectsAlgorithmConfusion(t *testing.T) {
+	keys := testKeys(t)
+	rsaKey := mustParseSigningKey(t, "rsa", AlgRS256, keys[AlgRS256][0])
+	ks, err := NewKeySet(rsaKey.ID, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useSigningKeys(t, ks)
+
+	// an HS256 token "signed" with the published RSA public key must not verify against that key
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "0197aaed-4a35-74da-8574-4165524a1111",
+		"jti":     "0197aaed-4a35-74da-8574-4165524a9999",
+		"iss":     AccessTokens.Issuer,
+		"aud":     AccessTokens.Audience,
+		"iat":     now.Unix(),
+		"exp":     now.Add(time.Minute).Unix(),
+	})
+	token.Header["kid"] = rsaKey.ID
+	signed, err := token.SignedString(keys[AlgRS256][1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims AuthClaims
+	if err := ExtractJWTClaims(signed, &claims); err == nil {
+		t.Error("expected the token to be rejected")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys := testKeys(t)
+	hmacKey := mustParseSigningKey(t, "hmac", AlgHS256, []byte("a secret that is at least 32 bytes long"))
+	rsaKey := mustParseSigningKey(t, "rsa", AlgRS256, keys[AlgRS256][0])
+	edKey := mustParseSigningKey(t, "ed", AlgEdDSA, keys[AlgEdDSA][1])
+
+	ks, err := NewKeySet(rsaKey.ID, hmacKey, rsaKey, edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := ks.JWKS()
+	// the HS256 secret must never be published
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(jwks.Keys))
+	}
+
+	rsaJWK, edJWK := jwks.Keys[0], jwks.Keys[1]
+	if rsaJWK.KeyID != "rsa" || rsaJWK.KeyType != "RSA" || rsaJWK.Algorithm != AlgRS256 || rsaJWK.E != "AQAB" || rsaJWK.N == "" {
+		t.Errorf("got %+v, want the RSA public key", rsaJWK)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(edJWK.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edJWK.KeyID != "ed" || edJWK.KeyType != "OKP" || edJWK.Curve != "Ed25519" || !ed25519.PublicKey(x).Equal(edKey.verifyKey) {
+		t.Errorf("got %+v, want the Ed25519 public key", edJWK)
+	}
+}
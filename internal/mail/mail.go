@@ -0,0 +1,183 @@
+// Package mail sends the emails users need to recover and verify their accounts
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+)
+
+const (
+	DriverSMTP   = "smtp"
+	DriverOutbox = "outbox"
+)
+
+// ErrInvalidMessage is returned when a message has an invalid recipient, or a header that would let it inject others
+var ErrInvalidMessage = errors.New("invalid mail message")
+
+// Message is a plain text email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// format returns msg as an RFC 5322 message from the given address
+func (msg Message) format(from string, date time.Time) ([]byte, error) {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("%w: recipient: %w", ErrInvalidMessage, err)
+	}
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("%w: line break in header", ErrInvalidMessage)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	b.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&b)
+	if _, err := w.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Mailer sends email
+type Mailer interface {
+	// Send returns once msg has been handed off for delivery
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the Mailer selected by cfg.Driver
+func New(cfg config.MailConfig) (Mailer, error) {
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("invalid mail.from address: %w", err)
+	}
+
+	switch cfg.Driver {
+	case DriverSMTP:
+		return NewSMTPMailer(cfg)
+	case DriverOutbox:
+		return NewOutbox(cfg.From, cfg.OutboxDir)
+	case "":
+		return nil, fmt.Errorf("mail.driver is required when mail is enabled - must be %q or %q", DriverSMTP, DriverOutbox)
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q - must be %q or %q", cfg.Driver, DriverSMTP, DriverOutbox)
+	}
+}
+
+// SMTPMailer delivers mail through an SMTP server, upgrading the connection with STARTTLS when the server
+// supports it
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(cfg config.MailConfig) (*SMTPMailer, error) {
+	if cfg.SMTP.Host == "" || cfg.SMTP.Port == 0 {
+		return nil, errors.New("mail.smtp.host and mail.smtp.port are required")
+	}
+
+	m := &SMTPMailer{
+		addr: net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port)),
+		from: cfg.From,
+	}
+	if cfg.SMTP.Username != "" {
+		// PlainAuth refuses to send credentials over a connection without TLS, other than to localhost
+		m.auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b, err := msg.format(m.from, time.Now())
+	if err != nil {
+		return err
+	}
+	// the envelope sender is the bare address, without any display name
+	from, _ := mail.ParseAddress(m.from)
+	if err := smtp.SendMail(m.addr, m.auth, from.Address, []string{msg.To}, b); err != nil {
+		return fmt.Errorf("error sending mail: %w", err)
+	}
+	return nil
+}
+
+// Outbox keeps mail rather than delivering it, for development and tests. Messages are also written to a
+// directory as .eml files, which mail clients can open, when one is given.
+type Outbox struct {
+	mu       sync.Mutex
+	from     string
+	dir      string
+	messages []Message
+}
+
+// NewOutbox returns an Outbox writing to dir, creating it if needed, or only keeping messages in memory if dir
+// is empty
+func NewOutbox(from, dir string) (*Outbox, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("error creating outbox: %w", err)
+		}
+	}
+	return &Outbox{from: from, dir: dir}, nil
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	b, err := msg.format(o.from, now)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.dir != "" {
+		name := fmt.Sprintf("%s-%03d.eml", now.UTC().Format("20060102T150405"), len(o.messages))
+		if err := os.WriteFile(filepath.Join(o.dir, name), b, 0o600); err != nil {
+			return fmt.Errorf("error writing to outbox: %w", err)
+		}
+	}
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// Messages returns every message sent, oldest first
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]Message(nil), o.messages...)
+}
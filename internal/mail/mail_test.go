@@ -0,0 +1,188 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+)
+
+func TestMessageFormat(t *testing.T) {
+	msg := Message{To: "kazuo@example.com", Subject: "Réinitialiser", Body: "line one\nline two"}
+
+	b, err := msg.format("Blog <blog@example.com>", time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		"From: Blog <blog@example.com>\r\n",
+		"To: kazuo@example.com\r\n",
+		"Subject: =?utf-8?q?R=C3=A9initialiser?=\r\n",
+		"Date: Sun, 01 Jun 2025 12:00:00 +0000\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestMessageFormatRejectsInjection(t *testing.T) {
+	tests := []struct {
+		Name string
+		Msg  Message
+	}{
+		{"Invalid Recipient", Message{To: "not an address", Subject: "hi"}},
+		{"Line Break In Recipient", Message{To: "kazuo@example.com\r\nBcc: everyone@example.com", Subject: "hi"}},
+		{"Line Break In Subject", Message{To: "kazuo@example.com", Subject: "hi\r\nBcc: everyone@example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if _, err := tt.Msg.format("blog@example.com", time.Now()); !errors.Is(err, ErrInvalidMessage) {
+				t.Errorf("got %v, want %v", err, ErrInvalidMessage)
+			}
+		})
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	outbox, err := NewOutbox("blog@example.com", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := Message{To: "kazuo@example.com", Subject: "Hello", Body: "Hello Kazuo"}
+	if err := outbox.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := outbox.Messages(); len(got) != 1 || got[0] != msg {
+		t.Errorf("got %+v, want the message sent", got)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || filepath.Ext(files[0].Name()) != ".eml" {
+		t.Fatalf("got %v, want a single .eml file", files)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "Hello Kazuo") {
+		t.Errorf("got %q, want the message body", b)
+	}
+}
+
+// serveSMTP accepts a single message on ln, sending what was received after DATA on the returned channel
+func serveSMTP(t *testing.T, ln net.Listener) <-chan string {
+	t.Helper()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		c := textproto.NewConn(conn)
+		c.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			switch verb := strings.ToUpper(strings.Fields(line)[0]); verb {
+			case "EHLO", "HELO":
+				c.PrintfLine("250 localhost")
+			case "DATA":
+				c.PrintfLine("354 go ahead")
+				data, err := c.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				received <- string(data)
+				c.PrintfLine("250 queued")
+			case "QUIT":
+				c.PrintfLine("221 bye")
+				return
+			default:
+				c.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := serveSMTP(t, ln)
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	mailer, err := New(config.MailConfig{
+		Driver: DriverSMTP,
+		From:   "Blog <blog@example.com>",
+		SMTP:   config.SMTPConfig{Host: host, Port: portNum},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mailer.Send(context.Background(), Message{To: "kazuo@example.com", Subject: "Hello", Body: "Hello Kazuo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-received:
+		r := textproto.NewReader(bufio.NewReader(strings.NewReader(data)))
+		header, err := r.ReadMIMEHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Get("To") != "kazuo@example.com" || header.Get("Subject") != "Hello" {
+			t.Errorf("got headers %v, want the message's", header)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Config config.MailConfig
+	}{
+		{"Missing Driver", config.MailConfig{From: "blog@example.com"}},
+		{"Unknown Driver", config.MailConfig{Driver: "pigeon", From: "blog@example.com"}},
+		{"Invalid From", config.MailConfig{Driver: DriverOutbox, From: "not an address"}},
+		{"Missing SMTP Host", config.MailConfig{Driver: DriverSMTP, From: "blog@example.com", SMTP: config.SMTPConfig{Port: 587}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if _, err := New(tt.Config); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
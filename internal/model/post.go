@@ -7,16 +7,23 @@ type BlogPostStatus string
 const (
 	PUBLISHED BlogPostStatus = "PUBLISHED"
 	DRAFT     BlogPostStatus = "DRAFT"
+	// DELETED posts are in the trash and can be restored by their author until they are purged
+	DELETED BlogPostStatus = "DELETED"
 )
 
+// BlogPost is a post and its metadata. Tags are stored lowercase, sorted and without duplicates.
 type BlogPost struct {
 	ID          string         `json:"id"`
 	Status      BlogPostStatus `json:"status"`
 	Title       string         `json:"title"`
 	Summary     string         `json:"summary"`
 	Contents    string         `json:"contents"`
+	Tags        []string       `json:"tags"`
 	AuthorID    string         `json:"author_id"`
 	CreatedTS   string         `json:"created_ts"`
 	PublishedTS string         `json:"published_ts"`
 	UpdatedTS   string         `json:"updated_ts"`
+	DeletedTS   string         `json:"deleted_ts"`
+	// Version is incremented on every update for optimistic concurrency control
+	Version int `json:"version"`
 }
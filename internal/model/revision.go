@@ -0,0 +1,30 @@
+package model
+
+// BlogPostRevision is an immutable snapshot of a blog post's editable fields at a given version
+type BlogPostRevision struct {
+	PostID   string `json:"post_id"`
+	Revision int    `json:"revision"`
+	// AuthorID is the user who made the change recorded by the revision, who is not necessarily the post's author
+	AuthorID  string         `json:"author_id"`
+	Status    BlogPostStatus `json:"status"`
+	Title     string         `json:"title"`
+	Summary   string         `json:"summary"`
+	Contents  string         `json:"contents"`
+	Tags      []string       `json:"tags"`
+	CreatedTS string         `json:"created_ts"`
+}
+
+// NewBlogPostRevision captures the current state of post as a revision, made by the user with ID editorID
+func NewBlogPostRevision(post BlogPost, editorID string) BlogPostRevision {
+	return BlogPostRevision{
+		PostID:    post.ID,
+		Revision:  post.Version,
+		AuthorID:  editorID,
+		Status:    post.Status,
+		Title:     post.Title,
+		Summary:   post.Summary,
+		Contents:  post.Contents,
+		Tags:      post.Tags,
+		CreatedTS: post.UpdatedTS,
+	}
+}
@@ -0,0 +1,77 @@
+package model
+
+import "fmt"
+
+// Role determines what a user is allowed to do
+type Role string
+
+const (
+	// RoleReader can read posts and manage their own account
+	RoleReader Role = "reader"
+	// RoleAuthor can also write posts of their own
+	RoleAuthor Role = "author"
+	// RoleEditor can also moderate the posts of other users
+	RoleEditor Role = "editor"
+	// RoleAdmin can do anything, including managing users
+	RoleAdmin Role = "admin"
+)
+
+// DefaultRole is given to users who sign up
+const DefaultRole = RoleAuthor
+
+// Roles lists every role, from least to most privileged
+var Roles = []Role{RoleReader, RoleAuthor, RoleEditor, RoleAdmin}
+
+// Permission is an action that is only allowed for some roles
+type Permission string
+
+const (
+	// PermReadPosts allows reading your own drafts, deleted posts and revisions
+	PermReadPosts Permission = "posts:read"
+	// PermWritePosts allows creating posts, and editing, deleting and restoring your own
+	PermWritePosts Permission = "posts:write"
+	// PermModeratePosts allows deleting any post
+	PermModeratePosts Permission = "posts:moderate"
+	// PermManageUsers allows managing the accounts and sessions of other users
+	PermManageUsers Permission = "users:manage"
+)
+
+// Permissions lists every permission
+var Permissions = []Permission{PermReadPosts, PermWritePosts, PermModeratePosts, PermManageUsers}
+
+// rolePermissions is the permission matrix - anything not listed is denied
+var rolePermissions = map[Role][]Permission{
+	RoleReader: {PermReadPosts},
+	RoleAuthor: {PermReadPosts, PermWritePosts},
+	RoleEditor: {PermReadPosts, PermWritePosts, PermModeratePosts},
+	RoleAdmin:  {PermReadPosts, PermWritePosts, PermModeratePosts, PermManageUsers},
+}
+
+// ParseRole returns the role with the given name
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if _, ok := rolePermissions[role]; !ok {
+		return "", fmt.Errorf("unknown role %q - expected one of %v", name, Roles)
+	}
+	return role, nil
+}
+
+// ParsePermission returns the permission with the given name
+func ParsePermission(name string) (Permission, error) {
+	for _, perm := range Permissions {
+		if string(perm) == name {
+			return perm, nil
+		}
+	}
+	return "", fmt.Errorf("unknown permission %q - expected one of %v", name, Permissions)
+}
+
+// Can reports whether the role has been granted perm. Unknown roles have no permissions.
+func (r Role) Can(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
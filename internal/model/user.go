@@ -1,8 +1,24 @@
 package model
 
 type User struct {
-	ID       string
-	Username string
-	Name     string
-	IsAdmin  bool
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Role     Role   `json:"role"`
+	// Email is where password resets are sent, and is empty for users who have not given one
+	Email string `json:"email,omitempty"`
+	// EmailVerified is set once the user has proven they can read mail sent to Email
+	EmailVerified bool `json:"email_verified"`
+	// Suspended users cannot log in, and their existing credentials are rejected, until an admin reactivates them
+	Suspended bool `json:"suspended,omitempty"`
+	// PostsHidden hides the posts of a suspended user from everyone but moderators
+	PostsHidden bool `json:"posts_hidden,omitempty"`
+	// PasswordHash is the bcrypt hash of the user's password and must never be returned to clients
+	PasswordHash string `json:"-"`
+}
+
+// CanPublish reports whether the user may publish posts. Users who signed up with an email address have to
+// verify it first.
+func (u *User) CanPublish() bool {
+	return u.Email == "" || u.EmailVerified
 }
@@ -0,0 +1,137 @@
+// Package oidc logs users in through an external OpenID Connect identity provider, using the authorization
+// code flow with PKCE
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrInvalidNonce is returned when an ID token was not issued for the login being completed
+var ErrInvalidNonce = errors.New("ID token nonce does not match")
+
+// Identity is the user an ID token was issued for
+type Identity struct {
+	// Issuer and Subject identify the user at the provider - usernames and emails can change, so are only hints
+	Issuer   string
+	Subject  string
+	Username string
+	Name     string
+}
+
+// Provider is a relying party of a single OpenID Connect provider
+type Provider struct {
+	oauth2        oauth2.Config
+	verifier      *gooidc.IDTokenVerifier
+	usernameClaim string
+}
+
+// NewProvider discovers the provider's endpoints and keys from its issuer URL
+func NewProvider(ctx context.Context, cfg config.OIDCConfig) (*Provider, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc.issuer_url, oidc.client_id and oidc.redirect_url are required")
+	}
+
+	provider, err := gooidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering OIDC provider: %w", err)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{gooidc.ScopeOpenID, "profile"}
+	}
+	usernameClaim := cfg.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+
+	return &Provider{
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier:      provider.Verifier(&gooidc.Config{ClientID: cfg.ClientID}),
+		usernameClaim: usernameClaim,
+	}, nil
+}
+
+// RedirectURL is this API's callback endpoint, as registered with the provider
+func (p *Provider) RedirectURL() string {
+	return p.oauth2.RedirectURL
+}
+
+// AuthCodeURL returns the provider URL to send the user to. state, nonce and verifier must be random, and
+// kept by the client until the user is redirected back.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth2.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange redeems the authorization code the user was redirected back with, returning who the verified ID
+// token says they are
+func (p *Provider) Exchange(ctx context.Context, code, nonce, verifier string) (Identity, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("error exchanging authorization code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, errors.New("token response did not include an ID token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("error verifying ID token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return Identity{}, ErrInvalidNonce
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, fmt.Errorf("error reading ID token claims: %w", err)
+	}
+	username, _ := claims[p.usernameClaim].(string)
+	name, _ := claims["name"].(string)
+
+	return Identity{
+		Issuer:   idToken.Issuer,
+		Subject:  idToken.Subject,
+		Username: username,
+		Name:     name,
+	}, nil
+}
+
+var invalidUsernameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// UsernameCandidates returns the usernames to try, in order, when provisioning a user for identity. The
+// provider's username is cleaned up to fit our rules, falling back on a name derived from the subject,
+// which is unique to the identity.
+func UsernameCandidates(identity Identity) []string {
+	sum := sha256.Sum256([]byte(identity.Issuer + "\x00" + identity.Subject))
+	suffix := hex.EncodeToString(sum[:4])
+
+	// drop the domain of email addresses used as usernames
+	base, _, _ := strings.Cut(strings.ToLower(identity.Username), "@")
+	base = strings.Trim(invalidUsernameChars.ReplaceAllString(base, "-"), "-._")
+	if len(base) > 23 {
+		base = base[:23]
+	}
+
+	if len(base) < 3 {
+		return []string{"user-" + suffix}
+	}
+	return []string{base, base + "-" + suffix}
+}
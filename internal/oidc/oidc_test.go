@@ -0,0 +1,35 @@
+package oidc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUsernameCandidates(t *testing.T) {
+	tt := []struct {
+		name     string
+		username string
+		want     string
+	}{
+		{name: "Valid Username", username: "jdoe", want: "jdoe"},
+		{name: "Email Address", username: "Jane.Doe@example.com", want: "jane.doe"},
+		{name: "Invalid Characters", username: "Jane Doe!", want: "jane-doe"},
+		{name: "Too Long", username: strings.Repeat("a", 40), want: strings.Repeat("a", 23)},
+		{name: "Too Short", username: "jd", want: "user-"},
+		{name: "Missing", username: "", want: "user-"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			candidates := UsernameCandidates(Identity{Issuer: "https://idp.example.com", Subject: "248289761001", Username: tc.username})
+			if !strings.HasPrefix(candidates[0], tc.want) {
+				t.Errorf("got first candidate %q, want %q", candidates[0], tc.want)
+			}
+			for _, c := range candidates {
+				if len(c) < 3 || len(c) > 32 {
+					t.Errorf("candidate %q is not a valid username length", c)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+// Package oidctest runs a stand-in OpenID Connect provider for tests, which logs in whichever user it is
+// told to without prompting
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/James-D-Wood/blog-api/internal/config"
+	"github.com/James-D-Wood/blog-api/internal/httputils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	ClientID     = "blog-api"
+	ClientSecret = "stand-in-client-secret"
+	RedirectURL  = "http://blog.example.com/api/v1/oidc/callback"
+	keyID        = "stand-in"
+)
+
+// User is an account at the provider
+type User struct {
+	Subject           string
+	PreferredUsername string
+	Name              string
+}
+
+// Provider is a stand-in OpenID Connect provider
+type Provider struct {
+	// URL is the issuer URL
+	URL string
+
+	key  *rsa.PrivateKey
+	jwks httputils.JWKSet
+
+	mu    sync.Mutex
+	user  User
+	codes map[string]authorization
+	// nonce overrides the nonce of issued ID tokens when set
+	nonce string
+}
+
+// authorization is an authorization code waiting to be redeemed
+type authorization struct {
+	user          User
+	redirectURL   string
+	nonce         string
+	codeChallenge string
+}
+
+// NewProvider starts a provider that is shut down when the test ends
+func NewProvider(t *testing.T) *Provider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := httputils.ParseSigningKey(keyID, httputils.AlgRS256, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet, err := httputils.NewKeySet(keyID, signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Provider{key: key, jwks: keySet.JWKS(), codes: map[string]authorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		httputils.RespondWithJson(w, p.jwks, 200)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	p.URL = server.URL
+	return p
+}
+
+// Config returns the configuration for logging in through the provider
+func (p *Provider) Config() config.OIDCConfig {
+	return config.OIDCConfig{
+		Enabled:      true,
+		IssuerURL:    p.URL,
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  RedirectURL,
+	}
+}
+
+// LogInAs sets the user that the next authorizations are granted for
+func (p *Provider) LogInAs(user User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = user
+}
+
+// OverrideNonce makes the provider issue ID tokens with the given nonce, rather than the one requested
+func (p *Provider) OverrideNonce(nonce string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nonce = nonce
+}
+
+// Authorize visits an authorization URL as the user's browser would, returning the callback URL the provider
+// redirects back to
+func (p *Provider) Authorize(t *testing.T, authURL string) *url.URL {
+	t.Helper()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("got %d from the authorization endpoint, want %d", resp.StatusCode, http.StatusFound)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	httputils.RespondWithJson(w, map[string]any{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{httputils.AlgRS256},
+		"code_challenge_methods_supported":      []string{"S256"},
+	}, 200)
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != ClientID || q.Get("redirect_uri") != RedirectURL || q.Get("response_type") != "code" {
+		http.Error(w, "invalid authorization request", 400)
+		return
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "PKCE is required", 400)
+		return
+	}
+
+	p.mu.Lock()
+	code := uuid.NewString()
+	p.codes[code] = authorization{
+		user:          p.user,
+		redirectURL:   q.Get("redirect_uri"),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+	}
+	p.mu.Unlock()
+
+	callback, _ := url.Parse(q.Get("redirect_uri"))
+	params := url.Values{"code": {code}, "state": {q.Get("state")}}
+	callback.RawQuery = params.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(ClientSecret)) != 1 {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	p.mu.Lock()
+	code := r.PostFormValue("code")
+	auth, ok := p.codes[code]
+	// codes can only be redeemed once
+	delete(p.codes, code)
+	nonce := auth.nonce
+	if p.nonce != "" {
+		nonce = p.nonce
+	}
+	p.mu.Unlock()
+
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != auth.redirectURL {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.codeChallenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                p.URL,
+		"sub":                auth.user.Subject,
+		"aud":                ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Minute).Unix(),
+		"nonce":              nonce,
+		"preferred_username": auth.user.PreferredUsername,
+		"name":               auth.user.Name,
+	})
+	idToken.Header["kid"] = keyID
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	httputils.RespondWithJson(w, map[string]any{
+		"access_token": uuid.NewString(),
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     signed,
+	}, 200)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(400)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
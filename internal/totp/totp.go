@@ -0,0 +1,106 @@
+// Package totp implements the time-based one-time passwords of RFC 6238, as generated by authenticator apps
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the length of a code
+	Digits = 6
+	// Period is how long each code is valid for
+	Period = 30 * time.Second
+	// skew is how many periods either side of the current one are accepted, to allow for clock drift between the
+	// server and the user's device
+	skew = 1
+)
+
+// encoding is how secrets are shown to users and in otpauth URIs
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random secret, base32 encoded as authenticator apps expect
+func GenerateSecret() (string, error) {
+	// RFC 4226 recommends 160 bits, the length of a SHA-1 HMAC key
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating TOTP secret: %w", err)
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Step returns the time step t falls in
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code for secret at the given time step
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range Digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod), nil
+}
+
+// Validate reports whether code is valid for secret at now, returning the time step it was generated for so
+// that callers can refuse to accept it again
+func Validate(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(now)
+	for step := current - skew; step <= current+skew; step++ {
+		want, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(want)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// URI returns the otpauth URI authenticator apps enroll secret from, usually shown as a QR code
+func URI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(Digits))
+	q.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
@@ -0,0 +1,94 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed used by the test vectors of RFC 6238 appendix B
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the RFC's vectors are 8 digits, of which codes are the last 6
+	tt := []struct {
+		Time int64
+		Want string
+	}{
+		{Time: 59, Want: "287082"},
+		{Time: 1111111109, Want: "081804"},
+		{Time: 1111111111, Want: "050471"},
+		{Time: 1234567890, Want: "005924"},
+		{Time: 2000000000, Want: "279037"},
+		{Time: 20000000000, Want: "353130"},
+	}
+
+	for _, tt := range tt {
+		t.Run(time.Unix(tt.Time, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			got, err := Code(rfc6238Secret, Step(time.Unix(tt.Time, 0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.Want {
+				t.Errorf("got %s, want %s", got, tt.Want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current, err := Code(rfc6238Secret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := Code(rfc6238Secret, Step(now)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := Code(rfc6238Secret, Step(now)-2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		Name     string
+		Code     string
+		Want     bool
+		WantStep int64
+	}{
+		{Name: "Current Code", Code: current, Want: true, WantStep: Step(now)},
+		{Name: "Previous Code Within Drift", Code: previous, Want: true, WantStep: Step(now) - 1},
+		{Name: "Stale Code", Code: stale, Want: false},
+		{Name: "Wrong Code", Code: "000000", Want: false},
+		{Name: "Wrong Length", Code: current[:5], Want: false},
+	}
+
+	for _, tt := range tt {
+		t.Run(tt.Name, func(t *testing.T) {
+			step, ok := Validate(rfc6238Secret, tt.Code, now)
+			if ok != tt.Want {
+				t.Fatalf("got %t, want %t", ok, tt.Want)
+			}
+			if ok && step != tt.WantStep {
+				t.Errorf("got step %d, want %d", step, tt.WantStep)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("generated secret %q cannot be used: %v", secret, err)
+	}
+
+	uri := URI("blog-api", "kishiguro", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/blog-api:kishiguro?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("got URI %s, want one for the account and secret", uri)
+	}
+}